@@ -0,0 +1,68 @@
+package binance
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/marianogappa/crypto-candles/candles/common"
+)
+
+//	{
+//	  "symbols": [
+//	    {
+//	      "symbol": "ETHBTC",
+//	      "status": "TRADING",
+//	      "baseAsset": "ETH",
+//	      "quoteAsset": "BTC",
+//	      ...
+//	    }
+//	  ],
+//	  ...
+//	}
+type exchangeInfoResponse struct {
+	Symbols []struct {
+		Symbol     string `json:"symbol"`
+		Status     string `json:"status"`
+		BaseAsset  string `json:"baseAsset"`
+		QuoteAsset string `json:"quoteAsset"`
+	} `json:"symbols"`
+}
+
+func (r exchangeInfoResponse) toMarketSources() []common.MarketSource {
+	marketSources := []common.MarketSource{}
+	for _, symbol := range r.Symbols {
+		if symbol.Status != "TRADING" || symbol.BaseAsset == "" || symbol.QuoteAsset == "" {
+			continue
+		}
+		marketSources = append(marketSources, common.MarketSource{Type: common.COIN, Provider: common.BINANCE, BaseAsset: symbol.BaseAsset, QuoteAsset: symbol.QuoteAsset})
+	}
+	return marketSources
+}
+
+func (e *Binance) requestMarkets() ([]common.MarketSource, error) {
+	req, _ := http.NewRequest("GET", fmt.Sprintf("%vexchangeInfo", e.apiURL), nil)
+
+	_, byts, err := e.httpRequester.DoRaw(req)
+	if err != nil {
+		return nil, err
+	}
+
+	maybeErrorResponse := errorResponse{}
+	err = json.Unmarshal(byts, &maybeErrorResponse)
+	if err == nil && maybeErrorResponse.Code != 0 {
+		return nil, common.CandleReqError{IsNotRetryable: false, Kind: common.KindTransient, Code: maybeErrorResponse.Code, Err: errors.New(maybeErrorResponse.Msg)}
+	}
+
+	maybeResponse := exchangeInfoResponse{}
+	if err := json.Unmarshal(byts, &maybeResponse); err != nil {
+		return nil, common.CandleReqError{IsNotRetryable: false, Kind: common.KindBadData, Err: common.ErrInvalidJSONResponse}
+	}
+	return maybeResponse.toMarketSources(), nil
+}
+
+// Example request for exchange info on Binance:
+// https://api.binance.com/api/v3/exchangeInfo
+//
+// Only symbols with status TRADING are listed; e.g. BREAK and HALT symbols don't serve new candlesticks.
@@ -0,0 +1,60 @@
+package binance
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/marianogappa/crypto-candles/candles/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListMarkets(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/exchangeInfo", r.URL.Path)
+		fmt.Fprintln(w, `{"timezone":"UTC","symbols":[
+			{"symbol":"BTCUSDT","status":"TRADING","baseAsset":"BTC","quoteAsset":"USDT"},
+			{"symbol":"LUNAUSDT","status":"BREAK","baseAsset":"LUNA","quoteAsset":"USDT"},
+			{"symbol":"ETHBTC","status":"TRADING","baseAsset":"ETH","quoteAsset":"BTC"}
+		]}`)
+	}))
+	defer ts.Close()
+
+	b := NewBinance()
+	b.apiURL = ts.URL + "/"
+
+	actual, err := b.ListMarkets()
+	require.Nil(t, err)
+	require.Equal(t, []common.MarketSource{
+		{Type: common.COIN, Provider: common.BINANCE, BaseAsset: "BTC", QuoteAsset: "USDT"},
+		{Type: common.COIN, Provider: common.BINANCE, BaseAsset: "ETH", QuoteAsset: "BTC"},
+	}, actual)
+}
+
+func TestListMarketsErrors(t *testing.T) {
+	tss := []struct {
+		name     string
+		response string
+		kind     common.ErrorKind
+	}{
+		{name: "error response", response: `{"code":-1003,"msg":"Way too many requests"}`, kind: common.KindTransient},
+		{name: "invalid JSON", response: `{"symbols":`, kind: common.KindBadData},
+	}
+	for _, ts := range tss {
+		t.Run(ts.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintln(w, ts.response)
+			}))
+			defer server.Close()
+
+			b := NewBinance()
+			b.apiURL = server.URL + "/"
+
+			_, err := b.ListMarkets()
+			var reqErr common.CandleReqError
+			require.ErrorAs(t, err, &reqErr)
+			require.Equal(t, ts.kind, reqErr.Kind)
+		})
+	}
+}
@@ -4,14 +4,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/marianogappa/crypto-candles/candles/common"
-	"github.com/rs/zerolog/log"
 )
 
 type errorResponse struct {
@@ -39,12 +36,9 @@ type successfulResponse struct {
 	ResponseCandlesticks [][]interface{}
 }
 
-func interfaceToFloatRoundInt(i interface{}) (int, bool) {
-	f, ok := i.(float64)
-	if !ok {
-		return 0, false
-	}
-	return int(f), true
+func interfaceToInt(i interface{}) (int, bool) {
+	n, ok := common.NumberToInt64(i)
+	return int(n), ok
 }
 
 func (r successfulResponse) toCandlesticks() ([]common.Candlestick, error) {
@@ -55,7 +49,7 @@ func (r successfulResponse) toCandlesticks() ([]common.Candlestick, error) {
 		if len(raw) != 12 {
 			return candlesticks, fmt.Errorf("candlestick %v has len != 12! Invalid syntax from Binance", i)
 		}
-		rawOpenTime, ok := interfaceToFloatRoundInt(raw[0])
+		rawOpenTime, ok := interfaceToInt(raw[0])
 		if !ok {
 			return candlesticks, fmt.Errorf("candlestick %v has non-int open time! Invalid syntax from Binance", i)
 		}
@@ -111,7 +105,7 @@ func (r successfulResponse) toCandlesticks() ([]common.Candlestick, error) {
 		}
 		candlestick.volume = volume
 
-		rawCloseTime, ok := interfaceToFloatRoundInt(raw[6])
+		rawCloseTime, ok := interfaceToInt(raw[6])
 		if !ok {
 			return candlesticks, fmt.Errorf("candlestick %v has non-int close time! Invalid syntax from Binance", i)
 		}
@@ -127,7 +121,7 @@ func (r successfulResponse) toCandlesticks() ([]common.Candlestick, error) {
 		}
 		candlestick.quoteAssetVolume = quoteAssetVolume
 
-		rawNumberOfTrades, ok := interfaceToFloatRoundInt(raw[8])
+		rawNumberOfTrades, ok := interfaceToInt(raw[8])
 		if !ok {
 			return candlesticks, fmt.Errorf("candlestick %v has non-int number of trades! Invalid syntax from Binance", i)
 		}
@@ -183,111 +177,95 @@ func (c binanceCandlestick) toCandlestick() common.Candlestick {
 	}
 }
 
+var intervals = map[time.Duration]string{
+	1 * time.Minute:           "1m",
+	3 * time.Minute:           "3m",
+	5 * time.Minute:           "5m",
+	15 * time.Minute:          "15m",
+	30 * time.Minute:          "30m",
+	1 * 60 * time.Minute:      "1h",
+	2 * 60 * time.Minute:      "2h",
+	4 * 60 * time.Minute:      "4h",
+	6 * 60 * time.Minute:      "6h",
+	8 * 60 * time.Minute:      "8h",
+	12 * 60 * time.Minute:     "12h",
+	1 * 60 * 24 * time.Minute: "1d",
+	3 * 60 * 24 * time.Minute: "3d",
+	7 * 60 * 24 * time.Minute: "1w",
+	// TODO This one is problematic because cannot patch holes or do other calculations (because months can have 28, 29, 30 & 31 days)
+	30 * 60 * 24 * time.Minute: "1M",
+}
+
 func (e *Binance) requestCandlesticks(baseAsset string, quoteAsset string, startTime time.Time, candlestickInterval time.Duration) ([]common.Candlestick, error) {
+	return e.requestCandlesticksUntil(baseAsset, quoteAsset, startTime, time.Time{}, candlestickInterval)
+}
+
+func (e *Binance) requestCandlesticksUntil(baseAsset string, quoteAsset string, startTime time.Time, endTime time.Time, candlestickInterval time.Duration) ([]common.Candlestick, error) {
+	return e.requestCandlesticksLimit(baseAsset, quoteAsset, startTime, endTime, candlestickInterval, maxLimit)
+}
+
+// maxLimit is the maximum number of candlesticks that the exchange returns per request.
+const maxLimit = 1000
+
+// requestCandlesticksLimit is like requestCandlesticksUntil, but requests at most "limit" candlesticks.
+func (e *Binance) requestCandlesticksLimit(baseAsset string, quoteAsset string, startTime time.Time, endTime time.Time, candlestickInterval time.Duration, limit int) ([]common.Candlestick, error) {
+	if limit <= 0 || limit > maxLimit {
+		limit = maxLimit
+	}
+	symbol, err := common.SymbolForProvider(common.MarketSource{BaseAsset: baseAsset, QuoteAsset: quoteAsset}, common.BINANCE)
+	if err != nil {
+		return nil, common.CandleReqError{IsNotRetryable: true, Kind: common.KindInvalidPair, Err: err}
+	}
 	req, _ := http.NewRequest("GET", fmt.Sprintf("%vklines", e.apiURL), nil)
-	symbol := fmt.Sprintf("%v%v", strings.ToUpper(baseAsset), strings.ToUpper(quoteAsset))
 
 	q := req.URL.Query()
 	q.Add("symbol", symbol)
 
-	switch candlestickInterval {
-	case 1 * time.Minute:
-		q.Add("interval", "1m")
-	case 3 * time.Minute:
-		q.Add("interval", "3m")
-	case 5 * time.Minute:
-		q.Add("interval", "5m")
-	case 15 * time.Minute:
-		q.Add("interval", "15m")
-	case 30 * time.Minute:
-		q.Add("interval", "30m")
-	case 1 * 60 * time.Minute:
-		q.Add("interval", "1h")
-	case 2 * 60 * time.Minute:
-		q.Add("interval", "2h")
-	case 4 * 60 * time.Minute:
-		q.Add("interval", "4h")
-	case 6 * 60 * time.Minute:
-		q.Add("interval", "6h")
-	case 8 * 60 * time.Minute:
-		q.Add("interval", "8h")
-	case 12 * 60 * time.Minute:
-		q.Add("interval", "12h")
-	case 1 * 60 * 24 * time.Minute:
-		q.Add("interval", "1d")
-	case 3 * 60 * 24 * time.Minute:
-		q.Add("interval", "3d")
-	case 7 * 60 * 24 * time.Minute:
-		q.Add("interval", "1w")
-	// TODO This one is problematic because cannot patch holes or do other calculations (because months can have 28, 29, 30 & 31 days)
-	case 30 * 60 * 24 * time.Minute:
-		q.Add("interval", "1M")
-	default:
-		return nil, common.CandleReqError{IsNotRetryable: true, Err: common.ErrUnsupportedCandlestickInterval}
+	interval, ok := intervals[candlestickInterval]
+	if !ok {
+		return nil, common.CandleReqError{IsNotRetryable: true, Kind: common.KindNotSupported, Err: common.ErrUnsupportedCandlestickInterval}
+	}
+	q.Add("interval", interval)
+	q.Add("limit", strconv.Itoa(limit))
+	// Without a startTime, Binance returns the latest candlesticks.
+	if !startTime.IsZero() {
+		q.Add("startTime", fmt.Sprintf("%v", startTime.Unix()*1000))
+	}
+	// Binance's endTime is inclusive.
+	if !endTime.IsZero() {
+		q.Add("endTime", fmt.Sprintf("%v", endTime.Unix()*1000-1))
 	}
-	q.Add("limit", "1000")
-	q.Add("startTime", fmt.Sprintf("%v", startTime.Unix()*1000))
 
 	req.URL.RawQuery = q.Encode()
 
-	client := &http.Client{Timeout: 10 * time.Second}
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, common.CandleReqError{IsNotRetryable: true, Err: fmt.Errorf("%w: %v", common.ErrExecutingRequest, err)}
-	}
-	defer resp.Body.Close()
-
-	byts, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, common.CandleReqError{IsNotRetryable: false, Err: common.ErrBrokenBodyResponse}
-	}
+	return e.httpRequester.DoWithInterval(req, candlestickInterval, decodeResponse)
+}
 
+func decodeResponse(statusCode int, byts []byte) ([]common.Candlestick, error) {
 	maybeErrorResponse := errorResponse{}
-	err = json.Unmarshal(byts, &maybeErrorResponse)
+	err := json.Unmarshal(byts, &maybeErrorResponse)
 	if err == nil && maybeErrorResponse.Code != 0 {
-		if resp.StatusCode == http.StatusTooManyRequests && len(resp.Header["Retry-After"]) == 1 {
-			seconds, _ := strconv.Atoi(resp.Header["Retry-After"][0])
-			retryAfter := time.Duration(seconds) * time.Second
-			return nil, common.CandleReqError{
-				IsNotRetryable: false,
-				Code:           maybeErrorResponse.Code,
-				Err:            common.ErrRateLimit,
-				RetryAfter:     retryAfter,
-			}
-		}
-
 		if maybeErrorResponse.Code == eRRINVALIDSYMBOL {
-			return nil, common.CandleReqError{IsNotRetryable: true, Code: maybeErrorResponse.Code, Err: common.ErrInvalidMarketPair}
+			return nil, common.CandleReqError{IsNotRetryable: true, Kind: common.KindInvalidPair, Code: maybeErrorResponse.Code, Err: common.ErrInvalidMarketPair}
+		}
+		if maybeErrorResponse.Code == eRRINVALIDINTERVAL {
+			return nil, common.CandleReqError{IsNotRetryable: true, Kind: common.KindNotSupported, Code: maybeErrorResponse.Code, Err: common.ErrUnsupportedCandlestickInterval}
 		}
 
 		return nil, common.CandleReqError{
 			IsNotRetryable: false,
+			Kind:           common.KindTransient,
 			Code:           maybeErrorResponse.Code,
 			Err:            errors.New(maybeErrorResponse.Msg),
 		}
 	}
 
 	maybeResponse := successfulResponse{}
-	err = json.Unmarshal(byts, &maybeResponse.ResponseCandlesticks)
-	if err != nil {
-		return nil, common.CandleReqError{IsNotRetryable: false, Err: common.ErrInvalidJSONResponse}
+	if err := common.UnmarshalUseNumber(byts, &maybeResponse.ResponseCandlesticks); err != nil {
+		return nil, common.CandleReqError{IsNotRetryable: false, Kind: common.KindBadData, Err: common.ErrInvalidJSONResponse}
 	}
 
-	candlesticks, err := maybeResponse.toCandlesticks()
-	if err != nil {
-		return nil, common.CandleReqError{IsNotRetryable: false, Err: err}
-	}
-
-	if len(candlesticks) == 0 {
-		return nil, common.CandleReqError{IsNotRetryable: false, Err: common.ErrOutOfCandlesticks}
-	}
-
-	if e.debug {
-		log.Info().Str("exchange", "Binance").Str("market", fmt.Sprintf("%v/%v", baseAsset, quoteAsset)).Int("candlestick_count", len(candlesticks)).Msg("Candlestick request successful!")
-	}
-
-	return candlesticks, nil
+	return maybeResponse.toCandlesticks()
 }
 
 // Example request for klines on Binance:
@@ -1,7 +1,6 @@
 package binance
 
 import (
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -55,6 +54,23 @@ func TestHappyToCandlesticks(t *testing.T) {
 	require.Equal(t, actual[0], expected)
 }
 
+func TestRequestLatestCandlesticksLimit(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "3", r.URL.Query().Get("limit"))
+		require.Empty(t, r.URL.Query().Get("startTime"))
+		fmt.Fprintln(w, `[[1499040000000,"1","1","1","1","1",1499040059999,"1",1,"1","1","0"]]`)
+	}))
+	defer ts.Close()
+
+	b := NewBinance()
+	b.requester.Strategy = common.RetryStrategy{Attempts: 1}
+	b.apiURL = ts.URL + "/"
+
+	actual, err := b.RequestLatestCandlesticksLimit(msBTCUSDT, time.Minute, 3)
+	require.Nil(t, err)
+	require.Len(t, actual, 1)
+}
+
 func TestOutOfCandlesticks(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintln(w, `[]`)
@@ -97,6 +113,8 @@ func TestErrTooManyRequests(t *testing.T) {
 
 	_, err := b.RequestCandlesticks(msBTCUSDT, tp("2017-07-03T00:00:00+00:00"), 1*time.Minute)
 	require.ErrorIs(t, err.(common.CandleReqError).Err, common.ErrRateLimit)
+	require.Equal(t, 5*time.Second, err.(common.CandleReqError).RetryAfter)
+	require.Equal(t, common.KindRateLimited, err.(common.CandleReqError).Kind)
 }
 
 func TestUnhappyToCandlesticks(t *testing.T) {
@@ -435,7 +453,7 @@ func TestUnhappyToCandlesticks(t *testing.T) {
 	for i, ts := range tests {
 		t.Run(fmt.Sprintf("Unhappy toCandlesticks %v", i), func(t *testing.T) {
 			sr := successfulResponse{}
-			err := json.Unmarshal([]byte(ts), &sr.ResponseCandlesticks)
+			err := common.UnmarshalUseNumber([]byte(ts), &sr.ResponseCandlesticks)
 			if err != nil {
 				t.Fatalf("Unmarshal failed: %v", err)
 			}
@@ -528,6 +546,23 @@ func TestKlinesErrorInvalidMarketPair(t *testing.T) {
 
 	_, err := b.RequestCandlesticks(msBTCUSDT, tp("2021-07-04T14:14:18+00:00"), time.Minute)
 	require.Equal(t, err.(common.CandleReqError).Err, common.ErrInvalidMarketPair)
+	require.Equal(t, common.KindInvalidPair, err.(common.CandleReqError).Kind)
+}
+
+func TestKlinesErrorInvalidInterval(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"code":-1120,"msg":"Invalid interval."}`)
+	}))
+	defer ts.Close()
+
+	b := NewBinance()
+	b.requester.Strategy = common.RetryStrategy{Attempts: 1}
+	b.apiURL = ts.URL + "/"
+
+	_, err := b.RequestCandlesticks(msBTCUSDT, tp("2021-07-04T14:14:18+00:00"), time.Minute)
+	require.ErrorIs(t, err, common.ErrUnsupportedCandlestickInterval)
+	require.Equal(t, common.KindNotSupported, err.(common.CandleReqError).Kind)
+	require.True(t, err.(common.CandleReqError).IsNotRetryable)
 }
 
 func TestKlinesInvalidJSONResponse(t *testing.T) {
@@ -636,3 +671,51 @@ var (
 		QuoteAsset: "USDT",
 	}
 )
+
+func TestRequestLatestCandlesticks(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.False(t, r.URL.Query().Has("startTime"))
+		fmt.Fprintln(w, `[
+			[1499040000000, "1", "1", "1", "1", "1", 1499040059999, "1", 1, "1", "1", "0"],
+			[1499040120000, "2", "2", "2", "2", "1", 1499040179999, "1", 1, "1", "1", "0"]
+		]`)
+	}))
+	defer ts.Close()
+
+	b := NewBinance()
+	b.requester.Strategy = common.RetryStrategy{Attempts: 1}
+	b.apiURL = ts.URL + "/"
+
+	actual, err := b.RequestLatestCandlesticks(msBTCUSDT, time.Minute)
+	require.Nil(t, err)
+	require.Equal(t, []common.Candlestick{
+		{Timestamp: 1499040000, OpenPrice: 1, ClosePrice: 1, LowestPrice: 1, HighestPrice: 1},
+		{Timestamp: 1499040060, OpenPrice: 2, ClosePrice: 2, LowestPrice: 2, HighestPrice: 2, Synthetic: true},
+		{Timestamp: 1499040120, OpenPrice: 2, ClosePrice: 2, LowestPrice: 2, HighestPrice: 2},
+	}, actual)
+}
+
+func TestRequestCandlesticksUntil(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "1499040000000", r.URL.Query().Get("startTime"))
+		require.Equal(t, "1499040119999", r.URL.Query().Get("endTime"))
+		fmt.Fprintln(w, `[
+			[1499040000000, "1", "1", "1", "1", "1", 1499040059999, "1", 1, "1", "1", "0"],
+			[1499040060000, "2", "2", "2", "2", "1", 1499040119999, "1", 1, "1", "1", "0"],
+			[1499040120000, "3", "3", "3", "3", "1", 1499040179999, "1", 1, "1", "1", "0"]
+		]`)
+	}))
+	defer ts.Close()
+
+	b := NewBinance()
+	b.requester.Strategy = common.RetryStrategy{Attempts: 1}
+	b.apiURL = ts.URL + "/"
+
+	// Candlesticks at or after the end time are trimmed, even if the exchange returns them.
+	actual, err := b.RequestCandlesticksUntil(msBTCUSDT, time.Unix(1499040000, 0), time.Unix(1499040120, 0), time.Minute)
+	require.Nil(t, err)
+	require.Equal(t, []common.Candlestick{
+		{Timestamp: 1499040000, OpenPrice: 1, ClosePrice: 1, LowestPrice: 1, HighestPrice: 1},
+		{Timestamp: 1499040060, OpenPrice: 2, ClosePrice: 2, LowestPrice: 2, HighestPrice: 2},
+	}, actual)
+}
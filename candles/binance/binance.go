@@ -1,6 +1,7 @@
 package binance
 
 import (
+	"net/http"
 	"sync"
 	"time"
 
@@ -9,18 +10,25 @@ import (
 
 // Binance struct enables requesting candlesticks from Binance
 type Binance struct {
-	apiURL    string
-	debug     bool
-	lock      sync.Mutex
-	requester common.RequesterWithRetry
+	apiURL        string
+	debug         bool
+	lock          sync.Mutex
+	requester     common.RequesterWithRetry
+	httpRequester common.Requester
+	patience      *common.PatienceSettings
+	anchor        *common.AnchorSettings
 }
 
 // NewBinance is the constructor for Binance
 func NewBinance() *Binance {
 	e := &Binance{
-		apiURL: "https://api.binance.com/api/v3/",
+		apiURL:   "https://api.binance.com/api/v3/",
+		patience: common.NewPatienceSettings(1 * time.Minute),
+		anchor:   common.NewAnchorSettings(common.BINANCE),
 	}
 
+	e.httpRequester = common.NewRequester("Binance", &e.debug)
+
 	e.requester = common.NewRequesterWithRetry(
 		e.requestCandlesticks,
 		common.RetryStrategy{Attempts: 3, FirstSleepTime: 1 * time.Second, SleepTimeMultiplier: 2.0},
@@ -46,19 +54,127 @@ func (e *Binance) RequestCandlesticks(marketSource common.MarketSource, startTim
 	e.lock.Lock()
 	defer e.lock.Unlock()
 
-	candlesticks, err := e.requestCandlesticks(marketSource.BaseAsset, marketSource.QuoteAsset, startTime, candlestickInterval)
+	candlesticks, err := e.requester.Request(marketSource.BaseAsset, marketSource.QuoteAsset, startTime, candlestickInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	return common.PatchAnchoredCandlestickHoles(candlesticks, int(startTime.Unix()), common.IntervalToSeconds(candlestickInterval), e.anchor.Get()), nil
+}
+
+// RequestCandlesticksUntil is like RequestCandlesticks, but candlesticks starting at or after the end time are neither
+// requested nor returned. The zero end time means that there's no end time.
+func (e *Binance) RequestCandlesticksUntil(marketSource common.MarketSource, startTime time.Time, endTime time.Time, candlestickInterval time.Duration) ([]common.Candlestick, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	requester := e.requester.WithFn(func(baseAsset string, quoteAsset string, startTime time.Time, candlestickInterval time.Duration) ([]common.Candlestick, error) {
+		return e.requestCandlesticksUntil(baseAsset, quoteAsset, startTime, endTime, candlestickInterval)
+	})
+	candlesticks, err := requester.Request(marketSource.BaseAsset, marketSource.QuoteAsset, startTime, candlestickInterval)
 	if err != nil {
 		return nil, err
 	}
 
-	return common.PatchCandlestickHoles(candlesticks, int(startTime.Unix()), int(candlestickInterval/time.Second)), nil
+	candlesticks = common.PatchAnchoredCandlestickHoles(candlesticks, int(startTime.Unix()), common.IntervalToSeconds(candlestickInterval), e.anchor.Get())
+	return common.TrimCandlesticksAtOrAfter(candlesticks, endTime), nil
+}
+
+// RequestLatestCandlesticks requests the latest candlesticks for the given market source, of a given candlestick
+// interval, by omitting the start time so that the exchange returns its most recent candlesticks.
+//
+// Candlesticks are returned in ascending order, and may include the current, unfinished candlestick.
+func (e *Binance) RequestLatestCandlesticks(marketSource common.MarketSource, candlestickInterval time.Duration) ([]common.Candlestick, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	candlesticks, err := e.requester.Request(marketSource.BaseAsset, marketSource.QuoteAsset, time.Time{}, candlestickInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	return common.PatchAnchoredCandlestickHoles(candlesticks, candlesticks[0].Timestamp, common.IntervalToSeconds(candlestickInterval), e.anchor.Get()), nil
+}
+
+// RequestLatestCandlesticksLimit is like RequestLatestCandlesticks, but requests at most "limit" candlesticks (up to
+// the exchange's maximum), to save bandwidth when only the latest few are needed.
+func (e *Binance) RequestLatestCandlesticksLimit(marketSource common.MarketSource, candlestickInterval time.Duration, limit int) ([]common.Candlestick, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	requester := e.requester.WithFn(func(baseAsset string, quoteAsset string, startTime time.Time, candlestickInterval time.Duration) ([]common.Candlestick, error) {
+		return e.requestCandlesticksLimit(baseAsset, quoteAsset, startTime, time.Time{}, candlestickInterval, limit)
+	})
+	candlesticks, err := requester.Request(marketSource.BaseAsset, marketSource.QuoteAsset, time.Time{}, candlestickInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	return common.PatchAnchoredCandlestickHoles(candlesticks, candlesticks[0].Timestamp, common.IntervalToSeconds(candlestickInterval), e.anchor.Get()), nil
+}
+
+// ListMarkets requests the market sources that are currently tradable at Binance.
+func (e *Binance) ListMarkets() ([]common.MarketSource, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	return e.requestMarkets()
 }
 
 // Patience returns the delay that this exchange usually takes in order for it to return candlesticks.
 //
 // Some exchanges may return results for unfinished candles (e.g. the current minute) and some may not, so callers
 // should not request unfinished candles. This patience should be taken into account in addition to unfinished candles.
-func (e *Binance) Patience() time.Duration { return 1 * time.Minute }
+func (e *Binance) Patience() time.Duration { return e.patience.Get() }
+
+// PatienceFor is like Patience, but takes into account the patience set for the given candlestick interval, if any.
+func (e *Binance) PatienceFor(candlestickInterval time.Duration) time.Duration {
+	return e.patience.For(candlestickInterval)
+}
+
+// SetPatience overrides this exchange's patience, for candlestick intervals without a specific patience.
+func (e *Binance) SetPatience(patience time.Duration) { e.patience.Set(patience) }
+
+// SetIntervalPatience overrides this exchange's patience for the given candlestick interval.
+func (e *Binance) SetIntervalPatience(candlestickInterval time.Duration, patience time.Duration) {
+	e.patience.SetFor(candlestickInterval, patience)
+}
+
+// Anchor returns where this exchange's candlestick boundaries are (see common.Anchor).
+func (e *Binance) Anchor() common.Anchor { return e.anchor.Get() }
+
+// SetAnchor overrides where this exchange's candlestick boundaries are, e.g. to anchor them to a UTC offset.
+func (e *Binance) SetAnchor(anchor common.Anchor) { e.anchor.Set(anchor) }
+
+// MaxHistoryDepth returns how far back in time this exchange serves candlesticks. Zero means there's no known limit.
+func (e *Binance) MaxHistoryDepth() time.Duration { return 0 }
+
+// MaxCandlesPerRequest returns the maximum number of candlesticks that this exchange returns per request.
+func (e *Binance) MaxCandlesPerRequest() int { return maxLimit }
+
+// Stats returns the Stats of every HTTP request made so far to this exchange, including retries.
+func (e *Binance) Stats() common.Stats { return e.httpRequester.Stats() }
+
+// RateLimitBreaker returns the breaker shared by every HTTP request to this exchange. It's disabled by default.
+func (e *Binance) RateLimitBreaker() *common.RateLimitBreaker {
+	return e.httpRequester.RateLimitBreaker()
+}
+
+// SetMaxInFlightRequests caps the concurrent HTTP requests to this exchange. Zero means no limit.
+func (e *Binance) SetMaxInFlightRequests(maxInFlight int) {
+	e.httpRequester.SetMaxInFlight(maxInFlight)
+}
+
+// InFlightRequests returns the number of HTTP requests to this exchange currently in flight.
+func (e *Binance) InFlightRequests() int { return e.httpRequester.InFlight() }
+
+// SetRawBodyMaxBytes caps the RawBody attached to this exchange's KindBadData errors. Zero disables it.
+func (e *Binance) SetRawBodyMaxBytes(maxBytes int) {
+	e.httpRequester.RawBodyMaxBytes = maxBytes
+}
+
+// SupportedIntervals returns the candlestick intervals supported by this exchange, in ascending order.
+func (e *Binance) SupportedIntervals() []time.Duration { return common.SortedIntervals(intervals) }
 
 // Name is the name of this candlestick provider.
 func (e *Binance) Name() string { return common.BINANCE }
@@ -68,4 +184,27 @@ func (e *Binance) SetDebug(debug bool) {
 	e.debug = debug
 }
 
-const eRRINVALIDSYMBOL = -1121
+// SetRetryStrategy overrides this exchange's retry strategy for failed requests.
+func (e *Binance) SetRetryStrategy(strategy common.RetryStrategy) {
+	e.requester.SetStrategy(strategy)
+}
+
+// SetAPIURL overrides this exchange's API base URL, which must end with a slash.
+func (e *Binance) SetAPIURL(apiURL string) {
+	e.apiURL = apiURL
+}
+
+// SetHTTPClient overrides the HTTP client used to request this exchange.
+func (e *Binance) SetHTTPClient(client *http.Client) {
+	e.httpRequester.SetHTTPClient(client)
+}
+
+// SetMaxRateLimitWait makes rate limited requests to this exchange block for up to maxWait. Zero disables it.
+func (e *Binance) SetMaxRateLimitWait(maxWait time.Duration) {
+	e.requester.SetMaxRateLimitWait(maxWait)
+}
+
+const (
+	eRRINVALIDSYMBOL   = -1121
+	eRRINVALIDINTERVAL = -1120
+)
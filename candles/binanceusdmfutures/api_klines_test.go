@@ -1,7 +1,6 @@
 package binanceusdmfutures
 
 import (
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -97,6 +96,7 @@ func TestErrTooManyRequests(t *testing.T) {
 
 	_, err := b.RequestCandlesticks(msBTCUSDT, tp("2017-07-03T00:00:00+00:00"), 1*time.Minute)
 	require.ErrorIs(t, err.(common.CandleReqError).Err, common.ErrRateLimit)
+	require.Equal(t, 5*time.Second, err.(common.CandleReqError).RetryAfter)
 }
 
 func TestUnhappyToCandlesticks(t *testing.T) {
@@ -435,7 +435,7 @@ func TestUnhappyToCandlesticks(t *testing.T) {
 	for i, ts := range tests {
 		t.Run(fmt.Sprintf("Unhappy toCandlesticks %v", i), func(t *testing.T) {
 			sr := successfulResponse{}
-			err := json.Unmarshal([]byte(ts), &sr.ResponseCandlesticks)
+			err := common.UnmarshalUseNumber([]byte(ts), &sr.ResponseCandlesticks)
 			if err != nil {
 				t.Fatalf("Unmarshal failed: %v", err)
 			}
@@ -530,6 +530,22 @@ func TestKlinesErrorInvalidMarketPair(t *testing.T) {
 	require.Equal(t, err.(common.CandleReqError).Err, common.ErrInvalidMarketPair)
 }
 
+func TestKlinesErrorInvalidInterval(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"code":-1120,"msg":"Invalid interval."}`)
+	}))
+	defer ts.Close()
+
+	b := NewBinanceUSDMFutures()
+	b.requester.Strategy = common.RetryStrategy{Attempts: 1}
+	b.apiURL = ts.URL + "/"
+
+	_, err := b.RequestCandlesticks(msBTCUSDT, tp("2021-07-04T14:14:18+00:00"), time.Minute)
+	require.ErrorIs(t, err, common.ErrUnsupportedCandlestickInterval)
+	require.Equal(t, common.KindNotSupported, err.(common.CandleReqError).Kind)
+	require.True(t, err.(common.CandleReqError).IsNotRetryable)
+}
+
 func TestKlinesInvalidJSONResponse(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintln(w, `invalid json`)
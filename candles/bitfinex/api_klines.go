@@ -3,25 +3,20 @@ package bitfinex
 import (
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"net/http"
-	"strings"
+	"strconv"
 	"time"
 
 	"github.com/marianogappa/crypto-candles/candles/common"
-	"github.com/rs/zerolog/log"
 )
 
 type response struct {
 	resp [][]interface{}
 }
 
-func interfaceToFloatRoundInt(i interface{}) (int, bool) {
-	f, ok := i.(float64)
-	if !ok {
-		return 0, false
-	}
-	return int(f), true
+func interfaceToInt(i interface{}) (int, bool) {
+	n, ok := common.NumberToInt64(i)
+	return int(n), ok
 }
 
 func (r response) toCandlesticks() ([]common.Candlestick, error) {
@@ -32,44 +27,38 @@ func (r response) toCandlesticks() ([]common.Candlestick, error) {
 		if len(raw) != 6 {
 			return candlesticks, fmt.Errorf("candlestick %v has len != 6! Invalid syntax from Bitfinex", i)
 		}
-		rawTimestamp, ok := interfaceToFloatRoundInt(raw[0])
+		rawTimestamp, ok := interfaceToInt(raw[0])
 		if !ok {
 			return candlesticks, fmt.Errorf("candlestick %v has non-int open time! Invalid syntax from Bitfinex", i)
 		}
 		candlestick.Timestamp = int(time.Unix(0, int64(rawTimestamp)*int64(time.Millisecond)).Unix())
 
-		rawOpen, ok := raw[1].(float64)
+		rawOpen, ok := common.NumberToFloat64(raw[1])
 		if !ok {
 			return candlesticks, fmt.Errorf("candlestick %v has non-float open! Invalid syntax from Bitfinex", i)
 		}
 		candlestick.OpenPrice = common.JSONFloat64(rawOpen)
 
-		rawClose, ok := raw[2].(float64)
+		rawClose, ok := common.NumberToFloat64(raw[2])
 		if !ok {
 			return candlesticks, fmt.Errorf("candlestick %v has non-float close! Invalid syntax from Bitfinex", i)
 		}
 		candlestick.ClosePrice = common.JSONFloat64(rawClose)
 
-		rawHigh, ok := raw[3].(float64)
+		rawHigh, ok := common.NumberToFloat64(raw[3])
 		if !ok {
 			return candlesticks, fmt.Errorf("candlestick %v has non-float high! Invalid syntax from Bitfinex", i)
 		}
 		candlestick.HighestPrice = common.JSONFloat64(rawHigh)
 
-		rawLow, ok := raw[4].(float64)
+		rawLow, ok := common.NumberToFloat64(raw[4])
 		if !ok {
 			return candlesticks, fmt.Errorf("candlestick %v has non-float low! Invalid syntax from Bitfinex", i)
 		}
 		candlestick.LowestPrice = common.JSONFloat64(rawLow)
 
-		if candlestick.LowestPrice > candlestick.HighestPrice {
-			return candlesticks, fmt.Errorf("candlestick %v had low = %v > high %v! Invalid syntax from Bitfinex", i, rawLow, rawHigh)
-		}
-		if candlestick.OpenPrice > candlestick.HighestPrice || candlestick.OpenPrice < candlestick.LowestPrice {
-			return candlesticks, fmt.Errorf("candlestick %v had open = %v not between low = %v & high = %v! Invalid syntax from Bitfinex", i, rawOpen, rawLow, rawHigh)
-		}
-		if candlestick.ClosePrice > candlestick.HighestPrice || candlestick.ClosePrice < candlestick.LowestPrice {
-			return candlesticks, fmt.Errorf("candlestick %v had close = %v not between low = %v & high = %v! Invalid syntax from Bitfinex", i, rawClose, rawLow, rawHigh)
+		if err := candlestick.IsValid(); err != nil {
+			return candlesticks, fmt.Errorf("candlestick %v: %w! Invalid syntax from Bitfinex", i, err)
 		}
 
 		candlesticks[i] = candlestick
@@ -102,68 +91,82 @@ func (e responseError) toCandleReqError() (common.CandleReqError, bool) {
 	}
 	err.Err = fmt.Errorf(fmt.Sprintf("%v: %v", err.Code, msg))
 	err.IsNotRetryable = true
+	err.Kind = common.KindUnknown
 
 	return err, true
 }
 
+var timeframes = map[time.Duration]string{
+	1 * time.Minute:            "1m",
+	5 * time.Minute:            "5m",
+	15 * time.Minute:           "15m",
+	30 * time.Minute:           "30m",
+	1 * 60 * time.Minute:       "1h",
+	3 * 60 * time.Minute:       "3h",
+	6 * 60 * time.Minute:       "6h",
+	12 * 60 * time.Minute:      "12h",
+	1 * 60 * 24 * time.Minute:  "1D",
+	7 * 60 * 24 * time.Minute:  "1W",
+	14 * 60 * 24 * time.Minute: "14D",
+	30 * 60 * 24 * time.Minute: "1M",
+}
+
 func (e *Bitfinex) requestCandlesticks(baseAsset string, quoteAsset string, startTime time.Time, candlestickInterval time.Duration) ([]common.Candlestick, error) {
+	return e.requestCandlesticksUntil(baseAsset, quoteAsset, startTime, time.Time{}, candlestickInterval)
+}
+
+func (e *Bitfinex) requestCandlesticksUntil(baseAsset string, quoteAsset string, startTime time.Time, endTime time.Time, candlestickInterval time.Duration) ([]common.Candlestick, error) {
+	return e.requestCandlesticksLimit(baseAsset, quoteAsset, startTime, endTime, candlestickInterval, maxLimit)
+}
+
+// maxLimit is the maximum number of candlesticks that the exchange returns per request.
+const maxLimit = 10000
+
+// requestCandlesticksLimit is like requestCandlesticksUntil, but requests at most "limit" candlesticks.
+func (e *Bitfinex) requestCandlesticksLimit(baseAsset string, quoteAsset string, startTime time.Time, endTime time.Time, candlestickInterval time.Duration, limit int) ([]common.Candlestick, error) {
+	if limit <= 0 || limit > maxLimit {
+		limit = maxLimit
+	}
+
+	timeframe, ok := timeframes[candlestickInterval]
+	if !ok {
+		return nil, common.CandleReqError{IsNotRetryable: true, Kind: common.KindNotSupported, Err: common.ErrUnsupportedCandlestickInterval}
+	}
+
+	symbol, err := common.SymbolForProvider(common.MarketSource{BaseAsset: baseAsset, QuoteAsset: quoteAsset}, common.BITFINEX)
+	if err != nil {
+		return nil, common.CandleReqError{IsNotRetryable: true, Kind: common.KindInvalidPair, Err: err}
+	}
+	req, _ := http.NewRequest("GET", fmt.Sprintf("%vcandles/trade:%v:%v/hist", e.apiURL, timeframe, symbol), nil)
+
+	q := req.URL.Query()
+	q.Add("limit", strconv.Itoa(limit))
 
-	timeframe := ""
-	switch candlestickInterval {
-	case 1 * time.Minute:
-		timeframe = "1m"
-	case 5 * time.Minute:
-		timeframe = "5m"
-	case 15 * time.Minute:
-		timeframe = "15m"
-	case 30 * time.Minute:
-		timeframe = "30m"
-	case 1 * 60 * time.Minute:
-		timeframe = "1h"
-	case 3 * 60 * time.Minute:
-		timeframe = "3h"
-	case 6 * 60 * time.Minute:
-		timeframe = "6h"
-	case 12 * 60 * time.Minute:
-		timeframe = "12h"
-	case 1 * 60 * 24 * time.Minute:
-		timeframe = "1D"
-	case 7 * 60 * 24 * time.Minute:
-		timeframe = "1W"
-	case 14 * 60 * 24 * time.Minute:
-		timeframe = "14D"
-	case 30 * 60 * 24 * time.Minute:
-		timeframe = "1M"
-	default:
-		return nil, common.CandleReqError{IsNotRetryable: true, Err: common.ErrUnsupportedCandlestickInterval}
-	}
-
-	req, _ := http.NewRequest("GET", fmt.Sprintf("%vcandles/trade:%v:t%v%v/hist", e.apiURL, timeframe, strings.ToUpper(baseAsset), strings.ToUpper(quoteAsset)), nil)
+	// Without a start, Bitfinex returns the latest candlesticks, but only in descending order.
+	if startTime.IsZero() {
+		q.Add("sort", "-1")
+		req.URL.RawQuery = q.Encode()
+
+		return e.httpRequester.DoWithInterval(req, candlestickInterval, decodeDescendingResponse)
+	}
 
 	// Some exchanges have the unusual strategy of returning the snapped timestamp to the past rather than the future,
 	// so it's important to do the snap to the future before making the request, to not depend on the echange doing so.
-	startTimeSecs := common.NormalizeTimestamp(startTime, candlestickInterval, "BITFINEX", false)
+	startTimeSecs := e.anchor.Get().Normalize(startTime, candlestickInterval, false)
 
-	q := req.URL.Query()
 	q.Add("start", fmt.Sprintf("%v", startTimeSecs*1000))
-	q.Add("limit", "10000")
+	// Bitfinex's end is inclusive.
+	if !endTime.IsZero() {
+		q.Add("end", fmt.Sprintf("%v", endTime.Unix()*1000-1))
+	}
 	q.Add("sort", "1")
 
 	req.URL.RawQuery = q.Encode()
 
-	client := &http.Client{Timeout: 10 * time.Second}
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, common.CandleReqError{IsNotRetryable: true, Err: fmt.Errorf("%w: %v", common.ErrExecutingRequest, err)}
-	}
-	defer resp.Body.Close()
-
-	byts, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, common.CandleReqError{IsNotRetryable: false, Err: common.ErrBrokenBodyResponse}
-	}
+	return e.httpRequester.DoWithInterval(req, candlestickInterval, decodeResponse)
+}
 
+func decodeResponse(statusCode int, byts []byte) ([]common.Candlestick, error) {
 	errorResp := responseError{}
 	if err := json.Unmarshal(byts, &errorResp.resp); err == nil {
 		if err, isError := errorResp.toCandleReqError(); isError {
@@ -172,22 +175,18 @@ func (e *Bitfinex) requestCandlesticks(baseAsset string, quoteAsset string, star
 	}
 
 	okResp := response{}
-	if err := json.Unmarshal(byts, &okResp.resp); err != nil {
-		return nil, common.CandleReqError{IsNotRetryable: false, Err: common.ErrInvalidJSONResponse}
+	if err := common.UnmarshalUseNumber(byts, &okResp.resp); err != nil {
+		return nil, common.CandleReqError{IsNotRetryable: false, Kind: common.KindBadData, Err: common.ErrInvalidJSONResponse}
 	}
 
 	candlesticks, err := okResp.toCandlesticks()
 	if err != nil {
-		return nil, common.CandleReqError{IsNotRetryable: false, Err: err}
+		return nil, err
 	}
 
 	// Bitfinex has a weird behaviour where invalid market pairs are returned as HTTP 200 with an empty array
 	if len(candlesticks) == 0 {
-		return nil, common.CandleReqError{IsNotRetryable: true, Err: common.ErrInvalidMarketPair}
-	}
-
-	if e.debug {
-		log.Info().Str("exchange", "Bitfinex").Str("market", fmt.Sprintf("%v/%v", baseAsset, quoteAsset)).Int("candlestick_count", len(candlesticks)).Msg("Candlestick request successful!")
+		return nil, common.CandleReqError{IsNotRetryable: true, Kind: common.KindInvalidPair, Err: common.ErrInvalidMarketPair}
 	}
 
 	return candlesticks, nil
@@ -210,4 +209,16 @@ func (e *Bitfinex) requestCandlesticks(baseAsset string, quoteAsset string, star
 // On the 1D timeframe, candlesticks exist every day at 00:00:00
 // On the 1W timeframe, it also follows the time.Add(7 day).Truncate(7 day) logic
 // On the 14D timeframe, INVESTIGATE FURTHER!!
-// On the 1M timeframe, INVESTIGATE FURTHER!!
+// On the 1M timeframe, candlesticks exist at the beginning of each calendar month
+
+// decodeDescendingResponse is like decodeResponse, but for responses sorted in descending order.
+func decodeDescendingResponse(statusCode int, byts []byte) ([]common.Candlestick, error) {
+	candlesticks, err := decodeResponse(statusCode, byts)
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(candlesticks)-1; i < j; i, j = i+1, j-1 {
+		candlesticks[i], candlesticks[j] = candlesticks[j], candlesticks[i]
+	}
+	return candlesticks, nil
+}
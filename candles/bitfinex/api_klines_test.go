@@ -83,6 +83,26 @@ func TestHappyToCandlesticks(t *testing.T) {
 	require.Equal(t, expected, actual)
 }
 
+func TestRequestLatestCandlesticks(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.False(t, r.URL.Query().Has("start"))
+		require.Equal(t, "-1", r.URL.Query().Get("sort"))
+		w.Write([]byte(`[[1564774920000, 2, 2, 2, 2, 1], [1564774860000, 1, 1, 1, 1, 1]]`))
+	}))
+	defer ts.Close()
+
+	b := NewBitfinex()
+	b.requester.Strategy = common.RetryStrategy{Attempts: 1}
+	b.apiURL = ts.URL + "/"
+
+	actual, err := b.RequestLatestCandlesticks(msBTCUSD, time.Minute)
+	require.Nil(t, err)
+	require.Equal(t, []common.Candlestick{
+		{Timestamp: 1564774860, OpenPrice: 1, ClosePrice: 1, HighestPrice: 1, LowestPrice: 1},
+		{Timestamp: 1564774920, OpenPrice: 2, ClosePrice: 2, HighestPrice: 2, LowestPrice: 2},
+	}, actual)
+}
+
 func TestUnhappyToCandlesticksWithRequest(t *testing.T) {
 	testResponse := `
 	[
@@ -110,6 +130,23 @@ func TestUnhappyToCandlesticksWithRequest(t *testing.T) {
 	require.NotNil(t, err)
 }
 
+func TestErrRateLimitRetryAfter(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Retry-After", "7")
+		w.WriteHeader(429)
+	}))
+	defer ts.Close()
+
+	b := NewBitfinex()
+	b.requester.Strategy = common.RetryStrategy{Attempts: 1}
+	b.apiURL = ts.URL + "/"
+
+	_, err := b.RequestCandlesticks(msBTCUSD, tp("2021-07-04T14:14:18+00:00"), time.Minute)
+	require.ErrorIs(t, err.(common.CandleReqError).Err, common.ErrRateLimit)
+	require.Equal(t, common.KindRateLimited, err.(common.CandleReqError).Kind)
+	require.Equal(t, 7*time.Second, err.(common.CandleReqError).RetryAfter)
+}
+
 func TestPatience(t *testing.T) {
 	require.Equal(t, 1*time.Minute, NewBitfinex().Patience())
 }
@@ -199,7 +236,7 @@ func TestUnhappyToCandlesticks(t *testing.T) {
 	for i, ts := range tests {
 		t.Run(fmt.Sprintf("Unhappy toCandlesticks %v", i), func(t *testing.T) {
 			r := response{}
-			require.Nil(t, json.Unmarshal([]byte(ts), &r.resp))
+			require.Nil(t, common.UnmarshalUseNumber([]byte(ts), &r.resp))
 			_, err := r.toCandlesticks()
 			require.NotNil(t, err, "for %v was %v", string(ts), err)
 		})
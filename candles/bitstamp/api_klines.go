@@ -4,14 +4,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/marianogappa/crypto-candles/candles/common"
-	"github.com/rs/zerolog/log"
 )
 
 type responseDataOHLC struct {
@@ -101,72 +99,97 @@ func (r response) toError() error {
 	return errors.New(strings.Join(ss, ", "))
 }
 
-func (e *Bitstamp) requestCandlesticks(baseAsset string, quoteAsset string, startTime time.Time, candlestickInterval time.Duration) ([]common.Candlestick, error) {
-	req, _ := http.NewRequest("GET", fmt.Sprintf("%vohlc/%v%v/", e.apiURL, strings.ToLower(baseAsset), strings.ToLower(quoteAsset)), nil)
+// https://www.bitstamp.net/api/#ohlc_data
+var steps = map[time.Duration]string{
+	1 * time.Minute:       "60",
+	3 * time.Minute:       "180",
+	5 * time.Minute:       "300",
+	15 * time.Minute:      "900",
+	30 * time.Minute:      "1800",
+	1 * 60 * time.Minute:  "3600",
+	2 * 60 * time.Minute:  "7200",
+	4 * 60 * time.Minute:  "14400",
+	6 * 60 * time.Minute:  "21600",
+	12 * 60 * time.Minute: "43200",
+	24 * 60 * time.Minute: "86400",
+	72 * 60 * time.Minute: "259200",
+}
 
-	// Bitstamp has the unusual strategy of returning the snapped timestamp to the past rather than the future, so
-	// for this particular case it's important to do the snap to the future before making the request.
-	startTimeSecs := common.NormalizeTimestamp(startTime, candlestickInterval, "BITSTAMP", false)
+func (e *Bitstamp) requestCandlesticks(baseAsset string, quoteAsset string, startTime time.Time, candlestickInterval time.Duration) ([]common.Candlestick, error) {
+	return e.requestCandlesticksUntil(baseAsset, quoteAsset, startTime, time.Time{}, candlestickInterval)
+}
 
-	q := req.URL.Query()
-	q.Add("start", fmt.Sprintf("%v", startTimeSecs))
-	q.Add("step", fmt.Sprintf("%v", int(candlestickInterval/time.Second)))
-	q.Add("limit", "1000")
+func (e *Bitstamp) requestCandlesticksUntil(baseAsset string, quoteAsset string, startTime time.Time, endTime time.Time, candlestickInterval time.Duration) ([]common.Candlestick, error) {
+	return e.requestCandlesticksLimit(baseAsset, quoteAsset, startTime, endTime, candlestickInterval, maxLimit)
+}
 
-	req.URL.RawQuery = q.Encode()
+// maxLimit is the maximum number of candlesticks that the exchange returns per request.
+const maxLimit = 1000
 
-	client := &http.Client{Timeout: 10 * time.Second}
+// requestCandlesticksLimit is like requestCandlesticksUntil, but requests at most "limit" candlesticks.
+func (e *Bitstamp) requestCandlesticksLimit(baseAsset string, quoteAsset string, startTime time.Time, endTime time.Time, candlestickInterval time.Duration, limit int) ([]common.Candlestick, error) {
+	if limit <= 0 || limit > maxLimit {
+		limit = maxLimit
+	}
+	step, ok := steps[candlestickInterval]
+	if !ok {
+		return nil, common.CandleReqError{IsNotRetryable: true, Kind: common.KindNotSupported, Err: common.ErrUnsupportedCandlestickInterval}
+	}
 
-	resp, err := client.Do(req)
+	symbol, err := common.SymbolForProvider(common.MarketSource{BaseAsset: baseAsset, QuoteAsset: quoteAsset}, common.BITSTAMP)
 	if err != nil {
-		return nil, common.CandleReqError{IsNotRetryable: true, Err: fmt.Errorf("%w: %v", common.ErrExecutingRequest, err)}
+		return nil, common.CandleReqError{IsNotRetryable: true, Kind: common.KindInvalidPair, Err: err}
 	}
-	defer resp.Body.Close()
+	req, _ := http.NewRequest("GET", fmt.Sprintf("%vohlc/%v/", e.apiURL, symbol), nil)
 
-	if resp.StatusCode == http.StatusTooManyRequests {
-		// https://www.bitstamp.net/api/#what-is-api
-		return nil, common.CandleReqError{IsNotRetryable: true, Err: common.ErrRateLimit}
-	}
+	q := req.URL.Query()
 
-	if resp.StatusCode == http.StatusNotFound {
-		return nil, common.CandleReqError{IsNotRetryable: true, Err: common.ErrInvalidMarketPair}
+	// Without a start, Bitstamp returns the latest candlesticks.
+	if !startTime.IsZero() {
+		// Bitstamp has the unusual strategy of returning the snapped timestamp to the past rather than the future, so
+		// for this particular case it's important to do the snap to the future before making the request.
+		startTimeSecs := e.anchor.Get().Normalize(startTime, candlestickInterval, false)
+		q.Add("start", fmt.Sprintf("%v", startTimeSecs))
 	}
+	// Bitstamp's end is inclusive.
+	if !endTime.IsZero() {
+		q.Add("end", fmt.Sprintf("%v", endTime.Unix()-1))
+	}
+	q.Add("step", step)
+	q.Add("limit", strconv.Itoa(limit))
 
-	// Catch-all for non-200 errors
-	if resp.StatusCode != http.StatusOK {
-		return nil, common.CandleReqError{IsNotRetryable: false, Err: fmt.Errorf("exchange returned status code %v", resp.StatusCode)}
+	req.URL.RawQuery = q.Encode()
+
+	return e.httpRequester.DoWithInterval(req, candlestickInterval, decodeResponse)
+}
+
+func decodeResponse(statusCode int, byts []byte) ([]common.Candlestick, error) {
+	if statusCode == http.StatusNotFound {
+		return nil, common.CandleReqError{IsNotRetryable: true, Kind: common.KindInvalidPair, Err: common.ErrInvalidMarketPair}
 	}
 
-	byts, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, common.CandleReqError{IsNotRetryable: false, Err: common.ErrBrokenBodyResponse}
+	// Catch-all for non-200 errors
+	if statusCode != http.StatusOK {
+		return nil, common.CandleReqError{IsNotRetryable: false, Kind: common.KindTransient, Err: fmt.Errorf("exchange returned status code %v", statusCode)}
 	}
 
 	maybeResponse := response{}
 	if err := json.Unmarshal(byts, &maybeResponse); err != nil {
-		return nil, common.CandleReqError{IsNotRetryable: false, Err: common.ErrInvalidJSONResponse}
+		return nil, common.CandleReqError{IsNotRetryable: false, Kind: common.KindBadData, Err: common.ErrInvalidJSONResponse}
 	}
 
 	// All listed errors are unretryable.
 	// https://www.bitstamp.net/api/#ohlc_data
 	if len(maybeResponse.Errors) > 0 {
-		return nil, common.CandleReqError{IsNotRetryable: true, Err: maybeResponse.toError()}
-	}
-
-	candlesticks, err := maybeResponse.toCandlesticks()
-	if err != nil {
-		return nil, common.CandleReqError{IsNotRetryable: false, Err: err}
-	}
-
-	if e.debug {
-		log.Info().Str("exchange", "Bitstamp").Str("market", fmt.Sprintf("%v/%v", baseAsset, quoteAsset)).Int("candlestick_count", len(candlesticks)).Msg("Candlestick request successful!")
-	}
-
-	if len(candlesticks) == 0 {
-		return nil, common.CandleReqError{IsNotRetryable: false, Err: common.ErrOutOfCandlesticks}
+		for _, subError := range maybeResponse.Errors {
+			if subError.Field == "step" {
+				return nil, common.CandleReqError{IsNotRetryable: true, Kind: common.KindNotSupported, Err: fmt.Errorf("%w: %v", common.ErrUnsupportedCandlestickInterval, maybeResponse.toError())}
+			}
+		}
+		return nil, common.CandleReqError{IsNotRetryable: true, Kind: common.KindUnknown, Err: maybeResponse.toError()}
 	}
 
-	return candlesticks, nil
+	return maybeResponse.toCandlesticks()
 }
 
 // Bitstamp uses the strategy of having candlesticks on multiples of an hour or a day, and truncating the requested
@@ -111,6 +111,26 @@ func TestNoCandlesticks(t *testing.T) {
 	require.Error(t, err, common.ErrOutOfCandlesticks)
 }
 
+func TestBeforeListing(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Only the latest candlesticks (i.e. without a start) exist.
+		if r.URL.Query().Get("start") != "" {
+			fmt.Fprintln(w, `{"data": {"pair": "BTC/USD", "ohlc": []}}`)
+			return
+		}
+		fmt.Fprintln(w, `{"data": {"pair": "BTC/USD", "ohlc": [{"high": "19122.76", "timestamp": "1656868680", "volume": "0.02005000", "low": "19111.99", "close": "19111.99", "open": "19122.76"}]}}`)
+	}))
+	defer ts.Close()
+
+	b := NewBitstamp()
+	b.requester.Strategy = common.RetryStrategy{Attempts: 1}
+	b.apiURL = ts.URL + "/"
+
+	_, err := b.RequestCandlesticks(msBTCUSD, tp("2020-07-03T17:18:00+00:00"), time.Minute)
+	require.ErrorIs(t, err, common.ErrBeforeListing)
+	require.Equal(t, common.KindTooFarBack, err.(common.CandleReqError).Kind)
+}
+
 func TestUnhappyToCandlesticks(t *testing.T) {
 	tests := []string{
 		// Invalid string high
@@ -199,6 +219,30 @@ func TestKlinesErrorResponse(t *testing.T) {
 	}
 }
 
+func TestKlinesErrorInvalidStep(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{
+			"code": "validation-error",
+			"errors": [
+			  {
+				"field": "step",
+				"message": "Must be one of: 60, 180, 300, 900, 1800, 3600, 7200, 14400, 21600, 43200, 86400, 259200.",
+				"code": "validation-error"
+			  }
+			]
+		  }`)
+	}))
+	defer ts.Close()
+
+	b := NewBitstamp()
+	b.requester.Strategy = common.RetryStrategy{Attempts: 1}
+	b.apiURL = ts.URL + "/"
+
+	_, err := b.RequestCandlesticks(msBTCUSD, tp("2021-07-04T14:14:18+00:00"), time.Minute)
+	require.ErrorIs(t, err, common.ErrUnsupportedCandlestickInterval)
+	require.Equal(t, common.KindNotSupported, err.(common.CandleReqError).Kind)
+}
+
 func Test404(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(404)
@@ -280,6 +324,23 @@ func TestKlinesInvalidFloatsInJSONResponse(t *testing.T) {
 	}
 }
 
+func TestErrRateLimitRetryAfter(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Retry-After", "7")
+		w.WriteHeader(429)
+	}))
+	defer ts.Close()
+
+	b := NewBitstamp()
+	b.requester.Strategy = common.RetryStrategy{Attempts: 1}
+	b.apiURL = ts.URL + "/"
+
+	_, err := b.RequestCandlesticks(msBTCUSD, tp("2021-07-04T14:14:18+00:00"), time.Minute)
+	require.ErrorIs(t, err.(common.CandleReqError).Err, common.ErrRateLimit)
+	require.Equal(t, common.KindRateLimited, err.(common.CandleReqError).Kind)
+	require.Equal(t, 7*time.Second, err.(common.CandleReqError).RetryAfter)
+}
+
 func TestPatience(t *testing.T) {
 	require.Equal(t, 1*time.Minute, NewBitstamp().Patience())
 }
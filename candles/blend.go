@@ -0,0 +1,49 @@
+package candles
+
+import (
+	"sort"
+	"time"
+
+	"github.com/marianogappa/crypto-candles/candles/common"
+)
+
+// RequestBlended returns a synthetic series of candlesticks of the given candlestick interval blended across market
+// sources, e.g. the same pair on several exchanges, for a reference price that's robust to any single exchange's
+// outages and outliers.
+//
+// Each market source's candlesticks are requested from the "start time" up to now, as with RequestRange, so only final
+// candlesticks are returned. Candlesticks with the same timestamp are aggregated with the supplied BlendFunc (e.g.
+// common.BlendMean or common.BlendMedian). Market sources that have no candlestick at a timestamp (e.g. an exchange
+// halt, or a hole patched in as Synthetic) are skipped for it, and timestamps that no market source has are skipped
+// altogether. Note that providers whose candlesticks start elsewhere (e.g. weekly candlesticks on KUCOIN) don't align
+// with the others.
+//
+// * Fails for the same reasons as RequestRange, for any of the market sources.
+func (m Market) RequestBlended(marketSources []common.MarketSource, startTime time.Time, candlestickInterval time.Duration, blend common.BlendFunc) ([]common.Candlestick, error) {
+	byTimestamp := map[int][]common.Candlestick{}
+	for _, marketSource := range marketSources {
+		candlesticks, err := m.requestRange(marketSource, startTime, m.timeNowFunc(), candlestickInterval)
+		if err != nil {
+			return nil, err
+		}
+		for _, candlestick := range candlesticks {
+			if candlestick.Synthetic {
+				continue
+			}
+			byTimestamp[candlestick.Timestamp] = append(byTimestamp[candlestick.Timestamp], candlestick)
+		}
+	}
+
+	timestamps := make([]int, 0, len(byTimestamp))
+	for ts := range byTimestamp {
+		timestamps = append(timestamps, ts)
+	}
+	sort.Ints(timestamps)
+	blended := make([]common.Candlestick, len(timestamps))
+	for i, ts := range timestamps {
+		blended[i] = blend(byTimestamp[ts])
+		blended[i].Timestamp = ts
+		blended[i] = blended[i].RoundPrices(m.priceDecimals)
+	}
+	return m.ordered(blended), nil
+}
@@ -43,7 +43,13 @@ import (
 
 // MemoryCache implements the in-memory LRU cache layer that this package exposes.
 type MemoryCache struct {
-	caches map[time.Duration]*lru.Cache
+	caches     map[time.Duration]*lru.Cache
+	global     *lru.Cache
+	byteBudget int
+	noop       bool
+	packed     bool
+	zeroCheck  ZeroCheck
+	rounding   Rounding
 
 	CacheMisses   int
 	CacheRequests int
@@ -74,6 +80,44 @@ var (
 	ErrCacheMiss = errors.New("cache miss")
 )
 
+// ZeroCheck configures which candlesticks are rejected by Put (and Seed) with ErrReceivedCandlestickWithZeroValue.
+type ZeroCheck int
+
+const (
+	// ZeroCheckAnyOHLC rejects candlesticks with any of their OHLC components being zero. This is the default.
+	ZeroCheckAnyOHLC ZeroCheck = iota
+	// ZeroCheckAllOHLC only rejects candlesticks with all of their OHLC components being zero, e.g. for micro-cap
+	// assets whose prices may legitimately round to zero on some components.
+	ZeroCheckAllOHLC
+	// ZeroCheckNone doesn't reject candlesticks with zero values.
+	ZeroCheckNone
+)
+
+func (z ZeroCheck) rejects(candlestick common.Candlestick) bool {
+	switch z {
+	case ZeroCheckAllOHLC:
+		return candlestick.OpenPrice == 0 && candlestick.HighestPrice == 0 && candlestick.LowestPrice == 0 && candlestick.ClosePrice == 0
+	case ZeroCheckNone:
+		return false
+	default:
+		return candlestick.OpenPrice == 0 || candlestick.HighestPrice == 0 || candlestick.LowestPrice == 0 || candlestick.ClosePrice == 0
+	}
+}
+
+// Rounding configures which candlesticks Get (and GetStrict) start at, when the supplied datetime is not a multiple of
+// the candlestick interval.
+type Rounding int
+
+const (
+	// RoundUp starts at the next candlestick, i.e. the first one that starts after the supplied datetime. This is the
+	// default.
+	RoundUp Rounding = iota
+	// RoundDown starts at the candlestick that contains the supplied datetime.
+	RoundDown
+	// RoundExact fails with ErrCacheMiss, as there's no candlestick starting exactly at the supplied datetime.
+	RoundExact
+)
+
 // NewMemoryCache instantiates the in-memory LRU cache layer that this package exposes.
 //
 // The cacheSize parameter configure which candlestick intervals are supported, and how many cache entries are
@@ -90,10 +134,87 @@ func NewMemoryCache(cacheSizes map[time.Duration]int) *MemoryCache {
 	return &MemoryCache{caches: caches}
 }
 
+// NewMemoryCacheWithByteBudget instantiates the in-memory LRU cache layer that this package exposes, bounded by an
+// approximate total memory footprint rather than by a number of entries per candlestick interval.
+//
+// All candlestick intervals are supported, and share a single LRU cache: when over budget, the least recently used
+// entry is evicted, regardless of its candlestick interval. The number of entries is the byte budget divided by the
+// estimated size of an entry of 500 candlesticks (~24KB, or ~16KB if packed), but at least one.
+func NewMemoryCacheWithByteBudget(bytes int) *MemoryCache {
+	global, _ := lru.New(entriesWithinBudget(bytes, estimatedEntryBytes))
+	return &MemoryCache{global: global, byteBudget: bytes}
+}
+
+func entriesWithinBudget(bytes int, entryBytes int) int {
+	size := bytes / entryBytes
+	if size <= 0 {
+		size = 1
+	}
+	return size
+}
+
+// NewNoOpMemoryCache instantiates a cache that doesn't cache anything: Get always fails with ErrCacheMiss, and Put
+// always succeeds without storing anything. Useful to explicitly disable caching.
+func NewNoOpMemoryCache() *MemoryCache {
+	return &MemoryCache{noop: true}
+}
+
+// IsNoOp returns true if the cache was created with NewNoOpMemoryCache, i.e. it doesn't cache anything.
+func (c *MemoryCache) IsNoOp() bool {
+	return c.noop
+}
+
+// SetZeroCheck configures which candlesticks are rejected with ErrReceivedCandlestickWithZeroValue. The default is
+// ZeroCheckAnyOHLC.
+func (c *MemoryCache) SetZeroCheck(zeroCheck ZeroCheck) {
+	c.zeroCheck = zeroCheck
+}
+
+// SetRounding configures which candlesticks Get (and GetStrict) start at when the supplied datetime is not a multiple
+// of the candlestick interval. The default is RoundUp.
+func (c *MemoryCache) SetRounding(rounding Rounding) {
+	c.rounding = rounding
+}
+
+// SetPacked configures whether entries are stored in a packed columnar form: four arrays of float64 prices per entry
+// of 500 candlesticks, with timestamps implied by their index, rather than 500 candlestick structs. It takes about a
+// third less memory (~16KB rather than ~24KB per entry, so a byte budget fits 50% more candlesticks), at the cost of
+// decoding candlesticks on Get.
+//
+// Call it before using the cache, as switching purges all entries.
+func (c *MemoryCache) SetPacked(packed bool) {
+	if c.noop || c.packed == packed {
+		return
+	}
+	c.packed = packed
+	for _, cache := range c.caches {
+		cache.Purge()
+	}
+	if c.global != nil {
+		c.global.Purge()
+		entryBytes := estimatedEntryBytes
+		if packed {
+			entryBytes = estimatedPackedEntryBytes
+		}
+		c.global.Resize(entriesWithinBudget(c.byteBudget, entryBytes))
+	}
+}
+
+// lruFor returns the LRU cache for the supplied candlestick interval, if the cache is configured for it.
+func (c *MemoryCache) lruFor(candlestickInterval time.Duration) (*lru.Cache, bool) {
+	if c.global != nil {
+		return c.global, true
+	}
+	cache, ok := c.caches[candlestickInterval]
+	return cache, ok
+}
+
 // Put pushes a slice of candlesticks from the given (metric, candlestick interval) into the cache. May evict older
 // entries.
 //
-// * Fails with ErrReceivedCandlestickWithZeroValue if a candlestick with zero values is supplied.
+// * Fails with ErrReceivedCandlestickWithZeroValue if a candlestick with zero values is supplied (see SetZeroCheck).
+//
+// * Fails with common.ErrInvalidCandlestick if a candlestick is not valid (see common.Candlestick.IsValid).
 //
 // * Fails with ErrReceivedNonSubsequentCandlestick if supplied candlesticks are not sorted ascendingly.
 //
@@ -105,7 +226,10 @@ func NewMemoryCache(cacheSizes map[time.Duration]int) *MemoryCache {
 // * Fails with ErrCacheNotConfiguredForCandlestickInterval if the cache was not configured to have candlesticks of the
 //   candlestick interval of the supplied metric.
 func (c *MemoryCache) Put(metric Metric, candlesticks []common.Candlestick) error {
-	if _, ok := c.caches[metric.CandlestickInterval]; !ok {
+	if c.noop {
+		return nil
+	}
+	if _, ok := c.lruFor(metric.CandlestickInterval); !ok {
 		return ErrCacheNotConfiguredForCandlestickInterval
 	}
 	if len(candlesticks) == 0 {
@@ -114,8 +238,25 @@ func (c *MemoryCache) Put(metric Metric, candlesticks []common.Candlestick) erro
 	return c.put(metric, candlesticks)
 }
 
+// Seed stores a slice of candlesticks from the given (metric, candlestick interval) into the cache, e.g. for warm starts
+// or offline tests. Unlike Put, it validates all candlesticks before storing any of them, so that the cache is left
+// untouched if the slice is invalid. It fails for the same reasons as Put.
+func (c *MemoryCache) Seed(metric Metric, candlesticks []common.Candlestick) error {
+	if c.noop {
+		return nil
+	}
+	if _, ok := c.lruFor(metric.CandlestickInterval); !ok {
+		return ErrCacheNotConfiguredForCandlestickInterval
+	}
+	if err := validate(metric, candlesticks, c.zeroCheck); err != nil {
+		return err
+	}
+	return c.Put(metric, candlesticks)
+}
+
 // Get retrieves candlesticks for the given (metric, candlestick interval) starting at the supplied datetime. The
-// supplied datetime will be normalized to the immediately next multiple datetime for the candlestick interval.
+// supplied datetime will be normalized to the immediately next multiple datetime for the candlestick interval, unless
+// configured otherwise with SetRounding.
 //
 // It will retrieve all subsequent candlesticks starting _exactly_ at the normalized datetime, and up to the end of the
 // cache entry. This means that it's possible that the cache still has subsequent candlesticks in a subsequent entry.
@@ -126,9 +267,12 @@ func (c *MemoryCache) Put(metric Metric, candlesticks []common.Candlestick) erro
 //   not prevent invalid strings to be supplied).
 //
 // * Fails with ErrCacheMiss if there are no values available in the cache. Client must handle this error, as it's
-//   completely normal to have cache misses.
+//   completely normal to have cache misses. With RoundExact, also if the datetime is not a multiple of the interval.
 func (c *MemoryCache) Get(metric Metric, initialISO8601 common.ISO8601) ([]common.Candlestick, error) {
-	if _, ok := c.caches[metric.CandlestickInterval]; !ok {
+	if c.noop {
+		return nil, ErrCacheMiss
+	}
+	if _, ok := c.lruFor(metric.CandlestickInterval); !ok {
 		return nil, ErrCacheNotConfiguredForCandlestickInterval
 	}
 	tm, err := initialISO8601.Time()
@@ -137,7 +281,39 @@ func (c *MemoryCache) Get(metric Metric, initialISO8601 common.ISO8601) ([]commo
 	}
 	c.CacheRequests++
 
-	startingTimestamp := common.NormalizeTimestamp(tm, metric.CandlestickInterval, "TODO_PROVIDER", false)
+	startingTimestamp, ok := c.startingTimestamp(tm, metric.CandlestickInterval)
+	if !ok {
+		c.CacheMisses++
+		return []common.Candlestick{}, ErrCacheMiss
+	}
+
+	candlesticks, _, err := c.get(metric, startingTimestamp)
+	return candlesticks, err
+}
+
+// GetStrict is like Get, but also reports whether the returned candlesticks are complete, i.e. false if they are a
+// prefix truncated by a gap, because subsequent candlesticks were cached (e.g. by two Puts that left a gap in between)
+// but the ones in the gap were not. Callers can use it to know when to request the missing candlesticks again.
+//
+// Candlesticks that reach the end of the cache entry are complete, as subsequent ones are retrieved by a subsequent Get.
+func (c *MemoryCache) GetStrict(metric Metric, initialISO8601 common.ISO8601) ([]common.Candlestick, bool, error) {
+	if c.noop {
+		return nil, false, ErrCacheMiss
+	}
+	if _, ok := c.lruFor(metric.CandlestickInterval); !ok {
+		return nil, false, ErrCacheNotConfiguredForCandlestickInterval
+	}
+	tm, err := initialISO8601.Time()
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: %v", ErrInvalidISO8601, initialISO8601)
+	}
+	c.CacheRequests++
+
+	startingTimestamp, ok := c.startingTimestamp(tm, metric.CandlestickInterval)
+	if !ok {
+		c.CacheMisses++
+		return []common.Candlestick{}, false, ErrCacheMiss
+	}
 
 	return c.get(metric, startingTimestamp)
 }
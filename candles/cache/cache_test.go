@@ -2,6 +2,7 @@ package cache
 
 import (
 	"errors"
+	"fmt"
 	"testing"
 	"time"
 
@@ -817,39 +818,476 @@ func TestCache(t *testing.T) {
 				},
 			},
 		},
+		// Secondly tests
+		{
+			name: "SECONDLY: Get empty returns ErrCacheMiss",
+			ops: []operation{
+				{
+					opType:              "GET",
+					marketSource:        opBTCUSDT,
+					candlestickInterval: 1 * time.Second,
+					initialISO8601:      tpToISO("2020-01-02 03:04:00"),
+					expectedErr:         ErrCacheMiss,
+					expectedTicks:       []common.Candlestick{},
+				},
+			},
+		},
+		{
+			name: "SECONDLY: Put with zero value fails",
+			ops: []operation{
+				{
+					opType:              "PUT",
+					marketSource:        opBTCUSDT,
+					candlestickInterval: 1 * time.Second,
+					candlesticks: []common.Candlestick{
+						{Timestamp: tInt("2020-01-02 03:04:00"), OpenPrice: 1234, HighestPrice: 1234, ClosePrice: 1234, LowestPrice: 1234},
+						{Timestamp: tInt("2020-01-02 03:04:01"), OpenPrice: 0, HighestPrice: 0, ClosePrice: 0, LowestPrice: 0},
+					},
+					expectedErr: ErrReceivedCandlestickWithZeroValue,
+				},
+			},
+		},
+		{
+			name: "SECONDLY: Put with non-subsequent timestamps fails",
+			ops: []operation{
+				{
+					opType:              "PUT",
+					marketSource:        opBTCUSDT,
+					candlestickInterval: 1 * time.Second,
+					candlesticks: []common.Candlestick{
+						{Timestamp: tInt("2020-01-02 03:04:00"), OpenPrice: 1234, HighestPrice: 1234, ClosePrice: 1234, LowestPrice: 1234},
+						{Timestamp: tInt("2020-01-02 03:04:02"), OpenPrice: 1234, HighestPrice: 1234, ClosePrice: 1234, LowestPrice: 1234},
+					},
+					expectedErr: ErrReceivedNonSubsequentCandlestick,
+				},
+			},
+		},
+		{
+			name: "SECONDLY: Valid Put succeeds, and a get of a different key does not return anything, but a get of same key works",
+			ops: []operation{
+				{
+					opType:              "PUT",
+					marketSource:        opBTCUSDT,
+					candlestickInterval: 1 * time.Second,
+					candlesticks: []common.Candlestick{
+						{Timestamp: tInt("2020-01-02 03:04:00"), OpenPrice: 1234, HighestPrice: 1234, ClosePrice: 1234, LowestPrice: 1234},
+						{Timestamp: tInt("2020-01-02 03:04:01"), OpenPrice: 2345, HighestPrice: 2345, ClosePrice: 2345, LowestPrice: 2345},
+					},
+					expectedErr: nil,
+				},
+				{
+					opType:              "GET",
+					marketSource:        opETHUSDT,
+					candlestickInterval: 1 * time.Second,
+					initialISO8601:      tpToISO("2020-01-02 03:04:00"),
+					expectedErr:         ErrCacheMiss,
+					expectedTicks:       []common.Candlestick{},
+				},
+				{
+					opType:              "GET",
+					marketSource:        opBTCUSDT,
+					candlestickInterval: 1 * time.Second,
+					initialISO8601:      tpToISO("2020-01-02 03:04:00"),
+					expectedErr:         nil,
+					expectedTicks: []common.Candlestick{
+						{Timestamp: tInt("2020-01-02 03:04:00"), OpenPrice: 1234, HighestPrice: 1234, ClosePrice: 1234, LowestPrice: 1234},
+						{Timestamp: tInt("2020-01-02 03:04:01"), OpenPrice: 2345, HighestPrice: 2345, ClosePrice: 2345, LowestPrice: 2345},
+					},
+				},
+			},
+		},
+		{
+			name: "SECONDLY: A secondary PUT with overlap makes the sequence larger on GET",
+			ops: []operation{
+				{
+					opType:              "PUT",
+					marketSource:        opBTCUSDT,
+					candlestickInterval: 1 * time.Second,
+					candlesticks: []common.Candlestick{
+						{Timestamp: tInt("2020-01-02 03:04:00"), OpenPrice: 1234, HighestPrice: 1234, ClosePrice: 1234, LowestPrice: 1234},
+						{Timestamp: tInt("2020-01-02 03:04:01"), OpenPrice: 2345, HighestPrice: 2345, ClosePrice: 2345, LowestPrice: 2345},
+					},
+					expectedErr: nil,
+				},
+				{
+					opType:              "PUT",
+					marketSource:        opBTCUSDT,
+					candlestickInterval: 1 * time.Second,
+					candlesticks: []common.Candlestick{
+						{Timestamp: tInt("2020-01-02 03:04:01"), OpenPrice: 2345, HighestPrice: 2345, ClosePrice: 2345, LowestPrice: 2345},
+						{Timestamp: tInt("2020-01-02 03:04:02"), OpenPrice: 3456, HighestPrice: 3456, ClosePrice: 3456, LowestPrice: 3456},
+					},
+					expectedErr: nil,
+				},
+				{
+					opType:              "GET",
+					marketSource:        opBTCUSDT,
+					candlestickInterval: 1 * time.Second,
+					initialISO8601:      tpToISO("2020-01-02 03:04:00"),
+					expectedErr:         nil,
+					expectedTicks: []common.Candlestick{
+						{Timestamp: tInt("2020-01-02 03:04:00"), OpenPrice: 1234, HighestPrice: 1234, ClosePrice: 1234, LowestPrice: 1234},
+						{Timestamp: tInt("2020-01-02 03:04:01"), OpenPrice: 2345, HighestPrice: 2345, ClosePrice: 2345, LowestPrice: 2345},
+						{Timestamp: tInt("2020-01-02 03:04:02"), OpenPrice: 3456, HighestPrice: 3456, ClosePrice: 3456, LowestPrice: 3456},
+					},
+				},
+			},
+		},
+		{
+			name: "SECONDLY: A secondary PUT without overlap does not make the sequence larger on GET, and a second get gets the other one",
+			ops: []operation{
+				{
+					opType:              "PUT",
+					marketSource:        opBTCUSDT,
+					candlestickInterval: 1 * time.Second,
+					candlesticks: []common.Candlestick{
+						{Timestamp: tInt("2020-01-02 03:04:00"), OpenPrice: 1234, HighestPrice: 1234, ClosePrice: 1234, LowestPrice: 1234},
+						{Timestamp: tInt("2020-01-02 03:04:01"), OpenPrice: 2345, HighestPrice: 2345, ClosePrice: 2345, LowestPrice: 2345},
+					},
+					expectedErr: nil,
+				},
+				{
+					opType:              "PUT",
+					marketSource:        opBTCUSDT,
+					candlestickInterval: 1 * time.Second,
+					candlesticks: []common.Candlestick{
+						{Timestamp: tInt("2020-01-02 03:04:03"), OpenPrice: 3456, HighestPrice: 3456, ClosePrice: 3456, LowestPrice: 3456},
+						{Timestamp: tInt("2020-01-02 03:04:04"), OpenPrice: 4567, HighestPrice: 4567, ClosePrice: 4567, LowestPrice: 4567},
+					},
+					expectedErr: nil,
+				},
+				{
+					opType:              "GET",
+					marketSource:        opBTCUSDT,
+					candlestickInterval: 1 * time.Second,
+					initialISO8601:      tpToISO("2020-01-02 03:04:00"),
+					expectedErr:         nil,
+					expectedTicks: []common.Candlestick{
+						{Timestamp: tInt("2020-01-02 03:04:00"), OpenPrice: 1234, HighestPrice: 1234, ClosePrice: 1234, LowestPrice: 1234},
+						{Timestamp: tInt("2020-01-02 03:04:01"), OpenPrice: 2345, HighestPrice: 2345, ClosePrice: 2345, LowestPrice: 2345},
+					},
+				},
+				{
+					opType:              "GET",
+					marketSource:        opBTCUSDT,
+					candlestickInterval: 1 * time.Second,
+					initialISO8601:      tpToISO("2020-01-02 03:04:03"),
+					expectedErr:         nil,
+					expectedTicks: []common.Candlestick{
+						{Timestamp: tInt("2020-01-02 03:04:03"), OpenPrice: 3456, HighestPrice: 3456, ClosePrice: 3456, LowestPrice: 3456},
+						{Timestamp: tInt("2020-01-02 03:04:04"), OpenPrice: 4567, HighestPrice: 4567, ClosePrice: 4567, LowestPrice: 4567},
+					},
+				},
+			},
+		},
+		{
+			name: "SECONDLY: Putting ticks that span two truncated intervals works, but requires two gets to get both ticks",
+			ops: []operation{
+				{
+					opType:              "PUT",
+					marketSource:        opBTCUSDT,
+					candlestickInterval: 1 * time.Second,
+					candlesticks: []common.Candlestick{
+						{Timestamp: tInt("2020-01-01 23:59:59"), OpenPrice: 1234, HighestPrice: 1234, ClosePrice: 1234, LowestPrice: 1234},
+						{Timestamp: tInt("2020-01-02 00:00:00"), OpenPrice: 2345, HighestPrice: 2345, ClosePrice: 2345, LowestPrice: 2345},
+					},
+					expectedErr: nil,
+				},
+				{
+					opType:              "GET",
+					marketSource:        opBTCUSDT,
+					candlestickInterval: 1 * time.Second,
+					initialISO8601:      tpToISO("2020-01-01 23:59:59"),
+					expectedErr:         nil,
+					expectedTicks: []common.Candlestick{
+						{Timestamp: tInt("2020-01-01 23:59:59"), OpenPrice: 1234, HighestPrice: 1234, ClosePrice: 1234, LowestPrice: 1234},
+					},
+				},
+				{
+					opType:              "GET",
+					marketSource:        opBTCUSDT,
+					candlestickInterval: 1 * time.Second,
+					initialISO8601:      tpToISO("2020-01-02 00:00:00"),
+					expectedErr:         nil,
+					expectedTicks: []common.Candlestick{
+						{Timestamp: tInt("2020-01-02 00:00:00"), OpenPrice: 2345, HighestPrice: 2345, ClosePrice: 2345, LowestPrice: 2345},
+					},
+				},
+			},
+		},
+		// 10-secondly tests
+		{
+			name: "10-SECONDLY: Get empty returns ErrCacheMiss",
+			ops: []operation{
+				{
+					opType:              "GET",
+					marketSource:        opBTCUSDT,
+					candlestickInterval: 10 * time.Second,
+					initialISO8601:      tpToISO("2020-01-02 03:04:00"),
+					expectedErr:         ErrCacheMiss,
+					expectedTicks:       []common.Candlestick{},
+				},
+			},
+		},
+		{
+			name: "10-SECONDLY: Put with timestamp not multiple of interval fails",
+			ops: []operation{
+				{
+					opType:              "PUT",
+					marketSource:        opBTCUSDT,
+					candlestickInterval: 10 * time.Second,
+					candlesticks: []common.Candlestick{
+						{Timestamp: tInt("2020-01-02 03:04:01"), OpenPrice: 1234, HighestPrice: 1234, ClosePrice: 1234, LowestPrice: 1234},
+					},
+					expectedErr: ErrTimestampMustBeMultipleOfCandlestickInterval,
+				},
+			},
+		},
+		{
+			name: "10-SECONDLY: Put with zero value fails",
+			ops: []operation{
+				{
+					opType:              "PUT",
+					marketSource:        opBTCUSDT,
+					candlestickInterval: 10 * time.Second,
+					candlesticks: []common.Candlestick{
+						{Timestamp: tInt("2020-01-02 03:04:00"), OpenPrice: 1234, HighestPrice: 1234, ClosePrice: 1234, LowestPrice: 1234},
+						{Timestamp: tInt("2020-01-02 03:04:10"), OpenPrice: 0, HighestPrice: 0, ClosePrice: 0, LowestPrice: 0},
+					},
+					expectedErr: ErrReceivedCandlestickWithZeroValue,
+				},
+			},
+		},
+		{
+			name: "10-SECONDLY: Put with non-subsequent timestamps fails",
+			ops: []operation{
+				{
+					opType:              "PUT",
+					marketSource:        opBTCUSDT,
+					candlestickInterval: 10 * time.Second,
+					candlesticks: []common.Candlestick{
+						{Timestamp: tInt("2020-01-02 03:04:00"), OpenPrice: 1234, HighestPrice: 1234, ClosePrice: 1234, LowestPrice: 1234},
+						{Timestamp: tInt("2020-01-02 03:04:20"), OpenPrice: 1234, HighestPrice: 1234, ClosePrice: 1234, LowestPrice: 1234},
+					},
+					expectedErr: ErrReceivedNonSubsequentCandlestick,
+				},
+			},
+		},
+		{
+			name: "10-SECONDLY: Valid Put succeeds, and a get of a different key does not return anything, but a get of same key works",
+			ops: []operation{
+				{
+					opType:              "PUT",
+					marketSource:        opBTCUSDT,
+					candlestickInterval: 10 * time.Second,
+					candlesticks: []common.Candlestick{
+						{Timestamp: tInt("2020-01-02 03:04:00"), OpenPrice: 1234, HighestPrice: 1234, ClosePrice: 1234, LowestPrice: 1234},
+						{Timestamp: tInt("2020-01-02 03:04:10"), OpenPrice: 2345, HighestPrice: 2345, ClosePrice: 2345, LowestPrice: 2345},
+					},
+					expectedErr: nil,
+				},
+				{
+					opType:              "GET",
+					marketSource:        opETHUSDT,
+					candlestickInterval: 10 * time.Second,
+					initialISO8601:      tpToISO("2020-01-02 03:04:00"),
+					expectedErr:         ErrCacheMiss,
+					expectedTicks:       []common.Candlestick{},
+				},
+				{
+					opType:              "GET",
+					marketSource:        opBTCUSDT,
+					candlestickInterval: 10 * time.Second,
+					initialISO8601:      tpToISO("2020-01-02 03:04:00"),
+					expectedErr:         nil,
+					expectedTicks: []common.Candlestick{
+						{Timestamp: tInt("2020-01-02 03:04:00"), OpenPrice: 1234, HighestPrice: 1234, ClosePrice: 1234, LowestPrice: 1234},
+						{Timestamp: tInt("2020-01-02 03:04:10"), OpenPrice: 2345, HighestPrice: 2345, ClosePrice: 2345, LowestPrice: 2345},
+					},
+				},
+			},
+		},
+		{
+			name: "10-SECONDLY: A secondary PUT with overlap makes the sequence larger on GET",
+			ops: []operation{
+				{
+					opType:              "PUT",
+					marketSource:        opBTCUSDT,
+					candlestickInterval: 10 * time.Second,
+					candlesticks: []common.Candlestick{
+						{Timestamp: tInt("2020-01-02 03:04:00"), OpenPrice: 1234, HighestPrice: 1234, ClosePrice: 1234, LowestPrice: 1234},
+						{Timestamp: tInt("2020-01-02 03:04:10"), OpenPrice: 2345, HighestPrice: 2345, ClosePrice: 2345, LowestPrice: 2345},
+					},
+					expectedErr: nil,
+				},
+				{
+					opType:              "PUT",
+					marketSource:        opBTCUSDT,
+					candlestickInterval: 10 * time.Second,
+					candlesticks: []common.Candlestick{
+						{Timestamp: tInt("2020-01-02 03:04:10"), OpenPrice: 2345, HighestPrice: 2345, ClosePrice: 2345, LowestPrice: 2345},
+						{Timestamp: tInt("2020-01-02 03:04:20"), OpenPrice: 3456, HighestPrice: 3456, ClosePrice: 3456, LowestPrice: 3456},
+					},
+					expectedErr: nil,
+				},
+				{
+					opType:              "GET",
+					marketSource:        opBTCUSDT,
+					candlestickInterval: 10 * time.Second,
+					initialISO8601:      tpToISO("2020-01-02 03:04:00"),
+					expectedErr:         nil,
+					expectedTicks: []common.Candlestick{
+						{Timestamp: tInt("2020-01-02 03:04:00"), OpenPrice: 1234, HighestPrice: 1234, ClosePrice: 1234, LowestPrice: 1234},
+						{Timestamp: tInt("2020-01-02 03:04:10"), OpenPrice: 2345, HighestPrice: 2345, ClosePrice: 2345, LowestPrice: 2345},
+						{Timestamp: tInt("2020-01-02 03:04:20"), OpenPrice: 3456, HighestPrice: 3456, ClosePrice: 3456, LowestPrice: 3456},
+					},
+				},
+			},
+		},
+		{
+			name: "10-SECONDLY: A secondary PUT without overlap does not make the sequence larger on GET, and a second get gets the other one",
+			ops: []operation{
+				{
+					opType:              "PUT",
+					marketSource:        opBTCUSDT,
+					candlestickInterval: 10 * time.Second,
+					candlesticks: []common.Candlestick{
+						{Timestamp: tInt("2020-01-02 03:04:00"), OpenPrice: 1234, HighestPrice: 1234, ClosePrice: 1234, LowestPrice: 1234},
+						{Timestamp: tInt("2020-01-02 03:04:10"), OpenPrice: 2345, HighestPrice: 2345, ClosePrice: 2345, LowestPrice: 2345},
+					},
+					expectedErr: nil,
+				},
+				{
+					opType:              "PUT",
+					marketSource:        opBTCUSDT,
+					candlestickInterval: 10 * time.Second,
+					candlesticks: []common.Candlestick{
+						{Timestamp: tInt("2020-01-02 03:04:30"), OpenPrice: 3456, HighestPrice: 3456, ClosePrice: 3456, LowestPrice: 3456},
+						{Timestamp: tInt("2020-01-02 03:04:40"), OpenPrice: 4567, HighestPrice: 4567, ClosePrice: 4567, LowestPrice: 4567},
+					},
+					expectedErr: nil,
+				},
+				{
+					opType:              "GET",
+					marketSource:        opBTCUSDT,
+					candlestickInterval: 10 * time.Second,
+					initialISO8601:      tpToISO("2020-01-02 03:04:00"),
+					expectedErr:         nil,
+					expectedTicks: []common.Candlestick{
+						{Timestamp: tInt("2020-01-02 03:04:00"), OpenPrice: 1234, HighestPrice: 1234, ClosePrice: 1234, LowestPrice: 1234},
+						{Timestamp: tInt("2020-01-02 03:04:10"), OpenPrice: 2345, HighestPrice: 2345, ClosePrice: 2345, LowestPrice: 2345},
+					},
+				},
+				{
+					opType:              "GET",
+					marketSource:        opBTCUSDT,
+					candlestickInterval: 10 * time.Second,
+					initialISO8601:      tpToISO("2020-01-02 03:04:30"),
+					expectedErr:         nil,
+					expectedTicks: []common.Candlestick{
+						{Timestamp: tInt("2020-01-02 03:04:30"), OpenPrice: 3456, HighestPrice: 3456, ClosePrice: 3456, LowestPrice: 3456},
+						{Timestamp: tInt("2020-01-02 03:04:40"), OpenPrice: 4567, HighestPrice: 4567, ClosePrice: 4567, LowestPrice: 4567},
+					},
+				},
+			},
+		},
+		{
+			name: "10-SECONDLY: Get with a non-multiple time returns the tick of the next multiple",
+			ops: []operation{
+				{
+					opType:              "PUT",
+					marketSource:        opBTCUSDT,
+					candlestickInterval: 10 * time.Second,
+					candlesticks: []common.Candlestick{
+						{Timestamp: tInt("2020-01-02 03:04:00"), OpenPrice: 1234, HighestPrice: 1234, ClosePrice: 1234, LowestPrice: 1234},
+						{Timestamp: tInt("2020-01-02 03:04:10"), OpenPrice: 2345, HighestPrice: 2345, ClosePrice: 2345, LowestPrice: 2345},
+					},
+					expectedErr: nil,
+				},
+				{
+					opType:              "GET",
+					marketSource:        opBTCUSDT,
+					candlestickInterval: 10 * time.Second,
+					initialISO8601:      tpToISO("2020-01-02 03:03:51"),
+					expectedErr:         nil,
+					expectedTicks: []common.Candlestick{
+						{Timestamp: tInt("2020-01-02 03:04:00"), OpenPrice: 1234, HighestPrice: 1234, ClosePrice: 1234, LowestPrice: 1234},
+						{Timestamp: tInt("2020-01-02 03:04:10"), OpenPrice: 2345, HighestPrice: 2345, ClosePrice: 2345, LowestPrice: 2345},
+					},
+				},
+			},
+		},
+		{
+			name: "10-SECONDLY: Putting ticks that span two truncated intervals works, but requires two gets to get both ticks",
+			ops: []operation{
+				{
+					opType:              "PUT",
+					marketSource:        opBTCUSDT,
+					candlestickInterval: 10 * time.Second,
+					candlesticks: []common.Candlestick{
+						{Timestamp: tInt("2020-01-01 23:59:50"), OpenPrice: 1234, HighestPrice: 1234, ClosePrice: 1234, LowestPrice: 1234},
+						{Timestamp: tInt("2020-01-02 00:00:00"), OpenPrice: 2345, HighestPrice: 2345, ClosePrice: 2345, LowestPrice: 2345},
+					},
+					expectedErr: nil,
+				},
+				{
+					opType:              "GET",
+					marketSource:        opBTCUSDT,
+					candlestickInterval: 10 * time.Second,
+					initialISO8601:      tpToISO("2020-01-01 23:59:50"),
+					expectedErr:         nil,
+					expectedTicks: []common.Candlestick{
+						{Timestamp: tInt("2020-01-01 23:59:50"), OpenPrice: 1234, HighestPrice: 1234, ClosePrice: 1234, LowestPrice: 1234},
+					},
+				},
+				{
+					opType:              "GET",
+					marketSource:        opBTCUSDT,
+					candlestickInterval: 10 * time.Second,
+					initialISO8601:      tpToISO("2020-01-02 00:00:00"),
+					expectedErr:         nil,
+					expectedTicks: []common.Candlestick{
+						{Timestamp: tInt("2020-01-02 00:00:00"), OpenPrice: 2345, HighestPrice: 2345, ClosePrice: 2345, LowestPrice: 2345},
+					},
+				},
+			},
+		},
 	}
-	for _, ts := range tss {
-		t.Run(ts.name, func(t *testing.T) {
-			cache := NewMemoryCache(map[time.Duration]int{time.Minute: 128, 24 * time.Hour: 128})
-			var (
-				actualCandlesticks []common.Candlestick
-				actualErr          error
-			)
-
-			for _, op := range ts.ops {
-				metric := Metric{Name: op.marketSource.String(), CandlestickInterval: op.candlestickInterval}
-				if op.opType == "GET" {
-					actualCandlesticks, actualErr = cache.Get(metric, op.initialISO8601)
-				} else if op.opType == "PUT" {
-					actualErr = cache.Put(metric, op.candlesticks)
-				}
-				if actualErr != nil && op.expectedErr == nil {
-					t.Logf("expected no error but had '%v'", actualErr)
-					t.FailNow()
-				}
-				if actualErr == nil && op.expectedErr != nil {
-					t.Logf("expected error '%v' but had no error", op.expectedErr)
-					t.FailNow()
-				}
-				if op.expectedErr != nil && actualErr != nil && !errors.Is(actualErr, op.expectedErr) {
-					t.Logf("expected error '%v' but had error '%v'", op.expectedErr, actualErr)
-					t.FailNow()
-				}
-				if op.expectedErr == nil && op.opType == "GET" {
-					require.Equal(t, op.expectedTicks, actualCandlesticks)
+	for _, packed := range []bool{false, true} {
+		for _, ts := range tss {
+			t.Run(fmt.Sprintf("%v (packed: %v)", ts.name, packed), func(t *testing.T) {
+				cache := NewMemoryCache(map[time.Duration]int{time.Second: 128, 10 * time.Second: 128, time.Minute: 128, 24 * time.Hour: 128})
+				cache.SetPacked(packed)
+				var (
+					actualCandlesticks []common.Candlestick
+					actualErr          error
+				)
+
+				for _, op := range ts.ops {
+					metric := Metric{Name: op.marketSource.String(), CandlestickInterval: op.candlestickInterval}
+					if op.opType == "GET" {
+						actualCandlesticks, actualErr = cache.Get(metric, op.initialISO8601)
+					} else if op.opType == "PUT" {
+						actualErr = cache.Put(metric, op.candlesticks)
+					}
+					if actualErr != nil && op.expectedErr == nil {
+						t.Logf("expected no error but had '%v'", actualErr)
+						t.FailNow()
+					}
+					if actualErr == nil && op.expectedErr != nil {
+						t.Logf("expected error '%v' but had no error", op.expectedErr)
+						t.FailNow()
+					}
+					if op.expectedErr != nil && actualErr != nil && !errors.Is(actualErr, op.expectedErr) {
+						t.Logf("expected error '%v' but had error '%v'", op.expectedErr, actualErr)
+						t.FailNow()
+					}
+					if op.expectedErr == nil && op.opType == "GET" {
+						require.Equal(t, op.expectedTicks, actualCandlesticks)
+					}
 				}
-			}
-		})
+			})
+		}
 	}
 }
 
@@ -878,3 +1316,316 @@ func TestNotConfiguredForCandlestickInterval(t *testing.T) {
 	_, err = c.Get(Metric{Name: "test", CandlestickInterval: 160 * time.Minute}, common.ISO8601("2020-01-02T03:04:05Z"))
 	require.ErrorIs(t, err, ErrCacheNotConfiguredForCandlestickInterval)
 }
+
+func TestByteBudgetEvictsAcrossCandlestickIntervals(t *testing.T) {
+	c := NewMemoryCacheWithByteBudget(2 * estimatedEntryBytes)
+
+	var (
+		minutely = Metric{Name: "test", CandlestickInterval: time.Minute}
+		hourly   = Metric{Name: "test", CandlestickInterval: time.Hour}
+		daily    = Metric{Name: "test", CandlestickInterval: 24 * time.Hour}
+		ts       = tInt("2020-01-02 00:00:00")
+		cstick   = common.Candlestick{Timestamp: ts, OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+		iso8601  = tpToISO("2020-01-02 00:00:00")
+	)
+
+	require.Nil(t, c.Put(minutely, []common.Candlestick{cstick}))
+	require.Nil(t, c.Put(hourly, []common.Candlestick{cstick}))
+
+	// Using the minutely entry makes the hourly one the least recently used.
+	_, err := c.Get(minutely, iso8601)
+	require.Nil(t, err)
+
+	require.Nil(t, c.Put(daily, []common.Candlestick{cstick}))
+
+	_, err = c.Get(hourly, iso8601)
+	require.ErrorIs(t, err, ErrCacheMiss)
+	for _, metric := range []Metric{minutely, daily} {
+		cs, err := c.Get(metric, iso8601)
+		require.Nil(t, err)
+		require.Equal(t, []common.Candlestick{cstick}, cs)
+	}
+}
+
+func TestByteBudgetSupportsAnyCandlestickInterval(t *testing.T) {
+	c := NewMemoryCacheWithByteBudget(0)
+	metric := Metric{Name: "test", CandlestickInterval: 160 * time.Minute}
+	cstick := common.Candlestick{Timestamp: tInt("2020-01-02 00:00:00"), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+
+	require.Nil(t, c.Put(metric, []common.Candlestick{cstick}))
+	cs, err := c.Get(metric, tpToISO("2020-01-02 00:00:00"))
+	require.Nil(t, err)
+	require.Equal(t, []common.Candlestick{cstick}, cs)
+}
+
+func TestNoOpMemoryCache(t *testing.T) {
+	c := NewNoOpMemoryCache()
+	metric := Metric{Name: "test", CandlestickInterval: time.Minute}
+	cstick := common.Candlestick{Timestamp: tInt("2020-01-02 00:00:00"), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+
+	require.True(t, c.IsNoOp())
+	require.Nil(t, c.Put(metric, []common.Candlestick{cstick}))
+	_, err := c.Get(metric, tpToISO("2020-01-02 00:00:00"))
+	require.ErrorIs(t, err, ErrCacheMiss)
+}
+
+func TestGetStrict(t *testing.T) {
+	metric := Metric{Name: "test", CandlestickInterval: time.Minute}
+	cstick := func(s string) common.Candlestick {
+		return common.Candlestick{Timestamp: tInt(s), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+	}
+
+	tss := []struct {
+		name             string
+		puts             [][]common.Candlestick
+		get              string
+		expected         []common.Candlestick
+		expectedComplete bool
+	}{
+		{
+			name:             "single put is complete",
+			puts:             [][]common.Candlestick{{cstick("2020-01-02 03:04:00"), cstick("2020-01-02 03:05:00")}},
+			get:              "2020-01-02 03:04:00",
+			expected:         []common.Candlestick{cstick("2020-01-02 03:04:00"), cstick("2020-01-02 03:05:00")},
+			expectedComplete: true,
+		},
+		{
+			name:             "two puts with a gap in between are a truncated prefix",
+			puts:             [][]common.Candlestick{{cstick("2020-01-02 03:04:00"), cstick("2020-01-02 03:05:00")}, {cstick("2020-01-02 03:07:00")}},
+			get:              "2020-01-02 03:04:00",
+			expected:         []common.Candlestick{cstick("2020-01-02 03:04:00"), cstick("2020-01-02 03:05:00")},
+			expectedComplete: false,
+		},
+		{
+			name:             "the run after the gap is complete",
+			puts:             [][]common.Candlestick{{cstick("2020-01-02 03:04:00"), cstick("2020-01-02 03:05:00")}, {cstick("2020-01-02 03:07:00")}},
+			get:              "2020-01-02 03:07:00",
+			expected:         []common.Candlestick{cstick("2020-01-02 03:07:00")},
+			expectedComplete: true,
+		},
+		{
+			name: "a gap before the next cache entry is a truncated prefix",
+			// Minutely entries span 500 minutes since the epoch, so an entry starts at 2020-01-02 08:20:00.
+			puts:             [][]common.Candlestick{{cstick("2020-01-02 08:18:00")}, {cstick("2020-01-02 08:21:00")}},
+			get:              "2020-01-02 08:18:00",
+			expected:         []common.Candlestick{cstick("2020-01-02 08:18:00")},
+			expectedComplete: false,
+		},
+		{
+			name:             "reaching the end of the cache entry is complete",
+			puts:             [][]common.Candlestick{{cstick("2020-01-02 08:18:00"), cstick("2020-01-02 08:19:00")}, {cstick("2020-01-02 08:21:00")}},
+			get:              "2020-01-02 08:18:00",
+			expected:         []common.Candlestick{cstick("2020-01-02 08:18:00"), cstick("2020-01-02 08:19:00")},
+			expectedComplete: true,
+		},
+	}
+	for _, ts := range tss {
+		t.Run(ts.name, func(t *testing.T) {
+			c := NewMemoryCache(map[time.Duration]int{time.Minute: 10})
+			for _, put := range ts.puts {
+				require.Nil(t, c.Put(metric, put))
+			}
+			actual, complete, err := c.GetStrict(metric, tpToISO(ts.get))
+			require.Nil(t, err)
+			require.Equal(t, ts.expected, actual)
+			require.Equal(t, ts.expectedComplete, complete)
+		})
+	}
+}
+
+func TestGetStrictCacheMiss(t *testing.T) {
+	c := NewMemoryCache(map[time.Duration]int{time.Minute: 10})
+	_, complete, err := c.GetStrict(Metric{Name: "test", CandlestickInterval: time.Minute}, tpToISO("2020-01-02 03:04:00"))
+	require.ErrorIs(t, err, ErrCacheMiss)
+	require.False(t, complete)
+}
+
+func TestSeed(t *testing.T) {
+	metric := Metric{Name: "test", CandlestickInterval: time.Minute}
+	cstick1 := common.Candlestick{Timestamp: tInt("2020-01-02 00:00:00"), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+	cstick2 := common.Candlestick{Timestamp: tInt("2020-01-02 00:01:00"), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+	cstick3 := common.Candlestick{Timestamp: tInt("2020-01-02 00:03:00"), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+	zero := common.Candlestick{Timestamp: tInt("2020-01-02 00:02:00")}
+	unaligned := common.Candlestick{Timestamp: tInt("2020-01-02 00:00:30"), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+
+	tss := []struct {
+		name         string
+		candlesticks []common.Candlestick
+		expectedErr  error
+	}{
+		{name: "non-subsequent", candlesticks: []common.Candlestick{cstick1, cstick2, cstick3}, expectedErr: ErrReceivedNonSubsequentCandlestick},
+		{name: "zero value", candlesticks: []common.Candlestick{cstick1, cstick2, zero}, expectedErr: ErrReceivedCandlestickWithZeroValue},
+		{name: "not a multiple", candlesticks: []common.Candlestick{unaligned}, expectedErr: ErrTimestampMustBeMultipleOfCandlestickInterval},
+	}
+	for _, ts := range tss {
+		t.Run(ts.name, func(t *testing.T) {
+			c := NewMemoryCache(map[time.Duration]int{time.Minute: 10})
+			require.ErrorIs(t, c.Seed(metric, ts.candlesticks), ts.expectedErr)
+
+			// Nothing is stored if the slice is invalid.
+			_, err := c.Get(metric, tpToISO("2020-01-02 00:00:00"))
+			require.ErrorIs(t, err, ErrCacheMiss)
+		})
+	}
+
+	c := NewMemoryCache(map[time.Duration]int{time.Minute: 10})
+	require.Nil(t, c.Seed(metric, []common.Candlestick{cstick1, cstick2}))
+	cs, err := c.Get(metric, tpToISO("2020-01-02 00:00:00"))
+	require.Nil(t, err)
+	require.Equal(t, []common.Candlestick{cstick1, cstick2}, cs)
+
+	require.ErrorIs(t, NewMemoryCache(map[time.Duration]int{}).Seed(metric, []common.Candlestick{cstick1}), ErrCacheNotConfiguredForCandlestickInterval)
+}
+
+func TestZeroCheck(t *testing.T) {
+	metric := Metric{Name: "test", CandlestickInterval: time.Minute}
+	zeroOpen := common.Candlestick{Timestamp: tInt("2020-01-02 00:00:00"), OpenPrice: 0, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+	allZero := common.Candlestick{Timestamp: tInt("2020-01-02 00:00:00"), Synthetic: true}
+
+	tss := []struct {
+		name        string
+		zeroCheck   ZeroCheck
+		candlestick common.Candlestick
+		expectedErr error
+	}{
+		{name: "any OHLC rejects a zero open", zeroCheck: ZeroCheckAnyOHLC, candlestick: zeroOpen, expectedErr: ErrReceivedCandlestickWithZeroValue},
+		{name: "all OHLC accepts a zero open", zeroCheck: ZeroCheckAllOHLC, candlestick: zeroOpen, expectedErr: nil},
+		{name: "all OHLC rejects all zeros", zeroCheck: ZeroCheckAllOHLC, candlestick: allZero, expectedErr: ErrReceivedCandlestickWithZeroValue},
+		{name: "none accepts all zeros", zeroCheck: ZeroCheckNone, candlestick: allZero, expectedErr: nil},
+	}
+	for _, ts := range tss {
+		t.Run(ts.name, func(t *testing.T) {
+			c := NewMemoryCache(map[time.Duration]int{time.Minute: 10})
+			c.SetZeroCheck(ts.zeroCheck)
+			require.ErrorIs(t, c.Put(metric, []common.Candlestick{ts.candlestick}), ts.expectedErr)
+
+			c = NewMemoryCache(map[time.Duration]int{time.Minute: 10})
+			c.SetZeroCheck(ts.zeroCheck)
+			require.ErrorIs(t, c.Seed(metric, []common.Candlestick{ts.candlestick}), ts.expectedErr)
+			if ts.expectedErr != nil {
+				return
+			}
+			cs, err := c.Get(metric, tpToISO("2020-01-02 00:00:00"))
+			require.Nil(t, err)
+			require.Equal(t, []common.Candlestick{ts.candlestick}, cs)
+		})
+	}
+}
+
+func TestRounding(t *testing.T) {
+	metric := Metric{Name: "test", CandlestickInterval: time.Minute}
+	cstick1 := common.Candlestick{Timestamp: tInt("2020-01-02 03:04:00"), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+	cstick2 := common.Candlestick{Timestamp: tInt("2020-01-02 03:05:00"), OpenPrice: 2345, HighestPrice: 2345, LowestPrice: 2345, ClosePrice: 2345}
+
+	tss := []struct {
+		name          string
+		rounding      Rounding
+		initialISO    common.ISO8601
+		expectedErr   error
+		expectedTicks []common.Candlestick
+	}{
+		{name: "round up starts at the next candlestick", rounding: RoundUp, initialISO: tpToISO("2020-01-02 03:04:01"), expectedTicks: []common.Candlestick{cstick2}},
+		{name: "round down starts at the containing candlestick", rounding: RoundDown, initialISO: tpToISO("2020-01-02 03:04:01"), expectedTicks: []common.Candlestick{cstick1, cstick2}},
+		{name: "exact misses unaligned datetimes", rounding: RoundExact, initialISO: tpToISO("2020-01-02 03:04:01"), expectedErr: ErrCacheMiss, expectedTicks: []common.Candlestick{}},
+		{name: "exact hits aligned datetimes", rounding: RoundExact, initialISO: tpToISO("2020-01-02 03:04:00"), expectedTicks: []common.Candlestick{cstick1, cstick2}},
+		{name: "round down misses before the first candlestick", rounding: RoundDown, initialISO: tpToISO("2020-01-02 03:03:59"), expectedErr: ErrCacheMiss, expectedTicks: []common.Candlestick{}},
+	}
+	for _, ts := range tss {
+		t.Run(ts.name, func(t *testing.T) {
+			c := NewMemoryCache(map[time.Duration]int{time.Minute: 10})
+			c.SetRounding(ts.rounding)
+			require.Nil(t, c.Put(metric, []common.Candlestick{cstick1, cstick2}))
+
+			cs, err := c.Get(metric, ts.initialISO)
+			require.ErrorIs(t, err, ts.expectedErr)
+			require.Equal(t, ts.expectedTicks, cs)
+
+			cs, _, err = c.GetStrict(metric, ts.initialISO)
+			require.ErrorIs(t, err, ts.expectedErr)
+			require.Equal(t, ts.expectedTicks, cs)
+			require.Equal(t, 2, c.CacheRequests)
+		})
+	}
+}
+
+func TestPutRejectsInvalidCandlestick(t *testing.T) {
+	metric := Metric{Name: "test", CandlestickInterval: time.Minute}
+	lowAboveHigh := common.Candlestick{Timestamp: tInt("2020-01-02 00:00:00"), OpenPrice: 2, HighestPrice: 1, LowestPrice: 3, ClosePrice: 2}
+
+	c := NewMemoryCache(map[time.Duration]int{time.Minute: 10})
+	require.ErrorIs(t, c.Put(metric, []common.Candlestick{lowAboveHigh}), common.ErrInvalidCandlestick)
+}
+
+func TestPackedCacheKeepsSyntheticAndGaps(t *testing.T) {
+	c := NewMemoryCache(map[time.Duration]int{time.Minute: 128})
+	c.SetPacked(true)
+	metric := Metric{Name: "test", CandlestickInterval: time.Minute}
+	cstick1 := common.Candlestick{Timestamp: tInt("2020-01-02 00:00:00"), OpenPrice: 1, HighestPrice: 4, LowestPrice: 0.5, ClosePrice: 2}
+	cstick2 := common.Candlestick{Timestamp: tInt("2020-01-02 00:01:00"), OpenPrice: 2, HighestPrice: 2, LowestPrice: 2, ClosePrice: 2, Synthetic: true}
+	cstick4 := common.Candlestick{Timestamp: tInt("2020-01-02 00:03:00"), OpenPrice: 3, HighestPrice: 3, LowestPrice: 3, ClosePrice: 3}
+
+	require.Nil(t, c.Put(metric, []common.Candlestick{cstick1, cstick2}))
+	require.Nil(t, c.Put(metric, []common.Candlestick{cstick4}))
+
+	cs, complete, err := c.GetStrict(metric, tpToISO("2020-01-02 00:00:00"))
+	require.Nil(t, err)
+	require.Equal(t, []common.Candlestick{cstick1, cstick2}, cs)
+	require.False(t, complete)
+
+	// Overwriting a synthetic candlestick with a real one clears the flag.
+	cstick2.Synthetic = false
+	require.Nil(t, c.Put(metric, []common.Candlestick{cstick2}))
+	cs, err = c.Get(metric, tpToISO("2020-01-02 00:01:00"))
+	require.Nil(t, err)
+	require.Equal(t, []common.Candlestick{cstick2}, cs)
+}
+
+func TestSetPackedFitsMoreEntriesInByteBudget(t *testing.T) {
+	cstick := common.Candlestick{Timestamp: tInt("2020-01-02 00:00:00"), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+	for _, ts := range []struct {
+		packed          bool
+		expectedEntries int
+	}{
+		{packed: false, expectedEntries: 3},
+		{packed: true, expectedEntries: 4},
+	} {
+		c := NewMemoryCacheWithByteBudget(3 * estimatedEntryBytes)
+		c.SetPacked(ts.packed)
+		for i := 0; i < 4; i++ {
+			require.Nil(t, c.Put(Metric{Name: fmt.Sprint(i), CandlestickInterval: time.Minute}, []common.Candlestick{cstick}))
+		}
+		entries := 0
+		for i := 0; i < 4; i++ {
+			if _, err := c.Get(Metric{Name: fmt.Sprint(i), CandlestickInterval: time.Minute}, tpToISO("2020-01-02 00:00:00")); err == nil {
+				entries++
+			}
+		}
+		require.Equal(t, ts.expectedEntries, entries, "packed: %v", ts.packed)
+	}
+}
+
+func benchmarkMemoryCache(b *testing.B, packed bool) {
+	metric := Metric{Name: "test", CandlestickInterval: time.Minute}
+	startTs := tInt("2020-01-02 00:00:00")
+	candlesticks := make([]common.Candlestick, 10*entrySize)
+	for i := range candlesticks {
+		candlesticks[i] = common.Candlestick{Timestamp: startTs + i*60, OpenPrice: 1, HighestPrice: 2, LowestPrice: 0.5, ClosePrice: 1.5}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		c := NewMemoryCache(map[time.Duration]int{time.Minute: 128})
+		c.SetPacked(packed)
+		if err := c.Put(metric, candlesticks); err != nil {
+			b.Fatal(err)
+		}
+		for i := 0; i < len(candlesticks); i += entrySize {
+			if _, err := c.Get(metric, common.ISO8601(time.Unix(int64(candlesticks[i].Timestamp), 0).UTC().Format(time.RFC3339))); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkMemoryCache(b *testing.B)       { benchmarkMemoryCache(b, false) }
+func BenchmarkPackedMemoryCache(b *testing.B) { benchmarkMemoryCache(b, true) }
@@ -0,0 +1,92 @@
+package cache
+
+import (
+	"reflect"
+
+	"github.com/marianogappa/crypto-candles/candles/common"
+)
+
+// entrySize is the number of subsequent candlesticks that a cache entry spans.
+const entrySize = 500
+
+// entry is a cache entry, spanning entrySize subsequent candlesticks. Entries stored in the LRU are never modified, as
+// they may be being read concurrently: put modifies a copy and replaces them.
+type entry interface {
+	// candlestickAt returns the candlestick at the supplied index, or false if there's none.
+	candlestickAt(index int) (common.Candlestick, bool)
+
+	// setCandlestick stores the candlestick at the supplied index.
+	setCandlestick(index int, candlestick common.Candlestick)
+
+	// clone returns a copy of the entry that can be modified.
+	clone() entry
+}
+
+// structEntry is an entry stored as an array of candlesticks. It's the default.
+type structEntry [entrySize]common.Candlestick
+
+func (e *structEntry) candlestickAt(index int) (common.Candlestick, bool) {
+	return e[index], e[index] != (common.Candlestick{})
+}
+
+func (e *structEntry) setCandlestick(index int, candlestick common.Candlestick) {
+	e[index] = candlestick
+}
+
+func (e *structEntry) clone() entry {
+	cloned := *e
+	return &cloned
+}
+
+// packedEntry is an entry stored in columns (see SetPacked). Timestamps are implied by the index, and presence and
+// Synthetic are stored as bitsets, so that it takes about two thirds of the memory of a structEntry.
+type packedEntry struct {
+	firstTimestamp int
+	intervalSecs   int
+	open           [entrySize]float64
+	close          [entrySize]float64
+	low            [entrySize]float64
+	high           [entrySize]float64
+	present        [(entrySize + 63) / 64]uint64
+	synthetic      [(entrySize + 63) / 64]uint64
+}
+
+func (e *packedEntry) candlestickAt(index int) (common.Candlestick, bool) {
+	if e.present[index/64]&(1<<(index%64)) == 0 {
+		return common.Candlestick{}, false
+	}
+	return common.Candlestick{
+		Timestamp:    e.firstTimestamp + index*e.intervalSecs,
+		OpenPrice:    common.JSONFloat64(e.open[index]),
+		ClosePrice:   common.JSONFloat64(e.close[index]),
+		LowestPrice:  common.JSONFloat64(e.low[index]),
+		HighestPrice: common.JSONFloat64(e.high[index]),
+		Synthetic:    e.synthetic[index/64]&(1<<(index%64)) != 0,
+	}, true
+}
+
+func (e *packedEntry) setCandlestick(index int, candlestick common.Candlestick) {
+	e.open[index] = float64(candlestick.OpenPrice)
+	e.close[index] = float64(candlestick.ClosePrice)
+	e.low[index] = float64(candlestick.LowestPrice)
+	e.high[index] = float64(candlestick.HighestPrice)
+	e.present[index/64] |= 1 << (index % 64)
+	if candlestick.Synthetic {
+		e.synthetic[index/64] |= 1 << (index % 64)
+	} else {
+		e.synthetic[index/64] &^= 1 << (index % 64)
+	}
+}
+
+func (e *packedEntry) clone() entry {
+	cloned := *e
+	return &cloned
+}
+
+var (
+	// estimatedEntryBytes is the estimated memory footprint of a cache entry, i.e. of 500 candlesticks.
+	estimatedEntryBytes = int(reflect.TypeOf(structEntry{}).Size())
+
+	// estimatedPackedEntryBytes is the estimated memory footprint of a packed cache entry (see SetPacked).
+	estimatedPackedEntryBytes = int(reflect.TypeOf(packedEntry{}).Size())
+)
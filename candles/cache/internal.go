@@ -8,34 +8,51 @@ import (
 )
 
 func (c *MemoryCache) put(metric Metric, candlesticks []common.Candlestick) error {
-	var lastTimestamp int
+	var (
+		lastTimestamp int
+		currentKey    string
+		current       entry
+	)
+	cache, _ := c.lruFor(metric.CandlestickInterval)
+	// Subsequent candlesticks usually fall in the same entry, so each entry is copied and replaced once per put.
+	flush := func() {
+		if current != nil {
+			cache.Add(currentKey, current)
+		}
+	}
+	defer flush()
+
 	for i, candlestick := range candlesticks {
-		if lastTimestamp != 0 && candlestick.Timestamp-lastTimestamp != int(metric.CandlestickInterval/time.Second) {
+		if lastTimestamp != 0 && candlestick.Timestamp-lastTimestamp != common.IntervalToSeconds(metric.CandlestickInterval) {
 			lastDateTime := time.Unix(int64(lastTimestamp), 0).UTC().Format(time.Kitchen)
 			thisDateTime := time.Unix(int64(candlestick.Timestamp), 0).UTC().Format(time.Kitchen)
 			return fmt.Errorf("%w: last date was %v and this was %v", ErrReceivedNonSubsequentCandlestick, lastDateTime, thisDateTime)
 		}
-		if candlestick.OpenPrice == 0 || candlestick.HighestPrice == 0 || candlestick.LowestPrice == 0 || candlestick.ClosePrice == 0 {
+		if c.zeroCheck.rejects(candlestick) {
 			return ErrReceivedCandlestickWithZeroValue
 		}
+		if err := candlestick.IsValid(); err != nil {
+			return err
+		}
 
 		var (
 			candlestickTime = time.Unix(int64(candlestick.Timestamp), 0)
-			truncatedTime   = candlestickTime.Truncate(metric.CandlestickInterval * 500)
-			key             = fmt.Sprintf("%v-%v-%v", metric.Name, metric.CandlestickInterval.String(), truncatedTime.Format(time.RFC3339))
+			truncatedTime   = candlestickTime.Truncate(metric.CandlestickInterval * entrySize)
+			key             = entryKey(metric, truncatedTime)
 			index           = int(candlestickTime.Sub(truncatedTime) / metric.CandlestickInterval)
 		)
 		if i == 0 && candlestickTime != truncatedTime.Add(time.Duration(index)*metric.CandlestickInterval) {
 			return ErrTimestampMustBeMultipleOfCandlestickInterval
 		}
 
-		elem, ok := c.caches[metric.CandlestickInterval].Get(key)
-		if !ok {
-			elem = [500]common.Candlestick{}
+		if key != currentKey || current == nil {
+			flush()
+			currentKey, current = key, c.newEntry(metric, truncatedTime)
+			if elem, ok := cache.Get(key); ok {
+				current = elem.(entry).clone()
+			}
 		}
-		typedElem := elem.([500]common.Candlestick)
-		typedElem[index] = candlestick
-		c.caches[metric.CandlestickInterval].Add(key, typedElem)
+		current.setCandlestick(index, candlestick)
 
 		lastTimestamp = candlestick.Timestamp
 	}
@@ -43,31 +60,108 @@ func (c *MemoryCache) put(metric Metric, candlesticks []common.Candlestick) erro
 	return nil
 }
 
-func (c *MemoryCache) get(metric Metric, startingTimestamp int) ([]common.Candlestick, error) {
+// validate checks the candlesticks for the same errors that put fails with, without storing them.
+func validate(metric Metric, candlesticks []common.Candlestick, zeroCheck ZeroCheck) error {
+	intervalSecs := common.IntervalToSeconds(metric.CandlestickInterval)
+	for i, candlestick := range candlesticks {
+		if i > 0 && candlestick.Timestamp-candlesticks[i-1].Timestamp != intervalSecs {
+			lastDateTime := time.Unix(int64(candlesticks[i-1].Timestamp), 0).UTC().Format(time.Kitchen)
+			thisDateTime := time.Unix(int64(candlestick.Timestamp), 0).UTC().Format(time.Kitchen)
+			return fmt.Errorf("%w: last date was %v and this was %v", ErrReceivedNonSubsequentCandlestick, lastDateTime, thisDateTime)
+		}
+		if zeroCheck.rejects(candlestick) {
+			return ErrReceivedCandlestickWithZeroValue
+		}
+		if err := candlestick.IsValid(); err != nil {
+			return err
+		}
+	}
+	if len(candlesticks) > 0 {
+		candlestickTime := time.Unix(int64(candlesticks[0].Timestamp), 0)
+		if candlestickTime != candlestickTime.Truncate(metric.CandlestickInterval) {
+			return ErrTimestampMustBeMultipleOfCandlestickInterval
+		}
+	}
+	return nil
+}
+
+// startingTimestamp returns the timestamp of the first candlestick that Get retrieves for the supplied datetime, as
+// configured by SetRounding, or false if there's none.
+func (c *MemoryCache) startingTimestamp(tm time.Time, candlestickInterval time.Duration) (int, bool) {
+	switch c.rounding {
+	case RoundDown:
+		return int(common.FloorToInterval(tm, candlestickInterval, "TODO_PROVIDER").Unix()), true
+	case RoundExact:
+		floor := common.FloorToInterval(tm, candlestickInterval, "TODO_PROVIDER")
+		return int(floor.Unix()), floor.Equal(tm)
+	default:
+		return common.NormalizeTimestamp(tm, candlestickInterval, "TODO_PROVIDER", false), true
+	}
+}
+
+func (c *MemoryCache) get(metric Metric, startingTimestamp int) ([]common.Candlestick, bool, error) {
 	var (
 		candlestickTime = time.Unix(int64(startingTimestamp), 0)
-		truncatedTime   = candlestickTime.Truncate(metric.CandlestickInterval * 500)
-		key             = fmt.Sprintf("%v-%v-%v", metric.Name, metric.CandlestickInterval.String(), truncatedTime.Format(time.RFC3339))
+		truncatedTime   = candlestickTime.Truncate(metric.CandlestickInterval * entrySize)
+		key             = entryKey(metric, truncatedTime)
 		index           = int(candlestickTime.Sub(truncatedTime) / metric.CandlestickInterval)
 		candlesticks    = []common.Candlestick{}
 	)
 
-	elem, ok := c.caches[metric.CandlestickInterval].Get(key)
+	cache, _ := c.lruFor(metric.CandlestickInterval)
+	elem, ok := cache.Get(key)
 	if !ok {
 		c.CacheMisses++
-		return []common.Candlestick{}, ErrCacheMiss
+		return []common.Candlestick{}, false, ErrCacheMiss
 	}
-	typedElem := elem.([500]common.Candlestick)
-	for i := index; i <= 499; i++ {
-		if typedElem[i] == (common.Candlestick{}) {
+	typedElem := elem.(entry)
+	i := index
+	for ; i < entrySize; i++ {
+		candlestick, ok := typedElem.candlestickAt(i)
+		if !ok {
 			break
 		}
-		candlesticks = append(candlesticks, typedElem[i])
+		candlesticks = append(candlesticks, candlestick)
 	}
 
 	if len(candlesticks) == 0 {
 		c.CacheMisses++
-		return candlesticks, ErrCacheMiss
+		return candlesticks, false, ErrCacheMiss
+	}
+	return candlesticks, !c.hasCandlesticksAfter(metric, truncatedTime, typedElem, i), nil
+}
+
+// hasCandlesticksAfter returns true if there are cached candlesticks after the supplied index of the entry, either in
+// the entry itself or in the next one, i.e. if a run of candlesticks that stopped at that index stopped at a gap.
+func (c *MemoryCache) hasCandlesticksAfter(metric Metric, truncatedTime time.Time, e entry, index int) bool {
+	if index >= entrySize {
+		return false
+	}
+	if hasCandlesticksFrom(e, index) {
+		return true
 	}
-	return candlesticks, nil
+	cache, _ := c.lruFor(metric.CandlestickInterval)
+	elem, ok := cache.Peek(entryKey(metric, truncatedTime.Add(metric.CandlestickInterval*entrySize)))
+	return ok && hasCandlesticksFrom(elem.(entry), 0)
+}
+
+func hasCandlesticksFrom(e entry, index int) bool {
+	for i := index; i < entrySize; i++ {
+		if _, ok := e.candlestickAt(i); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// newEntry returns an empty entry for the candlesticks starting at truncatedTime, packed if the cache is.
+func (c *MemoryCache) newEntry(metric Metric, truncatedTime time.Time) entry {
+	if c.packed {
+		return &packedEntry{firstTimestamp: int(truncatedTime.Unix()), intervalSecs: common.IntervalToSeconds(metric.CandlestickInterval)}
+	}
+	return &structEntry{}
+}
+
+func entryKey(metric Metric, truncatedTime time.Time) string {
+	return fmt.Sprintf("%v-%v-%v", metric.Name, metric.CandlestickInterval.String(), truncatedTime.Format(time.RFC3339))
 }
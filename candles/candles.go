@@ -48,7 +48,9 @@
 package candles
 
 import (
+	"errors"
 	"fmt"
+	"net/http"
 	"strings"
 	"time"
 
@@ -59,6 +61,7 @@ import (
 	"github.com/marianogappa/crypto-candles/candles/cache"
 	"github.com/marianogappa/crypto-candles/candles/coinbase"
 	"github.com/marianogappa/crypto-candles/candles/common"
+	"github.com/marianogappa/crypto-candles/candles/cryptocom"
 	"github.com/marianogappa/crypto-candles/candles/iterator"
 	"github.com/marianogappa/crypto-candles/candles/kucoin"
 )
@@ -68,14 +71,35 @@ import (
 // The Market guarantees that no two requests to the same exchange happen concurrently, and owns the cache, so you
 // should only construct a Market once.
 type Market struct {
-	cache     *cache.MemoryCache
-	exchanges map[string]common.Exchange
-	debug     bool
+	cache                  *cache.MemoryCache
+	exchanges              map[string]common.Exchange
+	debug                  bool
+	providerAgnosticCache  bool
+	cacheZeroCheck         cache.ZeroCheck
+	packedCache            bool
+	providerFallback       []string
+	autoResample           bool
+	flatHoles              bool
+	maxConsecutiveHoles    int
+	closeTimestamps        bool
+	priceDecimals          int
+	finalOnly              bool
+	strictTimestamps       bool
+	descending             bool
+	blockOnRateLimit       bool
+	maxRateLimitWait       time.Duration
+	rateLimitBreakerPause  time.Duration
+	timeNowFunc            func() time.Time
+	marketListTTL          time.Duration
+	marketLists            *marketListCache
+	earliestCandles        *earliestCandleCache
+	marketSourceNormalizer MarketSourceNormalizer
+	observer               common.Observer
 }
 
 // NewMarket constructs a Market.
 func NewMarket(options ...func(*Market)) Market {
-	m := Market{exchanges: buildExchanges()}
+	m := Market{exchanges: buildExchanges(), timeNowFunc: time.Now, marketListTTL: DefaultMarketListTTL, marketLists: newMarketListCache(), earliestCandles: newEarliestCandleCache(), observer: common.NoOpObserver{}, maxRateLimitWait: DefaultMaxRateLimitWait, priceDecimals: -1}
 
 	for _, option := range options {
 		option(&m)
@@ -83,6 +107,22 @@ func NewMarket(options ...func(*Market)) Market {
 	if m.cache == nil {
 		m.cache = buildDefaultCache()
 	}
+	m.cache.SetZeroCheck(m.cacheZeroCheck)
+	m.cache.SetPacked(m.packedCache)
+	if m.blockOnRateLimit {
+		for _, exchange := range m.exchanges {
+			if configurable, ok := exchange.(common.ConfigurableExchange); ok {
+				configurable.SetMaxRateLimitWait(m.maxRateLimitWait)
+			}
+		}
+	}
+	if m.rateLimitBreakerPause > 0 {
+		for _, exchange := range m.exchanges {
+			if breakerProvider, ok := exchange.(common.RateLimitBreakerProvider); ok {
+				breakerProvider.RateLimitBreaker().SetMaxPause(m.rateLimitBreakerPause)
+			}
+		}
+	}
 
 	return m
 }
@@ -94,16 +134,530 @@ func WithCacheSizes(cacheSizes map[time.Duration]int) func(*Market) {
 	}
 }
 
+// WithCacheByteBudget configures the cache for the market instance at construction time, bounded by an approximate
+// total memory footprint in bytes, rather than by a number of entries per candlestick interval (see WithCacheSizes).
+//
+// All candlestick intervals share a single, global LRU cache, so when over budget the least recently used entry is
+// evicted, regardless of its candlestick interval.
+func WithCacheByteBudget(bytes int) func(*Market) {
+	return func(m *Market) {
+		m.cache = cache.NewMemoryCacheWithByteBudget(bytes)
+	}
+}
+
+// WithNoCache disables the cache for the market instance, i.e. every candlestick is requested to the exchanges. Note
+// that Prefetch fails without a cache.
+func WithNoCache() func(*Market) {
+	return func(m *Market) {
+		m.cache = cache.NewNoOpMemoryCache()
+	}
+}
+
+// WithCacheZeroCheck configures which candlesticks the cache refuses to store because of zero prices. By default
+// (cache.ZeroCheckAnyOHLC), candlesticks with any zero OHLC component are not cached. Use cache.ZeroCheckAllOHLC or
+// cache.ZeroCheckNone for low-priced assets whose prices may legitimately round to zero.
+func WithCacheZeroCheck(zeroCheck cache.ZeroCheck) func(*Market) {
+	return func(m *Market) {
+		m.cacheZeroCheck = zeroCheck
+	}
+}
+
+// WithPackedCache makes the cache store candlesticks in a packed columnar form, which takes about a third less memory
+// at the cost of decoding them on every cache hit (see cache.MemoryCache.SetPacked).
+func WithPackedCache(packed bool) func(*Market) {
+	return func(m *Market) {
+		m.packedCache = packed
+	}
+}
+
+// WithProviderAgnosticCache makes the cache key ignore the provider, i.e. candlesticks are cached by (base asset,
+// quote asset, candlestick interval), so that e.g. BINANCE BTC/USDT and COINBASE BTC/USDT share cache entries.
+//
+// Only use this if you treat all exchanges as the same price series; values from different exchanges are slightly
+// different. By default, the cache is provider-specific.
+func WithProviderAgnosticCache() func(*Market) {
+	return func(m *Market) {
+		m.providerAgnosticCache = true
+	}
+}
+
+// WithProviderFallback configures a chain of providers (e.g. BINANCE, COINBASE, KUCOIN) for Iterators to fall back on
+// when their market source's provider fails with a retryable error (e.g. rate limiting, connection errors), for the
+// same market pair. Only applies to Iterators whose provider is in the chain; the rest of the chain is tried in order.
+//
+// Use the Iterator's LastProvider() to know which provider actually served each candlestick. Note that candlesticks
+// served by a fallback provider are cached as if they were served by the iterator's provider.
+func WithProviderFallback(providers []string) func(*Market) {
+	return func(m *Market) {
+		m.providerFallback = providers
+	}
+}
+
+// WithAutoResample makes Iterators support candlestick intervals that their provider doesn't support (e.g. 2h on
+// Kucoin, or 160m anywhere), by requesting the closest smaller supported interval that divides it evenly, and
+// resampling its candlesticks on the fly. Iterators still fail with ErrUnsupportedCandlestickInterval if there's no
+// such interval.
+func WithAutoResample(autoResample bool) func(*Market) {
+	return func(m *Market) {
+		m.autoResample = autoResample
+	}
+}
+
+// WithFlatHoles makes Iterators return the candlesticks that were patched in to fill holes left by the exchange (e.g.
+// on illiquid markets without trades) as flat candlesticks at the previous candlestick's close price. Patched-in
+// candlesticks are always marked as Synthetic, with or without this option.
+func WithFlatHoles(flatHoles bool) func(*Market) {
+	return func(m *Market) {
+		m.flatHoles = flatHoles
+	}
+}
+
+// WithMaxConsecutiveHoles makes Iterators (and so RequestRange) fail with common.ErrTooManyConsecutiveHoles rather
+// than return runs of more than the supplied number of consecutive candlesticks that were patched in to fill holes
+// (e.g. during an exchange's maintenance halt), so that fabricated data isn't mistaken for real data. The next call
+// to an Iterator's Next resumes after the run. Zero (default) means that there's no limit. See iterator.Impl.SetMaxConsecutiveHoles.
+func WithMaxConsecutiveHoles(maxConsecutiveHoles int) func(*Market) {
+	return func(m *Market) {
+		m.maxConsecutiveHoles = maxConsecutiveHoles
+	}
+}
+
+// WithCloseTimestamps makes Iterators (and Latest) set the CloseTimestamp of the candlesticks they return, e.g. to
+// reason about the exact span of monthly candlesticks. See common.CloseTimestamp.
+func WithCloseTimestamps(closeTimestamps bool) func(*Market) {
+	return func(m *Market) {
+		m.closeTimestamps = closeTimestamps
+	}
+}
+
+// WithPriceDecimals makes Iterators (and Latest, RequestRange & friends) round the prices of the candlesticks they
+// return to the supplied number of decimals, e.g. to the market's price precision, so that charts don't show float
+// artifacts like 96021.20000000001. The cache keeps the prices as the exchange returned them. Negative decimals
+// (default) disable rounding. See common.Candlestick.RoundPrices.
+func WithPriceDecimals(decimals int) func(*Market) {
+	return func(m *Market) {
+		m.priceDecimals = decimals
+	}
+}
+
+// WithFinalOnly makes Iterators drop the candlesticks that may not be final yet, i.e. those that closed less than
+// their provider's patience ago, even if the exchange returned them (e.g. the currently open candlestick). It's a
+// single knob for all providers; use WithPatience or WithIntervalPatience to tune each provider's patience.
+func WithFinalOnly(finalOnly bool) func(*Market) {
+	return func(m *Market) {
+		m.finalOnly = finalOnly
+	}
+}
+
+// WithStrictTimestamps makes Market.Iterator fail with common.ErrUnalignedStartTime if the start time is not already
+// aligned to the candlestick interval (as per common.Anchor.Floor), rather than silently rounding it up to the next
+// candlestick. Defaults to false.
+func WithStrictTimestamps(strictTimestamps bool) func(*Market) {
+	return func(m *Market) {
+		m.strictTimestamps = strictTimestamps
+	}
+}
+
+// WithDescendingOrder makes RequestRange, RequestRangeColumns and RequestMultiInterval return the most recent
+// candlestick first. Candlesticks are still requested and cached in ascending order; they are only reversed on return.
+// Iterators are not affected. Defaults to false.
+func WithDescendingOrder(descending bool) func(*Market) {
+	return func(m *Market) {
+		m.descending = descending
+	}
+}
+
+// WithClock overrides time.Now() for the whole Market, i.e. for its iterators (see iterator.SetTimeNowFunc), Latest,
+// Prefetch and Ping. Current time is used to decide which candlesticks are available (or final) yet, so this makes
+// time-dependent behaviour deterministic, e.g. in tests.
+func WithClock(timeNowFunc func() time.Time) func(*Market) {
+	return func(m *Market) {
+		m.timeNowFunc = timeNowFunc
+	}
+}
+
+// WithMetricsObserver makes the Market notify the supplied observer of every candlestick request to the exchanges and of
+// every cache lookup, e.g. to expose request counts, errors by Kind, latencies and cache hit ratios to Prometheus. The
+// default observer does nothing.
+func WithMetricsObserver(observer common.Observer) func(*Market) {
+	return func(m *Market) {
+		m.observer = observer
+	}
+}
+
+// WithPatience overrides the patience of the given provider (e.g. BINANCE), i.e. how long to wait after a candlestick
+// closes before requesting it, for candlestick intervals without a specific patience (see WithIntervalPatience).
+// Unknown providers, and providers that don't implement common.PatienceConfigurable, are ignored.
+func WithPatience(provider string, patience time.Duration) func(*Market) {
+	return func(m *Market) {
+		if configurable, ok := m.exchanges[strings.ToUpper(provider)].(common.PatienceConfigurable); ok {
+			configurable.SetPatience(patience)
+		}
+	}
+}
+
+// WithIntervalPatience overrides the patience of the given provider (e.g. BINANCE) for the given candlestick interval,
+// since e.g. daily candlesticks may take longer to be final than minutely ones. Unknown providers, and providers that
+// don't implement common.PatienceConfigurable, are ignored.
+func WithIntervalPatience(provider string, candlestickInterval time.Duration, patience time.Duration) func(*Market) {
+	return func(m *Market) {
+		if configurable, ok := m.exchanges[strings.ToUpper(provider)].(common.PatienceConfigurable); ok {
+			configurable.SetIntervalPatience(candlestickInterval, patience)
+		}
+	}
+}
+
+// ProviderOption configures a single provider, see WithProviderOption.
+type ProviderOption func(common.Exchange)
+
+// ProviderRetryStrategy overrides the provider's retry strategy for failed requests. Zero fields take their defaults.
+func ProviderRetryStrategy(strategy common.RetryStrategy) ProviderOption {
+	return func(exchange common.Exchange) {
+		if configurable, ok := exchange.(common.ConfigurableExchange); ok {
+			configurable.SetRetryStrategy(strategy)
+		}
+	}
+}
+
+// ProviderAPIURL overrides the provider's API base URL (which must end with a slash), e.g. to point it to a proxy.
+func ProviderAPIURL(apiURL string) ProviderOption {
+	return func(exchange common.Exchange) {
+		if configurable, ok := exchange.(common.ConfigurableExchange); ok {
+			configurable.SetAPIURL(apiURL)
+		}
+	}
+}
+
+// ProviderHTTPClient overrides the HTTP client used to request the provider, e.g. to change its 10 second timeout.
+func ProviderHTTPClient(client *http.Client) ProviderOption {
+	return func(exchange common.Exchange) {
+		if configurable, ok := exchange.(common.ConfigurableExchange); ok {
+			configurable.SetHTTPClient(client)
+		}
+	}
+}
+
+// ProviderPatience overrides the provider's patience, like WithPatience.
+func ProviderPatience(patience time.Duration) ProviderOption {
+	return func(exchange common.Exchange) {
+		if configurable, ok := exchange.(common.PatienceConfigurable); ok {
+			configurable.SetPatience(patience)
+		}
+	}
+}
+
+// ProviderUTCOffset anchors the provider's candlesticks to midnight at the given UTC offset rather than to UTC midnight,
+// for exchanges whose daily (and longer) candlesticks follow a local session, e.g. 9*time.Hour for 00:00 KST (see
+// common.Anchor.WithUTCOffset). It only affects this Market.
+func ProviderUTCOffset(offset time.Duration) ProviderOption {
+	return func(exchange common.Exchange) {
+		if configurable, ok := exchange.(common.AnchorConfigurable); ok {
+			configurable.SetAnchor(configurable.Anchor().WithUTCOffset(offset))
+		}
+	}
+}
+
+// ProviderWeekStart sets the weekday on which the provider's weekly candlesticks start, as exchanges disagree (see
+// common.Anchor.WithWeekStart). It only affects this Market.
+func ProviderWeekStart(weekday time.Weekday) ProviderOption {
+	return func(exchange common.Exchange) {
+		if configurable, ok := exchange.(common.AnchorConfigurable); ok {
+			configurable.SetAnchor(configurable.Anchor().WithWeekStart(weekday))
+		}
+	}
+}
+
+// ProviderMaxInFlightRequests caps the provider's concurrent HTTP requests, e.g. so that many iterators fanning out
+// don't open dozens of connections to it; further requests wait for a slot. Zero means no limit. Defaults to
+// common.DefaultMaxInFlightRequests.
+func ProviderMaxInFlightRequests(maxInFlight int) ProviderOption {
+	return func(exchange common.Exchange) {
+		if limited, ok := exchange.(common.InFlightLimitedProvider); ok {
+			limited.SetMaxInFlightRequests(maxInFlight)
+		}
+	}
+}
+
+// ProviderRawBodyMaxBytes caps the response body attached to the provider's KindBadData errors (see
+// common.CandleReqError.RawBody). Zero disables it. Defaults to common.DefaultRawBodyMaxBytes.
+func ProviderRawBodyMaxBytes(maxBytes int) ProviderOption {
+	return func(exchange common.Exchange) {
+		if limited, ok := exchange.(common.RawBodyLimitedProvider); ok {
+			limited.SetRawBodyMaxBytes(maxBytes)
+		}
+	}
+}
+
+// WithProviderOption configures the given provider (e.g. BINANCE) with the supplied options, in order. Unknown
+// providers are ignored, as are options that don't apply to providers registered with RegisterProvider.
+func WithProviderOption(provider string, options ...ProviderOption) func(*Market) {
+	return func(m *Market) {
+		exchange, ok := m.exchanges[strings.ToUpper(provider)]
+		if !ok {
+			return
+		}
+		for _, option := range options {
+			option(exchange)
+		}
+	}
+}
+
+// WithRetryStrategy overrides the retry strategy for failed requests of all providers. Use WithProviderOption and
+// ProviderRetryStrategy to override it for a single provider.
+func WithRetryStrategy(strategy common.RetryStrategy) func(*Market) {
+	return func(m *Market) {
+		for _, exchange := range m.exchanges {
+			ProviderRetryStrategy(strategy)(exchange)
+		}
+	}
+}
+
+// DefaultMaxRateLimitWait is how long a rate limited request blocks at most with WithBlockOnRateLimit, unless
+// WithMaxRateLimitWait says otherwise.
+const DefaultMaxRateLimitWait = time.Minute
+
+// WithBlockOnRateLimit makes rate limited requests to all providers sleep for exactly the time the exchange asked for
+// and retry (within the retry strategy's attempts), rather than backing off exponentially. Requests only fail with
+// common.ErrRateLimit if the attempts run out, or if the exchange asks to wait longer than WithMaxRateLimitWait.
+// Defaults to false.
+func WithBlockOnRateLimit(block bool) func(*Market) {
+	return func(m *Market) {
+		m.blockOnRateLimit = block
+	}
+}
+
+// WithMaxRateLimitWait caps how long a rate limited request blocks with WithBlockOnRateLimit. Defaults to
+// DefaultMaxRateLimitWait.
+func WithMaxRateLimitWait(maxWait time.Duration) func(*Market) {
+	return func(m *Market) {
+		m.maxRateLimitWait = maxWait
+	}
+}
+
+// WithRateLimitBreaker makes every request of this Market to a provider pause once the provider rate limits any of
+// them, until the RetryAfter it asked for elapses, so that concurrent iterators don't each retry into the limit.
+// Requests wait for up to maxPause; if the provider asked to wait longer, they fail right away with a retryable
+// common.ErrRateLimit (so that iterators fall back on other providers, see WithProviderFallback). Zero disables it,
+// which is the default. See RateLimitBreakerState.
+func WithRateLimitBreaker(maxPause time.Duration) func(*Market) {
+	return func(m *Market) {
+		m.rateLimitBreakerPause = maxPause
+	}
+}
+
 // Iterator returns a market iterator for a given operand at a given time and for a given candlestick interval.
+//
+// The market source and candlestick interval are validated before building the iterator, without requesting the
+// exchange:
+//
+// * Fails with ErrInvalidMarketType if the market source's type is neither COIN nor PERPETUAL.
+// * Fails with ErrEmptyProvider or ErrUnsuportedCandlestickProvider if the market source's provider is empty or not
+// supported.
+// * Fails with ErrEmptyBaseAsset or ErrEmptyQuoteAsset (both of which are also ErrEmptyAsset) if an asset is empty.
+// * Fails with ErrUnsupportedCandlestickInterval if the candlestick interval is not a positive whole number of seconds.
 func (m Market) Iterator(marketSource common.MarketSource, startTime time.Time, candlestickInterval time.Duration) (iterator.Iterator, error) {
-	if marketSource.Type != common.COIN {
+	marketSource = m.normalize(marketSource)
+	exchange, err := m.getExchange(marketSource)
+	if err != nil {
+		return nil, err
+	}
+	if err := marketSource.Validate(); err != nil {
+		return nil, err
+	}
+	if common.IntervalToSeconds(candlestickInterval) == 0 {
+		return nil, fmt.Errorf("%w: %v is not a positive whole number of seconds", common.ErrUnsupportedCandlestickInterval, candlestickInterval)
+	}
+	if m.strictTimestamps {
+		if aligned := common.AnchorOf(exchange).Floor(startTime, candlestickInterval); !aligned.Equal(startTime) {
+			return nil, fmt.Errorf("%w: %v is not a multiple of %v (previous boundary is %v)", common.ErrUnalignedStartTime, startTime.UTC().Format(time.RFC3339Nano), candlestickInterval, aligned.Format(time.RFC3339))
+		}
+	}
+	requestInterval, err := m.requestInterval(exchange, candlestickInterval)
+	if err != nil {
+		return nil, err
+	}
+	iter, err := iterator.NewIterator(marketSource, startTime, requestInterval, m.cache, exchange)
+	if err != nil {
+		return nil, err
+	}
+	if requestInterval != candlestickInterval {
+		if err := iter.SetResampleInterval(candlestickInterval); err != nil {
+			return nil, err
+		}
+	}
+	iter.SetCacheMetricName(m.cacheMetric(marketSource, candlestickInterval).Name)
+	iter.SetFlatHoles(m.flatHoles)
+	iter.SetMaxConsecutiveHoles(m.maxConsecutiveHoles)
+	iter.SetCloseTimestamps(m.closeTimestamps)
+	iter.SetPriceDecimals(m.priceDecimals)
+	iter.SetFinalOnly(m.finalOnly)
+	iter.SetTimeNowFunc(m.timeNowFunc)
+	iter.SetObserver(m.observer)
+	fallbackProviders, err := m.getFallbackProviders(marketSource)
+	if err != nil {
+		return nil, err
+	}
+	iter.SetFallbackProviders(fallbackProviders...)
+	return iter, nil
+}
+
+// Latest returns the most recent finalized candlestick for the given market source and candlestick interval, i.e. the
+// latest candlestick that has closed, taking into account the provider's patience.
+//
+// If the exchange implements LatestCandlestickProvider, the start time is omitted from the request, and the exchange's
+// most recent candlesticks are used instead; if it also implements LimitedLatestCandlestickProvider, only the few
+// candlesticks since the latest finalized one are requested. Otherwise, an Iterator is used.
+//
+// * Fails like Iterator if the market source is invalid.
+// * Fails with ErrNoNewTicksYet if the exchange doesn't have that candlestick yet.
+func (m Market) Latest(marketSource common.MarketSource, candlestickInterval time.Duration) (common.Candlestick, error) {
+	marketSource = m.normalize(marketSource)
+	if err := marketSource.Validate(); err != nil {
+		return common.Candlestick{}, err
+	}
+	exchange, err := m.getExchange(marketSource)
+	if err != nil {
+		return common.Candlestick{}, err
+	}
+	startTime := common.AnchorOf(exchange).Floor(m.timeNowFunc().Add(-common.PatienceFor(exchange, candlestickInterval)-candlestickInterval), candlestickInterval)
+	if latestProvider, ok := exchange.(common.LatestCandlestickProvider); ok && !m.needsResample(exchange, candlestickInterval) {
+		return m.latestWithoutStartTime(exchange, latestProvider, marketSource, startTime, candlestickInterval)
+	}
+	iter, err := m.Iterator(marketSource, startTime, candlestickInterval)
+	if err != nil {
+		return common.Candlestick{}, err
+	}
+	candlestick, err := iter.Next()
+	if errors.Is(err, common.ErrOutOfCandlesticks) || errors.Is(err, common.ErrExchangeReturnedNoTicks) {
+		return common.Candlestick{}, fmt.Errorf("%w: %v", common.ErrNoNewTicksYet, err)
+	}
+	return candlestick, err
+}
+
+func (m Market) latestWithoutStartTime(exchange common.Exchange, provider common.LatestCandlestickProvider, marketSource common.MarketSource, startTime time.Time, candlestickInterval time.Duration) (common.Candlestick, error) {
+	var (
+		candlesticks []common.Candlestick
+		err          error
+	)
+	requestStart := time.Now()
+	if limitedProvider, ok := provider.(common.LimitedLatestCandlestickProvider); ok {
+		// Enough to reach back from the current (unfinished) candlestick to the one at the start time, plus one in case
+		// a new candlestick starts in the meantime.
+		limit := int(m.timeNowFunc().Sub(startTime)/candlestickInterval) + 2
+		candlesticks, err = limitedProvider.RequestLatestCandlesticksLimit(marketSource, candlestickInterval, limit)
+	} else {
+		candlesticks, err = provider.RequestLatestCandlesticks(marketSource, candlestickInterval)
+	}
+	m.observer.ObserveRequest(exchange.Name(), candlestickInterval, time.Since(requestStart), err)
+	if errors.Is(err, common.ErrOutOfCandlesticks) || errors.Is(err, common.ErrExchangeReturnedNoTicks) {
+		return common.Candlestick{}, fmt.Errorf("%w: %v", common.ErrNoNewTicksYet, err)
+	}
+	if err != nil {
+		return common.Candlestick{}, err
+	}
+
+	// Candlesticks after the start time may not have finished yet, so they are discarded.
+	startTimeTs := int(startTime.Unix())
+	for len(candlesticks) > 0 && candlesticks[len(candlesticks)-1].Timestamp > startTimeTs {
+		candlesticks = candlesticks[:len(candlesticks)-1]
+	}
+	if len(candlesticks) == 0 || candlesticks[len(candlesticks)-1].Timestamp != startTimeTs {
+		return common.Candlestick{}, common.ErrNoNewTicksYet
+	}
+
+	// Finished candlesticks are worth caching. Failing to do so is not a reason to fail.
+	_ = m.cache.Put(m.cacheMetric(marketSource, candlestickInterval), candlesticks)
+
+	candlestick := candlesticks[len(candlesticks)-1]
+	if m.closeTimestamps {
+		candlestick.CloseTimestamp = common.AnchorOf(exchange).CloseTimestamp(candlestick.Timestamp, candlestickInterval)
+	}
+	return candlestick.RoundPrices(m.priceDecimals), nil
+}
+
+// perpetualProviders maps provider names to the provider that serves their perpetual futures markets.
+var perpetualProviders = map[string]string{
+	common.BINANCE:            common.BINANCEUSDMFUTURES,
+	common.BINANCEUSDMFUTURES: common.BINANCEUSDMFUTURES,
+}
+
+func (m Market) getExchange(marketSource common.MarketSource) (common.Exchange, error) {
+	provider := strings.ToUpper(marketSource.Provider)
+	if marketSource.Type != common.COIN && marketSource.Type != common.PERPETUAL {
 		return nil, common.ErrInvalidMarketType
 	}
-	exchange := m.exchanges[strings.ToUpper(marketSource.Provider)]
+	if strings.TrimSpace(provider) == "" {
+		return nil, common.ErrEmptyProvider
+	}
+	if marketSource.Type == common.PERPETUAL {
+		perpetualProvider, ok := perpetualProviders[provider]
+		if !ok {
+			return nil, fmt.Errorf("%w: the '%v' provider does not support PERPETUAL markets", common.ErrUnsuportedCandlestickProvider, marketSource.Provider)
+		}
+		provider = perpetualProvider
+	}
+	exchange := m.exchanges[provider]
 	if exchange == nil {
 		return nil, fmt.Errorf("%w: the '%v' provider is not supported", common.ErrUnsuportedCandlestickProvider, marketSource.Provider)
 	}
-	return iterator.NewIterator(marketSource, startTime, candlestickInterval, m.cache, exchange)
+	return exchange, nil
+}
+
+// requestInterval returns the candlestick interval to request to the exchange for the supplied one, which is different
+// only if auto resampling is enabled and the exchange doesn't support the supplied one.
+func (m Market) requestInterval(exchange common.Exchange, candlestickInterval time.Duration) (time.Duration, error) {
+	if !m.needsResample(exchange, candlestickInterval) {
+		return candlestickInterval, nil
+	}
+	requestInterval, ok := common.ClosestSupportedInterval(common.SupportedIntervalsOf(exchange), candlestickInterval)
+	if !ok {
+		return 0, fmt.Errorf("%w: no candlestick interval supported by %v divides %v", common.ErrUnsupportedCandlestickInterval, exchange.Name(), candlestickInterval)
+	}
+	return requestInterval, nil
+}
+
+func (m Market) needsResample(exchange common.Exchange, candlestickInterval time.Duration) bool {
+	supportedIntervals := common.SupportedIntervalsOf(exchange)
+	if !m.autoResample || supportedIntervals == nil {
+		return false
+	}
+	for _, supportedInterval := range supportedIntervals {
+		if supportedInterval == candlestickInterval {
+			return false
+		}
+	}
+	return true
+}
+
+func (m Market) getFallbackProviders(marketSource common.MarketSource) ([]common.CandlestickProvider, error) {
+	isInChain := false
+	for _, provider := range m.providerFallback {
+		isInChain = isInChain || strings.EqualFold(provider, marketSource.Provider)
+	}
+	if !isInChain {
+		return nil, nil
+	}
+	fallbackProviders := []common.CandlestickProvider{}
+	for _, provider := range m.providerFallback {
+		if strings.EqualFold(provider, marketSource.Provider) {
+			continue
+		}
+		fallbackMarketSource := marketSource
+		fallbackMarketSource.Provider = provider
+		exchange, err := m.getExchange(fallbackMarketSource)
+		if err != nil {
+			return nil, err
+		}
+		fallbackProviders = append(fallbackProviders, exchange)
+	}
+	return fallbackProviders, nil
+}
+
+func (m Market) cacheMetric(marketSource common.MarketSource, candlestickInterval time.Duration) cache.Metric {
+	if m.providerAgnosticCache {
+		return cache.Metric{Name: marketSource.ProviderAgnosticString(), CandlestickInterval: candlestickInterval}
+	}
+	return cache.Metric{Name: marketSource.String(), CandlestickInterval: candlestickInterval}
 }
 
 // SetDebug sets debug logging across all exchanges and the Market struct itself. Useful to know how many times an
@@ -131,15 +685,18 @@ func buildExchanges() map[string]common.Exchange {
 		common.BINANCEUSDMFUTURES: binanceusdmfutures.NewBinanceUSDMFutures(),
 		common.BITSTAMP:           bitstamp.NewBitstamp(),
 		common.BITFINEX:           bitfinex.NewBitfinex(),
+		common.CRYPTOCOM:          cryptocom.NewCryptoCom(),
 	}
 }
 
 func buildDefaultCache() *cache.MemoryCache {
 	return cache.NewMemoryCache(
 		map[time.Duration]int{
-			time.Minute:    10000,
-			1 * time.Hour:  1000,
-			24 * time.Hour: 1000,
+			time.Second:      1000,
+			10 * time.Second: 1000,
+			time.Minute:      10000,
+			1 * time.Hour:    1000,
+			24 * time.Hour:   1000,
 		},
 	)
 }
@@ -66,6 +66,17 @@ func TestIntegration(t *testing.T) {
 			}
 		})
 	}
+	for _, ts := range testCases {
+		t.Run(ts.name+" series", func(t *testing.T) {
+			endTime := ts.startTime.Add(time.Duration(len(ts.expectedCandlesticks)) * ts.candlestickInterval)
+			candlesticks, err := mkt.RequestRange(ts.marketSource, ts.startTime, endTime, ts.candlestickInterval)
+			require.Nil(t, err)
+			gaps, misaligned, err := common.CheckSeries(candlesticks, ts.candlestickInterval, int(ts.startTime.Unix()), int(endTime.Unix()))
+			require.Nil(t, err)
+			require.Empty(t, gaps)
+			require.Empty(t, misaligned)
+		})
+	}
 	mkt.CalculateCacheHitRatio()
 }
 
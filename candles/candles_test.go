@@ -0,0 +1,1631 @@
+package candles
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/marianogappa/crypto-candles/candles/cache"
+	"github.com/marianogappa/crypto-candles/candles/candletest"
+	"github.com/marianogappa/crypto-candles/candles/common"
+	"github.com/marianogappa/crypto-candles/candles/iterator"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProviderAgnosticCache(t *testing.T) {
+	cstick1 := common.Candlestick{Timestamp: int(tp("2022-07-09T15:00:00Z").Unix()), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+	cstick2 := common.Candlestick{Timestamp: int(tp("2022-07-09T15:01:00Z").Unix()), OpenPrice: 1235, HighestPrice: 1235, LowestPrice: 1235, ClosePrice: 1235}
+
+	tss := []struct {
+		name                  string
+		options               []func(*Market)
+		expectedCoinbaseCalls int
+	}{
+		{name: "Provider-specific cache by default", options: nil, expectedCoinbaseCalls: 1},
+		{name: "Provider-agnostic cache", options: []func(*Market){WithProviderAgnosticCache()}, expectedCoinbaseCalls: 0},
+	}
+	for _, ts := range tss {
+		t.Run(ts.name, func(t *testing.T) {
+			binance := candletest.NewFakeProvider([]candletest.Response{{Candlesticks: []common.Candlestick{cstick1, cstick2}}})
+			coinbase := candletest.NewFakeProvider([]candletest.Response{{Candlesticks: []common.Candlestick{cstick1, cstick2}}})
+			m := NewMarket(ts.options...)
+			m.exchanges = map[string]common.Exchange{common.BINANCE: binance, common.COINBASE: coinbase}
+
+			for _, provider := range []string{common.BINANCE, common.COINBASE} {
+				it, err := m.Iterator(common.MarketSource{Type: common.COIN, Provider: provider, BaseAsset: "BTC", QuoteAsset: "USDT"}, tp("2022-07-09T15:00:00Z"), time.Minute)
+				require.Nil(t, err)
+				cs, err := it.Next()
+				require.Nil(t, err)
+				require.Equal(t, cstick1, cs)
+			}
+
+			require.Equal(t, 1, binance.CallCount())
+			require.Len(t, coinbase.CallsSnapshot(), ts.expectedCoinbaseCalls)
+		})
+	}
+}
+
+func TestPrefetch(t *testing.T) {
+	ms := common.MarketSource{Type: common.COIN, Provider: common.BINANCE, BaseAsset: "BTC", QuoteAsset: "USDT"}
+	cs := []common.Candlestick{}
+	for i := 0; i < 5; i++ {
+		v := common.JSONFloat64(1234 + i)
+		cs = append(cs, common.Candlestick{Timestamp: int(tp("2022-07-09T15:00:00Z").Unix()) + i*60, OpenPrice: v, HighestPrice: v, LowestPrice: v, ClosePrice: v})
+	}
+
+	provider := candletest.NewFakeProvider([]candletest.Response{
+		{Candlesticks: cs[0:2]},
+		{Candlesticks: cs[2:5]},
+	})
+	m := NewMarket()
+	m.exchanges = map[string]common.Exchange{common.BINANCE: provider}
+
+	progress := [][2]int{}
+	err := m.Prefetch(ms, tp("2022-07-09T14:59:30Z"), tp("2022-07-09T15:04:00Z"), time.Minute, func(prefetched, total int) {
+		progress = append(progress, [2]int{prefetched, total})
+	})
+	require.Nil(t, err)
+	require.Equal(t, [][2]int{{2, 4}, {4, 4}}, progress)
+	require.Equal(t, []candletest.Call{
+		{MarketSource: ms, StartTime: tp("2022-07-09T15:00:00Z"), CandlestickInterval: time.Minute},
+		{MarketSource: ms, StartTime: tp("2022-07-09T15:02:00Z"), CandlestickInterval: time.Minute},
+	}, provider.CallsSnapshot())
+
+	// Everything was put in the cache, so an iterator doesn't need to call the provider.
+	provider.SetResponses(nil)
+	it, err := m.Iterator(ms, tp("2022-07-09T15:00:00Z"), time.Minute)
+	require.Nil(t, err)
+	for i := 0; i < 5; i++ {
+		c, err := it.Next()
+		require.Nil(t, err)
+		require.Equal(t, cs[i], c)
+	}
+	require.Equal(t, 2, provider.CallCount())
+}
+
+func TestPrefetchIsResumable(t *testing.T) {
+	ms := common.MarketSource{Type: common.COIN, Provider: common.BINANCE, BaseAsset: "BTC", QuoteAsset: "USDT"}
+	cs := []common.Candlestick{}
+	for i := 0; i < 4; i++ {
+		v := common.JSONFloat64(1234 + i)
+		cs = append(cs, common.Candlestick{Timestamp: int(tp("2022-07-09T15:00:00Z").Unix()) + i*60, OpenPrice: v, HighestPrice: v, LowestPrice: v, ClosePrice: v})
+	}
+
+	provider := candletest.NewFakeProvider([]candletest.Response{
+		{Candlesticks: cs[0:2]},
+		{Err: common.CandleReqError{Err: common.ErrRateLimit}},
+		{Candlesticks: cs[2:4]},
+	})
+	m := NewMarket()
+	m.exchanges = map[string]common.Exchange{common.BINANCE: provider}
+
+	err := m.Prefetch(ms, tp("2022-07-09T15:00:00Z"), tp("2022-07-09T15:04:00Z"), time.Minute, nil)
+	require.ErrorIs(t, err.(common.CandleReqError).Err, common.ErrRateLimit)
+
+	err = m.Prefetch(ms, tp("2022-07-09T15:00:00Z"), tp("2022-07-09T15:04:00Z"), time.Minute, nil)
+	require.Nil(t, err)
+	require.Equal(t, 3, provider.CallCount())
+	require.Equal(t, tp("2022-07-09T15:02:00Z"), provider.CallsSnapshot()[2].StartTime)
+}
+
+func TestPrefetchStepsByCalendarMonth(t *testing.T) {
+	ms := common.MarketSource{Type: common.COIN, Provider: common.BINANCE, BaseAsset: "BTC", QuoteAsset: "USDT"}
+	month := 30 * 24 * time.Hour
+	cs := []common.Candlestick{}
+	for i, start := range []string{"2023-12-01T00:00:00Z", "2024-01-01T00:00:00Z", "2024-02-01T00:00:00Z"} {
+		v := common.JSONFloat64(1234 + i)
+		cs = append(cs, common.Candlestick{Timestamp: int(tp(start).Unix()), OpenPrice: v, HighestPrice: v, LowestPrice: v, ClosePrice: v})
+	}
+
+	provider := candletest.NewFakeProvider([]candletest.Response{
+		{Candlesticks: cs[0:1]},
+		{Candlesticks: cs[1:3]},
+	})
+	provider.SetName(common.BINANCE)
+	m := NewMarket(WithCacheSizes(map[time.Duration]int{month: 10}), WithClock(func() time.Time { return tp("2024-03-15T00:00:00Z") }))
+	m.exchanges = map[string]common.Exchange{common.BINANCE: provider}
+
+	progress := [][2]int{}
+	err := m.Prefetch(ms, tp("2023-12-01T00:00:00Z"), tp("2024-04-01T00:00:00Z"), month, func(prefetched, total int) {
+		progress = append(progress, [2]int{prefetched, total})
+	})
+	require.Nil(t, err)
+	require.Equal(t, [][2]int{{1, 4}, {3, 4}}, progress)
+	require.Equal(t, []candletest.Call{
+		{MarketSource: ms, StartTime: tp("2023-12-01T00:00:00Z"), CandlestickInterval: month},
+		{MarketSource: ms, StartTime: tp("2024-01-01T00:00:00Z"), CandlestickInterval: month},
+	}, provider.CallsSnapshot())
+}
+
+func TestPrefetchContext(t *testing.T) {
+	ms := common.MarketSource{Type: common.COIN, Provider: common.BINANCE, BaseAsset: "BTC", QuoteAsset: "USDT"}
+	cs := []common.Candlestick{}
+	for i := 0; i < 4; i++ {
+		v := common.JSONFloat64(1234 + i)
+		cs = append(cs, common.Candlestick{Timestamp: int(tp("2022-07-09T15:00:00Z").Unix()) + i*60, OpenPrice: v, HighestPrice: v, LowestPrice: v, ClosePrice: v})
+	}
+
+	provider := candletest.NewFakeProvider([]candletest.Response{
+		{Candlesticks: cs[0:2]},
+		{Candlesticks: cs[2:4]},
+	})
+	m := NewMarket()
+	m.exchanges = map[string]common.Exchange{common.BINANCE: provider}
+
+	progressCh := make(chan PrefetchProgress)
+	progress := []PrefetchProgress{}
+	done := make(chan struct{})
+	go func() {
+		for p := range progressCh {
+			progress = append(progress, p)
+		}
+		close(done)
+	}()
+
+	err := m.PrefetchContext(context.Background(), ms, tp("2022-07-09T15:00:00Z"), tp("2022-07-09T15:04:00Z"), time.Minute, progressCh)
+	require.Nil(t, err)
+	<-done
+	require.Equal(t, []PrefetchProgress{{Prefetched: 2, Total: 4}, {Prefetched: 4, Total: 4}}, progress)
+}
+
+// cancellingProvider cancels a context after every request to a FakeProvider.
+type cancellingProvider struct {
+	*candletest.FakeProvider
+	cancel func()
+}
+
+func (p cancellingProvider) RequestCandlesticks(marketSource common.MarketSource, startTime time.Time, candlestickInterval time.Duration) ([]common.Candlestick, error) {
+	defer p.cancel()
+	return p.FakeProvider.RequestCandlesticks(marketSource, startTime, candlestickInterval)
+}
+
+func TestPrefetchContextCancelled(t *testing.T) {
+	ms := common.MarketSource{Type: common.COIN, Provider: common.BINANCE, BaseAsset: "BTC", QuoteAsset: "USDT"}
+	cs := []common.Candlestick{}
+	for i := 0; i < 4; i++ {
+		v := common.JSONFloat64(1234 + i)
+		cs = append(cs, common.Candlestick{Timestamp: int(tp("2022-07-09T15:00:00Z").Unix()) + i*60, OpenPrice: v, HighestPrice: v, LowestPrice: v, ClosePrice: v})
+	}
+
+	// Cancel after the first page is requested.
+	ctx, cancel := context.WithCancel(context.Background())
+	provider := cancellingProvider{candletest.NewFakeProvider([]candletest.Response{
+		{Candlesticks: cs[0:2]},
+		{Candlesticks: cs[2:4]},
+	}), cancel}
+	m := NewMarket()
+	m.exchanges = map[string]common.Exchange{common.BINANCE: provider}
+
+	err := m.PrefetchContext(ctx, ms, tp("2022-07-09T15:00:00Z"), tp("2022-07-09T15:04:00Z"), time.Minute, nil)
+	require.ErrorIs(t, err, context.Canceled)
+	require.True(t, err.(common.CandleReqError).IsNotRetryable)
+	require.Equal(t, 1, provider.CallCount())
+
+	// The first page was kept in the cache.
+	cached, err := m.cache.Get(m.cacheMetric(ms, time.Minute), common.ISO8601("2022-07-09T15:00:00Z"))
+	require.Nil(t, err)
+	require.Equal(t, cs[0:2], cached)
+}
+
+func TestIteratorValidation(t *testing.T) {
+	tss := []struct {
+		name          string
+		marketSource  common.MarketSource
+		interval      time.Duration
+		expectedError error
+	}{
+		{
+			name:          "invalid market type",
+			marketSource:  common.MarketSource{Type: common.UNSUPPORTED, Provider: common.BINANCE, BaseAsset: "BTC", QuoteAsset: "USDT"},
+			interval:      time.Minute,
+			expectedError: common.ErrInvalidMarketType,
+		},
+		{
+			name:          "empty base asset",
+			marketSource:  common.MarketSource{Type: common.COIN, Provider: common.BINANCE, QuoteAsset: "USDT"},
+			interval:      time.Minute,
+			expectedError: common.ErrEmptyBaseAsset,
+		},
+		{
+			name:          "empty quote asset",
+			marketSource:  common.MarketSource{Type: common.COIN, Provider: common.BINANCE, BaseAsset: "BTC"},
+			interval:      time.Minute,
+			expectedError: common.ErrEmptyQuoteAsset,
+		},
+		{
+			name:          "empty provider",
+			marketSource:  common.MarketSource{Type: common.COIN, BaseAsset: "BTC", QuoteAsset: "USDT"},
+			interval:      time.Minute,
+			expectedError: common.ErrEmptyProvider,
+		},
+		{
+			name:          "unknown provider",
+			marketSource:  common.MarketSource{Type: common.COIN, Provider: "FOO", BaseAsset: "BTC", QuoteAsset: "USDT"},
+			interval:      time.Minute,
+			expectedError: common.ErrUnsuportedCandlestickProvider,
+		},
+		{
+			name:          "zero interval",
+			marketSource:  common.MarketSource{Type: common.COIN, Provider: common.BINANCE, BaseAsset: "BTC", QuoteAsset: "USDT"},
+			interval:      0,
+			expectedError: common.ErrUnsupportedCandlestickInterval,
+		},
+		{
+			name:          "negative interval",
+			marketSource:  common.MarketSource{Type: common.COIN, Provider: common.BINANCE, BaseAsset: "BTC", QuoteAsset: "USDT"},
+			interval:      -time.Minute,
+			expectedError: common.ErrUnsupportedCandlestickInterval,
+		},
+	}
+	for _, ts := range tss {
+		t.Run(ts.name, func(t *testing.T) {
+			provider := candletest.NewFakeProvider(nil)
+			m := NewMarket()
+			m.exchanges = map[string]common.Exchange{common.BINANCE: provider}
+
+			_, err := m.Iterator(ts.marketSource, tp("2022-07-09T15:00:00Z"), ts.interval)
+			require.ErrorIs(t, err, ts.expectedError)
+			require.Equal(t, 0, provider.CallCount())
+		})
+	}
+}
+
+func TestWithStrictTimestamps(t *testing.T) {
+	cstick := common.Candlestick{Timestamp: int(tp("2022-07-09T15:00:00Z").Unix()), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+
+	t.Run("unaligned start time is rejected", func(t *testing.T) {
+		provider := candletest.NewFakeProvider(nil)
+		m := NewMarket(WithStrictTimestamps(true))
+		m.exchanges = map[string]common.Exchange{common.BINANCE: provider}
+
+		_, err := m.Iterator(msBTCUSDT, tp("2022-07-09T15:00:30Z"), time.Minute)
+		require.ErrorIs(t, err, common.ErrUnalignedStartTime)
+		require.Equal(t, 0, provider.CallCount())
+	})
+
+	t.Run("aligned start time is accepted", func(t *testing.T) {
+		provider := candletest.NewFakeProvider([]candletest.Response{{Candlesticks: []common.Candlestick{cstick}}})
+		m := NewMarket(WithStrictTimestamps(true), WithCacheSizes(map[time.Duration]int{}))
+		m.exchanges = map[string]common.Exchange{common.BINANCE: provider}
+
+		it, err := m.Iterator(msBTCUSDT, tp("2022-07-09T15:00:00Z"), time.Minute)
+		require.NoError(t, err)
+		actual, err := it.Next()
+		require.NoError(t, err)
+		require.Equal(t, cstick, actual)
+	})
+
+	t.Run("unaligned start time is rounded up by default", func(t *testing.T) {
+		provider := candletest.NewFakeProvider([]candletest.Response{{Candlesticks: []common.Candlestick{cstick}}})
+		m := NewMarket(WithCacheSizes(map[time.Duration]int{}))
+		m.exchanges = map[string]common.Exchange{common.BINANCE: provider}
+
+		it, err := m.Iterator(msBTCUSDT, tp("2022-07-09T14:59:30Z"), time.Minute)
+		require.NoError(t, err)
+		actual, err := it.Next()
+		require.NoError(t, err)
+		require.Equal(t, cstick, actual)
+	})
+}
+
+func TestPerpetualMarketType(t *testing.T) {
+	cstick := common.Candlestick{Timestamp: int(tp("2022-07-09T15:00:00Z").Unix()), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+	spot := candletest.NewFakeProvider(nil)
+	futures := candletest.NewFakeProvider([]candletest.Response{{Candlesticks: []common.Candlestick{cstick}}, {Candlesticks: []common.Candlestick{cstick}}})
+	m := NewMarket(WithCacheSizes(map[time.Duration]int{}))
+	m.exchanges = map[string]common.Exchange{common.BINANCE: spot, common.BINANCEUSDMFUTURES: futures, common.COINBASE: spot}
+
+	for _, provider := range []string{common.BINANCE, common.BINANCEUSDMFUTURES} {
+		ms := common.MarketSource{Type: common.PERPETUAL, Provider: provider, BaseAsset: "BTC", QuoteAsset: "USDT"}
+		iter, err := m.Iterator(ms, tp("2022-07-09T15:00:00Z"), time.Minute)
+		require.Nil(t, err)
+		actual, err := iter.Next()
+		require.Nil(t, err)
+		require.Equal(t, cstick, actual)
+	}
+	require.Equal(t, 2, futures.CallCount())
+	require.Equal(t, 0, spot.CallCount())
+
+	_, err := m.Iterator(common.MarketSource{Type: common.PERPETUAL, Provider: common.COINBASE, BaseAsset: "BTC", QuoteAsset: "USD"}, tp("2022-07-09T15:00:00Z"), time.Minute)
+	require.ErrorIs(t, err, common.ErrUnsuportedCandlestickProvider)
+}
+
+func TestPrefetchFailsWithoutCache(t *testing.T) {
+	m := NewMarket(WithCacheSizes(map[time.Duration]int{}))
+	m.exchanges = map[string]common.Exchange{common.BINANCE: candletest.NewFakeProvider(nil)}
+
+	err := m.Prefetch(common.MarketSource{Type: common.COIN, Provider: common.BINANCE, BaseAsset: "BTC", QuoteAsset: "USDT"}, tp("2022-07-09T15:00:00Z"), tp("2022-07-09T15:04:00Z"), time.Minute, nil)
+	require.ErrorIs(t, err, cache.ErrCacheNotConfiguredForCandlestickInterval)
+}
+
+func TestPrefetchFailsWithNoCache(t *testing.T) {
+	m := NewMarket(WithNoCache())
+	m.exchanges = map[string]common.Exchange{common.BINANCE: candletest.NewFakeProvider(nil)}
+
+	err := m.Prefetch(common.MarketSource{Type: common.COIN, Provider: common.BINANCE, BaseAsset: "BTC", QuoteAsset: "USDT"}, tp("2022-07-09T15:00:00Z"), tp("2022-07-09T15:04:00Z"), time.Minute, nil)
+	require.ErrorIs(t, err, cache.ErrCacheNotConfiguredForCandlestickInterval)
+}
+
+func TestPrefetchFailsWhenDataTooFarBack(t *testing.T) {
+	provider := candletest.NewFakeProvider(nil)
+	provider.SetMaxHistoryDepth(24 * time.Hour)
+	m := NewMarket()
+	m.exchanges = map[string]common.Exchange{common.BINANCE: provider}
+
+	err := m.Prefetch(common.MarketSource{Type: common.COIN, Provider: common.BINANCE, BaseAsset: "BTC", QuoteAsset: "USDT"}, time.Now().Add(-48*time.Hour), time.Now(), time.Minute, nil)
+	require.ErrorIs(t, err, common.ErrDataTooFarBack)
+	require.Equal(t, 0, provider.CallCount())
+}
+
+func TestLatest(t *testing.T) {
+	ms := common.MarketSource{Type: common.COIN, Provider: common.BINANCE, BaseAsset: "BTC", QuoteAsset: "USDT"}
+	cstick := common.Candlestick{Timestamp: int(tp("2022-07-09T15:58:00Z").Unix()), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+
+	provider := candletest.NewFakeProvider([]candletest.Response{{Candlesticks: []common.Candlestick{cstick}}})
+	provider.SetPatience(time.Minute)
+	m := NewMarket(WithCacheSizes(map[time.Duration]int{}))
+	m.exchanges = map[string]common.Exchange{common.BINANCE: provider}
+	m.timeNowFunc = func() time.Time { return tp("2022-07-09T16:00:30Z") }
+
+	actual, err := m.Latest(ms, time.Minute)
+	require.Nil(t, err)
+	require.Equal(t, cstick, actual)
+	require.Equal(t, []candletest.Call{{MarketSource: ms, StartTime: tp("2022-07-09T15:58:00Z"), CandlestickInterval: time.Minute}}, provider.CallsSnapshot())
+}
+
+func TestLatestWithIntervalPatience(t *testing.T) {
+	ms := common.MarketSource{Type: common.COIN, Provider: common.BINANCE, BaseAsset: "BTC", QuoteAsset: "USDT"}
+	cstick := common.Candlestick{Timestamp: int(tp("2022-07-07T00:00:00Z").Unix()), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+
+	provider := candletest.NewFakeProvider([]candletest.Response{{Candlesticks: []common.Candlestick{cstick}}})
+	provider.SetPatience(time.Minute)
+	provider.SetIntervalPatience(24*time.Hour, 2*time.Hour)
+	m := NewMarket(WithCacheSizes(map[time.Duration]int{}))
+	m.exchanges = map[string]common.Exchange{common.BINANCE: provider}
+	m.timeNowFunc = func() time.Time { return tp("2022-07-09T01:00:00Z") }
+
+	// With a minute of patience, the 2022-07-08 candlestick would be requested instead.
+	actual, err := m.Latest(ms, 24*time.Hour)
+	require.Nil(t, err)
+	require.Equal(t, cstick, actual)
+	require.Equal(t, []candletest.Call{{MarketSource: ms, StartTime: tp("2022-07-07T00:00:00Z"), CandlestickInterval: 24 * time.Hour}}, provider.CallsSnapshot())
+}
+
+func TestLatestFollowsProviderWeekStart(t *testing.T) {
+	ms := common.MarketSource{Type: common.COIN, Provider: common.BINANCE, BaseAsset: "BTC", QuoteAsset: "USDT"}
+	cstick := common.Candlestick{Timestamp: int(tp("2022-06-27T00:00:00Z").Unix()), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+
+	provider := candletest.NewFakeProvider([]candletest.Response{{Candlesticks: []common.Candlestick{cstick}}})
+	provider.SetName(common.BINANCE)
+	provider.SetPatience(time.Minute)
+	m := NewMarket(WithCacheSizes(map[time.Duration]int{}))
+	m.exchanges = map[string]common.Exchange{common.BINANCE: provider}
+	m.timeNowFunc = func() time.Time { return tp("2022-07-09T01:00:00Z") }
+
+	// Binance's weeks start on Mondays, rather than on Thursdays like multiples of a week since the UNIX epoch.
+	actual, err := m.Latest(ms, 7*24*time.Hour)
+	require.Nil(t, err)
+	require.Equal(t, cstick, actual)
+	require.Equal(t, []candletest.Call{{MarketSource: ms, StartTime: tp("2022-06-27T00:00:00Z"), CandlestickInterval: 7 * 24 * time.Hour}}, provider.CallsSnapshot())
+}
+
+func TestWithPatience(t *testing.T) {
+	m := NewMarket(WithPatience("binance", 5*time.Minute), WithIntervalPatience(common.BINANCE, 24*time.Hour, 2*time.Hour), WithPatience("UNKNOWN", time.Hour))
+
+	binance := m.exchanges[common.BINANCE]
+	require.Equal(t, 5*time.Minute, binance.Patience())
+	require.Equal(t, 5*time.Minute, common.PatienceFor(binance, time.Minute))
+	require.Equal(t, 2*time.Hour, common.PatienceFor(binance, 24*time.Hour))
+	require.Equal(t, time.Minute, m.exchanges[common.COINBASE].Patience())
+}
+
+func TestAutoResample(t *testing.T) {
+	ms := common.MarketSource{Type: common.COIN, Provider: common.BINANCE, BaseAsset: "BTC", QuoteAsset: "USDT"}
+	hourly := []common.Candlestick{
+		{Timestamp: int(tp("2022-07-09T00:00:00Z").Unix()), OpenPrice: 1, ClosePrice: 2, LowestPrice: 1, HighestPrice: 3},
+		{Timestamp: int(tp("2022-07-09T01:00:00Z").Unix()), OpenPrice: 2, ClosePrice: 4, LowestPrice: 0.5, HighestPrice: 4},
+		{Timestamp: int(tp("2022-07-09T02:00:00Z").Unix()), OpenPrice: 4, ClosePrice: 5, LowestPrice: 4, HighestPrice: 6},
+		{Timestamp: int(tp("2022-07-09T03:00:00Z").Unix()), OpenPrice: 5, ClosePrice: 3, LowestPrice: 2, HighestPrice: 5},
+	}
+
+	provider := candletest.NewFakeProvider([]candletest.Response{{Candlesticks: hourly}})
+	provider.SetSupportedIntervals([]time.Duration{time.Minute, time.Hour, 4 * time.Hour})
+	m := NewMarket(WithAutoResample(true), WithCacheSizes(map[time.Duration]int{}))
+	m.exchanges = map[string]common.Exchange{common.BINANCE: provider}
+
+	iter, err := m.Iterator(ms, tp("2022-07-08T23:30:00Z"), 2*time.Hour)
+	require.Nil(t, err)
+	iter.SetTimeNowFunc(func() time.Time { return tp("2022-07-10T00:00:00Z") })
+
+	actual1, err := iter.Next()
+	require.Nil(t, err)
+	require.Equal(t, common.Candlestick{Timestamp: int(tp("2022-07-09T00:00:00Z").Unix()), OpenPrice: 1, ClosePrice: 4, LowestPrice: 0.5, HighestPrice: 4}, actual1)
+	actual2, err := iter.Next()
+	require.Nil(t, err)
+	require.Equal(t, common.Candlestick{Timestamp: int(tp("2022-07-09T02:00:00Z").Unix()), OpenPrice: 4, ClosePrice: 3, LowestPrice: 2, HighestPrice: 6}, actual2)
+	require.Equal(t, []candletest.Call{{MarketSource: ms, StartTime: tp("2022-07-09T00:00:00Z"), CandlestickInterval: time.Hour}}, provider.CallsSnapshot())
+}
+
+func TestAutoResampleFailsWithoutDivisibleInterval(t *testing.T) {
+	ms := common.MarketSource{Type: common.COIN, Provider: common.BINANCE, BaseAsset: "BTC", QuoteAsset: "USDT"}
+	provider := candletest.NewFakeProvider(nil)
+	provider.SetSupportedIntervals([]time.Duration{time.Hour})
+	m := NewMarket(WithAutoResample(true))
+	m.exchanges = map[string]common.Exchange{common.BINANCE: provider}
+
+	_, err := m.Iterator(ms, tp("2022-07-09T00:00:00Z"), 90*time.Minute)
+	require.ErrorIs(t, err, common.ErrUnsupportedCandlestickInterval)
+}
+
+func TestLatestNotAvailableYet(t *testing.T) {
+	ms := common.MarketSource{Type: common.COIN, Provider: common.BINANCE, BaseAsset: "BTC", QuoteAsset: "USDT"}
+	provider := candletest.NewFakeProvider([]candletest.Response{{Err: common.CandleReqError{Kind: common.KindTransient, Err: common.ErrOutOfCandlesticks}}})
+	m := NewMarket(WithCacheSizes(map[time.Duration]int{}))
+	m.exchanges = map[string]common.Exchange{common.BINANCE: provider}
+
+	_, err := m.Latest(ms, time.Minute)
+	require.ErrorIs(t, err, common.ErrNoNewTicksYet)
+}
+
+// latestProvider adds LatestCandlestickProvider to a FakeProvider, recording latest requests with a zero start time.
+type latestProvider struct {
+	*candletest.FakeProvider
+}
+
+func (p latestProvider) RequestLatestCandlesticks(marketSource common.MarketSource, candlestickInterval time.Duration) ([]common.Candlestick, error) {
+	return p.RequestCandlesticks(marketSource, time.Time{}, candlestickInterval)
+}
+
+func TestLatestWithoutStartTime(t *testing.T) {
+	ms := common.MarketSource{Type: common.COIN, Provider: common.BINANCE, BaseAsset: "BTC", QuoteAsset: "USDT"}
+	cs := []common.Candlestick{}
+	for i := 0; i < 3; i++ {
+		v := common.JSONFloat64(1234 + i)
+		cs = append(cs, common.Candlestick{Timestamp: int(tp("2022-07-09T15:57:00Z").Unix()) + i*60, OpenPrice: v, HighestPrice: v, LowestPrice: v, ClosePrice: v})
+	}
+
+	tss := []struct {
+		name         string
+		now          time.Time
+		expected     common.Candlestick
+		expectedErr  error
+		expectCached bool
+	}{
+		{name: "Discards unfinished candlesticks", now: tp("2022-07-09T16:00:30Z"), expected: cs[1], expectCached: true},
+		{name: "Latest candlestick is the last one", now: tp("2022-07-09T16:01:30Z"), expected: cs[2], expectCached: true},
+		{name: "Latest candlestick not available yet", now: tp("2022-07-09T16:02:30Z"), expectedErr: common.ErrNoNewTicksYet},
+	}
+	for _, ts := range tss {
+		t.Run(ts.name, func(t *testing.T) {
+			provider := latestProvider{candletest.NewFakeProvider([]candletest.Response{{Candlesticks: cs}})}
+			provider.SetPatience(time.Minute)
+			m := NewMarket()
+			m.exchanges = map[string]common.Exchange{common.BINANCE: provider}
+			m.timeNowFunc = func() time.Time { return ts.now }
+
+			actual, err := m.Latest(ms, time.Minute)
+			require.ErrorIs(t, err, ts.expectedErr)
+			require.Equal(t, ts.expected, actual)
+			require.Equal(t, 1, provider.CallCount())
+			require.True(t, provider.CallsSnapshot()[0].StartTime.IsZero())
+
+			cached, err := m.cache.Get(m.cacheMetric(ms, time.Minute), common.ISO8601(tp("2022-07-09T15:57:00Z").Format(time.RFC3339)))
+			require.Equal(t, ts.expectCached, err == nil)
+			if ts.expectCached {
+				require.Equal(t, cs[0], cached[0])
+			}
+		})
+	}
+}
+
+type limitedLatestProvider struct {
+	latestProvider
+	limits *[]int
+}
+
+func (p limitedLatestProvider) RequestLatestCandlesticksLimit(marketSource common.MarketSource, candlestickInterval time.Duration, limit int) ([]common.Candlestick, error) {
+	*p.limits = append(*p.limits, limit)
+	return p.RequestLatestCandlesticks(marketSource, candlestickInterval)
+}
+
+func TestLatestRequestsSmallLimit(t *testing.T) {
+	ms := common.MarketSource{Type: common.COIN, Provider: common.BINANCE, BaseAsset: "BTC", QuoteAsset: "USDT"}
+	cstick := common.Candlestick{Timestamp: int(tp("2022-07-09T15:58:00Z").Unix()), OpenPrice: 1, HighestPrice: 1, LowestPrice: 1, ClosePrice: 1}
+	provider := limitedLatestProvider{latestProvider{candletest.NewFakeProvider([]candletest.Response{{Candlesticks: []common.Candlestick{cstick}}})}, &[]int{}}
+	provider.SetPatience(time.Minute)
+	m := NewMarket(WithClock(func() time.Time { return tp("2022-07-09T16:00:30Z") }))
+	m.exchanges = map[string]common.Exchange{common.BINANCE: provider}
+
+	actual, err := m.Latest(ms, time.Minute)
+	require.Nil(t, err)
+	require.Equal(t, cstick, actual)
+	// 15:58 (latest finalized), 15:59 (within patience), 16:00 (unfinished), and one more in case 16:01 starts.
+	require.Equal(t, []int{4}, *provider.limits)
+}
+
+func TestLatestWithoutStartTimeOutOfCandlesticks(t *testing.T) {
+	ms := common.MarketSource{Type: common.COIN, Provider: common.BINANCE, BaseAsset: "BTC", QuoteAsset: "USDT"}
+	provider := latestProvider{candletest.NewFakeProvider(nil)}
+	m := NewMarket()
+	m.exchanges = map[string]common.Exchange{common.BINANCE: provider}
+
+	_, err := m.Latest(ms, time.Minute)
+	require.ErrorIs(t, err, common.ErrNoNewTicksYet)
+}
+
+func TestProviders(t *testing.T) {
+	infos := Providers()
+	names := []string{}
+	for _, info := range infos {
+		names = append(names, info.Name)
+		require.NotEmpty(t, info.SupportedIntervals)
+		require.Contains(t, info.SupportedIntervals, time.Minute)
+		require.False(t, info.SupportsSeconds)
+		require.Positive(t, info.MaxCandlesPerRequest)
+	}
+	require.Equal(t, []string{common.BINANCE, common.BINANCEUSDMFUTURES, common.BITFINEX, common.BITSTAMP, common.COINBASE, common.CRYPTOCOM, common.KUCOIN}, names)
+}
+
+func TestProviderIntervalTables(t *testing.T) {
+	const (
+		minute = time.Minute
+		hour   = time.Hour
+		day    = 24 * time.Hour
+	)
+	query := func(key string) func(*http.Request) string {
+		return func(r *http.Request) string { return r.URL.Query().Get(key) }
+	}
+
+	// Every provider's SupportedIntervals must be exactly what it maps to the exchange's interval parameter.
+	tss := []struct {
+		provider  string
+		parameter func(*http.Request) string
+		expected  map[time.Duration]string
+	}{
+		{
+			provider:  common.BINANCE,
+			parameter: query("interval"),
+			expected: map[time.Duration]string{
+				minute: "1m", 3 * minute: "3m", 5 * minute: "5m", 15 * minute: "15m", 30 * minute: "30m", hour: "1h", 2 * hour: "2h",
+				4 * hour: "4h", 6 * hour: "6h", 8 * hour: "8h", 12 * hour: "12h", day: "1d", 3 * day: "3d", 7 * day: "1w", 30 * day: "1M",
+			},
+		},
+		{
+			provider:  common.BINANCEUSDMFUTURES,
+			parameter: query("interval"),
+			expected: map[time.Duration]string{
+				minute: "1m", 3 * minute: "3m", 5 * minute: "5m", 15 * minute: "15m", 30 * minute: "30m", hour: "1h", 2 * hour: "2h",
+				4 * hour: "4h", 6 * hour: "6h", 8 * hour: "8h", 12 * hour: "12h", day: "1d", 3 * day: "3d", 7 * day: "1w", 30 * day: "1M",
+			},
+		},
+		{
+			provider:  common.BITFINEX,
+			parameter: func(r *http.Request) string { return strings.Split(r.URL.Path, ":")[1] },
+			expected: map[time.Duration]string{
+				minute: "1m", 5 * minute: "5m", 15 * minute: "15m", 30 * minute: "30m", hour: "1h", 3 * hour: "3h", 6 * hour: "6h",
+				12 * hour: "12h", day: "1D", 7 * day: "1W", 14 * day: "14D", 30 * day: "1M",
+			},
+		},
+		{
+			provider:  common.BITSTAMP,
+			parameter: query("step"),
+			expected: map[time.Duration]string{
+				minute: "60", 3 * minute: "180", 5 * minute: "300", 15 * minute: "900", 30 * minute: "1800", hour: "3600",
+				2 * hour: "7200", 4 * hour: "14400", 6 * hour: "21600", 12 * hour: "43200", day: "86400", 3 * day: "259200",
+			},
+		},
+		{
+			provider:  common.COINBASE,
+			parameter: query("granularity"),
+			expected: map[time.Duration]string{
+				minute: "60", 5 * minute: "300", 15 * minute: "900", hour: "3600", 6 * hour: "21600", day: "86400",
+			},
+		},
+		{
+			provider:  common.CRYPTOCOM,
+			parameter: query("timeframe"),
+			expected: map[time.Duration]string{
+				minute: "1m", 5 * minute: "5m", 15 * minute: "15m", 30 * minute: "30m", hour: "1h", 4 * hour: "4h", 6 * hour: "6h",
+				12 * hour: "12h", day: "1D", 7 * day: "7D", 14 * day: "14D", 30 * day: "1M",
+			},
+		},
+		{
+			provider:  common.KUCOIN,
+			parameter: query("type"),
+			expected: map[time.Duration]string{
+				minute: "1min", 3 * minute: "3min", 5 * minute: "5min", 15 * minute: "15min", 30 * minute: "30min", hour: "1hour",
+				2 * hour: "2hour", 4 * hour: "4hour", 6 * hour: "6hour", 8 * hour: "8hour", 12 * hour: "12hour", day: "1day",
+				7 * day: "1week", 30 * day: "1month",
+			},
+		},
+	}
+	for _, ts := range tss {
+		t.Run(ts.provider, func(t *testing.T) {
+			var parameters []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				parameters = append(parameters, ts.parameter(r))
+				w.WriteHeader(http.StatusTeapot)
+			}))
+			defer server.Close()
+			m := NewMarket(
+				WithNoCache(),
+				WithRetryStrategy(common.RetryStrategy{Attempts: 1}),
+				WithProviderOption(ts.provider, ProviderAPIURL(server.URL+"/")),
+			)
+			exchange := m.exchanges[ts.provider]
+
+			require.Equal(t, common.SortedIntervals(ts.expected), common.SupportedIntervalsOf(exchange))
+
+			// Monthly candlesticks are calendar months, so they must be anchored to the 1st of the month.
+			if _, ok := ts.expected[30*day]; ok {
+				anchor := common.AnchorOf(exchange)
+				require.Equal(t, tp("2024-02-01T00:00:00Z"), anchor.Floor(tp("2024-02-15T00:00:00Z"), 30*day))
+				require.Equal(t, int(tp("2024-03-01T00:00:00Z").Unix()), anchor.Add(int(tp("2024-02-01T00:00:00Z").Unix()), 30*day, 1))
+			}
+
+			for _, interval := range common.SupportedIntervalsOf(exchange) {
+				parameters = nil
+				_, err := exchange.RequestCandlesticks(msBTCUSDT, tp("2022-07-01T00:00:00Z"), interval)
+				require.NotErrorIs(t, err, common.ErrUnsupportedCandlestickInterval, interval.String())
+				require.Equal(t, []string{ts.expected[interval]}, parameters, interval.String())
+			}
+
+			parameters = nil
+			_, err := exchange.RequestCandlesticks(msBTCUSDT, tp("2022-07-01T00:00:00Z"), 45*minute)
+			require.ErrorIs(t, err, common.ErrUnsupportedCandlestickInterval)
+			require.Empty(t, parameters)
+		})
+	}
+}
+
+func TestMarketProviders(t *testing.T) {
+	provider := candletest.NewFakeProvider(nil)
+	provider.SetPatience(2 * time.Minute)
+	provider.SetMaxHistoryDepth(24 * time.Hour)
+	provider.SetMaxCandlesPerRequest(500)
+	m := NewMarket()
+	m.exchanges = map[string]common.Exchange{"FAKE": provider}
+
+	require.Equal(t, []ProviderInfo{{Name: "FAKE", MaxHistoryDepth: 24 * time.Hour, Patience: 2 * time.Minute, MaxCandlesPerRequest: 500}}, m.Providers())
+}
+
+func TestProviderAnchorOptionsAreScopedToTheMarket(t *testing.T) {
+	anchored := NewMarket(WithProviderOption("binance", ProviderUTCOffset(9*time.Hour), ProviderWeekStart(time.Sunday)))
+	other := NewMarket()
+
+	binance, err := anchored.Provider(common.BINANCE)
+	require.Nil(t, err)
+	require.Equal(t, 9*time.Hour, common.AnchorOf(binance).UTCOffset())
+	require.Equal(t, time.Sunday, common.AnchorOf(binance).WeekStart())
+
+	binance, err = other.Provider(common.BINANCE)
+	require.Nil(t, err)
+	require.Equal(t, common.NewAnchor(common.BINANCE), common.AnchorOf(binance))
+}
+
+func TestProviderFallback(t *testing.T) {
+	ms := common.MarketSource{Type: common.COIN, Provider: common.BINANCE, BaseAsset: "BTC", QuoteAsset: "USDT"}
+	cstick := common.Candlestick{Timestamp: int(tp("2022-07-09T15:00:00Z").Unix()), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+
+	binance := candletest.NewFakeProvider([]candletest.Response{{Err: common.CandleReqError{Kind: common.KindRateLimited, Err: common.ErrRateLimit}}})
+	binance.SetName(common.BINANCE)
+	coinbase := candletest.NewFakeProvider([]candletest.Response{{Candlesticks: []common.Candlestick{cstick}}})
+	coinbase.SetName(common.COINBASE)
+	m := NewMarket(WithProviderFallback([]string{common.BINANCE, common.COINBASE}))
+	m.exchanges = map[string]common.Exchange{common.BINANCE: binance, common.COINBASE: coinbase}
+
+	it, err := m.Iterator(ms, tp("2022-07-09T15:00:00Z"), time.Minute)
+	require.Nil(t, err)
+	actual, err := it.Next()
+	require.Nil(t, err)
+	require.Equal(t, cstick, actual)
+	require.Equal(t, common.COINBASE, it.LastProvider())
+	require.Equal(t, 1, binance.CallCount())
+	require.Equal(t, 1, coinbase.CallCount())
+	require.Equal(t, common.COINBASE, coinbase.CallsSnapshot()[0].MarketSource.Provider)
+}
+
+func TestProviderFallbackIgnoredForProvidersNotInChain(t *testing.T) {
+	ms := common.MarketSource{Type: common.COIN, Provider: common.KUCOIN, BaseAsset: "BTC", QuoteAsset: "USDT"}
+	kucoin := candletest.NewFakeProvider([]candletest.Response{{Err: common.CandleReqError{Kind: common.KindRateLimited, Err: common.ErrRateLimit}}})
+	coinbase := candletest.NewFakeProvider(nil)
+	m := NewMarket(WithProviderFallback([]string{common.BINANCE, common.COINBASE}))
+	m.exchanges = map[string]common.Exchange{common.KUCOIN: kucoin, common.COINBASE: coinbase}
+
+	it, err := m.Iterator(ms, tp("2022-07-09T15:00:00Z"), time.Minute)
+	require.Nil(t, err)
+	_, err = it.Next()
+	require.ErrorIs(t, err, common.ErrRateLimit)
+	require.Equal(t, 0, coinbase.CallCount())
+}
+
+func TestProviderFallbackWithUnsupportedProvider(t *testing.T) {
+	ms := common.MarketSource{Type: common.COIN, Provider: common.BINANCE, BaseAsset: "BTC", QuoteAsset: "USDT"}
+	m := NewMarket(WithProviderFallback([]string{common.BINANCE, "NOT_AN_EXCHANGE"}))
+
+	_, err := m.Iterator(ms, tp("2022-07-09T15:00:00Z"), time.Minute)
+	require.ErrorIs(t, err, common.ErrUnsuportedCandlestickProvider)
+}
+
+func TestWithFlatHoles(t *testing.T) {
+	ms := common.MarketSource{Type: common.COIN, Provider: common.BINANCE, BaseAsset: "BTC", QuoteAsset: "USDT"}
+	cstick1 := common.Candlestick{Timestamp: int(tp("2022-07-09T15:00:00Z").Unix()), OpenPrice: 1, HighestPrice: 1, LowestPrice: 1, ClosePrice: 1}
+	cstick2 := common.Candlestick{Timestamp: int(tp("2022-07-09T15:01:00Z").Unix()), OpenPrice: 2, HighestPrice: 2, LowestPrice: 2, ClosePrice: 2, Synthetic: true}
+	cstick3 := common.Candlestick{Timestamp: int(tp("2022-07-09T15:02:00Z").Unix()), OpenPrice: 2, HighestPrice: 2, LowestPrice: 2, ClosePrice: 2}
+	binance := candletest.NewFakeProvider([]candletest.Response{{Candlesticks: []common.Candlestick{cstick1, cstick2, cstick3}}})
+	binance.SetName(common.BINANCE)
+	m := NewMarket(WithFlatHoles(true), WithNoCache())
+	m.exchanges = map[string]common.Exchange{common.BINANCE: binance}
+
+	it, err := m.Iterator(ms, tp("2022-07-09T15:00:00Z"), time.Minute)
+	require.Nil(t, err)
+	expected := []common.Candlestick{
+		cstick1,
+		{Timestamp: cstick2.Timestamp, OpenPrice: 1, HighestPrice: 1, LowestPrice: 1, ClosePrice: 1, Synthetic: true},
+		cstick3,
+	}
+	for _, expectedCandlestick := range expected {
+		actual, err := it.Next()
+		require.Nil(t, err)
+		require.Equal(t, expectedCandlestick, actual)
+	}
+}
+
+func TestWithFinalOnly(t *testing.T) {
+	ms := common.MarketSource{Type: common.COIN, Provider: common.BINANCE, BaseAsset: "BTC", QuoteAsset: "USDT"}
+	cstick1 := common.Candlestick{Timestamp: int(tp("2022-07-09T15:00:00Z").Unix()), OpenPrice: 1, HighestPrice: 1, LowestPrice: 1, ClosePrice: 1}
+	cstick2 := common.Candlestick{Timestamp: int(tp("2022-07-09T15:01:00Z").Unix()), OpenPrice: 2, HighestPrice: 2, LowestPrice: 2, ClosePrice: 2}
+	binance := candletest.NewFakeProvider([]candletest.Response{{Candlesticks: []common.Candlestick{cstick1, cstick2}}})
+	binance.SetName(common.BINANCE)
+	binance.SetPatience(time.Minute)
+	m := NewMarket(WithFinalOnly(true))
+	m.exchanges = map[string]common.Exchange{common.BINANCE: binance}
+	m.timeNowFunc = func() time.Time { return tp("2022-07-09T15:02:30Z") }
+
+	it, err := m.Iterator(ms, tp("2022-07-09T15:00:00Z"), time.Minute)
+	require.Nil(t, err)
+	it.SetTimeNowFunc(m.timeNowFunc)
+	actual, err := it.Next()
+	require.Nil(t, err)
+	require.Equal(t, cstick1, actual)
+	_, err = it.Next()
+	require.ErrorIs(t, err, common.ErrNoNewTicksYet)
+}
+
+func TestWithPriceDecimals(t *testing.T) {
+	cstick := common.Candlestick{Timestamp: int(tp("2022-07-09T15:00:00Z").Unix()), OpenPrice: 0.1 + 0.2, HighestPrice: 0.35, LowestPrice: 0.1, ClosePrice: 0.30000000000000004}
+	binance := candletest.NewFakeProvider([]candletest.Response{{Candlesticks: []common.Candlestick{cstick}}})
+	binance.SetName(common.BINANCE)
+	m := NewMarket(WithPriceDecimals(1), WithClock(func() time.Time { return tp("2022-07-10T00:00:00Z") }))
+	m.exchanges = map[string]common.Exchange{common.BINANCE: binance}
+
+	actual, err := m.RequestRange(msBTCUSDT, tp("2022-07-09T15:00:00Z"), tp("2022-07-09T15:01:00Z"), time.Minute)
+	require.Nil(t, err)
+	require.Equal(t, []common.Candlestick{{Timestamp: cstick.Timestamp, OpenPrice: 0.3, HighestPrice: 0.4, LowestPrice: 0.1, ClosePrice: 0.3}}, actual)
+
+	// The cache keeps the prices as the exchange returned them.
+	m.priceDecimals = -1
+	actual, err = m.RequestRange(msBTCUSDT, tp("2022-07-09T15:00:00Z"), tp("2022-07-09T15:01:00Z"), time.Minute)
+	require.Nil(t, err)
+	require.Equal(t, []common.Candlestick{cstick}, actual)
+	require.Equal(t, 1, binance.CallCount())
+}
+
+func TestWithCacheZeroCheck(t *testing.T) {
+	ms := common.MarketSource{Type: common.COIN, Provider: common.BINANCE, BaseAsset: "BTC", QuoteAsset: "USDT"}
+	cstick := common.Candlestick{Timestamp: int(tp("2022-07-09T15:00:00Z").Unix()), OpenPrice: 0, HighestPrice: 1, LowestPrice: 0, ClosePrice: 1}
+	binance := candletest.NewFakeProvider([]candletest.Response{{Candlesticks: []common.Candlestick{cstick}}})
+	binance.SetName(common.BINANCE)
+	m := NewMarket(WithCacheZeroCheck(cache.ZeroCheckAllOHLC))
+	m.exchanges = map[string]common.Exchange{common.BINANCE: binance}
+
+	it, err := m.Iterator(ms, tp("2022-07-09T15:00:00Z"), time.Minute)
+	require.Nil(t, err)
+	_, err = it.Next()
+	require.Nil(t, err)
+
+	// The second iterator is served by the cache, since the candlestick with zero values was cached.
+	it, err = m.Iterator(ms, tp("2022-07-09T15:00:00Z"), time.Minute)
+	require.Nil(t, err)
+	actual, err := it.Next()
+	require.Nil(t, err)
+	require.Equal(t, cstick, actual)
+	require.Equal(t, iterator.SourceCache, it.LastSource())
+	require.Equal(t, 1, binance.CallCount())
+}
+
+func TestPing(t *testing.T) {
+	cstick := common.Candlestick{Timestamp: int(tp("2022-07-09T14:55:00Z").Unix()), OpenPrice: 1, HighestPrice: 1, LowestPrice: 1, ClosePrice: 1}
+	binance := candletest.NewFakeProvider([]candletest.Response{
+		{Candlesticks: []common.Candlestick{cstick}},
+		{Err: common.CandleReqError{Kind: common.KindRateLimited, Err: common.ErrRateLimit}},
+	})
+	binance.SetName(common.BINANCE)
+	coinbase := candletest.NewFakeProvider([]candletest.Response{{Candlesticks: []common.Candlestick{cstick}}})
+	coinbase.SetName(common.COINBASE)
+	m := NewMarket(WithNoCache())
+	m.exchanges = map[string]common.Exchange{common.BINANCE: binance, common.COINBASE: coinbase}
+	m.timeNowFunc = func() time.Time { return tp("2022-07-09T15:00:30Z") }
+
+	require.Nil(t, m.Ping("binance"))
+	require.Equal(t, []candletest.Call{{
+		MarketSource:        common.MarketSource{Type: common.COIN, Provider: common.BINANCE, BaseAsset: "BTC", QuoteAsset: "USDT"},
+		StartTime:           tp("2022-07-09T14:55:00Z"),
+		CandlestickInterval: time.Minute,
+	}}, binance.CallsSnapshot())
+
+	var reqErr common.CandleReqError
+	err := m.Ping(common.BINANCE)
+	require.ErrorAs(t, err, &reqErr)
+	require.Equal(t, common.KindRateLimited, reqErr.Kind)
+
+	require.Nil(t, m.Ping(common.COINBASE))
+	require.Equal(t, "USD", coinbase.CallsSnapshot()[0].MarketSource.QuoteAsset)
+
+	require.ErrorIs(t, m.Ping("NOT_AN_EXCHANGE"), common.ErrUnsuportedCandlestickProvider)
+}
+
+func TestRegisterProvider(t *testing.T) {
+	cstick := common.Candlestick{Timestamp: int(tp("2022-07-09T15:00:00Z").Unix()), OpenPrice: 1, HighestPrice: 1, LowestPrice: 1, ClosePrice: 1}
+	fake := candletest.NewFakeProvider([]candletest.Response{{Candlesticks: []common.Candlestick{cstick}}})
+	m := NewMarket(WithNoCache())
+
+	// Embedding the interface hides FakeProvider's Exchange methods, so it's a bare CandlestickProvider.
+	m.RegisterProvider("myexchange", struct{ common.CandlestickProvider }{fake})
+	provider, err := m.Provider("MYEXCHANGE")
+	require.Nil(t, err)
+	require.Equal(t, "FAKE", provider.Name())
+	require.Contains(t, m.Providers(), ProviderInfo{Name: "MYEXCHANGE"})
+	m.SetDebug(true)
+
+	it, err := m.Iterator(common.MarketSource{Type: common.COIN, Provider: "MyExchange", BaseAsset: "BTC", QuoteAsset: "USDT"}, tp("2022-07-09T15:00:00Z"), time.Minute)
+	require.Nil(t, err)
+	actual, err := it.Next()
+	require.Nil(t, err)
+	require.Equal(t, cstick, actual)
+
+	// Exchanges are registered as is.
+	m.RegisterProvider("other", fake)
+	provider, err = m.Provider("OTHER")
+	require.Nil(t, err)
+	require.Equal(t, fake, provider)
+
+	_, err = m.Provider("NOT_AN_EXCHANGE")
+	require.ErrorIs(t, err, common.ErrUnsupportedProvider)
+	require.ErrorIs(t, err, common.ErrUnsuportedCandlestickProvider)
+	require.Contains(t, err.Error(), "NOT_AN_EXCHANGE")
+}
+
+// describedProvider is a bare CandlestickProvider that implements some optional interfaces.
+type describedProvider struct {
+	common.CandlestickProvider
+}
+
+func (describedProvider) SupportedIntervals() []time.Duration { return []time.Duration{time.Hour} }
+func (describedProvider) MaxHistoryDepth() time.Duration      { return 24 * time.Hour }
+func (describedProvider) TimestampSemantics() common.TimestampSemantics {
+	return common.CloseStamped
+}
+func (describedProvider) Anchor() common.Anchor {
+	return common.NewAnchor("MYEXCHANGE").WithWeekStart(time.Sunday)
+}
+
+func TestRegisterProviderForwardsOptionalInterfaces(t *testing.T) {
+	m := NewMarket(WithNoCache())
+	m.RegisterProvider("myexchange", describedProvider{candletest.NewFakeProvider(nil)})
+
+	require.Contains(t, m.Providers(), ProviderInfo{Name: "MYEXCHANGE", SupportedIntervals: []time.Duration{time.Hour}, MaxHistoryDepth: 24 * time.Hour})
+	provider, err := m.Provider("MYEXCHANGE")
+	require.Nil(t, err)
+	require.Equal(t, time.Sunday, common.AnchorOf(provider).WeekStart())
+	require.Equal(t, common.CloseStamped, common.TimestampSemanticsOf(provider))
+
+	// Without the optional interfaces, the defaults apply.
+	m.RegisterProvider("bare", struct{ common.CandlestickProvider }{candletest.NewFakeProvider(nil)})
+	provider, err = m.Provider("BARE")
+	require.Nil(t, err)
+	require.Equal(t, common.NewAnchor("FAKE"), common.AnchorOf(provider))
+	require.Equal(t, common.OpenStamped, common.TimestampSemanticsOf(provider))
+	require.Zero(t, common.MaxCandlesPerRequest(provider))
+}
+
+func TestWithClock(t *testing.T) {
+	ms := common.MarketSource{Type: common.COIN, Provider: common.BINANCE, BaseAsset: "BTC", QuoteAsset: "USDT"}
+	cstick := common.Candlestick{Timestamp: int(tp("2022-07-09T15:00:00Z").Unix()), OpenPrice: 1, HighestPrice: 1, LowestPrice: 1, ClosePrice: 1}
+	binance := candletest.NewFakeProvider([]candletest.Response{{Candlesticks: []common.Candlestick{cstick}}})
+	binance.SetName(common.BINANCE)
+	now := tp("2022-07-09T15:00:30Z")
+	m := NewMarket(WithNoCache(), WithClock(func() time.Time { return now }))
+	m.exchanges = map[string]common.Exchange{common.BINANCE: binance}
+
+	// The 15:00 candlestick hasn't closed yet at 15:00:30, so the exchange is not even requested.
+	it, err := m.Iterator(ms, tp("2022-07-09T15:00:00Z"), time.Minute)
+	require.Nil(t, err)
+	_, err = it.Next()
+	require.ErrorIs(t, err, common.ErrNoNewTicksYet)
+	require.Equal(t, 0, binance.CallCount())
+
+	now = tp("2022-07-09T15:01:30Z")
+	actual, err := m.Latest(ms, time.Minute)
+	require.Nil(t, err)
+	require.Equal(t, cstick, actual)
+}
+
+func TestRequestRange(t *testing.T) {
+	ms := common.MarketSource{Type: common.COIN, Provider: common.BINANCE, BaseAsset: "BTC", QuoteAsset: "USDT"}
+	cstick1 := common.Candlestick{Timestamp: int(tp("2022-07-09T15:00:00Z").Unix()), OpenPrice: 1, HighestPrice: 3, LowestPrice: 1, ClosePrice: 2}
+	cstick2 := common.Candlestick{Timestamp: int(tp("2022-07-09T15:01:00Z").Unix()), OpenPrice: 2, HighestPrice: 4, LowestPrice: 2, ClosePrice: 3}
+	cstick3 := common.Candlestick{Timestamp: int(tp("2022-07-09T15:02:00Z").Unix()), OpenPrice: 3, HighestPrice: 5, LowestPrice: 3, ClosePrice: 4}
+	binance := candletest.NewFakeProvider([]candletest.Response{{Candlesticks: []common.Candlestick{cstick1, cstick2, cstick3}}})
+	binance.SetName(common.BINANCE)
+	m := NewMarket(WithClock(func() time.Time { return tp("2022-07-10T00:00:00Z") }))
+	m.exchanges = map[string]common.Exchange{common.BINANCE: binance}
+
+	actual, err := m.RequestRange(ms, tp("2022-07-09T15:00:00Z"), tp("2022-07-09T15:02:00Z"), time.Minute)
+	require.Nil(t, err)
+	require.Equal(t, []common.Candlestick{cstick1, cstick2}, actual)
+
+	// The second request is served by the cache.
+	ts, open, high, low, close, err := m.RequestRangeColumns(ms, tp("2022-07-09T15:00:00Z"), tp("2022-07-09T15:03:00Z"), time.Minute)
+	require.Nil(t, err)
+	require.Equal(t, []int64{int64(cstick1.Timestamp), int64(cstick2.Timestamp), int64(cstick3.Timestamp)}, ts)
+	require.Equal(t, []float64{1, 2, 3}, open)
+	require.Equal(t, []float64{3, 4, 5}, high)
+	require.Equal(t, []float64{1, 2, 3}, low)
+	require.Equal(t, []float64{2, 3, 4}, close)
+	require.Equal(t, 1, binance.CallCount())
+
+	// Ranges reaching the present return the candlesticks available so far, which WithFinalOnly limits to final ones.
+	binance = candletest.NewFakeProvider([]candletest.Response{{Candlesticks: []common.Candlestick{cstick1, cstick2, cstick3}}})
+	binance.SetName(common.BINANCE)
+	m = NewMarket(WithFinalOnly(true), WithClock(func() time.Time { return tp("2022-07-09T15:02:30Z") }))
+	m.exchanges = map[string]common.Exchange{common.BINANCE: binance}
+	actual, err = m.RequestRange(ms, tp("2022-07-09T15:00:00Z"), tp("2022-07-09T16:00:00Z"), time.Minute)
+	require.Nil(t, err)
+	require.Equal(t, []common.Candlestick{cstick1, cstick2}, actual)
+}
+
+func TestRequestRangePartialLastPage(t *testing.T) {
+	cstick1 := common.Candlestick{Timestamp: int(tp("2022-07-09T15:00:00Z").Unix()), OpenPrice: 1, HighestPrice: 3, LowestPrice: 1, ClosePrice: 2}
+	cstick2 := common.Candlestick{Timestamp: int(tp("2022-07-09T15:01:00Z").Unix()), OpenPrice: 2, HighestPrice: 4, LowestPrice: 2, ClosePrice: 3}
+	cstick3 := common.Candlestick{Timestamp: int(tp("2022-07-09T15:02:00Z").Unix()), OpenPrice: 3, HighestPrice: 5, LowestPrice: 3, ClosePrice: 4}
+	cstick4 := common.Candlestick{Timestamp: int(tp("2022-07-09T15:03:00Z").Unix()), OpenPrice: 4, HighestPrice: 6, LowestPrice: 4, ClosePrice: 5}
+
+	// The page repeats the overlap candlestick, and its tip (15:03) is still open at 15:03:30.
+	binance := candletest.NewFakeProvider([]candletest.Response{{Candlesticks: []common.Candlestick{cstick1, cstick2, cstick2, cstick3, cstick4}}})
+	binance.SetName(common.BINANCE)
+	m := NewMarket(WithCacheSizes(map[time.Duration]int{}), WithClock(func() time.Time { return tp("2022-07-09T15:03:30Z") }))
+	m.exchanges = map[string]common.Exchange{common.BINANCE: binance}
+
+	actual, err := m.RequestRange(msBTCUSDT, tp("2022-07-09T15:00:00Z"), tp("2022-07-09T16:00:00Z"), time.Minute)
+	require.Nil(t, err)
+	require.Equal(t, []common.Candlestick{cstick1, cstick2, cstick3}, actual)
+
+	// The page overshoots the "to" time.
+	binance = candletest.NewFakeProvider([]candletest.Response{{Candlesticks: []common.Candlestick{cstick1, cstick2, cstick3, cstick4}}})
+	binance.SetName(common.BINANCE)
+	m = NewMarket(WithCacheSizes(map[time.Duration]int{}), WithClock(func() time.Time { return tp("2022-07-10T00:00:00Z") }))
+	m.exchanges = map[string]common.Exchange{common.BINANCE: binance}
+
+	actual, err = m.RequestRange(msBTCUSDT, tp("2022-07-09T15:00:00Z"), tp("2022-07-09T15:02:00Z"), time.Minute)
+	require.Nil(t, err)
+	require.Equal(t, []common.Candlestick{cstick1, cstick2}, actual)
+}
+
+func TestRequestRangeSpanningSeveralPages(t *testing.T) {
+	cs := []common.Candlestick{}
+	for i := 0; i < 5; i++ {
+		cs = append(cs, common.Candlestick{Timestamp: int(tp("2022-07-09T15:00:00Z").Unix()) + i*60, OpenPrice: 1, HighestPrice: 1, LowestPrice: 1, ClosePrice: 1})
+	}
+	binance := candletest.NewFakeProvider([]candletest.Response{{Candlesticks: cs[0:2]}, {Candlesticks: cs[2:4]}, {Candlesticks: cs[4:5]}})
+	binance.SetName(common.BINANCE)
+	binance.SetMaxCandlesPerRequest(2)
+	m := NewMarket(WithCacheSizes(map[time.Duration]int{}), WithClock(func() time.Time { return tp("2022-07-10T00:00:00Z") }))
+	m.exchanges = map[string]common.Exchange{common.BINANCE: binance}
+
+	actual, err := m.RequestRange(msBTCUSDT, tp("2022-07-09T15:00:00Z"), tp("2022-07-09T15:05:00Z"), time.Minute)
+	require.Nil(t, err)
+	require.Equal(t, cs, actual)
+	require.Equal(t, 3, binance.CallCount())
+	require.Equal(t, tp("2022-07-09T15:02:00Z"), binance.CallsSnapshot()[1].StartTime)
+	require.Equal(t, tp("2022-07-09T15:04:00Z"), binance.CallsSnapshot()[2].StartTime)
+}
+
+func TestRequestRecent(t *testing.T) {
+	cs := []common.Candlestick{}
+	for i := 0; i < 5; i++ {
+		price := common.JSONFloat64(i + 1)
+		cs = append(cs, common.Candlestick{Timestamp: int(tp("2022-07-09T15:00:00Z").Unix()) + i*60, OpenPrice: price, HighestPrice: price, LowestPrice: price, ClosePrice: price})
+	}
+	// At 15:04:30 with a minute of patience, 15:03 isn't final yet, so the last two final candlesticks are 15:01 & 15:02.
+	binance := candletest.NewFakeProvider([]candletest.Response{{Candlesticks: cs}})
+	binance.SetName(common.BINANCE)
+	binance.SetPatience(time.Minute)
+	m := NewMarket(WithCacheSizes(map[time.Duration]int{}), WithClock(func() time.Time { return tp("2022-07-09T15:04:30Z") }))
+	m.exchanges = map[string]common.Exchange{common.BINANCE: binance}
+
+	actual, err := m.RequestRecent(msBTCUSDT, time.Minute, 2)
+	require.Nil(t, err)
+	require.Equal(t, cs[1:3], actual)
+	require.Equal(t, 1, binance.CallCount())
+	require.Equal(t, tp("2022-07-09T15:00:00Z"), binance.CallsSnapshot()[0].StartTime)
+
+	actual, err = m.RequestRecent(msBTCUSDT, time.Minute, 0)
+	require.Nil(t, err)
+	require.Equal(t, []common.Candlestick{}, actual)
+}
+
+func TestFollowFrom(t *testing.T) {
+	cstick1 := common.Candlestick{Timestamp: int(tp("2022-07-09T15:00:00Z").Unix()), OpenPrice: 1, HighestPrice: 1, LowestPrice: 1, ClosePrice: 1}
+	cstick2 := common.Candlestick{Timestamp: int(tp("2022-07-09T15:01:00Z").Unix()), OpenPrice: 2, HighestPrice: 2, LowestPrice: 2, ClosePrice: 2}
+	cstick3 := common.Candlestick{Timestamp: int(tp("2022-07-09T15:02:00Z").Unix()), OpenPrice: 3, HighestPrice: 3, LowestPrice: 3, ClosePrice: 3}
+	forming := common.Candlestick{Timestamp: int(tp("2022-07-09T15:02:00Z").Unix()), OpenPrice: 9, HighestPrice: 9, LowestPrice: 9, ClosePrice: 9}
+	binance := candletest.NewFakeProvider([]candletest.Response{
+		{Candlesticks: []common.Candlestick{cstick1, cstick2, forming}},
+		{Candlesticks: []common.Candlestick{cstick3}},
+	})
+	binance.SetName(common.BINANCE)
+	binance.SetPatience(5 * time.Second)
+	now := tp("2022-07-09T15:02:30Z")
+	m := NewMarket(WithCacheSizes(map[time.Duration]int{}), WithClock(func() time.Time { return now }))
+	m.exchanges = map[string]common.Exchange{common.BINANCE: binance}
+
+	it, err := m.FollowFrom(msBTCUSDT, tp("2022-07-09T15:00:00Z"), time.Minute)
+	require.Nil(t, err)
+	sleeps := []time.Duration{}
+	it.(*follower).sleep = func(d time.Duration) {
+		sleeps = append(sleeps, d)
+		now = now.Add(d)
+	}
+	it.SetMaxCandles(3)
+
+	actual := []common.Candlestick{}
+	var candlestick common.Candlestick
+	for it.Scan(&candlestick) {
+		actual = append(actual, candlestick)
+	}
+	require.ErrorIs(t, it.Error(), common.ErrMaxCandlesReached)
+
+	// The forming candlestick is skipped, and the follower sleeps until 15:02 is final, i.e. 15:03:05.
+	require.Equal(t, []common.Candlestick{cstick1, cstick2, cstick3}, actual)
+	require.Equal(t, []time.Duration{35 * time.Second}, sleeps)
+	require.Equal(t, 2, binance.CallCount())
+}
+
+func TestFollowFromBacksOffOnTransientErrors(t *testing.T) {
+	cstick1 := common.Candlestick{Timestamp: int(tp("2022-07-09T15:00:00Z").Unix()), OpenPrice: 1, HighestPrice: 1, LowestPrice: 1, ClosePrice: 1}
+	cstick2 := common.Candlestick{Timestamp: int(tp("2022-07-09T15:01:00Z").Unix()), OpenPrice: 2, HighestPrice: 2, LowestPrice: 2, ClosePrice: 2}
+	rateLimitErr := common.CandleReqError{Kind: common.KindRateLimited, Err: common.ErrRateLimit, RetryAfter: 10 * time.Second}
+	transientErr := common.CandleReqError{Kind: common.KindTransient, Err: common.ErrExecutingRequest}
+	binance := candletest.NewFakeProvider([]candletest.Response{
+		{Err: rateLimitErr},
+		{Err: transientErr},
+		{Candlesticks: nil},
+		{Candlesticks: []common.Candlestick{cstick1}},
+		{Err: transientErr},
+		{Candlesticks: []common.Candlestick{cstick2}},
+	})
+	binance.SetName(common.BINANCE)
+	now := tp("2022-07-09T16:00:00Z")
+	m := NewMarket(WithCacheSizes(map[time.Duration]int{}), WithClock(func() time.Time { return now }))
+	m.exchanges = map[string]common.Exchange{common.BINANCE: binance}
+
+	it, err := m.FollowFrom(msBTCUSDT, tp("2022-07-09T15:00:00Z"), time.Minute)
+	require.Nil(t, err)
+	sleeps := []time.Duration{}
+	it.(*follower).sleep = func(d time.Duration) {
+		sleeps = append(sleeps, d)
+		now = now.Add(d)
+	}
+	it.SetMaxCandles(2)
+
+	actual := []common.Candlestick{}
+	var candlestick common.Candlestick
+	for it.Scan(&candlestick) {
+		actual = append(actual, candlestick)
+	}
+	require.ErrorIs(t, it.Error(), common.ErrMaxCandlesReached)
+	require.Equal(t, []common.Candlestick{cstick1, cstick2}, actual)
+
+	// The rate limit asks for 10s, then the backoff doubles (ErrExchangeReturnedNoTicks included), and it's reset by
+	// the first candlestick.
+	require.Equal(t, []time.Duration{10 * time.Second, 2 * time.Second, 4 * time.Second, time.Second}, sleeps)
+
+	// Other errors aren't retried, e.g. running out of the fake provider's responses.
+	it, err = m.FollowFrom(msBTCUSDT, tp("2022-07-09T15:02:00Z"), time.Minute)
+	require.Nil(t, err)
+	it.(*follower).sleep = func(d time.Duration) { t.Fatalf("unexpected sleep of %v", d) }
+	_, err = it.Next()
+	require.ErrorIs(t, err, common.ErrOutOfCandlesticks)
+}
+
+func TestRequestRangeDescending(t *testing.T) {
+	cstick1 := common.Candlestick{Timestamp: int(tp("2022-07-09T15:00:00Z").Unix()), OpenPrice: 1, HighestPrice: 3, LowestPrice: 1, ClosePrice: 2}
+	cstick2 := common.Candlestick{Timestamp: int(tp("2022-07-09T15:01:00Z").Unix()), OpenPrice: 2, HighestPrice: 4, LowestPrice: 2, ClosePrice: 3}
+	cstick3 := common.Candlestick{Timestamp: int(tp("2022-07-09T15:02:00Z").Unix()), OpenPrice: 3, HighestPrice: 5, LowestPrice: 3, ClosePrice: 4}
+	binance := candletest.NewFakeProvider([]candletest.Response{{Candlesticks: []common.Candlestick{cstick1, cstick2, cstick3}}})
+	binance.SetName(common.BINANCE)
+	m := NewMarket(WithDescendingOrder(true), WithClock(func() time.Time { return tp("2022-07-10T00:00:00Z") }))
+	m.exchanges = map[string]common.Exchange{common.BINANCE: binance}
+
+	actual, err := m.RequestRange(msBTCUSDT, tp("2022-07-09T15:00:00Z"), tp("2022-07-09T15:03:00Z"), time.Minute)
+	require.Nil(t, err)
+	require.Equal(t, []common.Candlestick{cstick3, cstick2, cstick1}, actual)
+
+	// The cache is still populated in ascending order, so the second request is served by it.
+	ts, _, _, _, _, err := m.RequestRangeColumns(msBTCUSDT, tp("2022-07-09T15:00:00Z"), tp("2022-07-09T15:02:00Z"), time.Minute)
+	require.Nil(t, err)
+	require.Equal(t, []int64{int64(cstick2.Timestamp), int64(cstick1.Timestamp)}, ts)
+	require.Equal(t, 1, binance.CallCount())
+
+	multi, err := m.RequestMultiInterval(msBTCUSDT, tp("2022-07-09T15:00:00Z"), []time.Duration{time.Minute}, 3)
+	require.Nil(t, err)
+	require.Equal(t, []common.Candlestick{cstick3, cstick2, cstick1}, multi[time.Minute])
+}
+
+var msBTCUSDT = common.MarketSource{Type: common.COIN, Provider: common.BINANCE, BaseAsset: "BTC", QuoteAsset: "USDT"}
+
+type fakeMarketLister struct {
+	*candletest.FakeProvider
+	calls int
+}
+
+func (l *fakeMarketLister) ListMarkets() ([]common.MarketSource, error) {
+	l.calls++
+	return []common.MarketSource{msBTCUSDT}, nil
+}
+
+func TestListMarkets(t *testing.T) {
+	lister := &fakeMarketLister{FakeProvider: candletest.NewFakeProvider(nil)}
+	now := tp("2022-07-09T15:00:00Z")
+	m := NewMarket(WithNoCache(), WithMarketListTTL(time.Hour))
+	m.exchanges = map[string]common.Exchange{common.BINANCE: lister, common.COINBASE: candletest.NewFakeProvider(nil)}
+	m.timeNowFunc = func() time.Time { return now }
+
+	marketSources, err := m.ListMarkets("binance")
+	require.Nil(t, err)
+	require.Equal(t, []common.MarketSource{msBTCUSDT}, marketSources)
+	require.Equal(t, 1, lister.calls)
+
+	marketSources[0].BaseAsset = "MUTATED"
+	marketSources, err = m.ListMarkets(common.BINANCE)
+	require.Nil(t, err)
+	require.Equal(t, []common.MarketSource{msBTCUSDT}, marketSources)
+	require.Equal(t, 1, lister.calls)
+
+	now = now.Add(time.Hour)
+	_, err = m.ListMarkets(common.BINANCE)
+	require.Nil(t, err)
+	require.Equal(t, 2, lister.calls)
+
+	_, err = m.ListMarkets(common.COINBASE)
+	require.ErrorIs(t, err, common.ErrNotSupported)
+
+	_, err = m.ListMarkets("NOT_AN_EXCHANGE")
+	require.ErrorIs(t, err, common.ErrUnsuportedCandlestickProvider)
+}
+
+func TestRequestMultiInterval(t *testing.T) {
+	cstick := func(ts string, price common.JSONFloat64) common.Candlestick {
+		return common.Candlestick{Timestamp: int(tp(ts).Unix()), OpenPrice: price, HighestPrice: price, LowestPrice: price, ClosePrice: price}
+	}
+	twoMinutely := []common.Candlestick{cstick("2022-07-09T15:00:00Z", 1), cstick("2022-07-09T15:02:00Z", 2), cstick("2022-07-09T15:04:00Z", 3), cstick("2022-07-09T15:06:00Z", 4)}
+	threeMinutely := []common.Candlestick{cstick("2022-07-09T15:00:00Z", 5), cstick("2022-07-09T15:03:00Z", 6)}
+	binance := candletest.NewFakeProvider([]candletest.Response{{Candlesticks: threeMinutely}, {Candlesticks: twoMinutely}})
+	binance.SetName(common.BINANCE)
+	m := NewMarket(WithClock(func() time.Time { return tp("2022-07-10T00:00:00Z") }))
+	m.exchanges = map[string]common.Exchange{common.BINANCE: binance}
+
+	actual, err := m.RequestMultiInterval(msBTCUSDT, tp("2022-07-09T15:00:00Z"), []time.Duration{4 * time.Minute, 2 * time.Minute, 3 * time.Minute}, 2)
+	require.Nil(t, err)
+	require.Equal(t, map[time.Duration][]common.Candlestick{
+		2 * time.Minute: twoMinutely[:2],
+		3 * time.Minute: threeMinutely,
+		4 * time.Minute: {
+			{Timestamp: int(tp("2022-07-09T15:00:00Z").Unix()), OpenPrice: 1, HighestPrice: 2, LowestPrice: 1, ClosePrice: 2},
+			{Timestamp: int(tp("2022-07-09T15:04:00Z").Unix()), OpenPrice: 3, HighestPrice: 4, LowestPrice: 3, ClosePrice: 4},
+		},
+	}, actual)
+
+	// 4m is resampled from 2m, but 3m isn't a multiple of 2m, so it's requested separately.
+	require.Equal(t, 2, binance.CallCount())
+	require.Equal(t, 3*time.Minute, binance.CallsSnapshot()[0].CandlestickInterval)
+	require.Equal(t, 2*time.Minute, binance.CallsSnapshot()[1].CandlestickInterval)
+
+	actual, err = m.RequestMultiInterval(msBTCUSDT, tp("2022-07-09T15:00:00Z"), []time.Duration{time.Minute}, 0)
+	require.Nil(t, err)
+	require.Equal(t, map[time.Duration][]common.Candlestick{time.Minute: {}}, actual)
+}
+
+func TestRequestMultiIntervalKucoinWeeksMatchNativeWeeks(t *testing.T) {
+	ms := common.MarketSource{Type: common.COIN, Provider: common.KUCOIN, BaseAsset: "BTC", QuoteAsset: "USDT"}
+	daily := []common.Candlestick{}
+	for ts := tp("2021-01-02T00:00:00Z"); ts.Before(tp("2021-01-21T00:00:00Z")); ts = ts.Add(24 * time.Hour) {
+		daily = append(daily, common.Candlestick{Timestamp: int(ts.Unix()), OpenPrice: 1, HighestPrice: 1, LowestPrice: 1, ClosePrice: 1})
+	}
+	weekly := []common.Candlestick{
+		{Timestamp: int(tp("2021-01-07T00:00:00Z").Unix()), OpenPrice: 1, HighestPrice: 1, LowestPrice: 1, ClosePrice: 1},
+		{Timestamp: int(tp("2021-01-14T00:00:00Z").Unix()), OpenPrice: 1, HighestPrice: 1, LowestPrice: 1, ClosePrice: 1},
+	}
+	kucoin := candletest.NewFakeProvider([]candletest.Response{{Candlesticks: daily}, {Candlesticks: weekly}})
+	kucoin.SetName(common.KUCOIN)
+	m := NewMarket(WithNoCache(), WithClock(func() time.Time { return tp("2021-02-01T00:00:00Z") }))
+	m.exchanges = map[string]common.Exchange{common.KUCOIN: kucoin}
+	week := 7 * 24 * time.Hour
+
+	// 2021-01-02 is a Saturday, and Kucoin's weeks start on Thursdays.
+	resampled, err := m.RequestMultiInterval(ms, tp("2021-01-02T00:00:00Z"), []time.Duration{24 * time.Hour, week}, 2)
+	require.Nil(t, err)
+	native, err := m.RequestMultiInterval(ms, tp("2021-01-02T00:00:00Z"), []time.Duration{week}, 2)
+	require.Nil(t, err)
+
+	require.Equal(t, 2, kucoin.CallCount())
+	require.Equal(t, 24*time.Hour, kucoin.CallsSnapshot()[0].CandlestickInterval)
+	require.Equal(t, week, kucoin.CallsSnapshot()[1].CandlestickInterval)
+	require.Equal(t, tp("2021-01-07T00:00:00Z"), kucoin.CallsSnapshot()[1].StartTime)
+	require.Len(t, resampled[week], 2)
+	for i := range native[week] {
+		require.Equal(t, native[week][i].Timestamp, resampled[week][i].Timestamp)
+	}
+}
+
+func TestRequestBlended(t *testing.T) {
+	cstick := func(ts string, price common.JSONFloat64) common.Candlestick {
+		return common.Candlestick{Timestamp: int(tp(ts).Unix()), OpenPrice: price, HighestPrice: price, LowestPrice: price, ClosePrice: price}
+	}
+	// Bitstamp misses 15:01, which is patched in as Synthetic and skipped.
+	binance := candletest.NewFakeProvider([]candletest.Response{{Candlesticks: []common.Candlestick{cstick("2022-07-09T15:00:00Z", 1), cstick("2022-07-09T15:01:00Z", 2), cstick("2022-07-09T15:02:00Z", 3)}}})
+	binance.SetName(common.BINANCE)
+	bitstamp := candletest.NewFakeProvider([]candletest.Response{{Candlesticks: []common.Candlestick{cstick("2022-07-09T15:00:00Z", 3), cstick("2022-07-09T15:02:00Z", 6)}}})
+	bitstamp.SetName(common.BITSTAMP)
+	m := NewMarket(WithCacheSizes(map[time.Duration]int{}), WithClock(func() time.Time { return tp("2022-07-09T15:03:30Z") }))
+	m.exchanges = map[string]common.Exchange{common.BINANCE: binance, common.BITSTAMP: bitstamp}
+
+	msBitstamp := common.MarketSource{Type: common.COIN, Provider: common.BITSTAMP, BaseAsset: "BTC", QuoteAsset: "USDT"}
+	actual, err := m.RequestBlended([]common.MarketSource{msBTCUSDT, msBitstamp}, tp("2022-07-09T15:00:00Z"), time.Minute, common.BlendMean)
+	require.Nil(t, err)
+	require.Equal(t, []common.Candlestick{cstick("2022-07-09T15:00:00Z", 2), cstick("2022-07-09T15:01:00Z", 2), cstick("2022-07-09T15:02:00Z", 4.5)}, actual)
+
+	actual, err = m.RequestBlended(nil, tp("2022-07-09T15:00:00Z"), time.Minute, common.BlendMean)
+	require.Nil(t, err)
+	require.Equal(t, []common.Candlestick{}, actual)
+}
+
+func TestWithProviderOption(t *testing.T) {
+	for name, exchange := range buildExchanges() {
+		_, ok := exchange.(common.ConfigurableExchange)
+		require.True(t, ok, "%v is not a ConfigurableExchange", name)
+	}
+
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintln(w, `{"code":-1000,"msg":"An unknown error occurred while processing the request."}`)
+	}))
+	defer ts.Close()
+
+	client := &http.Client{Timeout: time.Second}
+	m := NewMarket(
+		WithNoCache(),
+		WithRetryStrategy(common.RetryStrategy{Attempts: 3, FirstSleepTime: time.Millisecond}),
+		WithProviderOption("binance", ProviderAPIURL(ts.URL+"/"), ProviderHTTPClient(client), ProviderRetryStrategy(common.RetryStrategy{Attempts: 2, FirstSleepTime: time.Millisecond}), ProviderPatience(time.Hour)),
+		WithProviderOption("NOT_AN_EXCHANGE", ProviderPatience(time.Hour)),
+	)
+	require.Equal(t, time.Hour, m.exchanges[common.BINANCE].Patience())
+
+	_, err := m.exchanges[common.BINANCE].RequestCandlesticks(msBTCUSDT, tp("2022-07-09T15:00:00Z"), time.Minute)
+	var reqErr common.CandleReqError
+	require.ErrorAs(t, err, &reqErr)
+	require.Equal(t, -1000, reqErr.Code)
+	require.Equal(t, 2, requests)
+}
+
+func TestWithBlockOnRateLimit(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Retry-After", "2")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer ts.Close()
+
+	// The exchange asks to wait longer than the cap, so the request fails right away rather than sleeping.
+	m := NewMarket(
+		WithNoCache(),
+		WithBlockOnRateLimit(true),
+		WithMaxRateLimitWait(time.Second),
+		WithProviderOption("binance", ProviderAPIURL(ts.URL+"/")),
+	)
+	_, err := m.exchanges[common.BINANCE].RequestCandlesticks(msBTCUSDT, tp("2022-07-09T15:00:00Z"), time.Minute)
+	require.ErrorIs(t, err, common.ErrRateLimit)
+	require.Equal(t, 1, requests)
+}
+
+type recordingObserver struct {
+	requests     []error
+	cacheLookups []bool
+}
+
+func (o *recordingObserver) ObserveRequest(provider string, candlestickInterval time.Duration, duration time.Duration, err error) {
+	o.requests = append(o.requests, err)
+}
+
+func (o *recordingObserver) ObserveCacheLookup(provider string, candlestickInterval time.Duration, hit bool) {
+	o.cacheLookups = append(o.cacheLookups, hit)
+}
+
+func TestWithMetricsObserver(t *testing.T) {
+	cstick := common.Candlestick{Timestamp: int(tp("2022-07-09T15:00:00Z").Unix()), OpenPrice: 1, HighestPrice: 1, LowestPrice: 1, ClosePrice: 1}
+	rateLimitErr := common.CandleReqError{Kind: common.KindRateLimited, Err: common.ErrRateLimit}
+	binance := candletest.NewFakeProvider([]candletest.Response{{Err: rateLimitErr}, {Candlesticks: []common.Candlestick{cstick}}})
+	binance.SetName(common.BINANCE)
+	observer := &recordingObserver{}
+	m := NewMarket(WithMetricsObserver(observer), WithClock(func() time.Time { return tp("2022-07-10T00:00:00Z") }))
+	m.exchanges = map[string]common.Exchange{common.BINANCE: binance}
+
+	_, err := m.RequestRange(msBTCUSDT, tp("2022-07-09T15:00:00Z"), tp("2022-07-09T15:01:00Z"), time.Minute)
+	require.ErrorIs(t, err, common.ErrRateLimit)
+	_, err = m.RequestRange(msBTCUSDT, tp("2022-07-09T15:00:00Z"), tp("2022-07-09T15:01:00Z"), time.Minute)
+	require.Nil(t, err)
+	_, err = m.RequestRange(msBTCUSDT, tp("2022-07-09T15:00:00Z"), tp("2022-07-09T15:01:00Z"), time.Minute)
+	require.Nil(t, err)
+
+	require.Equal(t, []error{rateLimitErr, nil}, observer.requests)
+	require.Equal(t, []bool{false, false, true}, observer.cacheLookups)
+}
+
+// listedProvider serves hourly candlesticks from listedAt onwards. With a pageSize, pages before the listing are empty
+// (like COINBASE); without one, they skip to the listing (like BINANCE).
+type listedProvider struct {
+	*candletest.FakeProvider
+	listedAt time.Time
+	pageSize int
+	calls    int
+}
+
+func (p *listedProvider) RequestCandlesticks(marketSource common.MarketSource, startTime time.Time, candlestickInterval time.Duration) ([]common.Candlestick, error) {
+	p.calls++
+	if p.pageSize > 0 && !startTime.Add(time.Duration(p.pageSize)*candlestickInterval).After(p.listedAt) {
+		return nil, common.CandleReqError{IsNotRetryable: true, Kind: common.KindTooFarBack, Err: common.ErrBeforeListing}
+	}
+	if startTime.Before(p.listedAt) {
+		startTime = p.listedAt
+	}
+	return []common.Candlestick{{Timestamp: int(startTime.Unix()), OpenPrice: 1, HighestPrice: 1, LowestPrice: 1, ClosePrice: 1}}, nil
+}
+
+// blockingProvider is a listedProvider whose requests for blockedBaseAsset block until release is closed, signaling
+// started on the first one.
+type blockingProvider struct {
+	*listedProvider
+	blockedBaseAsset string
+	started          chan struct{}
+	release          chan struct{}
+	once             sync.Once
+	lock             sync.Mutex
+}
+
+func (p *blockingProvider) RequestCandlesticks(marketSource common.MarketSource, startTime time.Time, candlestickInterval time.Duration) ([]common.Candlestick, error) {
+	if marketSource.BaseAsset == p.blockedBaseAsset {
+		p.once.Do(func() { close(p.started) })
+		<-p.release
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.listedProvider.RequestCandlesticks(marketSource, startTime, candlestickInterval)
+}
+
+func TestEarliestCandle(t *testing.T) {
+	listedAt := tp("2021-03-04T05:00:00Z")
+	expected := common.Candlestick{Timestamp: int(listedAt.Unix()), OpenPrice: 1, HighestPrice: 1, LowestPrice: 1, ClosePrice: 1}
+
+	tss := []struct {
+		name          string
+		pageSize      int
+		expectedCalls int
+	}{
+		{name: "Provider that skips to the listing takes a single request", pageSize: 0, expectedCalls: 1},
+		{name: "Provider with empty pages before the listing is binary-searched", pageSize: 300, expectedCalls: 19},
+	}
+	for _, ts := range tss {
+		t.Run(ts.name, func(t *testing.T) {
+			provider := &listedProvider{FakeProvider: candletest.NewFakeProvider(nil), listedAt: listedAt, pageSize: ts.pageSize}
+			m := NewMarket(WithNoCache())
+			m.exchanges = map[string]common.Exchange{common.BINANCE: provider}
+			m.timeNowFunc = func() time.Time { return tp("2022-07-09T15:00:00Z") }
+
+			candlestick, err := m.EarliestCandle(msBTCUSDT, time.Hour)
+			require.Nil(t, err)
+			require.Equal(t, expected, candlestick)
+			require.Equal(t, ts.expectedCalls, provider.calls)
+
+			candlestick, err = m.EarliestCandle(msBTCUSDT, time.Hour)
+			require.Nil(t, err)
+			require.Equal(t, expected, candlestick)
+			require.Equal(t, ts.expectedCalls, provider.calls)
+		})
+	}
+
+	t.Run("Fails if the provider has no candlesticks", func(t *testing.T) {
+		m := NewMarket(WithNoCache())
+		m.exchanges = map[string]common.Exchange{common.BINANCE: candletest.NewFakeProvider(nil)}
+		_, err := m.EarliestCandle(msBTCUSDT, time.Hour)
+		require.ErrorIs(t, err, common.ErrOutOfCandlesticks)
+	})
+
+	t.Run("Searches for other market sources don't wait for each other", func(t *testing.T) {
+		listed := &listedProvider{FakeProvider: candletest.NewFakeProvider(nil), listedAt: listedAt}
+		provider := &blockingProvider{listedProvider: listed, blockedBaseAsset: "ETH", started: make(chan struct{}), release: make(chan struct{})}
+		m := NewMarket(WithNoCache())
+		m.exchanges = map[string]common.Exchange{common.BINANCE: provider}
+		m.timeNowFunc = func() time.Time { return tp("2022-07-09T15:00:00Z") }
+
+		msETHUSDT := common.MarketSource{Type: common.COIN, Provider: common.BINANCE, BaseAsset: "ETH", QuoteAsset: "USDT"}
+		blocked := make(chan error)
+		go func() {
+			_, err := m.EarliestCandle(msETHUSDT, time.Hour)
+			blocked <- err
+		}()
+		<-provider.started
+
+		done := make(chan error)
+		go func() {
+			_, err := m.EarliestCandle(msBTCUSDT, time.Hour)
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			require.Nil(t, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("EarliestCandle waited for the search of another market source")
+		}
+		close(provider.release)
+		require.Nil(t, <-blocked)
+	})
+
+	t.Run("Fails with an unsupported provider", func(t *testing.T) {
+		_, err := NewMarket(WithNoCache()).EarliestCandle(common.MarketSource{Type: common.COIN, Provider: "NOT_AN_EXCHANGE", BaseAsset: "BTC", QuoteAsset: "USDT"}, time.Hour)
+		require.ErrorIs(t, err, common.ErrUnsuportedCandlestickProvider)
+	})
+}
+
+func TestProviderStats(t *testing.T) {
+	body := `[[1657378800000,"1","1","1","1","1",1657378859999,"1",1,"1","1","0"]]`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, body)
+	}))
+	defer ts.Close()
+
+	m := NewMarket(WithNoCache(), WithProviderOption("binance", ProviderAPIURL(ts.URL+"/")))
+	_, err := m.exchanges[common.BINANCE].RequestCandlesticks(msBTCUSDT, tp("2022-07-09T15:00:00Z"), time.Minute)
+	require.Nil(t, err)
+
+	stats, err := m.ProviderStats("binance")
+	require.Nil(t, err)
+	require.Equal(t, 1, stats.RequestsMade)
+	require.Equal(t, int64(len(body)), stats.BytesReceived)
+	require.Equal(t, 1, stats.CandlesticksReceived)
+
+	m.exchanges[common.COINBASE] = candletest.NewFakeProvider(nil)
+	_, err = m.ProviderStats(common.COINBASE)
+	require.ErrorIs(t, err, common.ErrNotSupported)
+
+	_, err = m.ProviderStats("NOT_AN_EXCHANGE")
+	require.ErrorIs(t, err, common.ErrUnsuportedCandlestickProvider)
+}
+
+func TestProviderRawBodyMaxBytes(t *testing.T) {
+	body := `not json at all`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, body)
+	}))
+	defer ts.Close()
+
+	noRetries := ProviderRetryStrategy(common.RetryStrategy{Attempts: 1})
+	m := NewMarket(WithNoCache(), WithProviderOption("binance", ProviderAPIURL(ts.URL+"/"), noRetries, ProviderRawBodyMaxBytes(3)))
+	_, err := m.exchanges[common.BINANCE].RequestCandlesticks(msBTCUSDT, tp("2022-07-09T15:00:00Z"), time.Minute)
+	require.Equal(t, common.KindBadData, err.(common.CandleReqError).Kind)
+	require.Equal(t, []byte("not"), err.(common.CandleReqError).RawBody)
+
+	// Other Markets keep the default.
+	m = NewMarket(WithNoCache(), WithProviderOption("binance", ProviderAPIURL(ts.URL+"/"), noRetries))
+	_, err = m.exchanges[common.BINANCE].RequestCandlesticks(msBTCUSDT, tp("2022-07-09T15:00:00Z"), time.Minute)
+	require.Equal(t, []byte(body), err.(common.CandleReqError).RawBody)
+}
+
+func TestMarketSourceNormalizer(t *testing.T) {
+	symbols := []string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		symbols = append(symbols, r.URL.Query().Get("symbol"))
+		fmt.Fprint(w, `[[1657378800000,"1","1","1","1","1",1657378859999,"1",1,"1","1","0"]]`)
+	}))
+	defer ts.Close()
+
+	m := NewMarket(
+		WithNoCache(),
+		WithProviderOption("binance", ProviderAPIURL(ts.URL+"/")),
+		WithMarketSourceNormalizer(QuoteAssetEquivalences(map[string]map[string]string{"binance": {"usd": "usdt"}})),
+	)
+	msBTCUSD := common.MarketSource{Type: common.COIN, Provider: common.BINANCE, BaseAsset: "BTC", QuoteAsset: "USD"}
+	iter, err := m.Iterator(msBTCUSD, tp("2022-07-09T15:00:00Z"), time.Minute)
+	require.Nil(t, err)
+	_, err = iter.Next()
+	require.Nil(t, err)
+	require.Equal(t, []string{"BTCUSDT"}, symbols)
+
+	// Other providers and quote assets are left as they are.
+	coinbase := candletest.NewFakeProvider([]candletest.Response{{Candlesticks: []common.Candlestick{{Timestamp: 1657378800, OpenPrice: 1, ClosePrice: 1, LowestPrice: 1, HighestPrice: 1}}}})
+	m.exchanges[common.COINBASE] = coinbase
+	msCoinbase := msBTCUSD
+	msCoinbase.Provider = common.COINBASE
+	iter, err = m.Iterator(msCoinbase, tp("2022-07-09T15:00:00Z"), time.Minute)
+	require.Nil(t, err)
+	_, err = iter.Next()
+	require.Nil(t, err)
+	require.Equal(t, "USD", coinbase.CallsSnapshot()[0].MarketSource.QuoteAsset)
+	require.Equal(t, msBTCUSDT, QuoteAssetEquivalences(map[string]map[string]string{"BINANCE": {"USD": "USDT"}})(msBTCUSDT))
+}
+
+func TestRateLimitBreakerState(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer ts.Close()
+
+	m := NewMarket(WithNoCache(), WithRateLimitBreaker(time.Second), WithRetryStrategy(common.RetryStrategy{Attempts: 1}), WithProviderOption("binance", ProviderAPIURL(ts.URL+"/")))
+	state, err := m.RateLimitBreakerState(common.BINANCE)
+	require.Nil(t, err)
+	require.Equal(t, common.BreakerState{Enabled: true}, state)
+
+	_, err = m.exchanges[common.BINANCE].RequestCandlesticks(msBTCUSDT, tp("2022-07-09T15:00:00Z"), time.Minute)
+	require.ErrorIs(t, err, common.ErrRateLimit)
+	state, err = m.RateLimitBreakerState("binance")
+	require.Nil(t, err)
+	require.True(t, state.Open)
+	require.Equal(t, 1, state.Trips)
+
+	// Other providers aren't paused.
+	state, err = m.RateLimitBreakerState(common.COINBASE)
+	require.Nil(t, err)
+	require.False(t, state.Open)
+
+	m.exchanges[common.COINBASE] = candletest.NewFakeProvider(nil)
+	_, err = m.RateLimitBreakerState(common.COINBASE)
+	require.ErrorIs(t, err, common.ErrNotSupported)
+
+	_, err = m.RateLimitBreakerState("NOT_AN_EXCHANGE")
+	require.ErrorIs(t, err, common.ErrUnsuportedCandlestickProvider)
+}
+
+func TestInFlightRequests(t *testing.T) {
+	inFlight := make(chan int, 1)
+	var m Market
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count, _ := m.InFlightRequests(common.BINANCE)
+		inFlight <- count
+		fmt.Fprint(w, `[[1657378800000,"1","1","1","1","1",1657378859999,"1",1,"1","1","0"]]`)
+	}))
+	defer ts.Close()
+
+	m = NewMarket(WithNoCache(), WithProviderOption("binance", ProviderAPIURL(ts.URL+"/"), ProviderMaxInFlightRequests(1)))
+	_, err := m.exchanges[common.BINANCE].RequestCandlesticks(msBTCUSDT, tp("2022-07-09T15:00:00Z"), time.Minute)
+	require.Nil(t, err)
+	require.Equal(t, 1, <-inFlight)
+	count, err := m.InFlightRequests("binance")
+	require.Nil(t, err)
+	require.Equal(t, 0, count)
+
+	m.exchanges[common.COINBASE] = candletest.NewFakeProvider(nil)
+	_, err = m.InFlightRequests(common.COINBASE)
+	require.ErrorIs(t, err, common.ErrNotSupported)
+
+	_, err = m.InFlightRequests("NOT_AN_EXCHANGE")
+	require.ErrorIs(t, err, common.ErrUnsuportedCandlestickProvider)
+}
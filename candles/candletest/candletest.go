@@ -0,0 +1,197 @@
+// Package candletest provides a scriptable fake CandlestickProvider, useful for unit testing code that consumes
+// candlesticks without hitting real exchanges.
+//
+// Usage:
+//
+// ```
+//
+//	provider := candletest.NewFakeProvider([]candletest.Response{
+//		{Candlesticks: []common.Candlestick{{Timestamp: 1642329960, OpenPrice: 1, ClosePrice: 1, LowestPrice: 1, HighestPrice: 1}}},
+//		{Err: common.ErrOutOfCandlesticks},
+//	})
+//
+//	iter, err := iterator.NewIterator(marketSource, startTime, time.Minute, nil, provider)
+//	...
+//	require.Equal(t, 2, provider.CallCount())
+//
+// ```
+package candletest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/marianogappa/crypto-candles/candles/common"
+)
+
+// Response is a scripted response for a single RequestCandlesticks call.
+type Response struct {
+	Candlesticks []common.Candlestick
+	Err          error
+}
+
+// Call records the arguments of a RequestCandlesticks call.
+type Call struct {
+	MarketSource        common.MarketSource
+	StartTime           time.Time
+	CandlestickInterval time.Duration
+}
+
+// FakeProvider is a CandlestickProvider (and Exchange) that returns scripted responses in order, and records every
+// call made to it. It's safe for concurrent use; read the recorded calls with CallCount and CallsSnapshot.
+type FakeProvider struct {
+	// calls contains every call to RequestCandlesticks, in order. Start times are stored in UTC.
+	calls []Call
+
+	// responses is the queue of scripted responses. The nth call to RequestCandlesticks returns the nth response.
+	responses []Response
+
+	patience        time.Duration
+	patienceFor     map[time.Duration]time.Duration
+	maxHistoryDepth time.Duration
+	maxCandles      int
+	intervals       []time.Duration
+	name            string
+	debug           bool
+	lock            sync.Mutex
+}
+
+// NewFakeProvider is the constructor for FakeProvider. It has zero patience, no max history depth, and is named "FAKE"
+// by default.
+func NewFakeProvider(responses []Response) *FakeProvider {
+	return &FakeProvider{responses: responses, name: "FAKE"}
+}
+
+// RequestCandlesticks records the call and returns the next scripted response. If the scripted responses ran out, it
+// fails with ErrOutOfCandlesticks.
+func (p *FakeProvider) RequestCandlesticks(marketSource common.MarketSource, startTime time.Time, candlestickInterval time.Duration) ([]common.Candlestick, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	i := len(p.calls)
+	p.calls = append(p.calls, Call{MarketSource: marketSource, StartTime: startTime.UTC(), CandlestickInterval: candlestickInterval})
+	if i >= len(p.responses) {
+		return nil, common.CandleReqError{IsNotRetryable: true, Kind: common.KindUnknown, Err: common.ErrOutOfCandlesticks}
+	}
+	return p.responses[i].Candlesticks, p.responses[i].Err
+}
+
+// CallCount returns how many times RequestCandlesticks was called so far.
+func (p *FakeProvider) CallCount() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return len(p.calls)
+}
+
+// CallsSnapshot returns a copy of every call to RequestCandlesticks so far, in order. Start times are in UTC.
+func (p *FakeProvider) CallsSnapshot() []Call {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return append([]Call{}, p.calls...)
+}
+
+// SetResponses replaces the scripted responses. The nth call to RequestCandlesticks (counting the calls made so far)
+// returns the nth response.
+func (p *FakeProvider) SetResponses(responses []Response) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.responses = responses
+}
+
+// Patience returns the configured patience (zero by default).
+func (p *FakeProvider) Patience() time.Duration {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.patience
+}
+
+// SetPatience configures the value returned by Patience.
+func (p *FakeProvider) SetPatience(patience time.Duration) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.patience = patience
+}
+
+// PatienceFor returns the patience configured for the candlestick interval, or Patience if none was configured.
+func (p *FakeProvider) PatienceFor(candlestickInterval time.Duration) time.Duration {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if patience, ok := p.patienceFor[candlestickInterval]; ok {
+		return patience
+	}
+	return p.patience
+}
+
+// SetIntervalPatience configures the value returned by PatienceFor for the given candlestick interval.
+func (p *FakeProvider) SetIntervalPatience(candlestickInterval time.Duration, patience time.Duration) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.patienceFor == nil {
+		p.patienceFor = map[time.Duration]time.Duration{}
+	}
+	p.patienceFor[candlestickInterval] = patience
+}
+
+// MaxHistoryDepth returns the configured max history depth (zero, i.e. no limit, by default).
+func (p *FakeProvider) MaxHistoryDepth() time.Duration {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.maxHistoryDepth
+}
+
+// SetMaxHistoryDepth configures the value returned by MaxHistoryDepth.
+func (p *FakeProvider) SetMaxHistoryDepth(maxHistoryDepth time.Duration) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.maxHistoryDepth = maxHistoryDepth
+}
+
+// MaxCandlesPerRequest returns the configured max candles per request (zero, i.e. not known, by default).
+func (p *FakeProvider) MaxCandlesPerRequest() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.maxCandles
+}
+
+// SetMaxCandlesPerRequest configures the value returned by MaxCandlesPerRequest.
+func (p *FakeProvider) SetMaxCandlesPerRequest(maxCandles int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.maxCandles = maxCandles
+}
+
+// SupportedIntervals returns the configured supported intervals (nil, i.e. any candlestick interval is accepted, by
+// default).
+func (p *FakeProvider) SupportedIntervals() []time.Duration {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.intervals
+}
+
+// SetSupportedIntervals configures the value returned by SupportedIntervals.
+func (p *FakeProvider) SetSupportedIntervals(intervals []time.Duration) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.intervals = intervals
+}
+
+// Name returns the configured name ("FAKE" by default).
+func (p *FakeProvider) Name() string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.name
+}
+
+// SetName configures the value returned by Name.
+func (p *FakeProvider) SetName(name string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.name = name
+}
+
+// SetDebug exists to satisfy the Exchange interface. It has no effect.
+func (p *FakeProvider) SetDebug(debug bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.debug = debug
+}
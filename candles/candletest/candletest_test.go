@@ -0,0 +1,120 @@
+package candletest
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/marianogappa/crypto-candles/candles/common"
+	"github.com/marianogappa/crypto-candles/candles/iterator"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	_ common.Exchange             = &FakeProvider{}
+	_ common.PatienceConfigurable = &FakeProvider{}
+)
+
+func TestFakeProvider(t *testing.T) {
+	cstick := common.Candlestick{Timestamp: tInt("2020-01-02 00:00:00"), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+	p := NewFakeProvider([]Response{
+		{Candlesticks: []common.Candlestick{cstick}},
+		{Err: common.ErrRateLimit},
+	})
+
+	cs, err := p.RequestCandlesticks(msBTCUSDT, tp("2020-01-02 00:00:00"), time.Minute)
+	require.Nil(t, err)
+	require.Equal(t, []common.Candlestick{cstick}, cs)
+
+	_, err = p.RequestCandlesticks(msBTCUSDT, tp("2020-01-02 00:01:00"), time.Minute)
+	require.ErrorIs(t, err, common.ErrRateLimit)
+
+	_, err = p.RequestCandlesticks(msBTCUSDT, tp("2020-01-02 00:02:00"), time.Minute)
+	require.ErrorIs(t, err.(common.CandleReqError).Err, common.ErrOutOfCandlesticks)
+	require.Equal(t, common.KindUnknown, err.(common.CandleReqError).Kind)
+	require.True(t, err.(common.CandleReqError).IsNotRetryable)
+
+	require.Equal(t, []Call{
+		{MarketSource: msBTCUSDT, StartTime: tp("2020-01-02 00:00:00"), CandlestickInterval: time.Minute},
+		{MarketSource: msBTCUSDT, StartTime: tp("2020-01-02 00:01:00"), CandlestickInterval: time.Minute},
+		{MarketSource: msBTCUSDT, StartTime: tp("2020-01-02 00:02:00"), CandlestickInterval: time.Minute},
+	}, p.CallsSnapshot())
+}
+
+func TestFakeProviderConcurrentCalls(t *testing.T) {
+	p := NewFakeProvider(nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = p.RequestCandlesticks(msBTCUSDT, tp("2020-01-02 00:00:00"), time.Minute)
+			_ = p.CallCount()
+			p.SetPatience(time.Minute)
+			p.SetIntervalPatience(time.Hour, 2*time.Minute)
+			p.SetName("BINANCE")
+			_ = p.PatienceFor(time.Hour)
+			_ = p.Name()
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, 10, p.CallCount())
+
+	// Snapshots are copies, so they don't change with later calls.
+	calls := p.CallsSnapshot()
+	p.SetResponses([]Response{})
+	_, _ = p.RequestCandlesticks(msBTCUSDT, tp("2020-01-02 00:00:00"), time.Minute)
+	require.Len(t, calls, 10)
+	require.Equal(t, 11, p.CallCount())
+}
+
+func TestFakeProviderPatienceAndName(t *testing.T) {
+	p := NewFakeProvider(nil)
+	require.Equal(t, time.Duration(0), p.Patience())
+	require.Equal(t, time.Duration(0), p.MaxHistoryDepth())
+	require.Equal(t, "FAKE", p.Name())
+
+	p.SetPatience(time.Minute)
+	p.SetMaxHistoryDepth(24 * time.Hour)
+	p.SetName("BINANCE")
+	require.Equal(t, time.Minute, p.Patience())
+	require.Equal(t, 24*time.Hour, p.MaxHistoryDepth())
+	require.Equal(t, "BINANCE", p.Name())
+}
+
+func TestFakeProviderWorksWithIterator(t *testing.T) {
+	cstick1 := common.Candlestick{Timestamp: tInt("2020-01-02 00:00:00"), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+	cstick2 := common.Candlestick{Timestamp: tInt("2020-01-02 00:01:00"), OpenPrice: 1235, HighestPrice: 1235, LowestPrice: 1235, ClosePrice: 1235}
+	p := NewFakeProvider([]Response{{Candlesticks: []common.Candlestick{cstick1, cstick2}}})
+
+	it, err := iterator.NewIterator(msBTCUSDT, tp("2020-01-02 00:00:00"), time.Minute, nil, p)
+	require.Nil(t, err)
+	it.SetTimeNowFunc(func() time.Time { return tp("2020-01-03 00:00:00") })
+
+	var cs common.Candlestick
+	require.True(t, it.Scan(&cs))
+	require.Equal(t, cstick1, cs)
+	require.True(t, it.Scan(&cs))
+	require.Equal(t, cstick2, cs)
+	require.False(t, it.Scan(&cs))
+	require.ErrorIs(t, it.Error().(common.CandleReqError).Err, common.ErrOutOfCandlesticks)
+	require.Equal(t, 2, p.CallCount())
+}
+
+func tp(s string) time.Time {
+	t, _ := time.Parse("2006-01-02 15:04:05", s)
+	return t.UTC()
+}
+
+func tInt(s string) int {
+	return int(tp(s).Unix())
+}
+
+var (
+	msBTCUSDT = common.MarketSource{
+		Type:       common.COIN,
+		Provider:   "BINANCE",
+		BaseAsset:  "BTC",
+		QuoteAsset: "USDT",
+	}
+)
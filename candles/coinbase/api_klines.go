@@ -4,13 +4,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/marianogappa/crypto-candles/candles/common"
-	"github.com/rs/zerolog/log"
 )
 
 type successResponse = [][]interface{}
@@ -23,30 +21,29 @@ func coinbaseToCandlesticks(response successResponse) ([]common.Candlestick, err
 	candlesticks := make([]common.Candlestick, len(response))
 	for i := 0; i < len(response); i++ {
 		raw := response[i]
-		timestampFloat, ok := raw[0].(float64)
+		timestamp, ok := common.NumberToInt64(raw[0])
 		if !ok {
-			return candlesticks, fmt.Errorf("candlestick %v had timestampMillis = %v! Invalid syntax from Coinbase", i, timestampFloat)
+			return candlesticks, fmt.Errorf("candlestick %v had timestamp = %v! Invalid syntax from Coinbase", i, raw[0])
 		}
-		timestamp := int(timestampFloat)
-		lowestPrice, ok := raw[1].(float64)
+		lowestPrice, ok := common.NumberToFloat64(raw[1])
 		if !ok {
 			return candlesticks, fmt.Errorf("candlestick %v had lowestPrice = %v! Invalid syntax from Coinbase", i, lowestPrice)
 		}
-		highestPrice, ok := raw[2].(float64)
+		highestPrice, ok := common.NumberToFloat64(raw[2])
 		if !ok {
 			return candlesticks, fmt.Errorf("candlestick %v had highestPrice = %v! Invalid syntax from Coinbase", i, highestPrice)
 		}
-		openPrice, ok := raw[3].(float64)
+		openPrice, ok := common.NumberToFloat64(raw[3])
 		if !ok {
 			return candlesticks, fmt.Errorf("candlestick %v had openPrice = %v! Invalid syntax from Coinbase", i, openPrice)
 		}
-		closePrice, ok := raw[4].(float64)
+		closePrice, ok := common.NumberToFloat64(raw[4])
 		if !ok {
 			return candlesticks, fmt.Errorf("candlestick %v had closePrice = %v! Invalid syntax from Coinbase", i, closePrice)
 		}
 
 		candlestick := common.Candlestick{
-			Timestamp:    timestamp,
+			Timestamp:    int(timestamp),
 			LowestPrice:  common.JSONFloat64(lowestPrice),
 			HighestPrice: common.JSONFloat64(highestPrice),
 			OpenPrice:    common.JSONFloat64(openPrice),
@@ -58,80 +55,90 @@ func coinbaseToCandlesticks(response successResponse) ([]common.Candlestick, err
 	return candlesticks, nil
 }
 
-func (e *Coinbase) requestCandlesticks(baseAsset string, quoteAsset string, startTime time.Time, candlestickInterval time.Duration) ([]common.Candlestick, error) {
-	req, _ := http.NewRequest("GET", fmt.Sprintf("%vproducts/%v-%v/candles", e.apiURL, strings.ToUpper(baseAsset), strings.ToUpper(quoteAsset)), nil)
+var granularities = map[time.Duration]string{
+	1 * time.Minute:       "60",
+	5 * time.Minute:       "300",
+	15 * time.Minute:      "900",
+	1 * 60 * time.Minute:  "3600",
+	6 * 60 * time.Minute:  "21600",
+	24 * 60 * time.Minute: "86400",
+}
 
-	q := req.URL.Query()
+func (e *Coinbase) requestCandlesticks(baseAsset string, quoteAsset string, startTime time.Time, candlestickInterval time.Duration) ([]common.Candlestick, error) {
+	return e.requestCandlesticksUntil(baseAsset, quoteAsset, startTime, time.Time{}, candlestickInterval)
+}
 
-	granularity := int(candlestickInterval / time.Second)
+// maxLimit is the maximum number of candlesticks that the exchange returns per request.
+const maxLimit = 300
 
-	validGranularities := map[int]bool{
-		60:    true,
-		300:   true,
-		900:   true,
-		3600:  true,
-		21600: true,
-		86400: true,
-	}
-	if isValid := validGranularities[granularity]; !isValid {
-		return nil, common.CandleReqError{IsNotRetryable: true, Err: common.ErrUnsupportedCandlestickInterval}
+func (e *Coinbase) requestCandlesticksUntil(baseAsset string, quoteAsset string, startTime time.Time, endTime time.Time, candlestickInterval time.Duration) ([]common.Candlestick, error) {
+	symbol, err := common.SymbolForProvider(common.MarketSource{BaseAsset: baseAsset, QuoteAsset: quoteAsset}, common.COINBASE)
+	if err != nil {
+		return nil, common.CandleReqError{IsNotRetryable: true, Kind: common.KindInvalidPair, Err: err}
 	}
+	req, _ := http.NewRequest("GET", fmt.Sprintf("%vproducts/%v/candles", e.apiURL, symbol), nil)
 
-	q.Add("granularity", fmt.Sprintf("%v", granularity))
-
-	startTimeISO8601 := startTime.Format(time.RFC3339)
-	endTimeISO8601 := startTime.Add(299 * candlestickInterval).Format(time.RFC3339)
+	q := req.URL.Query()
 
-	q.Add("start", fmt.Sprintf("%v", startTimeISO8601))
-	q.Add("end", fmt.Sprintf("%v", endTimeISO8601))
+	granularity, ok := granularities[candlestickInterval]
+	if !ok {
+		return nil, common.CandleReqError{IsNotRetryable: true, Kind: common.KindNotSupported, Err: common.ErrUnsupportedCandlestickInterval}
+	}
 
-	req.URL.RawQuery = q.Encode()
+	q.Add("granularity", granularity)
 
-	client := &http.Client{Timeout: 10 * time.Second}
+	// Without start & end, Coinbase returns the latest candlesticks.
+	if !startTime.IsZero() {
+		startTimeISO8601 := startTime.Format(time.RFC3339)
+		pageEndTime := startTime.Add((maxLimit - 1) * candlestickInterval)
+		// Coinbase's end is inclusive.
+		if !endTime.IsZero() && endTime.Add(-candlestickInterval).Before(pageEndTime) {
+			pageEndTime = endTime.Add(-candlestickInterval)
+		}
+		endTimeISO8601 := pageEndTime.Format(time.RFC3339)
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, common.CandleReqError{IsNotRetryable: true, Err: fmt.Errorf("%w: %v", common.ErrExecutingRequest, err)}
+		q.Add("start", fmt.Sprintf("%v", startTimeISO8601))
+		q.Add("end", fmt.Sprintf("%v", endTimeISO8601))
 	}
-	defer resp.Body.Close()
 
-	byts, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, common.CandleReqError{IsNotRetryable: false, Err: common.ErrBrokenBodyResponse}
-	}
+	req.URL.RawQuery = q.Encode()
+
+	return e.httpRequester.DoWithInterval(req, candlestickInterval, decodeResponse)
+}
 
+func decodeResponse(statusCode int, byts []byte) ([]common.Candlestick, error) {
 	maybeErrorResponse := errorResponse{}
-	err = json.Unmarshal(byts, &maybeErrorResponse)
+	err := json.Unmarshal(byts, &maybeErrorResponse)
 	if err == nil && (maybeErrorResponse.Message != "") {
 		if maybeErrorResponse.Message == "NotFound" {
 			return nil, common.CandleReqError{
 				IsNotRetryable: true,
+				Kind:           common.KindInvalidPair,
 				Err:            common.ErrInvalidMarketPair,
 			}
 		}
+		if strings.Contains(strings.ToLower(maybeErrorResponse.Message), "granularity") {
+			return nil, common.CandleReqError{
+				IsNotRetryable: true,
+				Kind:           common.KindNotSupported,
+				Err:            fmt.Errorf("%w: %v", common.ErrUnsupportedCandlestickInterval, maybeErrorResponse.Message),
+			}
+		}
 		return nil, common.CandleReqError{
 			IsNotRetryable: false,
+			Kind:           common.KindTransient,
 			Err:            errors.New(maybeErrorResponse.Message),
 		}
 	}
 
 	maybeResponse := successResponse{}
-	err = json.Unmarshal(byts, &maybeResponse)
-	if err != nil {
-		return nil, common.CandleReqError{IsNotRetryable: false, Err: common.ErrInvalidJSONResponse}
+	if err := common.UnmarshalUseNumber(byts, &maybeResponse); err != nil {
+		return nil, common.CandleReqError{IsNotRetryable: false, Kind: common.KindBadData, Err: common.ErrInvalidJSONResponse}
 	}
 
 	candlesticks, err := coinbaseToCandlesticks(maybeResponse)
 	if err != nil {
-		return nil, common.CandleReqError{IsNotRetryable: false, Err: err}
-	}
-
-	if e.debug {
-		log.Info().Str("exchange", "Coinbase").Str("market", fmt.Sprintf("%v/%v", baseAsset, quoteAsset)).Int("candlestick_count", len(candlesticks)).Msg("Candlestick request successful!")
-	}
-
-	if len(candlesticks) == 0 {
-		return nil, common.CandleReqError{IsNotRetryable: false, Err: common.ErrOutOfCandlesticks}
+		return nil, err
 	}
 
 	// Reverse slice, because Coinbase returns candlesticks in descending order
@@ -1,7 +1,6 @@
 package coinbase
 
 import (
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -94,6 +93,31 @@ func TestOutOfCandlesticks(t *testing.T) {
 	require.Equal(t, err.(common.CandleReqError).Err, common.ErrOutOfCandlesticks)
 }
 
+func TestBeforeListing(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Only the latest candlesticks (i.e. without a start) exist.
+		if r.URL.Query().Get("start") != "" {
+			fmt.Fprintln(w, `[]`)
+			return
+		}
+		fmt.Fprintln(w, `[[1642330740,42915.09,42993.82,42986.05,42940.33,14.98295725]]`)
+	}))
+	defer ts.Close()
+
+	b := NewCoinbase()
+	b.requester.Strategy = common.RetryStrategy{Attempts: 1}
+	b.apiURL = ts.URL + "/"
+
+	_, err := b.RequestCandlesticks(msBTCUSDT, tp("2020-01-16T10:57:00+00:00"), time.Minute)
+	require.ErrorIs(t, err, common.ErrBeforeListing)
+	require.True(t, err.(common.CandleReqError).IsNotRetryable)
+	require.Equal(t, common.KindTooFarBack, err.(common.CandleReqError).Kind)
+
+	// The latest candlestick is within the requested page, so the pair is listed: its candlesticks aren't there yet.
+	_, err = b.RequestCandlesticksUntil(msBTCUSDT, tp("2022-01-16T10:57:00+00:00"), tp("2022-01-16T11:57:00+00:00"), time.Minute)
+	require.ErrorIs(t, err, common.ErrOutOfCandlesticks)
+}
+
 func TestUnhappyToCandlesticks(t *testing.T) {
 	tests := []string{
 		`[["1626868560",31540.72,31584.3,31540.72,31576.13,0.08432516]]`,
@@ -106,7 +130,7 @@ func TestUnhappyToCandlesticks(t *testing.T) {
 	for i, ts := range tests {
 		t.Run(fmt.Sprintf("Unhappy toCandlesticks %v", i), func(t *testing.T) {
 			sr := successResponse{}
-			err := json.Unmarshal([]byte(ts), &sr)
+			err := common.UnmarshalUseNumber([]byte(ts), &sr)
 			if err != nil {
 				t.Fatalf("Unmarshal failed: %v", err)
 			}
@@ -189,6 +213,20 @@ func TestKlinesErrorNotFound(t *testing.T) {
 	require.ErrorIs(t, err.(common.CandleReqError).Err, common.ErrInvalidMarketPair)
 }
 
+func TestKlinesErrorUnsupportedGranularity(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"message": "Unsupported granularity"}`)
+	}))
+	defer ts.Close()
+
+	b := NewCoinbase()
+	b.requester.Strategy = common.RetryStrategy{Attempts: 1}
+	b.apiURL = ts.URL + "/"
+	_, err := b.RequestCandlesticks(msBTCUSDT, tp("2021-07-04T14:14:18+00:00"), time.Minute)
+	require.ErrorIs(t, err, common.ErrUnsupportedCandlestickInterval)
+	require.Equal(t, common.KindNotSupported, err.(common.CandleReqError).Kind)
+}
+
 func TestKlinesNon200Response(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(500)
@@ -236,6 +274,23 @@ func TestKlinesInvalidFloatsInJSONResponse(t *testing.T) {
 	}
 }
 
+func TestErrRateLimitRetryAfter(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Retry-After", "7")
+		w.WriteHeader(429)
+	}))
+	defer ts.Close()
+
+	b := NewCoinbase()
+	b.requester.Strategy = common.RetryStrategy{Attempts: 1}
+	b.apiURL = ts.URL + "/"
+
+	_, err := b.RequestCandlesticks(msBTCUSDT, tp("2021-07-04T14:14:18+00:00"), time.Minute)
+	require.ErrorIs(t, err.(common.CandleReqError).Err, common.ErrRateLimit)
+	require.Equal(t, common.KindRateLimited, err.(common.CandleReqError).Kind)
+	require.Equal(t, 7*time.Second, err.(common.CandleReqError).RetryAfter)
+}
+
 func TestPatience(t *testing.T) {
 	require.Equal(t, 1*time.Minute, NewCoinbase().Patience())
 }
@@ -253,6 +308,25 @@ func tp(s string) time.Time {
 	return t
 }
 
+func TestTrimsCandlesticksOlderThanStartTime(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `[
+			[1642330740, 1, 1, 1, 1, 1],
+			[1642330680, 2, 2, 2, 2, 1]
+		]`)
+	}))
+	defer ts.Close()
+
+	b := NewCoinbase()
+	b.requester.Strategy = common.RetryStrategy{Attempts: 1}
+	b.apiURL = ts.URL + "/"
+
+	// The start time is normalized to the next minute, so the first returned candlestick is older than it.
+	actual, err := b.RequestCandlesticks(msBTCUSDT, tp("2022-01-16T10:58:30+00:00"), time.Minute)
+	require.Nil(t, err)
+	require.Equal(t, []common.Candlestick{{Timestamp: 1642330740, OpenPrice: 1, ClosePrice: 1, LowestPrice: 1, HighestPrice: 1}}, actual)
+}
+
 var (
 	msBTCUSDT = common.MarketSource{
 		Type:       common.COIN,
@@ -0,0 +1,173 @@
+package common
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Anchor says where a provider's candlestick boundaries are, beyond multiples of the candlestick interval, as exchanges
+// disagree on them (see FloorToInterval). Each provider instance has its own (see AnchorOf), so that anchoring one
+// Market's exchanges doesn't affect other Markets in the process.
+//
+// The zero Anchor is that of an unknown provider: candlesticks are anchored to UTC midnight, and weeks start on Mondays.
+type Anchor struct {
+	provider        string
+	utcOffset       time.Duration
+	daysAfterMonday int
+}
+
+// NewAnchor returns the provider's default Anchor, i.e. UTC midnight, with weeks starting on Mondays, except for KUCOIN,
+// whose weekly candlesticks start on Thursdays (i.e. they are multiples of a week since the UNIX epoch).
+func NewAnchor(provider string) Anchor {
+	anchor := Anchor{provider: strings.ToUpper(provider)}
+	if anchor.provider == KUCOIN {
+		return anchor.WithWeekStart(time.Thursday)
+	}
+	return anchor
+}
+
+// WithUTCOffset returns a copy of the Anchor whose candlesticks are anchored to midnight at the given UTC offset rather
+// than to UTC midnight, for exchanges whose daily (and longer) candlesticks follow a local session, e.g. +9h for 00:00
+// KST. Zero anchors to UTC.
+//
+// Note that candlesticks that aren't anchored to UTC are not cached, as the cache requires timestamps to be multiples
+// of the candlestick interval.
+func (a Anchor) WithUTCOffset(offset time.Duration) Anchor {
+	a.utcOffset = offset
+	return a
+}
+
+// WithWeekStart returns a copy of the Anchor whose weekly candlesticks start on the given weekday.
+func (a Anchor) WithWeekStart(weekday time.Weekday) Anchor {
+	a.daysAfterMonday = (int(weekday) - int(time.Monday) + 7) % 7
+	return a
+}
+
+// UTCOffset returns the UTC offset that the candlesticks are anchored to (see WithUTCOffset).
+func (a Anchor) UTCOffset() time.Duration { return a.utcOffset }
+
+// WeekStart returns the weekday on which weekly candlesticks start (see WithWeekStart).
+func (a Anchor) WeekStart() time.Weekday {
+	return time.Weekday((int(time.Monday) + a.daysAfterMonday) % 7)
+}
+
+// AnchoredProvider is optionally implemented by CandlestickProviders whose candlestick boundaries differ from their
+// provider's defaults (see NewAnchor). Use AnchorOf rather than calling it directly.
+type AnchoredProvider interface {
+	// Anchor returns where the provider's candlestick boundaries are.
+	Anchor() Anchor
+}
+
+// AnchorConfigurable is optionally implemented by AnchoredProviders whose Anchor can be overridden, e.g. by the
+// Market's anchor options. All the Exchanges shipped with the library implement it.
+type AnchorConfigurable interface {
+	AnchoredProvider
+
+	// SetAnchor overrides the provider's Anchor.
+	SetAnchor(anchor Anchor)
+}
+
+// AnchorOf returns the provider's Anchor, which is its name's default (see NewAnchor) unless it implements
+// AnchoredProvider.
+func AnchorOf(provider CandlestickProvider) Anchor {
+	if anchoredProvider, ok := provider.(AnchoredProvider); ok {
+		return anchoredProvider.Anchor()
+	}
+	return NewAnchor(provider.Name())
+}
+
+// AnchorSettings holds an exchange's Anchor. It's safe for concurrent use, so it can be overridden while iterators are
+// running.
+type AnchorSettings struct {
+	lock   sync.RWMutex
+	anchor Anchor
+}
+
+// NewAnchorSettings constructs AnchorSettings with the provider's default Anchor (see NewAnchor).
+func NewAnchorSettings(provider string) *AnchorSettings {
+	return &AnchorSettings{anchor: NewAnchor(provider)}
+}
+
+// Get returns the Anchor.
+func (s *AnchorSettings) Get() Anchor {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.anchor
+}
+
+// Set overrides the Anchor.
+func (s *AnchorSettings) Set(anchor Anchor) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.anchor = anchor
+}
+
+// Floor is like FloorToInterval, but for the Anchor's candlestick boundaries.
+func (a Anchor) Floor(t time.Time, candlestickInterval time.Duration) time.Time {
+	return a.floor(t.UTC().Add(a.utcOffset), candlestickInterval).Add(-a.utcOffset)
+}
+
+// Ceil is like CeilToInterval, but for the Anchor's candlestick boundaries.
+func (a Anchor) Ceil(t time.Time, candlestickInterval time.Duration) time.Time {
+	t = t.UTC().Add(a.utcOffset)
+	floor := a.floor(t, candlestickInterval)
+	switch {
+	case floor.Equal(t):
+	case a.IsCalendarMonth(candlestickInterval):
+		floor = floor.AddDate(0, 1, 0)
+	default:
+		floor = floor.Add(candlestickInterval)
+	}
+	return floor.Add(-a.utcOffset)
+}
+
+// Normalize is like NormalizeTimestamp, but for the Anchor's candlestick boundaries.
+func (a Anchor) Normalize(rawTm time.Time, candlestickInterval time.Duration, startFromNext bool) int {
+	tm := a.Ceil(rawTm, candlestickInterval)
+	if startFromNext {
+		// i.e. the boundary after tm.
+		tm = a.Ceil(tm.Add(time.Nanosecond), candlestickInterval)
+	}
+	return int(tm.Unix())
+}
+
+// CloseTimestamp is like the CloseTimestamp function, but for the Anchor's candlestick boundaries.
+func (a Anchor) CloseTimestamp(timestamp int, candlestickInterval time.Duration) int {
+	return a.Normalize(time.Unix(int64(timestamp), 0), candlestickInterval, true)
+}
+
+// Add returns the timestamp of the candlestick n candlesticks after the one at the supplied timestamp (or before it, if
+// n is negative). That's n intervals later, except for calendar months, which don't all last the same.
+func (a Anchor) Add(timestamp int, candlestickInterval time.Duration, n int) int {
+	if !a.IsCalendarMonth(candlestickInterval) {
+		return timestamp + n*IntervalToSeconds(candlestickInterval)
+	}
+	t := time.Unix(int64(timestamp), 0).UTC().Add(a.utcOffset)
+	return int(t.AddDate(0, n, 0).Add(-a.utcOffset).Unix())
+}
+
+// IsCalendarMonth returns true if the Anchor's candlesticks of the given interval are calendar months rather than 30
+// days, i.e. if they don't all last the same.
+func (a Anchor) IsCalendarMonth(candlestickInterval time.Duration) bool {
+	if candlestickInterval != 30*24*time.Hour {
+		return false
+	}
+	switch a.provider {
+	case BINANCE, BINANCEUSDMFUTURES, BITFINEX, CRYPTOCOM, KUCOIN:
+		return true
+	}
+	return false
+}
+
+func (a Anchor) floor(t time.Time, candlestickInterval time.Duration) time.Time {
+	switch {
+	case a.IsCalendarMonth(candlestickInterval):
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	case candlestickInterval == 7*24*time.Hour:
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		daysSinceWeekStart := (int(day.Weekday()) - int(a.WeekStart()) + 7) % 7
+		return day.AddDate(0, 0, -daysSinceWeekStart)
+	}
+	return t.Truncate(candlestickInterval).UTC()
+}
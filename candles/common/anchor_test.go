@@ -0,0 +1,127 @@
+package common
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnchorUTCOffset(t *testing.T) {
+	require.Equal(t, time.Duration(0), NewAnchor("KST_EXCHANGE").UTCOffset())
+	anchor := NewAnchor("KST_EXCHANGE").WithUTCOffset(9 * time.Hour)
+	require.Equal(t, 9*time.Hour, anchor.UTCOffset())
+
+	// Daily candlesticks anchored to 00:00 KST start at 15:00 UTC.
+	day := 24 * time.Hour
+	require.Equal(t, tp("2021-01-01 15:00:00"), anchor.Floor(tp("2021-01-02 01:42:24"), day))
+	require.Equal(t, tp("2021-01-02 15:00:00"), anchor.Ceil(tp("2021-01-02 01:42:24"), day))
+	require.Equal(t, tp("2021-01-02 15:00:00"), anchor.Floor(tp("2021-01-02 15:00:00"), day))
+	require.Equal(t, tp("2021-01-02 15:00:00"), anchor.Ceil(tp("2021-01-02 15:00:00"), day))
+	require.Equal(t, tInt("2021-01-02 15:00:00"), anchor.Normalize(tp("2021-01-02 01:42:24"), day, false))
+	require.Equal(t, tInt("2021-01-03 15:00:00"), anchor.Normalize(tp("2021-01-02 01:42:24"), day, true))
+
+	// Anchors are values, so other anchors (and the provider's defaults) are still anchored to UTC.
+	require.Equal(t, tp("2021-01-02 00:00:00"), FloorToInterval(tp("2021-01-02 01:42:24"), day, "KST_EXCHANGE"))
+	require.Equal(t, tp("2021-01-02 00:00:00"), NewAnchor(BINANCE).Floor(tp("2021-01-02 01:42:24"), day))
+
+	// Holes are patched from the anchor's boundary, rather than from UTC midnight.
+	cs := []Candlestick{
+		{Timestamp: tInt("2021-01-02 15:00:00"), OpenPrice: 1, ClosePrice: 1, LowestPrice: 1, HighestPrice: 1},
+		{Timestamp: tInt("2021-01-04 15:00:00"), OpenPrice: 2, ClosePrice: 2, LowestPrice: 2, HighestPrice: 2},
+	}
+	expected := []Candlestick{
+		cs[0],
+		{Timestamp: tInt("2021-01-03 15:00:00"), OpenPrice: 2, ClosePrice: 2, LowestPrice: 2, HighestPrice: 2, Synthetic: true},
+		cs[1],
+	}
+	require.Equal(t, expected, PatchAnchoredCandlestickHoles(cs, tInt("2021-01-02 01:42:24"), IntervalToSeconds(day), anchor))
+}
+
+func TestAnchorWeekStart(t *testing.T) {
+	require.Equal(t, time.Monday, Anchor{}.WeekStart())
+	require.Equal(t, time.Monday, NewAnchor(BINANCE).WeekStart())
+	require.Equal(t, time.Thursday, NewAnchor(KUCOIN).WeekStart())
+	require.Equal(t, time.Sunday, NewAnchor("SUNDAY_EXCHANGE").WithWeekStart(time.Sunday).WeekStart())
+
+	// 2021-01-02 is a Saturday.
+	week := 7 * 24 * time.Hour
+	tss := []struct {
+		name          string
+		anchor        Anchor
+		expectedFloor time.Time
+		expectedCeil  time.Time
+	}{
+		{name: BINANCE, anchor: NewAnchor(BINANCE), expectedFloor: tp("2020-12-28 00:00:00"), expectedCeil: tp("2021-01-04 00:00:00")},
+		{name: KUCOIN, anchor: NewAnchor(KUCOIN), expectedFloor: tp("2020-12-31 00:00:00"), expectedCeil: tp("2021-01-07 00:00:00")},
+		{name: "SUNDAY_EXCHANGE", anchor: NewAnchor("SUNDAY_EXCHANGE").WithWeekStart(time.Sunday), expectedFloor: tp("2020-12-27 00:00:00"), expectedCeil: tp("2021-01-03 00:00:00")},
+	}
+	for _, ts := range tss {
+		t.Run(ts.name, func(t *testing.T) {
+			require.Equal(t, ts.expectedFloor, ts.anchor.Floor(tp("2021-01-02 01:42:24"), week))
+			require.Equal(t, ts.expectedCeil, ts.anchor.Ceil(tp("2021-01-02 01:42:24"), week))
+			require.Equal(t, ts.expectedFloor, ts.anchor.Floor(ts.expectedFloor, week))
+			require.Equal(t, int(ts.expectedCeil.Unix()), ts.anchor.Normalize(tp("2021-01-02 01:42:24"), week, false))
+		})
+	}
+
+	// Kucoin's weekly candlesticks are still multiples of a week since the UNIX epoch.
+	require.Zero(t, FloorToInterval(tp("2021-01-02 01:42:24"), week, KUCOIN).Unix()%int64(IntervalToSeconds(week)))
+}
+
+func TestAnchorUTCOffsetMonthlyBinance(t *testing.T) {
+	anchor := NewAnchor(BINANCE).WithUTCOffset(9 * time.Hour)
+
+	month := 30 * 24 * time.Hour
+	require.Equal(t, tp("2021-01-31 15:00:00"), anchor.Floor(tp("2021-02-14 00:00:00"), month))
+	require.Equal(t, tp("2021-02-28 15:00:00"), anchor.Ceil(tp("2021-02-14 00:00:00"), month))
+}
+
+func TestAnchorAdd(t *testing.T) {
+	day, month := 24*time.Hour, 30*24*time.Hour
+	require.Equal(t, tInt("2021-02-02 00:00:00"), NewAnchor(BINANCE).Add(tInt("2021-01-31 00:00:00"), day, 2))
+	require.Equal(t, tInt("2021-03-01 00:00:00"), NewAnchor(BINANCE).Add(tInt("2021-01-01 00:00:00"), month, 2))
+	require.Equal(t, tInt("2020-12-01 00:00:00"), NewAnchor(KUCOIN).Add(tInt("2021-01-01 00:00:00"), month, -1))
+	require.Equal(t, tInt("2021-03-02 00:00:00"), NewAnchor(BITSTAMP).Add(tInt("2021-01-31 00:00:00"), month, 1))
+
+	// Months are added in the anchor's time zone.
+	kst := NewAnchor(BINANCE).WithUTCOffset(9 * time.Hour)
+	require.Equal(t, tInt("2021-02-28 15:00:00"), kst.Add(tInt("2021-01-31 15:00:00"), month, 1))
+
+	// Holes in monthly candlesticks are patched by calendar month.
+	cs := []Candlestick{
+		{Timestamp: tInt("2021-01-01 00:00:00"), OpenPrice: 1, ClosePrice: 1, LowestPrice: 1, HighestPrice: 1},
+		{Timestamp: tInt("2021-03-01 00:00:00"), OpenPrice: 2, ClosePrice: 2, LowestPrice: 2, HighestPrice: 2},
+	}
+	expected := []Candlestick{
+		cs[0],
+		{Timestamp: tInt("2021-02-01 00:00:00"), OpenPrice: 2, ClosePrice: 2, LowestPrice: 2, HighestPrice: 2, Synthetic: true},
+		cs[1],
+	}
+	require.Equal(t, expected, PatchAnchoredCandlestickHoles(cs, tInt("2021-01-01 00:00:00"), IntervalToSeconds(month), NewAnchor(BINANCE)))
+}
+
+type anchoredProvider struct {
+	CandlestickProvider
+	anchor Anchor
+}
+
+func (p anchoredProvider) Anchor() Anchor { return p.anchor }
+
+type namedProvider struct {
+	CandlestickProvider
+	name string
+}
+
+func (p namedProvider) Name() string { return p.name }
+
+func TestAnchorOf(t *testing.T) {
+	require.Equal(t, NewAnchor(KUCOIN), AnchorOf(namedProvider{name: KUCOIN}))
+	anchor := NewAnchor("KST_EXCHANGE").WithUTCOffset(9 * time.Hour)
+	require.Equal(t, anchor, AnchorOf(anchoredProvider{anchor: anchor}))
+
+	settings := NewAnchorSettings(KUCOIN)
+	require.Equal(t, NewAnchor(KUCOIN), settings.Get())
+	settings.Set(anchor)
+	require.Equal(t, anchor, settings.Get())
+}
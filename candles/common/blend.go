@@ -0,0 +1,50 @@
+package common
+
+import "sort"
+
+// BlendFunc aggregates candlesticks of the same timestamp from different market sources (e.g. the same pair on several
+// exchanges) into a single one (see Market.RequestBlended). It's never called with an empty slice. The timestamp of
+// the returned candlestick is ignored.
+type BlendFunc func(cs []Candlestick) Candlestick
+
+// BlendMean is a BlendFunc whose open, high, low & close prices are the mean of the supplied candlesticks' ones.
+func BlendMean(cs []Candlestick) Candlestick {
+	return blendPrices(cs, func(prices []JSONFloat64) JSONFloat64 {
+		sum := JSONFloat64(0)
+		for _, price := range prices {
+			sum += price
+		}
+		return sum / JSONFloat64(len(prices))
+	})
+}
+
+// BlendMedian is a BlendFunc whose open, high, low & close prices are the median of the supplied candlesticks' ones,
+// so that a single exchange's outlier doesn't move the blended price.
+func BlendMedian(cs []Candlestick) Candlestick {
+	return blendPrices(cs, func(prices []JSONFloat64) JSONFloat64 {
+		sort.Slice(prices, func(i, j int) bool { return prices[i] < prices[j] })
+		middle := len(prices) / 2
+		if len(prices)%2 == 0 {
+			return (prices[middle-1] + prices[middle]) / 2
+		}
+		return prices[middle]
+	})
+}
+
+// blendPrices aggregates each of the candlesticks' prices separately with the supplied function.
+func blendPrices(cs []Candlestick, aggregate func(prices []JSONFloat64) JSONFloat64) Candlestick {
+	column := func(price func(Candlestick) JSONFloat64) JSONFloat64 {
+		prices := make([]JSONFloat64, len(cs))
+		for i, candlestick := range cs {
+			prices[i] = price(candlestick)
+		}
+		return aggregate(prices)
+	}
+	return Candlestick{
+		Timestamp:    cs[0].Timestamp,
+		OpenPrice:    column(func(c Candlestick) JSONFloat64 { return c.OpenPrice }),
+		ClosePrice:   column(func(c Candlestick) JSONFloat64 { return c.ClosePrice }),
+		LowestPrice:  column(func(c Candlestick) JSONFloat64 { return c.LowestPrice }),
+		HighestPrice: column(func(c Candlestick) JSONFloat64 { return c.HighestPrice }),
+	}
+}
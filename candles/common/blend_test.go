@@ -0,0 +1,22 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlendMeanAndMedian(t *testing.T) {
+	cs := []Candlestick{
+		{Timestamp: 60, OpenPrice: 1, ClosePrice: 2, LowestPrice: 1, HighestPrice: 3},
+		{Timestamp: 60, OpenPrice: 3, ClosePrice: 4, LowestPrice: 2, HighestPrice: 5},
+		{Timestamp: 60, OpenPrice: 8, ClosePrice: 9, LowestPrice: 6, HighestPrice: 10},
+	}
+	require.Equal(t, Candlestick{Timestamp: 60, OpenPrice: 4, ClosePrice: 5, LowestPrice: 3, HighestPrice: 6}, BlendMean(cs))
+	require.Equal(t, Candlestick{Timestamp: 60, OpenPrice: 3, ClosePrice: 4, LowestPrice: 2, HighestPrice: 5}, BlendMedian(cs))
+	require.Equal(t, Candlestick{Timestamp: 60, OpenPrice: 2, ClosePrice: 3, LowestPrice: 1.5, HighestPrice: 4}, BlendMedian(cs[:2]))
+	require.Equal(t, cs[2], BlendMean(cs[2:]))
+
+	// The supplied candlesticks are not modified.
+	require.Equal(t, JSONFloat64(8), cs[2].OpenPrice)
+}
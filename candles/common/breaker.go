@@ -0,0 +1,115 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// BreakerState is a snapshot of a RateLimitBreaker.
+type BreakerState struct {
+	// Enabled is false if the breaker never pauses requests (see RateLimitBreaker.SetMaxPause).
+	Enabled bool
+
+	// Open is true while requests are paused, i.e. until OpenUntil.
+	Open bool
+
+	// OpenUntil is when the RetryAfter of the latest rate limited response elapses. Zero if it never tripped.
+	OpenUntil time.Time
+
+	// Trips is the number of rate limited responses that tripped the breaker so far.
+	Trips int
+
+	// PausedRequests is the number of requests that waited for the breaker to close.
+	PausedRequests int
+
+	// RejectedRequests is the number of requests that failed with ErrRateLimit without being sent, as the breaker
+	// would have stayed open longer than its max pause.
+	RejectedRequests int
+}
+
+// RateLimitBreakerProvider is optionally implemented by CandlestickProviders whose requests go through a
+// RateLimitBreaker.
+type RateLimitBreakerProvider interface {
+	// RateLimitBreaker returns the breaker shared by all of the provider's requests.
+	RateLimitBreaker() *RateLimitBreaker
+}
+
+// RateLimitBreaker is a circuit breaker for an exchange's rate limit: once a request is rate limited, it pauses every
+// new request to the exchange until the RetryAfter the exchange asked for elapses, rather than letting each caller
+// retry on its own (and worsen the limit). It's safe for concurrent use, and disabled until SetMaxPause is called.
+type RateLimitBreaker struct {
+	lock        sync.Mutex
+	maxPause    time.Duration
+	state       BreakerState
+	timeNowFunc func() time.Time
+	sleep       func(time.Duration)
+}
+
+// NewRateLimitBreaker constructs a disabled RateLimitBreaker.
+func NewRateLimitBreaker() *RateLimitBreaker {
+	return &RateLimitBreaker{timeNowFunc: time.Now, sleep: time.Sleep}
+}
+
+// SetMaxPause enables the breaker: while it's open, requests wait for it to close for up to maxPause; if it stays
+// open longer than that, they fail right away with a retryable ErrRateLimit whose RetryAfter is the remaining time
+// (e.g. so that iterators fall back on other providers). Zero disables it.
+func (b *RateLimitBreaker) SetMaxPause(maxPause time.Duration) {
+	if b == nil {
+		return
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.maxPause = maxPause
+	b.state.Enabled = maxPause > 0
+}
+
+// State returns a snapshot of the breaker's state.
+func (b *RateLimitBreaker) State() BreakerState {
+	if b == nil {
+		return BreakerState{}
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	state := b.state
+	state.Open = state.Enabled && b.timeNowFunc().Before(state.OpenUntil)
+	return state
+}
+
+// wait blocks until the breaker is closed, or fails if it would be open for longer than the max pause.
+func (b *RateLimitBreaker) wait() error {
+	if b == nil {
+		return nil
+	}
+	b.lock.Lock()
+	remaining := b.state.OpenUntil.Sub(b.timeNowFunc())
+	if !b.state.Enabled || remaining <= 0 {
+		b.lock.Unlock()
+		return nil
+	}
+	if remaining > b.maxPause {
+		b.state.RejectedRequests++
+		b.lock.Unlock()
+		err := fmt.Errorf("%w: requests are paused for %v more", ErrRateLimit, remaining.Round(time.Millisecond))
+		return CandleReqError{IsNotRetryable: false, Kind: KindRateLimited, Err: err, RetryAfter: remaining}
+	}
+	b.state.PausedRequests++
+	b.lock.Unlock()
+	b.sleep(remaining)
+	return nil
+}
+
+// trip opens the breaker for the RetryAfter of the supplied error, if it's an ErrRateLimit.
+func (b *RateLimitBreaker) trip(err error) {
+	var candleReqErr CandleReqError
+	if b == nil || !errors.Is(err, ErrRateLimit) || !errors.As(err, &candleReqErr) {
+		return
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.state.Trips++
+	if openUntil := b.timeNowFunc().Add(candleReqErr.RetryAfter); openUntil.After(b.state.OpenUntil) {
+		b.state.OpenUntil = openUntil
+	}
+}
@@ -0,0 +1,76 @@
+package common
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimitBreaker(t *testing.T) {
+	now := time.Date(2022, 7, 9, 15, 0, 0, 0, time.UTC)
+	slept := []time.Duration{}
+	b := NewRateLimitBreaker()
+	b.timeNowFunc = func() time.Time { return now }
+	b.sleep = func(d time.Duration) { slept = append(slept, d) }
+
+	// Disabled breakers never pause.
+	b.trip(CandleReqError{Kind: KindRateLimited, Err: ErrRateLimit, RetryAfter: 10 * time.Second})
+	require.Nil(t, b.wait())
+	require.Empty(t, slept)
+	require.Equal(t, BreakerState{Trips: 1, OpenUntil: now.Add(10 * time.Second)}, b.State())
+
+	b.SetMaxPause(30 * time.Second)
+	require.True(t, b.State().Open)
+	require.Nil(t, b.wait())
+	require.Equal(t, []time.Duration{10 * time.Second}, slept)
+
+	// Other errors don't trip it, and a shorter RetryAfter doesn't shorten it.
+	b.trip(CandleReqError{Kind: KindTransient, Err: ErrBrokenBodyResponse, RetryAfter: time.Minute})
+	b.trip(CandleReqError{Kind: KindRateLimited, Err: ErrRateLimit, RetryAfter: time.Second})
+	require.Equal(t, now.Add(10*time.Second), b.State().OpenUntil)
+
+	// Pauses longer than the max pause are rejected.
+	b.trip(CandleReqError{Kind: KindRateLimited, Err: ErrRateLimit, RetryAfter: time.Minute})
+	err := b.wait()
+	require.ErrorIs(t, err, ErrRateLimit)
+	var candleReqErr CandleReqError
+	require.True(t, errors.As(err, &candleReqErr))
+	require.False(t, candleReqErr.IsNotRetryable)
+	require.Equal(t, time.Minute, candleReqErr.RetryAfter)
+
+	now = now.Add(time.Minute)
+	require.Nil(t, b.wait())
+	require.Equal(t, BreakerState{Enabled: true, OpenUntil: now, Trips: 3, PausedRequests: 1, RejectedRequests: 1}, b.State())
+}
+
+func TestRequesterRateLimitBreaker(t *testing.T) {
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer ts.Close()
+
+	debug := false
+	r := NewRequester("test", &debug)
+	r.RateLimitBreaker().SetMaxPause(time.Second)
+	req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+	_, err := r.Do(req, func(int, []byte) ([]Candlestick, error) { return nil, nil })
+	require.ErrorIs(t, err, ErrRateLimit)
+
+	// Copies share the breaker, which rejects requests without sending them while the exchange asks to wait longer
+	// than the max pause.
+	copied := r
+	_, _, err = copied.DoRaw(req)
+	require.ErrorIs(t, err, ErrRateLimit)
+	require.Equal(t, 1, calls)
+	state := r.RateLimitBreaker().State()
+	require.True(t, state.Open)
+	require.Equal(t, 1, state.Trips)
+	require.Equal(t, 1, state.RejectedRequests)
+}
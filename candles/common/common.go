@@ -1,59 +1,534 @@
 package common
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"syscall"
 	"time"
 )
 
 // PatchCandlestickHoles takes a slice of candlesticks and it patches any holes in it, either at the beginning or within
 // any pair of candlesticks whose difference in seconds doesn't match the supplied "durSecs", by cloning the latest
 // available candlestick "on the left", or the first candlestick (i.e. "on the right") if it's at the beginning.
+//
+// Sub-minute intervals (e.g. 1s, 10s) are supported, as long as "durSecs" is a positive number of seconds.
+//
+// The supplied slice is never mutated, and the returned slice never shares its backing array, even if nothing needed
+// patching, so callers can append to either one (e.g. to a slice that is also cached) without corrupting the other.
 func PatchCandlestickHoles(cs []Candlestick, startTimeTs, durSecs int) []Candlestick {
-	startTimeTs = NormalizeTimestamp(time.Unix(int64(startTimeTs), 0), time.Duration(durSecs)*time.Second, "TODO_PROVIDER", false)
-	lastTs := startTimeTs - durSecs
-	for len(cs) > 0 && cs[0].Timestamp < lastTs+durSecs {
+	return PatchAnchoredCandlestickHoles(cs, startTimeTs, durSecs, Anchor{})
+}
+
+// PatchAnchoredCandlestickHoles is like PatchCandlestickHoles, but the start time is normalized to the supplied
+// Anchor's candlestick boundaries (see Anchor.Normalize), e.g. taking its UTC offset into account, and consecutive
+// candlesticks follow each other as per Anchor.Add, e.g. by calendar months.
+func PatchAnchoredCandlestickHoles(cs []Candlestick, startTimeTs, durSecs int, anchor Anchor) []Candlestick {
+	if durSecs <= 0 {
+		return append([]Candlestick{}, cs...)
+	}
+	interval := time.Duration(durSecs) * time.Second
+	startTimeTs = anchor.Normalize(time.Unix(int64(startTimeTs), 0), interval, false)
+	for len(cs) > 0 && cs[0].Timestamp < startTimeTs {
 		cs = cs[1:]
 	}
 	if len(cs) == 0 {
-		return cs
+		return []Candlestick{}
 	}
 
-	fixedCSS := []Candlestick{}
+	fixedCSS := make([]Candlestick, 0, len(cs))
+	nextTs := startTimeTs
 	for _, candlestick := range cs {
-		if candlestick.Timestamp == lastTs+durSecs {
-			fixedCSS = append(fixedCSS, candlestick)
-			lastTs = candlestick.Timestamp
-			continue
-		}
-		for candlestick.Timestamp >= lastTs+durSecs {
+		for candlestick.Timestamp >= nextTs {
 			clonedCandlestick := candlestick
-			clonedCandlestick.Timestamp = lastTs + durSecs
+			clonedCandlestick.Timestamp = nextTs
+			clonedCandlestick.Synthetic = candlestick.Synthetic || candlestick.Timestamp != clonedCandlestick.Timestamp
 			fixedCSS = append(fixedCSS, clonedCandlestick)
-			lastTs += durSecs
+			nextTs = anchor.Add(nextTs, interval, 1)
 		}
 	}
 	return fixedCSS
 }
 
+// IntervalToSeconds returns the supplied candlestick interval in seconds, which is how exchanges and timestamps express
+// it. All conversions from candlestick intervals to seconds should go through here.
+//
+// It returns zero if the interval is not a positive whole number of seconds (e.g. 1500ms), so that callers can reject
+// it. Calendar intervals (e.g. 1 month) are currently treated as their fixed-length approximation.
+func IntervalToSeconds(candlestickInterval time.Duration) int {
+	if candlestickInterval < time.Second || candlestickInterval%time.Second != 0 {
+		return 0
+	}
+	return int(candlestickInterval / time.Second)
+}
+
+// SortedIntervals returns the candlestick intervals of the supplied map (e.g. from interval to the exchange's name for
+// it), in ascending order.
+func SortedIntervals(intervals map[time.Duration]string) []time.Duration {
+	sorted := make([]time.Duration, 0, len(intervals))
+	for interval := range intervals {
+		sorted = append(sorted, interval)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
+
+// ClosestSupportedInterval returns the largest of the supported candlestick intervals that is not larger than the
+// supplied candlestick interval and divides it evenly, i.e. the best candidate to resample the supplied interval from.
+// If the supplied interval is supported, it's returned as is. Returns false if there's no such interval.
+func ClosestSupportedInterval(supportedIntervals []time.Duration, candlestickInterval time.Duration) (time.Duration, bool) {
+	var (
+		closest time.Duration
+		found   bool
+	)
+	for _, supported := range supportedIntervals {
+		if supported <= 0 || supported > candlestickInterval || candlestickInterval%supported != 0 {
+			continue
+		}
+		if !found || supported > closest {
+			closest, found = supported, true
+		}
+	}
+	return closest, found
+}
+
+// ResampleCandlesticks aggregates candlesticks of a candlestick interval into candlesticks of a larger resample
+// interval (e.g. 1h into 2h), which must be a multiple of it. Candlesticks must be sorted in ascending order.
+//
+// Resampled candlesticks start at the Anchor's boundaries of the resample interval (see Anchor.Floor), like the
+// provider's own candlesticks of that interval would, open at the first open price, close at the last close price, and
+// span the lowest and highest prices. Groups that are incomplete (e.g. at the start or end of the slice) are
+// discarded, as their candlestick hasn't finished or its start is unknown. Returns an empty slice if the resample
+// interval is not a multiple of the candlestick interval.
+func ResampleCandlesticks(cs []Candlestick, candlestickInterval time.Duration, resampleInterval time.Duration, anchor Anchor) []Candlestick {
+	resampled := []Candlestick{}
+	if candlestickInterval <= 0 || resampleInterval < candlestickInterval || resampleInterval%candlestickInterval != 0 {
+		return resampled
+	}
+	groupStart := func(c Candlestick) int {
+		return int(anchor.Floor(time.Unix(int64(c.Timestamp), 0), resampleInterval).Unix())
+	}
+	for i := 0; i < len(cs); {
+		groupTs := groupStart(cs[i])
+		j := i
+		for j < len(cs) && groupStart(cs[j]) == groupTs {
+			j++
+		}
+		// Groups may not all have the same size, e.g. calendar months.
+		groupSize := (anchor.CloseTimestamp(groupTs, resampleInterval) - groupTs) / IntervalToSeconds(candlestickInterval)
+		if j-i == groupSize && cs[i].Timestamp == groupTs {
+			resampled = append(resampled, resample(groupTs, cs[i:j]))
+		}
+		i = j
+	}
+	return resampled
+}
+
+// ResampleStampedCandlesticks is like ResampleCandlesticks, but for candlesticks whose Timestamp follows the supplied
+// TimestampSemantics: close-stamped candlesticks are grouped by the resample interval boundary they close at (e.g. 1h
+// candlesticks stamped 01:00 and 02:00 make up the 2h candlestick stamped 02:00), and resampled ones are close-stamped
+// too. Iterators and RequestMultiInterval resample with the provider's TimestampSemanticsOf.
+func ResampleStampedCandlesticks(cs []Candlestick, candlestickInterval time.Duration, resampleInterval time.Duration, anchor Anchor, semantics TimestampSemantics) []Candlestick {
+	if semantics != CloseStamped {
+		return ResampleCandlesticks(cs, candlestickInterval, resampleInterval, anchor)
+	}
+	openStamped := make([]Candlestick, len(cs))
+	for i, candlestick := range cs {
+		candlestick.Timestamp = anchor.Add(candlestick.Timestamp, candlestickInterval, -1)
+		openStamped[i] = candlestick
+	}
+	resampled := ResampleCandlesticks(openStamped, candlestickInterval, resampleInterval, anchor)
+	for i := range resampled {
+		resampled[i].Timestamp = anchor.CloseTimestamp(resampled[i].Timestamp, resampleInterval)
+	}
+	return resampled
+}
+
+func resample(ts int, group []Candlestick) Candlestick {
+	candlestick := Candlestick{
+		Timestamp:    ts,
+		OpenPrice:    group[0].OpenPrice,
+		ClosePrice:   group[len(group)-1].ClosePrice,
+		LowestPrice:  group[0].LowestPrice,
+		HighestPrice: group[0].HighestPrice,
+	}
+	for _, c := range group[1:] {
+		if c.LowestPrice < candlestick.LowestPrice {
+			candlestick.LowestPrice = c.LowestPrice
+		}
+		if c.HighestPrice > candlestick.HighestPrice {
+			candlestick.HighestPrice = c.HighestPrice
+		}
+	}
+	return candlestick
+}
+
 // NormalizeTimestamp takes a time and a candlestick interval, and normalizes the timestamp by returning the immediately
-// next multiple of that time as defined by .Truncate(candlestickInterval), unless the time already satisfies it.
+// next candlestick boundary of the provider (see CeilToInterval), unless the time already is one.
 //
-// It also optionally returns the next time (i.e. it appends a candlestick interval to it).
+// It also optionally returns the next time (i.e. the boundary after that one).
 //
-// TODO: this function only currently supports 1m, 5m, 15m, 1h & 1d intervals. Using other intervals will
-// result in silently incorrect behaviour due to exchanges behaving differently. Please review api_klines files for
-// documented differences in behaviour.
+// TODO: only the anchoring documented in FloorToInterval is supported. Other intervals may result in silently incorrect
+// behaviour due to exchanges behaving differently. Please review api_klines files for documented differences.
 func NormalizeTimestamp(rawTm time.Time, candlestickInterval time.Duration, provider string, startFromNext bool) int {
-	rawTm = rawTm.UTC()
-	tm := rawTm.Truncate(candlestickInterval).UTC()
-	if tm != rawTm {
-		tm = tm.Add(candlestickInterval)
+	return NewAnchor(provider).Normalize(rawTm, candlestickInterval, startFromNext)
+}
+
+// FloorToInterval returns the start of the provider's candlestick of the given interval that contains the time, i.e.
+// the time itself if it's on a candlestick boundary, or the previous boundary otherwise. The result is in UTC.
+//
+// Boundaries are multiples of the interval as defined by time.Truncate, except for these exchange-specific anchors:
+//
+// * Weekly candlesticks start on Mondays, except on KUCOIN, where they start on Thursdays.
+// * BINANCE's, BINANCEUSDMFUTURES' & KUCOIN's monthly candlesticks (i.e. 30 days) start on the first day of each month.
+//
+// These are the provider's defaults (see NewAnchor). Use AnchorOf(provider).Floor to take a provider instance's
+// overrides into account, e.g. a UTC offset.
+func FloorToInterval(t time.Time, candlestickInterval time.Duration, provider string) time.Time {
+	return NewAnchor(provider).Floor(t, candlestickInterval)
+}
+
+// CloseTimestamp returns the UNIX timestamp at which the provider's candlestick starting at the supplied timestamp
+// closes, i.e. the provider's next candlestick boundary (see NormalizeTimestamp), so that variable-length candlesticks
+// (e.g. calendar months on BINANCE) close when the exchange says they do.
+func CloseTimestamp(timestamp int, candlestickInterval time.Duration, provider string) int {
+	return NewAnchor(provider).CloseTimestamp(timestamp, candlestickInterval)
+}
+
+// CeilToInterval is like FloorToInterval, but it returns the next candlestick boundary of the provider if the time is
+// not on one, i.e. the start of the first candlestick that starts at or after the time. The result is in UTC.
+func CeilToInterval(t time.Time, candlestickInterval time.Duration, provider string) time.Time {
+	return NewAnchor(provider).Ceil(t, candlestickInterval)
+}
+
+// NewRateLimitError builds a retryable ErrRateLimit CandleReqError for an exchange's HTTP 429 response, setting
+// RetryAfter from the response headers, so that the retrier sleeps as long as the exchange asked.
+//
+// The standard Retry-After header is honored (either in seconds or as an HTTP date), as well as the RateLimit-Reset &
+// X-RateLimit-Reset headers (in seconds until reset, or as the UNIX timestamp of the reset if it's later than now).
+// Usage headers like Binance's x-mbx-used-weight don't say when the limit resets, so they are ignored. If no header is present, RetryAfter is the supplied fallback.
+func NewRateLimitError(header http.Header, fallback time.Duration) CandleReqError {
+	return CandleReqError{IsNotRetryable: false, Kind: KindRateLimited, Err: ErrRateLimit, RetryAfter: parseRetryAfter(header, fallback)}
+}
+
+func parseRetryAfter(header http.Header, fallback time.Duration) time.Duration {
+	if value := header.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second
+		}
+		if tm, err := http.ParseTime(value); err == nil {
+			if d := time.Until(tm); d > 0 {
+				return d.Round(time.Second)
+			}
+			return 0
+		}
+	}
+	for _, name := range []string{"RateLimit-Reset", "X-RateLimit-Reset"} {
+		seconds, err := strconv.ParseInt(header.Get(name), 10, 64)
+		if err != nil || seconds < 0 {
+			continue
+		}
+		// Some exchanges send the UNIX timestamp at which the limit resets rather than the seconds until then.
+		if now := time.Now(); seconds > now.Unix() {
+			return time.Unix(seconds, 0).Sub(now).Round(time.Second)
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	return fallback
+}
+
+// CheckHistoryDepth fails with ErrDataTooFarBack if startTime is older than the provider's MaxHistoryDepth, relative
+// to the supplied current time. Providers with no known limit never fail.
+func CheckHistoryDepth(provider CandlestickProvider, startTime time.Time, now time.Time) error {
+	maxDepth := MaxHistoryDepthOf(provider)
+	if maxDepth <= 0 {
+		return nil
+	}
+	if earliest := now.Add(-maxDepth); startTime.Before(earliest) {
+		err := fmt.Errorf("%w: %v only serves candlesticks since %v, but %v was requested", ErrDataTooFarBack, provider.Name(), earliest.UTC().Format(time.RFC3339), startTime.UTC().Format(time.RFC3339))
+		return CandleReqError{IsNotRetryable: true, Kind: KindTooFarBack, Err: err}
+	}
+	return nil
+}
+
+// SupportedIntervalsOf returns the candlestick intervals supported by the provider, in ascending order, or nil if
+// they are not known upfront (i.e. the provider doesn't implement IntervalsProvider).
+func SupportedIntervalsOf(provider CandlestickProvider) []time.Duration {
+	if intervalsProvider, ok := provider.(IntervalsProvider); ok {
+		return intervalsProvider.SupportedIntervals()
+	}
+	return nil
+}
+
+// MaxHistoryDepthOf returns how far back in time (relative to now) the provider serves candlesticks, or zero if
+// there's no known limit (i.e. the provider doesn't implement HistoryDepthProvider).
+func MaxHistoryDepthOf(provider CandlestickProvider) time.Duration {
+	if historyDepthProvider, ok := provider.(HistoryDepthProvider); ok {
+		return historyDepthProvider.MaxHistoryDepth()
 	}
-	return int(tm.Add(candlestickInterval * time.Duration(b2i(startFromNext))).Unix())
+	return 0
 }
 
-func b2i(b bool) int {
-	if b {
-		return 1
+// MaxCandlesPerRequest returns the maximum number of candlesticks that the provider returns per request, or zero if
+// it's not known (i.e. the provider doesn't implement MaxCandlesPerRequestProvider).
+func MaxCandlesPerRequest(provider CandlestickProvider) int {
+	if maxCandlesProvider, ok := provider.(MaxCandlesPerRequestProvider); ok {
+		return maxCandlesProvider.MaxCandlesPerRequest()
 	}
 	return 0
 }
+
+// CandlesticksToTicks converts a slice of candlesticks into a slice of ticks, using the close price of each
+// candlestick as the tick's value.
+func CandlesticksToTicks(cs []Candlestick) []Tick {
+	ticks := make([]Tick, len(cs))
+	for i, candlestick := range cs {
+		ticks[i] = Tick{Timestamp: candlestick.Timestamp, Value: candlestick.ClosePrice}
+	}
+	return ticks
+}
+
+// CandlesticksToOHLCTicks converts a slice of candlesticks into a slice of ticks, emitting four ticks per candlestick
+// in a realistic order: the open price, then the lowest & highest prices (whichever is closest to the open price
+// first), and then the close price. Ticks are spread evenly across the candlestick interval, i.e. at 0, 1/4, 2/4 and
+// 3/4 of it, rounded down to the second.
+//
+// This gives simulations (e.g. backtests) more intra-candlestick resolution than a single tick per candlestick.
+func CandlesticksToOHLCTicks(cs []Candlestick, candlestickInterval time.Duration) []Tick {
+	var (
+		ticks        = make([]Tick, 0, len(cs)*4)
+		intervalSecs = IntervalToSeconds(candlestickInterval)
+	)
+	for _, candlestick := range cs {
+		first, second := candlestick.LowestPrice, candlestick.HighestPrice
+		if math.Abs(float64(candlestick.HighestPrice-candlestick.OpenPrice)) < math.Abs(float64(candlestick.OpenPrice-candlestick.LowestPrice)) {
+			first, second = second, first
+		}
+		for i, value := range []JSONFloat64{candlestick.OpenPrice, first, second, candlestick.ClosePrice} {
+			ticks = append(ticks, Tick{Timestamp: candlestick.Timestamp + i*intervalSecs/4, Value: value})
+		}
+	}
+	return ticks
+}
+
+// CandlesticksToTypicalTicks converts a slice of candlesticks into a slice of ticks, using the typical price (i.e.
+// (high + low + close) / 3) of each candlestick as the tick's value.
+func CandlesticksToTypicalTicks(cs []Candlestick) []Tick {
+	ticks := make([]Tick, len(cs))
+	for i, candlestick := range cs {
+		ticks[i] = Tick{Timestamp: candlestick.Timestamp, Value: candlestick.TypicalPrice()}
+	}
+	return ticks
+}
+
+// CandlesticksReturns returns the simple close-to-close returns of a slice of candlesticks, i.e. one less than the
+// number of candlesticks, where the ith return is close[i+1] / close[i] - 1. Returns after a zero close price are
+// undefined, so they are NaN.
+func CandlesticksReturns(cs []Candlestick) []float64 {
+	if len(cs) < 2 {
+		return []float64{}
+	}
+	returns := make([]float64, len(cs)-1)
+	for i := range returns {
+		prev, curr := float64(cs[i].ClosePrice), float64(cs[i+1].ClosePrice)
+		if prev == 0 {
+			returns[i] = math.NaN()
+			continue
+		}
+		returns[i] = curr/prev - 1
+	}
+	return returns
+}
+
+// CandlesticksLogReturns is like CandlesticksReturns, but it returns log returns, i.e. ln(close[i+1] / close[i]).
+// Returns from or to a zero close price are undefined, so they are NaN.
+func CandlesticksLogReturns(cs []Candlestick) []float64 {
+	if len(cs) < 2 {
+		return []float64{}
+	}
+	returns := make([]float64, len(cs)-1)
+	for i := range returns {
+		prev, curr := float64(cs[i].ClosePrice), float64(cs[i+1].ClosePrice)
+		if prev == 0 || curr == 0 {
+			returns[i] = math.NaN()
+			continue
+		}
+		returns[i] = math.Log(curr / prev)
+	}
+	return returns
+}
+
+// CandlesticksToColumns converts a slice of candlesticks into parallel slices (i.e. columns) of timestamps and prices,
+// e.g. for feeding into dataframe or numeric libraries.
+func CandlesticksToColumns(cs []Candlestick) (ts []int64, open, high, low, close []float64) {
+	ts, open, high, low, close = make([]int64, len(cs)), make([]float64, len(cs)), make([]float64, len(cs)), make([]float64, len(cs)), make([]float64, len(cs))
+	for i, candlestick := range cs {
+		ts[i] = int64(candlestick.Timestamp)
+		open[i] = float64(candlestick.OpenPrice)
+		high[i] = float64(candlestick.HighestPrice)
+		low[i] = float64(candlestick.LowestPrice)
+		close[i] = float64(candlestick.ClosePrice)
+	}
+	return ts, open, high, low, close
+}
+
+// ReverseCandlesticks returns a copy of the candlesticks in reverse order, e.g. to turn an ascending slice into a
+// descending one. The supplied slice is not modified.
+func ReverseCandlesticks(cs []Candlestick) []Candlestick {
+	reversed := make([]Candlestick, len(cs))
+	for i, candlestick := range cs {
+		reversed[len(cs)-1-i] = candlestick
+	}
+	return reversed
+}
+
+// MergePreference decides which candlestick MergeCandlesticks keeps when both slices have one with the same timestamp.
+type MergePreference int
+
+const (
+	// PreferNewer keeps the candlestick of the second slice (i.e. the newer fetch), like a secondary cache Put does.
+	PreferNewer MergePreference = iota
+	// PreferA keeps the candlestick of the first slice.
+	PreferA
+)
+
+// MergeCandlesticks merges two slices of candlesticks sorted in ascending order by timestamp (e.g. cached and freshly
+// requested ones) into a new sorted slice without duplicate timestamps. Gaps between the slices are kept as is. The
+// supplied slices are not modified.
+func MergeCandlesticks(a, b []Candlestick, prefer MergePreference) []Candlestick {
+	merged := make([]Candlestick, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i].Timestamp < b[j].Timestamp:
+			merged = append(merged, a[i])
+			i++
+		case a[i].Timestamp > b[j].Timestamp:
+			merged = append(merged, b[j])
+			j++
+		default:
+			if prefer == PreferA {
+				merged = append(merged, a[i])
+			} else {
+				merged = append(merged, b[j])
+			}
+			i++
+			j++
+		}
+	}
+	merged = append(merged, a[i:]...)
+	return append(merged, b[j:]...)
+}
+
+// FindFirstAtOrAfter returns the index of the first candlestick whose timestamp is at or after ts, or len(cs) if
+// there's none. Candlesticks must be sorted in ascending order by timestamp.
+func FindFirstAtOrAfter(cs []Candlestick, ts int) int {
+	return sort.Search(len(cs), func(i int) bool { return cs[i].Timestamp >= ts })
+}
+
+// FindLastAtOrBefore returns the index of the last candlestick whose timestamp is at or before ts, or -1 if there's
+// none. Candlesticks must be sorted in ascending order by timestamp.
+func FindLastAtOrBefore(cs []Candlestick, ts int) int {
+	return sort.Search(len(cs), func(i int) bool { return cs[i].Timestamp > ts }) - 1
+}
+
+// TrimCandlesticksAtOrAfter returns the subslice of candlesticks that start before the end time. The zero end time
+// means that there's no end time, so all candlesticks are returned. Candlesticks must be sorted in ascending order.
+func TrimCandlesticksAtOrAfter(cs []Candlestick, endTime time.Time) []Candlestick {
+	if endTime.IsZero() {
+		return cs
+	}
+	return cs[:FindFirstAtOrAfter(cs, int(endTime.Unix()))]
+}
+
+// FinalCandlesticks returns the prefix of candlesticks that are final at the given time, i.e. that closed at least
+// "patience" ago, so they won't change anymore. Candlesticks must be sorted in ascending order. The result shares the
+// underlying array with cs.
+func FinalCandlesticks(cs []Candlestick, candlestickInterval time.Duration, patience time.Duration, now time.Time) []Candlestick {
+	return FinalAnchoredCandlesticks(cs, candlestickInterval, patience, now, Anchor{})
+}
+
+// FinalAnchoredCandlesticks is like FinalCandlesticks, but candlesticks close at the supplied Anchor's next boundary
+// (see Anchor.Add), e.g. at the end of a calendar month.
+func FinalAnchoredCandlesticks(cs []Candlestick, candlestickInterval time.Duration, patience time.Duration, now time.Time, anchor Anchor) []Candlestick {
+	for i, candlestick := range cs {
+		closeTime := time.Unix(int64(anchor.Add(candlestick.Timestamp, candlestickInterval, 1)), 0)
+		if closeTime.After(now.Add(-patience)) {
+			return cs[:i]
+		}
+	}
+	return cs
+}
+
+// BeforeListingError is for exchanges that return no candlesticks for pages before a market pair was listed, rather than
+// an error. If the supplied error is ErrOutOfCandlesticks for the page starting at the start time (with up to
+// pageCandlesticks candlesticks, or up to the end time if it's earlier and not zero), it requests the exchange's latest
+// candlesticks to confirm: if there are candlesticks after the page, it returns a non-retryable ErrBeforeListing
+// CandleReqError, so that iterators don't stall on a page that will never have candlesticks. Otherwise, it returns the
+// supplied error as is.
+func BeforeListingError(err error, startTime, endTime time.Time, pageCandlesticks int, candlestickInterval time.Duration, requestLatest func() ([]Candlestick, error)) error {
+	if !errors.Is(err, ErrOutOfCandlesticks) || startTime.IsZero() {
+		return err
+	}
+	pageEndTime := startTime.Add(time.Duration(pageCandlesticks) * candlestickInterval)
+	if !endTime.IsZero() && endTime.Before(pageEndTime) {
+		pageEndTime = endTime
+	}
+	latest, latestErr := requestLatest()
+	if latestErr != nil || len(latest) == 0 || latest[len(latest)-1].Timestamp < int(pageEndTime.Unix()) {
+		return err
+	}
+	return CandleReqError{
+		IsNotRetryable: true,
+		Kind:           KindTooFarBack,
+		Err:            fmt.Errorf("%w: no candlesticks from %v to %v", ErrBeforeListing, startTime.UTC().Format(time.RFC3339), pageEndTime.UTC().Format(time.RFC3339)),
+	}
+}
+
+// Window returns the subslice of candlesticks whose timestamps are between from and to, both inclusive. Candlesticks
+// must be sorted in ascending order by timestamp. The result shares the underlying array with cs.
+func Window(cs []Candlestick, from, to int) []Candlestick {
+	start, end := FindFirstAtOrAfter(cs, from), FindLastAtOrBefore(cs, to)+1
+	if start >= end {
+		return []Candlestick{}
+	}
+	return cs[start:end]
+}
+
+// ClassifyClientDoError converts an error returned by client.Do() into a CandleReqError.
+//
+// Timeouts are usually transient, so they are returned as a retryable ErrTimeout. Connection-level failures (e.g.
+// connection resets, connections closed before a response, temporary DNS failures) are also transient, so they are
+// returned as a retryable ErrExecutingRequest. Any other error (e.g. an invalid URL) is returned as a non-retryable
+// ErrExecutingRequest.
+func ClassifyClientDoError(err error) CandleReqError {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return CandleReqError{IsNotRetryable: false, Kind: KindTransient, Err: fmt.Errorf("%w: %v", ErrTimeout, err)}
+	}
+	if isTransientConnectionError(err) {
+		return CandleReqError{IsNotRetryable: false, Kind: KindTransient, Err: fmt.Errorf("%w: %v", ErrExecutingRequest, err)}
+	}
+	return CandleReqError{IsNotRetryable: true, Kind: KindUnknown, Err: fmt.Errorf("%w: %v", ErrExecutingRequest, err)}
+}
+
+func isTransientConnectionError(err error) bool {
+	// DNS errors are wrapped in net.OpErrors, but e.g. "no such host" won't be fixed by retrying.
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTemporary || dnsErr.IsTimeout
+	}
+	var opErr *net.OpError
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.As(err, &opErr)
+}
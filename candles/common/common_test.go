@@ -2,8 +2,16 @@ package common
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"syscall"
 	"testing"
 	"time"
 
@@ -131,7 +139,7 @@ func TestPatchCandlestickHoles(t *testing.T) {
 			startTs: 120,
 			durSecs: 60,
 			expected: []Candlestick{
-				{Timestamp: 120, OpenPrice: 2, HighestPrice: 2, ClosePrice: 2, LowestPrice: 2},
+				{Timestamp: 120, OpenPrice: 2, HighestPrice: 2, ClosePrice: 2, LowestPrice: 2, Synthetic: true},
 				{Timestamp: 180, OpenPrice: 2, HighestPrice: 2, ClosePrice: 2, LowestPrice: 2},
 				{Timestamp: 240, OpenPrice: 3, HighestPrice: 3, ClosePrice: 3, LowestPrice: 3},
 			},
@@ -145,10 +153,10 @@ func TestPatchCandlestickHoles(t *testing.T) {
 			startTs: 120,
 			durSecs: 60,
 			expected: []Candlestick{
-				{Timestamp: 120, OpenPrice: 2, HighestPrice: 2, ClosePrice: 2, LowestPrice: 2},
+				{Timestamp: 120, OpenPrice: 2, HighestPrice: 2, ClosePrice: 2, LowestPrice: 2, Synthetic: true},
 				{Timestamp: 180, OpenPrice: 2, HighestPrice: 2, ClosePrice: 2, LowestPrice: 2},
-				{Timestamp: 240, OpenPrice: 3, HighestPrice: 3, ClosePrice: 3, LowestPrice: 3},
-				{Timestamp: 300, OpenPrice: 3, HighestPrice: 3, ClosePrice: 3, LowestPrice: 3},
+				{Timestamp: 240, OpenPrice: 3, HighestPrice: 3, ClosePrice: 3, LowestPrice: 3, Synthetic: true},
+				{Timestamp: 300, OpenPrice: 3, HighestPrice: 3, ClosePrice: 3, LowestPrice: 3, Synthetic: true},
 				{Timestamp: 360, OpenPrice: 3, HighestPrice: 3, ClosePrice: 3, LowestPrice: 3},
 			},
 		},
@@ -181,15 +189,77 @@ func TestPatchCandlestickHoles(t *testing.T) {
 				{Timestamp: tInt("2020-01-02 00:05:00"), OpenPrice: 3, HighestPrice: 3, ClosePrice: 3, LowestPrice: 3},
 			},
 		},
+		{
+			name: "Secondly: needs to add an initial tick, as well as in the middle",
+			candlesticks: []Candlestick{
+				{Timestamp: tInt("2020-01-02 00:03:01"), OpenPrice: 2, HighestPrice: 2, ClosePrice: 2, LowestPrice: 2},
+				{Timestamp: tInt("2020-01-02 00:03:03"), OpenPrice: 3, HighestPrice: 3, ClosePrice: 3, LowestPrice: 3},
+			},
+			startTs: tInt("2020-01-02 00:03:00"),
+			durSecs: 1,
+			expected: []Candlestick{
+				{Timestamp: tInt("2020-01-02 00:03:00"), OpenPrice: 2, HighestPrice: 2, ClosePrice: 2, LowestPrice: 2, Synthetic: true},
+				{Timestamp: tInt("2020-01-02 00:03:01"), OpenPrice: 2, HighestPrice: 2, ClosePrice: 2, LowestPrice: 2},
+				{Timestamp: tInt("2020-01-02 00:03:02"), OpenPrice: 3, HighestPrice: 3, ClosePrice: 3, LowestPrice: 3, Synthetic: true},
+				{Timestamp: tInt("2020-01-02 00:03:03"), OpenPrice: 3, HighestPrice: 3, ClosePrice: 3, LowestPrice: 3},
+			},
+		},
+		{
+			name: "10-secondly: adjusts start time rounding up, and patches a hole in the middle",
+			candlesticks: []Candlestick{
+				{Timestamp: tInt("2020-01-02 00:03:00"), OpenPrice: 1, HighestPrice: 1, ClosePrice: 1, LowestPrice: 1},
+				{Timestamp: tInt("2020-01-02 00:03:10"), OpenPrice: 2, HighestPrice: 2, ClosePrice: 2, LowestPrice: 2},
+				{Timestamp: tInt("2020-01-02 00:03:30"), OpenPrice: 3, HighestPrice: 3, ClosePrice: 3, LowestPrice: 3},
+			},
+			startTs: tInt("2020-01-02 00:03:04"),
+			durSecs: 10,
+			expected: []Candlestick{
+				{Timestamp: tInt("2020-01-02 00:03:10"), OpenPrice: 2, HighestPrice: 2, ClosePrice: 2, LowestPrice: 2},
+				{Timestamp: tInt("2020-01-02 00:03:20"), OpenPrice: 3, HighestPrice: 3, ClosePrice: 3, LowestPrice: 3, Synthetic: true},
+				{Timestamp: tInt("2020-01-02 00:03:30"), OpenPrice: 3, HighestPrice: 3, ClosePrice: 3, LowestPrice: 3},
+			},
+		},
+		{
+			name: "Non-positive durSecs returns the input untouched",
+			candlesticks: []Candlestick{
+				{Timestamp: 120, OpenPrice: 1, HighestPrice: 1, ClosePrice: 1, LowestPrice: 1},
+			},
+			startTs: 60,
+			durSecs: 0,
+			expected: []Candlestick{
+				{Timestamp: 120, OpenPrice: 1, HighestPrice: 1, ClosePrice: 1, LowestPrice: 1},
+			},
+		},
 	}
 	for _, ts := range tss {
 		t.Run(ts.name, func(t *testing.T) {
+			input := append([]Candlestick{}, ts.candlesticks...)
 			actual := PatchCandlestickHoles(ts.candlesticks, ts.startTs, ts.durSecs)
 			require.Equal(t, ts.expected, actual)
+			require.Equal(t, input, ts.candlesticks)
+
+			// The result must not alias the input, so writing to it or appending to it leaves the input intact.
+			for i := range actual {
+				actual[i].ClosePrice = -1
+			}
+			_ = append(actual, Candlestick{Timestamp: -1})
+			require.Equal(t, input, ts.candlesticks)
 		})
 	}
 }
 
+func TestPatchCandlestickHolesDoesNotAliasTrimmedInput(t *testing.T) {
+	cs := []Candlestick{
+		{Timestamp: 60, OpenPrice: 1, HighestPrice: 1, ClosePrice: 1, LowestPrice: 1},
+		{Timestamp: 120, OpenPrice: 2, HighestPrice: 2, ClosePrice: 2, LowestPrice: 2},
+	}
+	actual := PatchCandlestickHoles(cs[:1], 120, 60)
+	require.Equal(t, []Candlestick{}, actual)
+
+	_ = append(actual, Candlestick{Timestamp: 180})
+	require.Equal(t, 120, cs[1].Timestamp)
+}
+
 func tp(s string) time.Time {
 	t, _ := time.Parse("2006-01-02 15:04:05", s)
 	return t
@@ -199,6 +269,27 @@ func tInt(s string) int {
 	return int(tp(s).Unix())
 }
 
+func TestIntervalToSeconds(t *testing.T) {
+	tss := []struct {
+		interval time.Duration
+		expected int
+	}{
+		{interval: time.Second, expected: 1},
+		{interval: time.Minute, expected: 60},
+		{interval: time.Hour, expected: 3600},
+		{interval: 24 * time.Hour, expected: 86400},
+		{interval: 0, expected: 0},
+		{interval: -time.Minute, expected: 0},
+		{interval: 500 * time.Millisecond, expected: 0},
+		{interval: 1500 * time.Millisecond, expected: 0},
+	}
+	for _, ts := range tss {
+		t.Run(ts.interval.String(), func(t *testing.T) {
+			require.Equal(t, ts.expected, IntervalToSeconds(ts.interval))
+		})
+	}
+}
+
 func TestNormalizeTimestamp(t *testing.T) {
 	tss := []struct {
 		name                string
@@ -368,6 +459,70 @@ func TestNormalizeTimestamp(t *testing.T) {
 			startFromNext:       true,
 			expected:            ISO8601("2021-01-03T00:00:00Z"),
 		},
+		{
+			name:                "1s, BINANCE, startFromNext = false, already normalized",
+			tm:                  ISO8601("2021-01-02T01:42:24Z"),
+			candlestickInterval: 1 * time.Second,
+			provider:            "BINANCE",
+			startFromNext:       false,
+			expected:            ISO8601("2021-01-02T01:42:24Z"),
+		},
+		{
+			name:                "1s, BINANCE, startFromNext = true, already normalized",
+			tm:                  ISO8601("2021-01-02T01:42:24Z"),
+			candlestickInterval: 1 * time.Second,
+			provider:            "BINANCE",
+			startFromNext:       true,
+			expected:            ISO8601("2021-01-02T01:42:25Z"),
+		},
+		{
+			name:                "10s, BINANCE, startFromNext = false",
+			tm:                  ISO8601("2021-01-02T01:42:24Z"),
+			candlestickInterval: 10 * time.Second,
+			provider:            "BINANCE",
+			startFromNext:       false,
+			expected:            ISO8601("2021-01-02T01:42:30Z"),
+		},
+		{
+			name:                "10s, BINANCE, startFromNext = true",
+			tm:                  ISO8601("2021-01-02T01:42:24Z"),
+			candlestickInterval: 10 * time.Second,
+			provider:            "BINANCE",
+			startFromNext:       true,
+			expected:            ISO8601("2021-01-02T01:42:40Z"),
+		},
+		{
+			name:                "10s, BINANCE, startFromNext = false, already normalized",
+			tm:                  ISO8601("2021-01-02T01:42:20Z"),
+			candlestickInterval: 10 * time.Second,
+			provider:            "BINANCE",
+			startFromNext:       false,
+			expected:            ISO8601("2021-01-02T01:42:20Z"),
+		},
+		{
+			name:                "10s, BINANCE, startFromNext = true, already normalized",
+			tm:                  ISO8601("2021-01-02T01:42:20Z"),
+			candlestickInterval: 10 * time.Second,
+			provider:            "BINANCE",
+			startFromNext:       true,
+			expected:            ISO8601("2021-01-02T01:42:30Z"),
+		},
+		{
+			name:                "1w, KUCOIN, startFromNext = true",
+			tm:                  ISO8601("2021-01-02T01:42:24Z"),
+			candlestickInterval: 7 * 24 * time.Hour,
+			provider:            "KUCOIN",
+			startFromNext:       true,
+			expected:            ISO8601("2021-01-14T00:00:00Z"),
+		},
+		{
+			name:                "1M, BINANCE, startFromNext = true",
+			tm:                  ISO8601("2021-01-02T01:42:24Z"),
+			candlestickInterval: 30 * 24 * time.Hour,
+			provider:            "BINANCE",
+			startFromNext:       true,
+			expected:            ISO8601("2021-03-01T00:00:00Z"),
+		},
 	}
 	for _, ts := range tss {
 		t.Run(ts.name, func(t *testing.T) {
@@ -380,3 +535,442 @@ func TestNormalizeTimestamp(t *testing.T) {
 		})
 	}
 }
+
+func TestCloseTimestamp(t *testing.T) {
+	month := 30 * 24 * time.Hour
+	require.Equal(t, tInt("2021-01-02 04:00:00"), CloseTimestamp(tInt("2021-01-02 03:00:00"), time.Hour, BINANCE))
+	require.Equal(t, tInt("2021-02-01 00:00:00"), CloseTimestamp(tInt("2021-01-01 00:00:00"), month, BINANCE))
+	require.Equal(t, tInt("2021-03-01 00:00:00"), CloseTimestamp(tInt("2021-02-01 00:00:00"), month, BINANCE))
+	require.Equal(t, tInt("2021-01-11 00:00:00"), CloseTimestamp(tInt("2021-01-04 00:00:00"), 7*24*time.Hour, BINANCE))
+	// Providers without calendar months close monthly candlesticks after 30 days.
+	open := FloorToInterval(tp("2021-02-01 00:00:00"), month, COINBASE)
+	require.Equal(t, int(open.Add(month).Unix()), CloseTimestamp(int(open.Unix()), month, COINBASE))
+
+	bs, err := json.Marshal(Candlestick{Timestamp: 60, OpenPrice: 1, ClosePrice: 1, LowestPrice: 1, HighestPrice: 1, CloseTimestamp: 120})
+	require.Nil(t, err)
+	require.Equal(t, `{"t":60,"o":1,"c":1,"l":1,"h":1,"ct":120}`, string(bs))
+}
+
+func TestFloorAndCeilToInterval(t *testing.T) {
+	tss := []struct {
+		name                string
+		tm                  time.Time
+		candlestickInterval time.Duration
+		provider            string
+		expectedFloor       time.Time
+		expectedCeil        time.Time
+	}{
+		{name: "1m", tm: tp("2021-01-02 01:42:24"), candlestickInterval: time.Minute, provider: BINANCE, expectedFloor: tp("2021-01-02 01:42:00"), expectedCeil: tp("2021-01-02 01:43:00")},
+		{name: "1m on a boundary", tm: tp("2021-01-02 01:42:00"), candlestickInterval: time.Minute, provider: BINANCE, expectedFloor: tp("2021-01-02 01:42:00"), expectedCeil: tp("2021-01-02 01:42:00")},
+		{name: "1h in another time zone", tm: tp("2021-01-02 01:42:24").In(time.FixedZone("UTC-3", -3*60*60)), candlestickInterval: time.Hour, provider: BINANCE, expectedFloor: tp("2021-01-02 01:00:00"), expectedCeil: tp("2021-01-02 02:00:00")},
+		{name: "1w starts on Mondays", tm: tp("2021-01-02 01:42:24"), candlestickInterval: 7 * 24 * time.Hour, provider: BINANCE, expectedFloor: tp("2020-12-28 00:00:00"), expectedCeil: tp("2021-01-04 00:00:00")},
+		{name: "1w starts on Thursdays on KUCOIN", tm: tp("2021-01-02 01:42:24"), candlestickInterval: 7 * 24 * time.Hour, provider: KUCOIN, expectedFloor: tp("2020-12-31 00:00:00"), expectedCeil: tp("2021-01-07 00:00:00")},
+		{name: "1M starts on the first of the month on BINANCE", tm: tp("2021-02-14 01:42:24"), candlestickInterval: 30 * 24 * time.Hour, provider: BINANCE, expectedFloor: tp("2021-02-01 00:00:00"), expectedCeil: tp("2021-03-01 00:00:00")},
+		{name: "1M on a boundary on BINANCEUSDMFUTURES", tm: tp("2021-02-01 00:00:00"), candlestickInterval: 30 * 24 * time.Hour, provider: BINANCEUSDMFUTURES, expectedFloor: tp("2021-02-01 00:00:00"), expectedCeil: tp("2021-02-01 00:00:00")},
+		{name: "1M starts on the first of the month on KUCOIN", tm: tp("2021-12-31 23:59:59"), candlestickInterval: 30 * 24 * time.Hour, provider: KUCOIN, expectedFloor: tp("2021-12-01 00:00:00"), expectedCeil: tp("2022-01-01 00:00:00")},
+	}
+	for _, ts := range tss {
+		t.Run(ts.name, func(t *testing.T) {
+			require.Equal(t, ts.expectedFloor.UTC(), FloorToInterval(ts.tm, ts.candlestickInterval, ts.provider))
+			require.Equal(t, ts.expectedCeil.UTC(), CeilToInterval(ts.tm, ts.candlestickInterval, ts.provider))
+		})
+	}
+}
+
+func TestCandlesticksToTicks(t *testing.T) {
+	cs := []Candlestick{
+		{Timestamp: 60, OpenPrice: 1, ClosePrice: 2, LowestPrice: 1, HighestPrice: 3},
+		{Timestamp: 120, OpenPrice: 2, ClosePrice: 4, LowestPrice: 2, HighestPrice: 6},
+	}
+	require.Equal(t, []Tick{{Timestamp: 60, Value: 2}, {Timestamp: 120, Value: 4}}, CandlesticksToTicks(cs))
+	require.Equal(t, []Tick{{Timestamp: 60, Value: 2}, {Timestamp: 120, Value: 4}}, CandlesticksToTypicalTicks(cs))
+	require.Equal(t, []Tick{}, CandlesticksToTicks([]Candlestick{}))
+	require.Equal(t, []Tick{}, CandlesticksToTypicalTicks(nil))
+}
+
+func TestCandlesticksReturns(t *testing.T) {
+	cs := []Candlestick{{Timestamp: 60, ClosePrice: 2}, {Timestamp: 120, ClosePrice: 4}, {Timestamp: 180, ClosePrice: 3}}
+	require.InDeltaSlice(t, []float64{1, -0.25}, CandlesticksReturns(cs), 1e-9)
+	require.InDeltaSlice(t, []float64{math.Log(2), math.Log(0.75)}, CandlesticksLogReturns(cs), 1e-9)
+
+	require.Equal(t, []float64{}, CandlesticksReturns(nil))
+	require.Equal(t, []float64{}, CandlesticksReturns(cs[:1]))
+	require.Equal(t, []float64{}, CandlesticksLogReturns(nil))
+	require.Equal(t, []float64{}, CandlesticksLogReturns(cs[:1]))
+
+	zero := []Candlestick{{Timestamp: 60, ClosePrice: 2}, {Timestamp: 120, ClosePrice: 0}, {Timestamp: 180, ClosePrice: 3}}
+	returns := CandlesticksReturns(zero)
+	require.Len(t, returns, 2)
+	require.Equal(t, -1.0, returns[0])
+	require.True(t, math.IsNaN(returns[1]))
+	logReturns := CandlesticksLogReturns(zero)
+	require.Len(t, logReturns, 2)
+	require.True(t, math.IsNaN(logReturns[0]))
+	require.True(t, math.IsNaN(logReturns[1]))
+}
+
+func TestCandlesticksToColumns(t *testing.T) {
+	cs := []Candlestick{
+		{Timestamp: 60, OpenPrice: 1, ClosePrice: 2, LowestPrice: 1, HighestPrice: 3},
+		{Timestamp: 120, OpenPrice: 2, ClosePrice: 4, LowestPrice: 2, HighestPrice: 6},
+	}
+	ts, open, high, low, close := CandlesticksToColumns(cs)
+	require.Equal(t, []int64{60, 120}, ts)
+	require.Equal(t, []float64{1, 2}, open)
+	require.Equal(t, []float64{3, 6}, high)
+	require.Equal(t, []float64{1, 2}, low)
+	require.Equal(t, []float64{2, 4}, close)
+
+	ts, open, _, _, close = CandlesticksToColumns(nil)
+	require.Equal(t, []int64{}, ts)
+	require.Equal(t, []float64{}, open)
+	require.Equal(t, []float64{}, close)
+}
+
+func TestReverseCandlesticks(t *testing.T) {
+	cs := []Candlestick{{Timestamp: 60}, {Timestamp: 120}, {Timestamp: 180}}
+	require.Equal(t, []Candlestick{{Timestamp: 180}, {Timestamp: 120}, {Timestamp: 60}}, ReverseCandlesticks(cs))
+	require.Equal(t, []Candlestick{{Timestamp: 60}, {Timestamp: 120}, {Timestamp: 180}}, cs)
+	require.Equal(t, []Candlestick{}, ReverseCandlesticks(nil))
+}
+
+func TestMergeCandlesticks(t *testing.T) {
+	a1 := Candlestick{Timestamp: 60, OpenPrice: 1, ClosePrice: 1, LowestPrice: 1, HighestPrice: 1}
+	a2 := Candlestick{Timestamp: 120, OpenPrice: 1, ClosePrice: 1, LowestPrice: 1, HighestPrice: 1}
+	a3 := Candlestick{Timestamp: 180, OpenPrice: 1, ClosePrice: 1, LowestPrice: 1, HighestPrice: 1}
+	b2 := Candlestick{Timestamp: 120, OpenPrice: 2, ClosePrice: 2, LowestPrice: 2, HighestPrice: 2}
+	b3 := Candlestick{Timestamp: 180, OpenPrice: 2, ClosePrice: 2, LowestPrice: 2, HighestPrice: 2}
+	b4 := Candlestick{Timestamp: 240, OpenPrice: 2, ClosePrice: 2, LowestPrice: 2, HighestPrice: 2}
+	b6 := Candlestick{Timestamp: 360, OpenPrice: 2, ClosePrice: 2, LowestPrice: 2, HighestPrice: 2}
+
+	tss := []struct {
+		name     string
+		a        []Candlestick
+		b        []Candlestick
+		prefer   MergePreference
+		expected []Candlestick
+	}{
+		{name: "both empty", a: nil, b: nil, prefer: PreferNewer, expected: []Candlestick{}},
+		{name: "only a", a: []Candlestick{a1, a2}, b: nil, prefer: PreferNewer, expected: []Candlestick{a1, a2}},
+		{name: "only b", a: nil, b: []Candlestick{b2}, prefer: PreferA, expected: []Candlestick{b2}},
+		{name: "full overlap prefers newer", a: []Candlestick{a2, a3}, b: []Candlestick{b2, b3}, prefer: PreferNewer, expected: []Candlestick{b2, b3}},
+		{name: "full overlap prefers a", a: []Candlestick{a2, a3}, b: []Candlestick{b2, b3}, prefer: PreferA, expected: []Candlestick{a2, a3}},
+		{name: "overlap makes the sequence larger", a: []Candlestick{a1, a2, a3}, b: []Candlestick{b3, b4}, prefer: PreferNewer, expected: []Candlestick{a1, a2, b3, b4}},
+		{name: "b before a", a: []Candlestick{a3}, b: []Candlestick{b2}, prefer: PreferNewer, expected: []Candlestick{b2, a3}},
+		{name: "gaps are kept", a: []Candlestick{a1}, b: []Candlestick{b4, b6}, prefer: PreferNewer, expected: []Candlestick{a1, b4, b6}},
+	}
+	for _, ts := range tss {
+		t.Run(ts.name, func(t *testing.T) {
+			require.Equal(t, ts.expected, MergeCandlesticks(ts.a, ts.b, ts.prefer))
+		})
+	}
+}
+
+func TestCandlesticksToOHLCTicks(t *testing.T) {
+	cs := []Candlestick{
+		// Low is closest to open
+		{Timestamp: 60, OpenPrice: 2, ClosePrice: 3, LowestPrice: 1, HighestPrice: 5},
+		// High is closest to open
+		{Timestamp: 120, OpenPrice: 4, ClosePrice: 2, LowestPrice: 1, HighestPrice: 5},
+	}
+	require.Equal(t, []Tick{
+		{Timestamp: 60, Value: 2},
+		{Timestamp: 75, Value: 1},
+		{Timestamp: 90, Value: 5},
+		{Timestamp: 105, Value: 3},
+		{Timestamp: 120, Value: 4},
+		{Timestamp: 135, Value: 5},
+		{Timestamp: 150, Value: 1},
+		{Timestamp: 165, Value: 2},
+	}, CandlesticksToOHLCTicks(cs, time.Minute))
+	require.Equal(t, []Tick{}, CandlesticksToOHLCTicks(nil, time.Minute))
+}
+
+func TestClosestSupportedInterval(t *testing.T) {
+	supported := []time.Duration{time.Minute, 5 * time.Minute, 30 * time.Minute, time.Hour, 4 * time.Hour}
+
+	tss := []struct {
+		interval      time.Duration
+		expected      time.Duration
+		expectedFound bool
+	}{
+		{interval: time.Hour, expected: time.Hour, expectedFound: true},
+		{interval: 2 * time.Hour, expected: time.Hour, expectedFound: true},
+		{interval: 160 * time.Minute, expected: 5 * time.Minute, expectedFound: true},
+		{interval: 12 * time.Hour, expected: 4 * time.Hour, expectedFound: true},
+		{interval: 90 * time.Second, expected: 0, expectedFound: false},
+		{interval: 30 * time.Second, expected: 0, expectedFound: false},
+	}
+	for _, ts := range tss {
+		actual, found := ClosestSupportedInterval(supported, ts.interval)
+		require.Equal(t, ts.expectedFound, found, ts.interval.String())
+		require.Equal(t, ts.expected, actual, ts.interval.String())
+	}
+}
+
+func TestResampleCandlesticks(t *testing.T) {
+	cs := []Candlestick{
+		// Incomplete group: its start is missing
+		{Timestamp: 3600, OpenPrice: 1, ClosePrice: 1, LowestPrice: 1, HighestPrice: 1},
+		{Timestamp: 7200, OpenPrice: 2, ClosePrice: 3, LowestPrice: 1, HighestPrice: 4},
+		{Timestamp: 10800, OpenPrice: 3, ClosePrice: 5, LowestPrice: 2, HighestPrice: 6},
+		{Timestamp: 14400, OpenPrice: 5, ClosePrice: 4, LowestPrice: 3, HighestPrice: 5},
+		{Timestamp: 18000, OpenPrice: 4, ClosePrice: 2, LowestPrice: 0.5, HighestPrice: 4},
+		// Incomplete group: it hasn't finished
+		{Timestamp: 21600, OpenPrice: 2, ClosePrice: 2, LowestPrice: 2, HighestPrice: 2},
+	}
+	require.Equal(t, []Candlestick{
+		{Timestamp: 7200, OpenPrice: 2, ClosePrice: 5, LowestPrice: 1, HighestPrice: 6},
+		{Timestamp: 14400, OpenPrice: 5, ClosePrice: 2, LowestPrice: 0.5, HighestPrice: 5},
+	}, ResampleCandlesticks(cs, time.Hour, 2*time.Hour, Anchor{}))
+	require.Equal(t, cs, ResampleCandlesticks(cs, time.Hour, time.Hour, Anchor{}))
+	require.Equal(t, []Candlestick{}, ResampleCandlesticks(cs, time.Hour, 90*time.Minute, Anchor{}))
+	require.Equal(t, []Candlestick{}, ResampleCandlesticks(nil, time.Hour, 2*time.Hour, Anchor{}))
+}
+
+func TestResampleCandlesticksFollowsAnchor(t *testing.T) {
+	hourly := func(from string, hours int) []Candlestick {
+		cs := []Candlestick{}
+		for i := 0; i < hours; i++ {
+			cs = append(cs, Candlestick{Timestamp: tInt(from) + i*3600, OpenPrice: 1, ClosePrice: 1, LowestPrice: 1, HighestPrice: 1})
+		}
+		return cs
+	}
+
+	// Daily candlesticks anchored to 00:00 KST start at 15:00 UTC, rather than at UTC midnight.
+	kst := NewAnchor("KST_EXCHANGE").WithUTCOffset(9 * time.Hour)
+	resampled := ResampleCandlesticks(hourly("2021-01-01 15:00:00", 48), time.Hour, 24*time.Hour, kst)
+	require.Len(t, resampled, 2)
+	require.Equal(t, tInt("2021-01-01 15:00:00"), resampled[0].Timestamp)
+	require.Equal(t, tInt("2021-01-02 15:00:00"), resampled[1].Timestamp)
+
+	// Calendar months have different numbers of candlesticks.
+	daily := []Candlestick{}
+	for ts := tInt("2021-02-01 00:00:00"); ts < tInt("2021-04-01 00:00:00"); ts += 24 * 3600 {
+		daily = append(daily, Candlestick{Timestamp: ts, OpenPrice: 1, ClosePrice: 1, LowestPrice: 1, HighestPrice: 1})
+	}
+	resampled = ResampleCandlesticks(daily, 24*time.Hour, 30*24*time.Hour, NewAnchor(BINANCE))
+	require.Len(t, resampled, 2)
+	require.Equal(t, tInt("2021-02-01 00:00:00"), resampled[0].Timestamp)
+	require.Equal(t, tInt("2021-03-01 00:00:00"), resampled[1].Timestamp)
+}
+
+type closeStampedProvider struct{ CandlestickProvider }
+
+func (closeStampedProvider) TimestampSemantics() TimestampSemantics { return CloseStamped }
+
+func TestResampleStampedCandlesticks(t *testing.T) {
+	// The same candlesticks as in TestResampleCandlesticks, stamped at their close.
+	cs := []Candlestick{
+		// Incomplete group: its start is missing
+		{Timestamp: 7200, OpenPrice: 1, ClosePrice: 1, LowestPrice: 1, HighestPrice: 1},
+		{Timestamp: 10800, OpenPrice: 2, ClosePrice: 3, LowestPrice: 1, HighestPrice: 4},
+		{Timestamp: 14400, OpenPrice: 3, ClosePrice: 5, LowestPrice: 2, HighestPrice: 6},
+		{Timestamp: 18000, OpenPrice: 5, ClosePrice: 4, LowestPrice: 3, HighestPrice: 5},
+		{Timestamp: 21600, OpenPrice: 4, ClosePrice: 2, LowestPrice: 0.5, HighestPrice: 4},
+		// Incomplete group: it hasn't finished
+		{Timestamp: 25200, OpenPrice: 2, ClosePrice: 2, LowestPrice: 2, HighestPrice: 2},
+	}
+	semantics := TimestampSemanticsOf(closeStampedProvider{})
+	require.Equal(t, CloseStamped, semantics)
+	require.Equal(t, []Candlestick{
+		{Timestamp: 14400, OpenPrice: 2, ClosePrice: 5, LowestPrice: 1, HighestPrice: 6},
+		{Timestamp: 21600, OpenPrice: 5, ClosePrice: 2, LowestPrice: 0.5, HighestPrice: 5},
+	}, ResampleStampedCandlesticks(cs, time.Hour, 2*time.Hour, Anchor{}, semantics))
+	require.Equal(t, cs, ResampleStampedCandlesticks(cs, time.Hour, time.Hour, Anchor{}, semantics))
+	require.Equal(t, []Candlestick{}, ResampleStampedCandlesticks(nil, time.Hour, 2*time.Hour, Anchor{}, semantics))
+
+	// Open-stamped candlesticks are resampled as with ResampleCandlesticks.
+	require.Equal(t, OpenStamped, TimestampSemanticsOf(struct{ CandlestickProvider }{}))
+	require.Equal(t, ResampleCandlesticks(cs, time.Hour, 2*time.Hour, Anchor{}), ResampleStampedCandlesticks(cs, time.Hour, 2*time.Hour, Anchor{}, OpenStamped))
+}
+
+func TestFindAndWindow(t *testing.T) {
+	cs := []Candlestick{{Timestamp: 60}, {Timestamp: 120}, {Timestamp: 180}, {Timestamp: 240}}
+
+	tss := []struct {
+		ts                 int
+		expectedFirstAfter int
+		expectedLastBefore int
+	}{
+		{ts: 0, expectedFirstAfter: 0, expectedLastBefore: -1},
+		{ts: 60, expectedFirstAfter: 0, expectedLastBefore: 0},
+		{ts: 90, expectedFirstAfter: 1, expectedLastBefore: 0},
+		{ts: 240, expectedFirstAfter: 3, expectedLastBefore: 3},
+		{ts: 300, expectedFirstAfter: 4, expectedLastBefore: 3},
+	}
+	for _, ts := range tss {
+		require.Equal(t, ts.expectedFirstAfter, FindFirstAtOrAfter(cs, ts.ts), "FindFirstAtOrAfter(%v)", ts.ts)
+		require.Equal(t, ts.expectedLastBefore, FindLastAtOrBefore(cs, ts.ts), "FindLastAtOrBefore(%v)", ts.ts)
+	}
+
+	require.Equal(t, cs, Window(cs, 0, 300))
+	require.Equal(t, cs[1:3], Window(cs, 120, 180))
+	require.Equal(t, cs[1:3], Window(cs, 90, 200))
+	require.Equal(t, []Candlestick{}, Window(cs, 130, 170))
+	require.Equal(t, []Candlestick{}, Window(cs, 300, 60))
+	require.Equal(t, []Candlestick{}, Window(nil, 0, 300))
+}
+
+func TestTrimCandlesticksAtOrAfter(t *testing.T) {
+	cs := []Candlestick{{Timestamp: 60}, {Timestamp: 120}, {Timestamp: 180}}
+
+	require.Equal(t, cs, TrimCandlesticksAtOrAfter(cs, time.Time{}))
+	require.Equal(t, cs[:2], TrimCandlesticksAtOrAfter(cs, time.Unix(180, 0)))
+	require.Equal(t, cs[:2], TrimCandlesticksAtOrAfter(cs, time.Unix(150, 0)))
+	require.Equal(t, []Candlestick{}, TrimCandlesticksAtOrAfter(cs, time.Unix(60, 0)))
+}
+
+func TestClassifyClientDoError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	client := &http.Client{Timeout: 1 * time.Millisecond}
+	_, err := client.Get(ts.URL)
+	require.NotNil(t, err)
+	candleReqErr := ClassifyClientDoError(err)
+	require.ErrorIs(t, candleReqErr.Err, ErrTimeout)
+	require.False(t, candleReqErr.IsNotRetryable)
+	require.Equal(t, KindTransient, candleReqErr.Kind)
+
+	_, err = client.Get("invalid url")
+	require.NotNil(t, err)
+	candleReqErr = ClassifyClientDoError(err)
+	require.ErrorIs(t, candleReqErr.Err, ErrExecutingRequest)
+	require.True(t, candleReqErr.IsNotRetryable)
+}
+
+func TestClassifyClientDoErrorConnectionErrors(t *testing.T) {
+	tss := []struct {
+		name                 string
+		err                  error
+		expectedNotRetryable bool
+	}{
+		{name: "connection reset", err: &url.Error{Op: "Get", URL: "http://x", Err: &net.OpError{Op: "read", Err: syscall.ECONNRESET}}, expectedNotRetryable: false},
+		{name: "connection refused", err: &url.Error{Op: "Get", URL: "http://x", Err: &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}}, expectedNotRetryable: false},
+		{name: "connection closed before response", err: &url.Error{Op: "Get", URL: "http://x", Err: io.EOF}, expectedNotRetryable: false},
+		{name: "temporary DNS failure", err: &url.Error{Op: "Get", URL: "http://x", Err: &net.OpError{Op: "dial", Err: &net.DNSError{Err: "server misbehaving", IsTemporary: true}}}, expectedNotRetryable: false},
+		{name: "no such host", err: &url.Error{Op: "Get", URL: "http://x", Err: &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host"}}}, expectedNotRetryable: true},
+		{name: "unsupported protocol scheme", err: &url.Error{Op: "Get", URL: "x", Err: errors.New(`unsupported protocol scheme ""`)}, expectedNotRetryable: true},
+	}
+	for _, ts := range tss {
+		t.Run(ts.name, func(t *testing.T) {
+			candleReqErr := ClassifyClientDoError(ts.err)
+			require.ErrorIs(t, candleReqErr.Err, ErrExecutingRequest)
+			require.Equal(t, ts.expectedNotRetryable, candleReqErr.IsNotRetryable)
+		})
+	}
+}
+
+type historyDepthProvider struct{ maxHistoryDepth time.Duration }
+
+func (p historyDepthProvider) RequestCandlesticks(MarketSource, time.Time, time.Duration) ([]Candlestick, error) {
+	return nil, nil
+}
+func (p historyDepthProvider) Patience() time.Duration             { return 0 }
+func (p historyDepthProvider) MaxHistoryDepth() time.Duration      { return p.maxHistoryDepth }
+func (p historyDepthProvider) SupportedIntervals() []time.Duration { return nil }
+func (p historyDepthProvider) Name() string                        { return "TEST" }
+
+func TestCheckHistoryDepth(t *testing.T) {
+	now := time.Date(2022, 7, 9, 15, 0, 0, 0, time.UTC)
+
+	require.Nil(t, CheckHistoryDepth(historyDepthProvider{}, now.Add(-10*365*24*time.Hour), now))
+	require.Nil(t, CheckHistoryDepth(historyDepthProvider{maxHistoryDepth: time.Hour}, now.Add(-time.Hour), now))
+	err := CheckHistoryDepth(historyDepthProvider{maxHistoryDepth: time.Hour}, now.Add(-time.Hour-time.Second), now)
+	require.ErrorIs(t, err, ErrDataTooFarBack)
+	require.Equal(t, KindTooFarBack, err.(CandleReqError).Kind)
+
+	// Providers that don't implement HistoryDepthProvider have no known limit.
+	require.Equal(t, time.Duration(0), MaxHistoryDepthOf(struct{ CandlestickProvider }{}))
+	require.Nil(t, CheckHistoryDepth(struct{ CandlestickProvider }{}, now.Add(-10*365*24*time.Hour), now))
+}
+
+func TestSupportedIntervalsOf(t *testing.T) {
+	require.Nil(t, SupportedIntervalsOf(historyDepthProvider{}))
+	require.Nil(t, SupportedIntervalsOf(struct{ CandlestickProvider }{}))
+}
+
+func TestNewRateLimitError(t *testing.T) {
+	tss := []struct {
+		name     string
+		header   http.Header
+		expected time.Duration
+	}{
+		{name: "no headers uses fallback", header: http.Header{}, expected: 11 * time.Second},
+		{name: "Retry-After in seconds", header: http.Header{"Retry-After": []string{"5"}}, expected: 5 * time.Second},
+		{name: "Retry-After in the past", header: http.Header{"Retry-After": []string{"Wed, 21 Oct 2015 07:28:00 GMT"}}, expected: 0},
+		{name: "RateLimit-Reset", header: http.Header{"Ratelimit-Reset": []string{"30"}}, expected: 30 * time.Second},
+		{name: "X-RateLimit-Reset", header: http.Header{"X-Ratelimit-Reset": []string{"2"}}, expected: 2 * time.Second},
+		{name: "invalid Retry-After uses fallback", header: http.Header{"Retry-After": []string{"soon"}}, expected: 11 * time.Second},
+		{name: "usage headers are ignored", header: http.Header{"X-Mbx-Used-Weight": []string{"1200"}}, expected: 11 * time.Second},
+	}
+	for _, ts := range tss {
+		t.Run(ts.name, func(t *testing.T) {
+			err := NewRateLimitError(ts.header, 11*time.Second)
+			require.ErrorIs(t, err, ErrRateLimit)
+			require.Equal(t, KindRateLimited, err.Kind)
+			require.False(t, err.IsNotRetryable)
+			require.Equal(t, ts.expected, err.RetryAfter)
+		})
+	}
+
+	inAMinute := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	err := NewRateLimitError(http.Header{"Retry-After": []string{inAMinute}}, 0)
+	require.InDelta(t, float64(time.Minute), float64(err.RetryAfter), float64(2*time.Second))
+
+	// X-RateLimit-Reset as the UNIX timestamp of the reset.
+	resetTs := strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10)
+	err = NewRateLimitError(http.Header{"X-Ratelimit-Reset": []string{resetTs}}, 0)
+	require.InDelta(t, float64(time.Minute), float64(err.RetryAfter), float64(2*time.Second))
+}
+
+func TestSortedIntervals(t *testing.T) {
+	require.Equal(t, []time.Duration{time.Second, time.Minute, time.Hour}, SortedIntervals(map[time.Duration]string{time.Hour: "1h", time.Second: "1s", time.Minute: "1m"}))
+	require.Equal(t, []time.Duration{}, SortedIntervals(nil))
+}
+
+func TestBeforeListingError(t *testing.T) {
+	outOfCandlesticks := CandleReqError{Kind: KindTransient, Err: ErrOutOfCandlesticks}
+	startTime := time.Unix(0, 0)
+	latestAt := func(ts int) func() ([]Candlestick, error) {
+		return func() ([]Candlestick, error) { return []Candlestick{{Timestamp: ts}}, nil }
+	}
+
+	err := BeforeListingError(outOfCandlesticks, startTime, time.Time{}, 10, time.Minute, latestAt(600))
+	require.ErrorIs(t, err, ErrBeforeListing)
+	require.True(t, err.(CandleReqError).IsNotRetryable)
+
+	// The latest candlestick is within the page.
+	require.Equal(t, outOfCandlesticks, BeforeListingError(outOfCandlesticks, startTime, time.Time{}, 10, time.Minute, latestAt(540)))
+	// The end time shortens the page.
+	require.ErrorIs(t, BeforeListingError(outOfCandlesticks, startTime, time.Unix(300, 0), 10, time.Minute, latestAt(540)), ErrBeforeListing)
+	// The latest candlesticks can't be requested.
+	require.Equal(t, outOfCandlesticks, BeforeListingError(outOfCandlesticks, startTime, time.Time{}, 10, time.Minute, func() ([]Candlestick, error) { return nil, outOfCandlesticks }))
+	// Other errors are returned as is, without requesting the latest candlesticks.
+	rateLimit := CandleReqError{Kind: KindRateLimited, Err: ErrRateLimit}
+	require.Equal(t, rateLimit, BeforeListingError(rateLimit, startTime, time.Time{}, 10, time.Minute, nil))
+}
+
+func TestFinalCandlesticks(t *testing.T) {
+	cs := []Candlestick{{Timestamp: 0}, {Timestamp: 60}, {Timestamp: 120}}
+
+	require.Equal(t, cs, FinalCandlesticks(cs, time.Minute, 0, time.Unix(180, 0)))
+	require.Equal(t, cs[:2], FinalCandlesticks(cs, time.Minute, 0, time.Unix(179, 0)))
+	require.Equal(t, cs[:1], FinalCandlesticks(cs, time.Minute, time.Minute, time.Unix(179, 0)))
+	require.Equal(t, []Candlestick{}, FinalCandlesticks(cs, time.Minute, 0, time.Unix(59, 0)))
+
+	// Monthly candlesticks close at the end of the calendar month, e.g. after 31 days in January, and 29 in February.
+	month := 30 * 24 * time.Hour
+	monthly := []Candlestick{{Timestamp: tInt("2024-01-01 00:00:00")}, {Timestamp: tInt("2024-02-01 00:00:00")}}
+	binance := NewAnchor(BINANCE)
+	require.Equal(t, []Candlestick{}, FinalAnchoredCandlesticks(monthly, month, 0, tp("2024-01-31 12:00:00"), binance))
+	require.Equal(t, monthly[:1], FinalAnchoredCandlesticks(monthly, month, 0, tp("2024-02-01 00:00:00"), binance))
+	require.Equal(t, monthly[:1], FinalAnchoredCandlesticks(monthly, month, time.Minute, tp("2024-03-01 00:00:30"), binance))
+	require.Equal(t, monthly, FinalAnchoredCandlesticks(monthly, month, time.Minute, tp("2024-03-01 00:01:00"), binance))
+
+	// Without a calendar month anchor, they last 30 days.
+	require.Equal(t, monthly[:1], FinalCandlesticks(monthly, month, 0, tp("2024-01-31 00:00:00")))
+}
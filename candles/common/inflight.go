@@ -0,0 +1,73 @@
+package common
+
+import "sync"
+
+// DefaultMaxInFlightRequests is the maximum number of concurrent HTTP requests of newly constructed Requesters. Set it
+// before constructing a Market to change it for all exchanges. Zero means no limit.
+var DefaultMaxInFlightRequests = 5
+
+// InFlightLimitedProvider is optionally implemented by CandlestickProviders that cap their concurrent HTTP requests.
+type InFlightLimitedProvider interface {
+	// SetMaxInFlightRequests caps the provider's concurrent HTTP requests; further ones wait for a slot. Zero means no
+	// limit.
+	SetMaxInFlightRequests(maxInFlight int)
+
+	// InFlightRequests returns the number of the provider's HTTP requests currently in flight.
+	InFlightRequests() int
+}
+
+// inFlightLimiter is a semaphore whose capacity can change while in use. It's a pointer within Requester, so that
+// copies of a Requester share it.
+type inFlightLimiter struct {
+	lock     sync.Mutex
+	cond     *sync.Cond
+	max      int
+	inFlight int
+}
+
+func newInFlightLimiter(max int) *inFlightLimiter {
+	l := &inFlightLimiter{max: max}
+	l.cond = sync.NewCond(&l.lock)
+	return l
+}
+
+func (l *inFlightLimiter) setMax(max int) {
+	if l == nil {
+		return
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.max = max
+	l.cond.Broadcast()
+}
+
+func (l *inFlightLimiter) acquire() {
+	if l == nil {
+		return
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	for l.max > 0 && l.inFlight >= l.max {
+		l.cond.Wait()
+	}
+	l.inFlight++
+}
+
+func (l *inFlightLimiter) release() {
+	if l == nil {
+		return
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.inFlight--
+	l.cond.Signal()
+}
+
+func (l *inFlightLimiter) count() int {
+	if l == nil {
+		return 0
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.inFlight
+}
@@ -0,0 +1,51 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// UnmarshalUseNumber is like json.Unmarshal, but numbers decoded into interface{} values are json.Number rather than
+// float64, so that no precision is lost before they're converted (e.g. millisecond timestamps). Use NumberToInt64 and
+// NumberToFloat64 to convert them.
+func UnmarshalUseNumber(byts []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(byts))
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return errors.New("invalid character after top-level value")
+	}
+	return nil
+}
+
+// NumberToInt64 converts a number decoded by UnmarshalUseNumber to an int64, without going through float64. Returns
+// false if it's not a whole number.
+func NumberToInt64(i interface{}) (int64, bool) {
+	number, ok := i.(json.Number)
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(string(number), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+// NumberToFloat64 converts a number decoded by UnmarshalUseNumber to a float64.
+func NumberToFloat64(i interface{}) (float64, bool) {
+	number, ok := i.(json.Number)
+	if !ok {
+		return 0, false
+	}
+	f, err := number.Float64()
+	if err != nil {
+		return 0, false
+	}
+	return f, true
+}
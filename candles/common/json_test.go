@@ -0,0 +1,39 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnmarshalUseNumber(t *testing.T) {
+	var raw []interface{}
+	require.Nil(t, UnmarshalUseNumber([]byte(`[1499040000123, 9007199254740993, "31540.72", 31540.72]`), &raw))
+
+	millis, ok := NumberToInt64(raw[0])
+	require.True(t, ok)
+	require.Equal(t, int64(1499040000123), millis)
+
+	// 2^53 + 1 is the smallest positive integer that a float64 can't represent.
+	volume, ok := NumberToInt64(raw[1])
+	require.True(t, ok)
+	require.Equal(t, int64(9007199254740993), volume)
+
+	_, ok = NumberToInt64(raw[2])
+	require.False(t, ok)
+	_, ok = NumberToFloat64(raw[2])
+	require.False(t, ok)
+
+	price, ok := NumberToFloat64(raw[3])
+	require.True(t, ok)
+	require.Equal(t, 31540.72, price)
+
+	_, ok = NumberToInt64(raw[3])
+	require.False(t, ok)
+}
+
+func TestUnmarshalUseNumberInvalidJSON(t *testing.T) {
+	var raw []interface{}
+	require.NotNil(t, UnmarshalUseNumber([]byte(`invalid json`), &raw))
+	require.NotNil(t, UnmarshalUseNumber([]byte(`[1] [2]`), &raw))
+}
@@ -0,0 +1,25 @@
+package common
+
+import "time"
+
+// Observer is notified of requests to exchanges and of cache lookups, e.g. to expose them as metrics (requests and
+// errors per provider, request latency, cache hit ratio) without this library depending on a metrics library.
+//
+// Implementations must be safe for concurrent use, and should return quickly, as they're called inline.
+type Observer interface {
+	// ObserveRequest is called after each candlestick request to an exchange, with how long it took (including
+	// retries) and its error, if any. Errors are usually CandleReqErrors, whose Kind classifies them.
+	ObserveRequest(provider string, candlestickInterval time.Duration, duration time.Duration, err error)
+
+	// ObserveCacheLookup is called after each cache lookup, with whether the cache had the candlesticks.
+	ObserveCacheLookup(provider string, candlestickInterval time.Duration, hit bool)
+}
+
+// NoOpObserver is an Observer that does nothing. It's the default.
+type NoOpObserver struct{}
+
+// ObserveRequest does nothing.
+func (NoOpObserver) ObserveRequest(string, time.Duration, time.Duration, error) {}
+
+// ObserveCacheLookup does nothing.
+func (NoOpObserver) ObserveCacheLookup(string, time.Duration, bool) {}
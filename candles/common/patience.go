@@ -0,0 +1,61 @@
+package common
+
+import (
+	"sync"
+	"time"
+)
+
+// PatienceSettings holds an exchange's patience (see CandlestickProvider.Patience), optionally tuned per candlestick
+// interval, since e.g. a daily candlestick may take longer to be final than a minutely one.
+//
+// It's safe for concurrent use, so it can be tuned while iterators are running.
+type PatienceSettings struct {
+	lock            sync.RWMutex
+	defaultPatience time.Duration
+	byInterval      map[time.Duration]time.Duration
+}
+
+// NewPatienceSettings constructs PatienceSettings with the given patience for all candlestick intervals.
+func NewPatienceSettings(defaultPatience time.Duration) *PatienceSettings {
+	return &PatienceSettings{defaultPatience: defaultPatience, byInterval: map[time.Duration]time.Duration{}}
+}
+
+// Get returns the patience for candlestick intervals without a specific patience.
+func (p *PatienceSettings) Get() time.Duration {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.defaultPatience
+}
+
+// For returns the patience for the given candlestick interval, or the default patience if it wasn't tuned.
+func (p *PatienceSettings) For(candlestickInterval time.Duration) time.Duration {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	if patience, ok := p.byInterval[candlestickInterval]; ok {
+		return patience
+	}
+	return p.defaultPatience
+}
+
+// Set sets the patience for candlestick intervals without a specific patience.
+func (p *PatienceSettings) Set(patience time.Duration) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.defaultPatience = patience
+}
+
+// SetFor sets the patience for the given candlestick interval, overriding the default patience.
+func (p *PatienceSettings) SetFor(candlestickInterval time.Duration, patience time.Duration) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.byInterval[candlestickInterval] = patience
+}
+
+// PatienceFor returns the provider's patience for the given candlestick interval, if the provider implements
+// IntervalPatienceProvider, or its Patience otherwise.
+func PatienceFor(provider CandlestickProvider, candlestickInterval time.Duration) time.Duration {
+	if intervalPatienceProvider, ok := provider.(IntervalPatienceProvider); ok {
+		return intervalPatienceProvider.PatienceFor(candlestickInterval)
+	}
+	return provider.Patience()
+}
@@ -0,0 +1,37 @@
+package common
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPatienceSettings(t *testing.T) {
+	p := NewPatienceSettings(time.Minute)
+	require.Equal(t, time.Minute, p.Get())
+	require.Equal(t, time.Minute, p.For(24*time.Hour))
+
+	p.SetFor(24*time.Hour, 5*time.Minute)
+	require.Equal(t, time.Minute, p.Get())
+	require.Equal(t, time.Minute, p.For(time.Minute))
+	require.Equal(t, 5*time.Minute, p.For(24*time.Hour))
+
+	p.Set(30 * time.Second)
+	require.Equal(t, 30*time.Second, p.Get())
+	require.Equal(t, 30*time.Second, p.For(time.Minute))
+	require.Equal(t, 5*time.Minute, p.For(24*time.Hour))
+}
+
+type intervalPatienceProvider struct {
+	historyDepthProvider
+}
+
+func (p intervalPatienceProvider) PatienceFor(candlestickInterval time.Duration) time.Duration {
+	return candlestickInterval
+}
+
+func TestPatienceFor(t *testing.T) {
+	require.Equal(t, time.Duration(0), PatienceFor(historyDepthProvider{}, time.Hour))
+	require.Equal(t, time.Hour, PatienceFor(intervalPatienceProvider{}, time.Hour))
+}
@@ -1,6 +1,9 @@
 package common
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"math"
 	"time"
 
@@ -13,39 +16,97 @@ type RetryStrategy struct {
 	Attempts            int
 	FirstSleepTime      time.Duration
 	SleepTimeMultiplier float64
+
+	// MaxSleepTime caps the sleep between retries, including the RetryAfter an exchange asks for, unless rate limited
+	// requests block for it (see RequesterWithRetry.SetMaxRateLimitWait). Zero means the longest sleep of the
+	// exponential backoff, i.e. before the last attempt.
+	MaxSleepTime time.Duration
+
+	// Deadline bounds the total time of a request across all attempts and sleeps, unlike the HTTP client's timeout,
+	// which bounds a single attempt. Zero means no deadline.
+	Deadline time.Duration
 }
 
 // RequesterWithRetry runs an exchange's candlestick request, with a supplied retry strategy.
 type RequesterWithRetry struct {
-	fn       func(string, string, time.Time, time.Duration) ([]Candlestick, error)
-	Strategy RetryStrategy
-	debug    *bool
+	fn               func(string, string, time.Time, time.Duration) ([]Candlestick, error)
+	Strategy         RetryStrategy
+	debug            *bool
+	maxRateLimitWait time.Duration
 }
 
 // NewRequesterWithRetry constructs a RequesterWithRetry
 func NewRequesterWithRetry(fn func(string, string, time.Time, time.Duration) ([]Candlestick, error), strategy RetryStrategy, debug *bool) RequesterWithRetry {
-	if strategy.Attempts == 0 {
-		strategy.Attempts = 3
+	return RequesterWithRetry{fn: fn, Strategy: strategy.withDefaults(), debug: debug}
+}
+
+// SetMaxRateLimitWait makes rate limited requests block for exactly the RetryAfter the exchange asked for (rather than
+// backing off exponentially from it) before retrying, as long as it's not longer than maxWait; otherwise the request
+// fails with ErrRateLimit right away. Retries still count towards the strategy's attempts. Zero disables it.
+func (r *RequesterWithRetry) SetMaxRateLimitWait(maxWait time.Duration) {
+	r.maxRateLimitWait = maxWait
+}
+
+// SetStrategy overrides the retry strategy. Zero fields take the same defaults as in NewRequesterWithRetry.
+func (r *RequesterWithRetry) SetStrategy(strategy RetryStrategy) {
+	r.Strategy = strategy.withDefaults()
+}
+
+func (s RetryStrategy) withDefaults() RetryStrategy {
+	if s.Attempts == 0 {
+		s.Attempts = 3
 	}
-	if strategy.FirstSleepTime == 0 {
-		strategy.FirstSleepTime = 1 * time.Second
+	if s.FirstSleepTime == 0 {
+		s.FirstSleepTime = 1 * time.Second
 	}
-	if strategy.SleepTimeMultiplier == 0.0 {
-		strategy.SleepTimeMultiplier = 2.0
+	if s.SleepTimeMultiplier == 0.0 {
+		s.SleepTimeMultiplier = 2.0
 	}
-	return RequesterWithRetry{fn, strategy, debug}
+	return s
+}
+
+// maxSleepTime returns MaxSleepTime, or the longest sleep of the exponential backoff if it's zero.
+func (s RetryStrategy) maxSleepTime() time.Duration {
+	if s.MaxSleepTime > 0 {
+		return s.MaxSleepTime
+	}
+	longest := time.Duration(math.Round(float64(s.FirstSleepTime) * math.Pow(math.Max(s.SleepTimeMultiplier, 1), float64(s.Attempts-2))))
+	if longest < s.FirstSleepTime {
+		return s.FirstSleepTime
+	}
+	return longest
+}
+
+// WithFn returns a copy of the RequesterWithRetry that runs the supplied request function instead, with the same retry
+// strategy. Useful to supply extra parameters to a single request (e.g. an end time).
+func (r RequesterWithRetry) WithFn(fn func(string, string, time.Time, time.Duration) ([]Candlestick, error)) RequesterWithRetry {
+	r.fn = fn
+	return r
 }
 
 // Request runs an exchange's candlestick request, with a supplied retry strategy.
+//
+// If the strategy has a Deadline and it's exceeded, the last error is returned, wrapped so that it also matches
+// context.DeadlineExceeded (or ErrTimeout if the first attempt didn't finish). An attempt in flight is abandoned, but
+// it still runs (bounded by the HTTP client's timeout) and its result is ignored.
 func (r RequesterWithRetry) Request(baseAsset string, quoteAsset string, startTime time.Time, candlestickInterval time.Duration) ([]Candlestick, error) {
+	ctx := context.Background()
+	if r.Strategy.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Strategy.Deadline)
+		defer cancel()
+	}
 	var (
-		err          error
-		candlesticks []Candlestick
-		sleepTime    = r.Strategy.FirstSleepTime
-		attempts     = r.Strategy.Attempts
+		err       error
+		sleepTime = r.Strategy.FirstSleepTime
+		attempts  = r.Strategy.Attempts
 	)
 	for attempts > 0 {
-		if candlesticks, err = r.fn(baseAsset, quoteAsset, startTime, candlestickInterval); err == nil {
+		candlesticks, finished, attemptErr := r.attempt(ctx, baseAsset, quoteAsset, startTime, candlestickInterval)
+		if !finished {
+			return nil, deadlineExceeded(err)
+		}
+		if err = attemptErr; err == nil {
 			return candlesticks, nil
 		}
 		candleReqErr := err.(CandleReqError)
@@ -55,6 +116,13 @@ func (r RequesterWithRetry) Request(baseAsset string, quoteAsset string, startTi
 		if candleReqErr.RetryAfter > 0 {
 			sleepTime = candleReqErr.RetryAfter
 		}
+		blocking := r.maxRateLimitWait > 0 && errors.Is(candleReqErr, ErrRateLimit)
+		if blocking && sleepTime > r.maxRateLimitWait {
+			break
+		}
+		if maxSleepTime := r.Strategy.maxSleepTime(); !blocking && sleepTime > maxSleepTime {
+			sleepTime = maxSleepTime
+		}
 		attempts--
 		if attempts == 0 {
 			break
@@ -62,8 +130,75 @@ func (r RequesterWithRetry) Request(baseAsset string, quoteAsset string, startTi
 		if *r.debug {
 			log.Info().Msgf("Request failed with error: %v, retrying (%v attempts left) candlestick request after sleeping for %v", candleReqErr.Err, attempts, sleepTime)
 		}
-		time.Sleep(sleepTime)
+		if !sleepCtx(ctx, sleepTime) {
+			return nil, deadlineExceeded(err)
+		}
+		if blocking {
+			sleepTime = r.Strategy.FirstSleepTime
+			continue
+		}
 		sleepTime = time.Duration(int64(math.Round(float64(sleepTime) * r.Strategy.SleepTimeMultiplier)))
 	}
 	return nil, err
 }
+
+// attempt runs the request function once. Without a deadline, it runs on the calling goroutine. Otherwise, it returns
+// unfinished if the deadline is exceeded before the request function returns.
+func (r RequesterWithRetry) attempt(ctx context.Context, baseAsset string, quoteAsset string, startTime time.Time, candlestickInterval time.Duration) ([]Candlestick, bool, error) {
+	if ctx.Done() == nil {
+		candlesticks, err := r.fn(baseAsset, quoteAsset, startTime, candlestickInterval)
+		return candlesticks, true, err
+	}
+	type result struct {
+		candlesticks []Candlestick
+		err          error
+	}
+	results := make(chan result, 1)
+	go func() {
+		candlesticks, err := r.fn(baseAsset, quoteAsset, startTime, candlestickInterval)
+		results <- result{candlesticks, err}
+	}()
+	select {
+	case res := <-results:
+		return res.candlesticks, true, res.err
+	case <-ctx.Done():
+		return nil, false, nil
+	}
+}
+
+// sleepCtx sleeps for the given duration, unless the context is done first, in which case it returns false.
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// deadlineError wraps the last error of a request whose deadline was exceeded, so that it matches both.
+type deadlineError struct {
+	err error
+}
+
+func (e deadlineError) Error() string {
+	return fmt.Sprintf("%v: %v", context.DeadlineExceeded, e.err)
+}
+
+func (e deadlineError) Unwrap() error { return e.err }
+
+func (e deadlineError) Is(target error) bool { return target == context.DeadlineExceeded }
+
+// deadlineExceeded builds the non-retryable error returned when a request's deadline is exceeded, from the last error
+// (nil if no attempt finished).
+func deadlineExceeded(lastErr error) error {
+	candleReqErr, ok := lastErr.(CandleReqError)
+	if !ok {
+		candleReqErr = CandleReqError{Kind: KindTransient, Err: ErrTimeout}
+	}
+	candleReqErr.IsNotRetryable = true
+	candleReqErr.Err = deadlineError{candleReqErr.Err}
+	return candleReqErr
+}
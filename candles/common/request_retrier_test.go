@@ -1,6 +1,9 @@
 package common
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -59,6 +62,60 @@ func TestRequestRetrierDoesNotRetryBecauseUnretryable(t *testing.T) {
 	require.Equal(t, 1, *callCount)
 }
 
+func TestRequestRetrierBlocksOnRateLimit(t *testing.T) {
+	var (
+		sampleCandlesticks = []Candlestick{{Timestamp: 1, OpenPrice: 2, ClosePrice: 3, LowestPrice: 2, HighestPrice: 3}}
+		call1              = response{candlesticks: nil, err: CandleReqError{Kind: KindRateLimited, Err: ErrRateLimit, RetryAfter: 5 * time.Millisecond}}
+		call2              = response{candlesticks: nil, err: CandleReqError{Kind: KindRateLimited, Err: ErrRateLimit, RetryAfter: 5 * time.Millisecond}}
+		call3              = response{candlesticks: sampleCandlesticks, err: nil}
+		fn, callCount      = testFn([]response{call1, call2, call3})
+		strategy           = RetryStrategy{Attempts: 3, FirstSleepTime: time.Millisecond, SleepTimeMultiplier: 100}
+		requester          = NewRequesterWithRetry(fn, strategy, pBool(true))
+	)
+	requester.SetMaxRateLimitWait(10 * time.Millisecond)
+
+	// Without blocking, the second sleep would be 500ms.
+	start := time.Now()
+	candlesticks, err := requester.Request("BTC", "USDT", time.Now(), time.Minute)
+	require.Less(t, time.Since(start), 250*time.Millisecond)
+	require.Equal(t, sampleCandlesticks, candlesticks)
+	require.Nil(t, err)
+	require.Equal(t, 3, *callCount)
+}
+
+func TestRequestRetrierDoesNotBlockLongerThanMaxRateLimitWait(t *testing.T) {
+	var (
+		rateLimitErr  = CandleReqError{Kind: KindRateLimited, Err: ErrRateLimit, RetryAfter: time.Hour}
+		fn, callCount = testFn([]response{{candlesticks: nil, err: rateLimitErr}})
+		strategy      = RetryStrategy{Attempts: 3, FirstSleepTime: time.Millisecond}
+		requester     = NewRequesterWithRetry(fn, strategy, pBool(true))
+	)
+	requester.SetMaxRateLimitWait(time.Second)
+
+	candlesticks, err := requester.Request("BTC", "USDT", time.Now(), time.Minute)
+	require.Nil(t, candlesticks)
+	require.ErrorIs(t, err, ErrRateLimit)
+	require.Equal(t, 1, *callCount)
+}
+
+func TestRequestRetrierClampsRetryAfterToMaxSleepTime(t *testing.T) {
+	var (
+		sampleCandlesticks = []Candlestick{{Timestamp: 1, OpenPrice: 2, ClosePrice: 3, LowestPrice: 2, HighestPrice: 3}}
+		call1              = response{candlesticks: nil, err: CandleReqError{Kind: KindRateLimited, Err: ErrRateLimit, RetryAfter: time.Hour}}
+		call2              = response{candlesticks: sampleCandlesticks, err: nil}
+		fn, callCount      = testFn([]response{call1, call2})
+		strategy           = RetryStrategy{Attempts: 3, FirstSleepTime: time.Millisecond, SleepTimeMultiplier: 2}
+		requester          = NewRequesterWithRetry(fn, strategy, pBool(true))
+	)
+
+	start := time.Now()
+	candlesticks, err := requester.Request("BTC", "USDT", time.Now(), time.Minute)
+	require.Less(t, time.Since(start), 250*time.Millisecond)
+	require.Equal(t, sampleCandlesticks, candlesticks)
+	require.Nil(t, err)
+	require.Equal(t, 2, *callCount)
+}
+
 func TestRequestRetrierWorksThirdTime(t *testing.T) {
 	var (
 		candlestick1       = Candlestick{Timestamp: 1, OpenPrice: 2, ClosePrice: 3, LowestPrice: 4, HighestPrice: 5}
@@ -97,6 +154,45 @@ func TestRequestRetrierGivesUpAtThirdAttempt(t *testing.T) {
 	require.Equal(t, 3, *callCount)
 }
 
+func TestRequestRetrierDeadline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(150 * time.Millisecond)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	httpRequester := NewRequester("TEST", pBool(false))
+	fn := func(baseAsset string, quoteAsset string, startTime time.Time, candlestickInterval time.Duration) ([]Candlestick, error) {
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		return httpRequester.Do(req, func(int, []byte) ([]Candlestick, error) {
+			return nil, CandleReqError{Kind: KindTransient, Err: ErrExecutingRequest}
+		})
+	}
+	requester := NewRequesterWithRetry(fn, RetryStrategy{Attempts: 10, FirstSleepTime: 10 * time.Millisecond, SleepTimeMultiplier: 1, Deadline: 400 * time.Millisecond}, pBool(false))
+
+	start := time.Now()
+	candlesticks, err := requester.Request("BTC", "USDT", time.Now(), time.Minute)
+	require.Less(t, time.Since(start), time.Second)
+	require.Nil(t, candlesticks)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.ErrorIs(t, err, ErrExecutingRequest)
+	var candleReqErr CandleReqError
+	require.ErrorAs(t, err, &candleReqErr)
+	require.True(t, candleReqErr.IsNotRetryable)
+}
+
+func TestRequestRetrierDeadlineBeforeFirstAttemptFinishes(t *testing.T) {
+	fn := func(baseAsset string, quoteAsset string, startTime time.Time, candlestickInterval time.Duration) ([]Candlestick, error) {
+		time.Sleep(200 * time.Millisecond)
+		return nil, nil
+	}
+	requester := NewRequesterWithRetry(fn, RetryStrategy{Deadline: 10 * time.Millisecond}, pBool(false))
+
+	_, err := requester.Request("BTC", "USDT", time.Now(), time.Minute)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.ErrorIs(t, err, ErrTimeout)
+}
+
 func pBool(b bool) *bool { return &b }
 
 type response struct {
@@ -113,3 +209,9 @@ func testFn(responses []response) (func(baseAsset string, quoteAsset string, sta
 	}
 	return fn, &callCount
 }
+
+func TestRequestRetrierSetStrategy(t *testing.T) {
+	r := NewRequesterWithRetry(nil, RetryStrategy{}, nil)
+	r.SetStrategy(RetryStrategy{Attempts: 1})
+	require.Equal(t, RetryStrategy{Attempts: 1, FirstSleepTime: time.Second, SleepTimeMultiplier: 2.0}, r.Strategy)
+}
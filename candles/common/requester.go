@@ -0,0 +1,218 @@
+package common
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Requester executes an exchange's candlestick HTTP request, and takes care of what's common to all exchanges:
+// transport errors & timeouts, rate limiting (i.e. HTTP 429), broken bodies, unparseable responses and empty results,
+// all mapped to CandleReqErrors. Exchanges only have to build the request and decode the response.
+//
+// It's meant to be used within the function supplied to a RequesterWithRetry, which retries retryable errors.
+type Requester struct {
+	// RawBodyMaxBytes is the maximum size of the RawBody attached to KindBadData errors. Zero disables it.
+	RawBodyMaxBytes int
+
+	// RateLimitFallback is the RetryAfter of HTTP 429 responses that don't specify when to retry.
+	RateLimitFallback time.Duration
+
+	// RateLimitIsNotRetryable makes HTTP 429 responses not retryable, for exchanges that ban repeat offenders.
+	RateLimitIsNotRetryable bool
+
+	name    string
+	client  *http.Client
+	debug   *bool
+	stats   *statsCounter
+	breaker *RateLimitBreaker
+	limiter *inFlightLimiter
+}
+
+// DefaultRawBodyMaxBytes is the RawBodyMaxBytes of newly constructed Requesters. It can be changed per exchange (see
+// RawBodyLimitedProvider).
+const DefaultRawBodyMaxBytes = 2048
+
+// RawBodyLimitedProvider is optionally implemented by CandlestickProviders that attach the exchange's response body to
+// KindBadData errors (see CandleReqError.RawBody). All the Exchanges shipped with the library implement it.
+type RawBodyLimitedProvider interface {
+	// SetRawBodyMaxBytes caps the size of the RawBody attached to KindBadData errors. Zero disables it.
+	SetRawBodyMaxBytes(maxBytes int)
+}
+
+// ResponseDecoder decodes an exchange's response body into candlesticks, in ascending order. It should return
+// CandleReqErrors for exchange-specific errors (e.g. invalid market pair). Other errors are considered bad data.
+type ResponseDecoder func(statusCode int, body []byte) ([]Candlestick, error)
+
+// NewRequester constructs a Requester. The name is only used for debug logging.
+func NewRequester(name string, debug *bool) Requester {
+	return Requester{RawBodyMaxBytes: DefaultRawBodyMaxBytes, name: name, client: &http.Client{Timeout: 10 * time.Second}, debug: debug, stats: &statsCounter{}, breaker: NewRateLimitBreaker(), limiter: newInFlightLimiter(DefaultMaxInFlightRequests)}
+}
+
+// SetHTTPClient overrides the HTTP client used to execute requests, e.g. to use a proxy or a different timeout.
+func (r *Requester) SetHTTPClient(client *http.Client) {
+	r.client = client
+}
+
+// Stats returns the Stats of every request executed so far by this Requester and its copies.
+func (r Requester) Stats() Stats {
+	return r.stats.get()
+}
+
+// SetMaxInFlight caps the concurrent HTTP requests of this Requester and its copies; further ones wait for a slot.
+// Zero means no limit. Defaults to DefaultMaxInFlightRequests.
+func (r *Requester) SetMaxInFlight(maxInFlight int) {
+	r.limiter.setMax(maxInFlight)
+}
+
+// InFlight returns the number of HTTP requests of this Requester and its copies currently in flight.
+func (r Requester) InFlight() int {
+	return r.limiter.count()
+}
+
+// RateLimitBreaker returns the breaker shared by every request of this Requester and its copies. It's disabled until
+// its SetMaxPause is called.
+func (r Requester) RateLimitBreaker() *RateLimitBreaker {
+	return r.breaker
+}
+
+// Do executes the request, and decodes the response with the supplied decoder.
+//
+// * Fails with ErrOutOfCandlesticks if the decoder returns no candlesticks.
+// * Fails with ErrExchangeReturnedDuplicateTimestamp if the decoder returns more than one candlestick with the same
+// timestamp, as holes can't be patched nor candlesticks cached reliably in that case.
+// * Fails with ErrInvalidCandlestick if any candlestick is not valid (see Candlestick.IsValid).
+// * Errors of KindBadData carry the (truncated) response body in RawBody, to see what the exchange actually sent.
+func (r Requester) Do(req *http.Request, decode ResponseDecoder) ([]Candlestick, error) {
+	return r.doCandlesticks(req, 0, decode)
+}
+
+// DoWithInterval is like Do, but it also checks that the candlesticks are of the requested candlestick interval, so
+// that exchanges that silently return another interval's candlesticks (e.g. for an unsupported or mismapped interval
+// parameter) don't go unnoticed.
+//
+// * Fails with ErrExchangeReturnedWrongInterval if the candlesticks' spacing doesn't match the interval (see
+// CheckInterval). Retrying wouldn't help, so it's not retryable.
+func (r Requester) DoWithInterval(req *http.Request, candlestickInterval time.Duration, decode ResponseDecoder) ([]Candlestick, error) {
+	return r.doCandlesticks(req, candlestickInterval, decode)
+}
+
+func (r Requester) doCandlesticks(req *http.Request, candlestickInterval time.Duration, decode ResponseDecoder) ([]Candlestick, error) {
+	statusCode, byts, err := r.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	candlesticks, err := decode(statusCode, byts)
+	if err != nil {
+		candleReqErr, ok := err.(CandleReqError)
+		if !ok {
+			candleReqErr = CandleReqError{IsNotRetryable: false, Kind: KindBadData, Err: err}
+		}
+		if candleReqErr.Kind == KindBadData {
+			candleReqErr.RawBody = r.truncateRawBody(byts)
+		}
+		r.breaker.trip(candleReqErr)
+		return nil, candleReqErr
+	}
+
+	if len(candlesticks) == 0 {
+		return nil, CandleReqError{IsNotRetryable: false, Kind: KindTransient, Err: ErrOutOfCandlesticks}
+	}
+
+	if ts, ok := findDuplicateTimestamp(candlesticks); ok {
+		err := fmt.Errorf("%w: %v", ErrExchangeReturnedDuplicateTimestamp, time.Unix(int64(ts), 0).UTC().Format(time.RFC3339))
+		return nil, CandleReqError{IsNotRetryable: false, Kind: KindBadData, Err: err, RawBody: r.truncateRawBody(byts)}
+	}
+
+	for _, candlestick := range candlesticks {
+		if err := candlestick.IsValid(); err != nil {
+			err := fmt.Errorf("%w at %v", err, time.Unix(int64(candlestick.Timestamp), 0).UTC().Format(time.RFC3339))
+			return nil, CandleReqError{IsNotRetryable: false, Kind: KindBadData, Err: err, RawBody: r.truncateRawBody(byts)}
+		}
+	}
+
+	if candlestickInterval != 0 {
+		if err := CheckInterval(candlesticks, candlestickInterval); err != nil {
+			return nil, CandleReqError{IsNotRetryable: true, Kind: KindBadData, Err: err, RawBody: r.truncateRawBody(byts)}
+		}
+	}
+
+	r.stats.add(Stats{CandlesticksReceived: len(candlesticks)})
+	if r.debug != nil && *r.debug {
+		log.Info().Str("exchange", r.name).Str("url", req.URL.String()).Int("candlestick_count", len(candlesticks)).Msg("Candlestick request successful!")
+	}
+
+	return candlesticks, nil
+}
+
+// DoRaw executes a request to an exchange's endpoint other than the candlesticks one (e.g. to list its markets), and
+// returns the response's status code and body. Transport errors, timeouts, rate limiting and broken bodies are mapped
+// to CandleReqErrors like in Do; decoding the body is up to the caller.
+func (r Requester) DoRaw(req *http.Request) (int, []byte, error) {
+	statusCode, byts, err := r.do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	if r.debug != nil && *r.debug {
+		log.Info().Str("exchange", r.name).Str("url", req.URL.String()).Int("status_code", statusCode).Msg("Request successful!")
+	}
+	return statusCode, byts, nil
+}
+
+func (r Requester) do(req *http.Request) (int, []byte, error) {
+	if err := r.breaker.wait(); err != nil {
+		return 0, nil, err
+	}
+	r.limiter.acquire()
+	requestStart := time.Now()
+	statusCode, byts, err := r.doHTTP(req)
+	r.limiter.release()
+	r.stats.add(Stats{RequestsMade: 1, BytesReceived: int64(len(byts)), TotalLatency: time.Since(requestStart)})
+	r.breaker.trip(err)
+	return statusCode, byts, err
+}
+
+func (r Requester) doHTTP(req *http.Request) (int, []byte, error) {
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return 0, nil, ClassifyClientDoError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		err := NewRateLimitError(resp.Header, r.RateLimitFallback)
+		err.IsNotRetryable = r.RateLimitIsNotRetryable
+		return 0, nil, err
+	}
+
+	byts, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, CandleReqError{IsNotRetryable: false, Kind: KindTransient, Err: ErrBrokenBodyResponse}
+	}
+	return resp.StatusCode, byts, nil
+}
+
+func findDuplicateTimestamp(candlesticks []Candlestick) (int, bool) {
+	seen := make(map[int]bool, len(candlesticks))
+	for _, candlestick := range candlesticks {
+		if seen[candlestick.Timestamp] {
+			return candlestick.Timestamp, true
+		}
+		seen[candlestick.Timestamp] = true
+	}
+	return 0, false
+}
+
+func (r Requester) truncateRawBody(byts []byte) []byte {
+	if r.RawBodyMaxBytes <= 0 {
+		return nil
+	}
+	if len(byts) > r.RawBodyMaxBytes {
+		byts = byts[:r.RawBodyMaxBytes]
+	}
+	return append([]byte{}, byts...)
+}
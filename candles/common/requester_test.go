@@ -0,0 +1,366 @@
+package common
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequesterDo(t *testing.T) {
+	sampleCandlesticks := []Candlestick{{Timestamp: 1, OpenPrice: 3, ClosePrice: 4, LowestPrice: 2, HighestPrice: 5}}
+
+	tss := []struct {
+		name                 string
+		handler              http.HandlerFunc
+		decoder              ResponseDecoder
+		rateLimitFallback    time.Duration
+		rateLimitNotRetry    bool
+		expectedCandlesticks []Candlestick
+		expectedErr          error
+		expectedKind         ErrorKind
+		expectedNotRetryable bool
+		expectedRetryAfter   time.Duration
+	}{
+		{
+			name:    "happy path",
+			handler: func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) },
+			decoder: func(statusCode int, body []byte) ([]Candlestick, error) {
+				if statusCode != http.StatusOK || string(body) != "ok" {
+					return nil, errors.New("unexpected response")
+				}
+				return sampleCandlesticks, nil
+			},
+			expectedCandlesticks: sampleCandlesticks,
+		},
+		{
+			name:               "rate limited with fallback",
+			handler:            func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(429) },
+			rateLimitFallback:  11 * time.Second,
+			expectedErr:        ErrRateLimit,
+			expectedKind:       KindRateLimited,
+			expectedRetryAfter: 11 * time.Second,
+		},
+		{
+			name: "rate limited with Retry-After",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("Retry-After", "3")
+				w.WriteHeader(429)
+			},
+			rateLimitFallback:  11 * time.Second,
+			expectedErr:        ErrRateLimit,
+			expectedKind:       KindRateLimited,
+			expectedRetryAfter: 3 * time.Second,
+		},
+		{
+			name:                 "rate limited not retryable",
+			handler:              func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(429) },
+			rateLimitNotRetry:    true,
+			expectedErr:          ErrRateLimit,
+			expectedKind:         KindRateLimited,
+			expectedNotRetryable: true,
+		},
+		{
+			name:         "broken body",
+			handler:      func(w http.ResponseWriter, r *http.Request) { w.Header().Set("Content-Length", "1") },
+			expectedErr:  ErrBrokenBodyResponse,
+			expectedKind: KindTransient,
+		},
+		{
+			name:    "decoder returns a plain error",
+			handler: func(w http.ResponseWriter, r *http.Request) {},
+			decoder: func(statusCode int, body []byte) ([]Candlestick, error) {
+				return nil, ErrInvalidJSONResponse
+			},
+			expectedErr:  ErrInvalidJSONResponse,
+			expectedKind: KindBadData,
+		},
+		{
+			name:    "decoder returns a CandleReqError",
+			handler: func(w http.ResponseWriter, r *http.Request) {},
+			decoder: func(statusCode int, body []byte) ([]Candlestick, error) {
+				return nil, CandleReqError{IsNotRetryable: true, Kind: KindInvalidPair, Err: ErrInvalidMarketPair}
+			},
+			expectedErr:          ErrInvalidMarketPair,
+			expectedKind:         KindInvalidPair,
+			expectedNotRetryable: true,
+		},
+		{
+			name:    "no candlesticks",
+			handler: func(w http.ResponseWriter, r *http.Request) {},
+			decoder: func(statusCode int, body []byte) ([]Candlestick, error) {
+				return []Candlestick{}, nil
+			},
+			expectedErr:  ErrOutOfCandlesticks,
+			expectedKind: KindTransient,
+		},
+		{
+			name:    "duplicate timestamps",
+			handler: func(w http.ResponseWriter, r *http.Request) {},
+			decoder: func(statusCode int, body []byte) ([]Candlestick, error) {
+				return []Candlestick{{Timestamp: 60}, {Timestamp: 120}, {Timestamp: 120}}, nil
+			},
+			expectedErr:  ErrExchangeReturnedDuplicateTimestamp,
+			expectedKind: KindBadData,
+		},
+		{
+			name:    "invalid candlestick",
+			handler: func(w http.ResponseWriter, r *http.Request) {},
+			decoder: func(statusCode int, body []byte) ([]Candlestick, error) {
+				return []Candlestick{{Timestamp: 60, OpenPrice: 1, ClosePrice: 1, LowestPrice: 2, HighestPrice: 1}}, nil
+			},
+			expectedErr:  ErrInvalidCandlestick,
+			expectedKind: KindBadData,
+		},
+	}
+	for _, ts := range tss {
+		t.Run(ts.name, func(t *testing.T) {
+			server := httptest.NewServer(ts.handler)
+			defer server.Close()
+
+			requester := NewRequester("TEST", pBool(true))
+			requester.RateLimitFallback = ts.rateLimitFallback
+			requester.RateLimitIsNotRetryable = ts.rateLimitNotRetry
+			req, _ := http.NewRequest("GET", server.URL, nil)
+
+			decoder := ts.decoder
+			if decoder == nil {
+				decoder = func(int, []byte) ([]Candlestick, error) { return sampleCandlesticks, nil }
+			}
+
+			candlesticks, err := requester.Do(req, decoder)
+			if ts.expectedErr == nil {
+				require.Nil(t, err)
+				require.Equal(t, ts.expectedCandlesticks, candlesticks)
+				return
+			}
+			candleReqErr, ok := err.(CandleReqError)
+			require.True(t, ok)
+			require.ErrorIs(t, candleReqErr, ts.expectedErr)
+			require.Equal(t, ts.expectedKind, candleReqErr.Kind)
+			require.Equal(t, ts.expectedNotRetryable, candleReqErr.IsNotRetryable)
+			require.Equal(t, ts.expectedRetryAfter, candleReqErr.RetryAfter)
+		})
+	}
+}
+
+func TestRequesterDoInvalidURL(t *testing.T) {
+	req, _ := http.NewRequest("GET", "invalid url", nil)
+	_, err := NewRequester("TEST", pBool(false)).Do(req, func(int, []byte) ([]Candlestick, error) { return nil, nil })
+	require.ErrorIs(t, err, ErrExecutingRequest)
+}
+
+func TestRequesterDoAttachesRawBodyOnBadData(t *testing.T) {
+	tss := []struct {
+		name            string
+		body            string
+		decoder         ResponseDecoder
+		rawBodyMaxBytes int
+		expectedRawBody []byte
+	}{
+		{
+			name:            "plain decoder error",
+			body:            "not json",
+			decoder:         func(int, []byte) ([]Candlestick, error) { return nil, errors.New("bad candlestick") },
+			rawBodyMaxBytes: 2048,
+			expectedRawBody: []byte("not json"),
+		},
+		{
+			name: "bad data CandleReqError",
+			body: "not json",
+			decoder: func(int, []byte) ([]Candlestick, error) {
+				return nil, CandleReqError{Kind: KindBadData, Err: ErrInvalidJSONResponse}
+			},
+			rawBodyMaxBytes: 2048,
+			expectedRawBody: []byte("not json"),
+		},
+		{
+			name:            "truncated",
+			body:            "not json",
+			decoder:         func(int, []byte) ([]Candlestick, error) { return nil, errors.New("bad candlestick") },
+			rawBodyMaxBytes: 3,
+			expectedRawBody: []byte("not"),
+		},
+		{
+			name:            "disabled",
+			body:            "not json",
+			decoder:         func(int, []byte) ([]Candlestick, error) { return nil, errors.New("bad candlestick") },
+			rawBodyMaxBytes: 0,
+			expectedRawBody: nil,
+		},
+		{
+			name: "not bad data",
+			body: "not found",
+			decoder: func(int, []byte) ([]Candlestick, error) {
+				return nil, CandleReqError{Kind: KindInvalidPair, Err: ErrInvalidMarketPair}
+			},
+			rawBodyMaxBytes: 2048,
+			expectedRawBody: nil,
+		},
+	}
+	for _, ts := range tss {
+		t.Run(ts.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(ts.body)) }))
+			defer server.Close()
+
+			requester := NewRequester("TEST", pBool(false))
+			requester.RawBodyMaxBytes = ts.rawBodyMaxBytes
+			req, _ := http.NewRequest("GET", server.URL, nil)
+
+			_, err := requester.Do(req, ts.decoder)
+			require.Equal(t, ts.expectedRawBody, err.(CandleReqError).RawBody)
+		})
+	}
+}
+
+func TestRequesterDoWithInterval(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) }))
+	defer server.Close()
+	hourly := []Candlestick{
+		{Timestamp: 3600, OpenPrice: 1, ClosePrice: 1, LowestPrice: 1, HighestPrice: 1},
+		{Timestamp: 7200, OpenPrice: 1, ClosePrice: 1, LowestPrice: 1, HighestPrice: 1},
+	}
+	decoder := func(int, []byte) ([]Candlestick, error) { return hourly, nil }
+	req, _ := http.NewRequest("GET", server.URL, nil)
+
+	candlesticks, err := NewRequester("TEST", pBool(false)).DoWithInterval(req, time.Hour, decoder)
+	require.Nil(t, err)
+	require.Equal(t, hourly, candlesticks)
+
+	_, err = NewRequester("TEST", pBool(false)).DoWithInterval(req, 24*time.Hour, decoder)
+	require.ErrorIs(t, err, ErrExchangeReturnedWrongInterval)
+	require.Equal(t, KindBadData, err.(CandleReqError).Kind)
+	require.True(t, err.(CandleReqError).IsNotRetryable)
+	require.Equal(t, []byte("ok"), err.(CandleReqError).RawBody)
+}
+
+func TestNewRequesterDefaultRawBodyMaxBytes(t *testing.T) {
+	require.Equal(t, 2048, DefaultRawBodyMaxBytes)
+	require.Equal(t, DefaultRawBodyMaxBytes, NewRequester("TEST", pBool(false)).RawBodyMaxBytes)
+}
+
+func TestRequesterRetriesClosedConnection(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	requester := NewRequester("TEST", pBool(false))
+	fn := func(baseAsset string, quoteAsset string, startTime time.Time, candlestickInterval time.Duration) ([]Candlestick, error) {
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		return requester.Do(req, func(int, []byte) ([]Candlestick, error) {
+			return []Candlestick{{Timestamp: 1, OpenPrice: 1, ClosePrice: 1, LowestPrice: 1, HighestPrice: 1}}, nil
+		})
+	}
+	retrier := NewRequesterWithRetry(fn, RetryStrategy{Attempts: 2, FirstSleepTime: time.Millisecond}, pBool(false))
+
+	candlesticks, err := retrier.Request("BTC", "USDT", time.Unix(0, 0), time.Minute)
+	require.Nil(t, err)
+	require.Len(t, candlesticks, 1)
+	require.Equal(t, 2, attempts)
+}
+
+func TestRequesterStats(t *testing.T) {
+	rateLimited := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rateLimited {
+			w.WriteHeader(429)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+	decode := func(statusCode int, body []byte) ([]Candlestick, error) {
+		return []Candlestick{{Timestamp: 1, OpenPrice: 3, ClosePrice: 4, LowestPrice: 2, HighestPrice: 5}}, nil
+	}
+
+	requester := NewRequester("test", nil)
+	require.Equal(t, Stats{}, requester.Stats())
+
+	// Copies of a Requester share their Stats.
+	requesterCopy := requester
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+		_, err := requesterCopy.Do(req, decode)
+		require.Nil(t, err)
+	}
+	rateLimited = true
+	req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+	_, err := requester.Do(req, decode)
+	require.ErrorIs(t, err, ErrRateLimit)
+
+	stats := requester.Stats()
+	require.Equal(t, 3, stats.RequestsMade)
+	require.Equal(t, int64(4), stats.BytesReceived)
+	require.Equal(t, 2, stats.CandlesticksReceived)
+	require.True(t, stats.TotalLatency > 0)
+}
+
+func TestRequesterMaxInFlight(t *testing.T) {
+	var (
+		lock        sync.Mutex
+		concurrent  int
+		maxObserved int
+		arrived     = make(chan struct{}, 10)
+		unblock     = make(chan struct{})
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		concurrent++
+		if concurrent > maxObserved {
+			maxObserved = concurrent
+		}
+		lock.Unlock()
+		arrived <- struct{}{}
+		<-unblock
+		lock.Lock()
+		concurrent--
+		lock.Unlock()
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	debug := false
+	r := NewRequester("test", &debug)
+	r.SetMaxInFlight(2)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		// Copies share the limit.
+		go func(r Requester) {
+			defer wg.Done()
+			req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+			_, _, err := r.DoRaw(req)
+			require.Nil(t, err)
+		}(r)
+	}
+	<-arrived
+	<-arrived
+	require.Equal(t, 2, r.InFlight())
+	select {
+	case <-arrived:
+		t.Fatal("more requests in flight than the limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(unblock)
+	wg.Wait()
+	require.Equal(t, 2, maxObserved)
+	require.Equal(t, 0, r.InFlight())
+}
+
+func TestNewRequesterDefaultMaxInFlight(t *testing.T) {
+	debug := false
+	require.Equal(t, 5, DefaultMaxInFlightRequests)
+	require.Equal(t, 5, NewRequester("test", &debug).limiter.max)
+}
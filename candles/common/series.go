@@ -0,0 +1,164 @@
+package common
+
+import (
+	"fmt"
+	"time"
+)
+
+// Gap is a run of candlesticks missing from a series (see CheckSeries): those starting at From, From + the
+// candlestick interval, and so on, up to (but excluding) To.
+type Gap struct {
+	From int
+	To   int
+}
+
+// CheckSeries is a read-only diagnostic of a series of candlesticks (e.g. returned by RequestRange), which must be in
+// ascending order, against the candlestick interval it's supposed to have, between the from (inclusive) and to
+// (exclusive) UNIX timestamps.
+//
+// It returns the gaps, i.e. the runs of timestamps that are multiples of the candlestick interval within the range but
+// have no candlestick, and the timestamps of the candlesticks within the range that aren't multiples of it. Synthetic
+// candlesticks (see PatchCandlestickHoles) are not gaps. Candlesticks outside of the range are ignored.
+//
+// Multiples of the candlestick interval are counted since the UNIX epoch (as time.Truncate does), so intervals whose
+// candlesticks start elsewhere (e.g. calendar months, or providers with a UTC offset) are reported as misaligned.
+//
+// * Fails with ErrUnsupportedCandlestickInterval if the interval is not a positive whole number of seconds.
+// * Fails with ErrUnsortedCandlesticks if the candlesticks are not in strictly ascending order.
+func CheckSeries(cs []Candlestick, interval time.Duration, from, to int) (gaps []Gap, misaligned []int, err error) {
+	intervalSecs := IntervalToSeconds(interval)
+	if intervalSecs == 0 {
+		return nil, nil, fmt.Errorf("%w: %v is not a positive whole number of seconds", ErrUnsupportedCandlestickInterval, interval)
+	}
+	for i := 1; i < len(cs); i++ {
+		if cs[i].Timestamp <= cs[i-1].Timestamp {
+			return nil, nil, fmt.Errorf("%w: %v is not after %v", ErrUnsortedCandlesticks, cs[i].Timestamp, cs[i-1].Timestamp)
+		}
+	}
+
+	gaps, misaligned = []Gap{}, []int{}
+	// expected is the next timestamp within the range that is a multiple of the interval and hasn't been seen yet.
+	expected := ceilToMultiple(from, intervalSecs)
+	for _, candlestick := range cs {
+		if candlestick.Timestamp < from || candlestick.Timestamp >= to {
+			continue
+		}
+		if candlestick.Timestamp%intervalSecs != 0 {
+			misaligned = append(misaligned, candlestick.Timestamp)
+			continue
+		}
+		if candlestick.Timestamp > expected {
+			gaps = append(gaps, Gap{From: expected, To: candlestick.Timestamp})
+		}
+		expected = candlestick.Timestamp + intervalSecs
+	}
+	if expected < to {
+		gaps = append(gaps, Gap{From: expected, To: ceilToMultiple(to, intervalSecs)})
+	}
+	return gaps, misaligned, nil
+}
+
+// minSpacingsToDetectCoarserInterval is how many consecutive spacings CheckInterval needs to see, none of them of a
+// single candlestick interval, to consider the candlesticks of a coarser interval rather than just sparse.
+const minSpacingsToDetectCoarserInterval = 10
+
+// CheckInterval is a sanity check of candlesticks returned by an exchange, which must be in ascending order, against
+// the candlestick interval that was requested. Spacings between consecutive candlesticks are compared to the interval
+// within a tolerance of a tenth of it, so that calendar months pass as 30 days.
+//
+// Spacings may be larger than the interval, as exchanges skip candlesticks without trades, but never smaller. If there
+// are enough of them (see minSpacingsToDetectCoarserInterval), at least one must be of a single interval.
+//
+// * Fails with ErrExchangeReturnedWrongInterval if the spacings don't match the interval.
+func CheckInterval(cs []Candlestick, candlestickInterval time.Duration) error {
+	intervalSecs := IntervalToSeconds(candlestickInterval)
+	if intervalSecs == 0 || len(cs) < 2 {
+		return nil
+	}
+	toleranceSecs := intervalSecs / 10
+	minSpacing := 0
+	for i := 1; i < len(cs); i++ {
+		spacing := cs[i].Timestamp - cs[i-1].Timestamp
+		if spacing < intervalSecs-toleranceSecs {
+			return fmt.Errorf("%w: expected %v but candlesticks at %v and %v are %v apart", ErrExchangeReturnedWrongInterval, candlestickInterval,
+				cs[i-1].Timestamp, cs[i].Timestamp, time.Duration(spacing)*time.Second)
+		}
+		if minSpacing == 0 || spacing < minSpacing {
+			minSpacing = spacing
+		}
+	}
+	if len(cs)-1 >= minSpacingsToDetectCoarserInterval && minSpacing > intervalSecs+toleranceSecs {
+		return fmt.Errorf("%w: expected %v but candlesticks are at least %v apart", ErrExchangeReturnedWrongInterval, candlestickInterval,
+			time.Duration(minSpacing)*time.Second)
+	}
+	return nil
+}
+
+// ceilToMultiple returns the smallest multiple of secs that is not smaller than ts.
+func ceilToMultiple(ts, secs int) int {
+	if remainder := ts % secs; remainder != 0 {
+		return ts + secs - remainder
+	}
+	return ts
+}
+
+// DiffKind is the kind of discrepancy between two series of candlesticks (see DiffSeries).
+type DiffKind int
+
+const (
+	// DiffMissingInA means that only the second series has a candlestick at the timestamp.
+	DiffMissingInA DiffKind = iota
+	// DiffMissingInB means that only the first series has a candlestick at the timestamp.
+	DiffMissingInB
+	// DiffMismatch means that both series have a candlestick at the timestamp, but their prices differ by more than
+	// epsilon (see Candlestick.EqualWithin).
+	DiffMismatch
+)
+
+func (k DiffKind) String() string {
+	switch k {
+	case DiffMissingInA:
+		return "MissingInA"
+	case DiffMissingInB:
+		return "MissingInB"
+	case DiffMismatch:
+		return "Mismatch"
+	default:
+		return "Unknown"
+	}
+}
+
+// SeriesDiff is a discrepancy between two series of candlesticks at a timestamp (see DiffSeries). A and B are the
+// candlesticks of each series at the timestamp, or the zero Candlestick if the series has none.
+type SeriesDiff struct {
+	Timestamp int
+	Kind      DiffKind
+	A         Candlestick
+	B         Candlestick
+}
+
+// DiffSeries compares two series of candlesticks sorted in ascending order by timestamp (e.g. the same market pair
+// and candlestick interval from two providers), and returns their discrepancies in ascending order by timestamp:
+// candlesticks missing from either series, and candlesticks whose prices differ by more than epsilon. The Synthetic
+// flag is not compared. Returns an empty slice if the series match.
+func DiffSeries(a, b []Candlestick, epsilon float64) []SeriesDiff {
+	diffs := []SeriesDiff{}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case j == len(b) || (i < len(a) && a[i].Timestamp < b[j].Timestamp):
+			diffs = append(diffs, SeriesDiff{Timestamp: a[i].Timestamp, Kind: DiffMissingInB, A: a[i]})
+			i++
+		case i == len(a) || a[i].Timestamp > b[j].Timestamp:
+			diffs = append(diffs, SeriesDiff{Timestamp: b[j].Timestamp, Kind: DiffMissingInA, B: b[j]})
+			j++
+		default:
+			if !a[i].EqualWithin(b[j], epsilon) {
+				diffs = append(diffs, SeriesDiff{Timestamp: a[i].Timestamp, Kind: DiffMismatch, A: a[i], B: b[j]})
+			}
+			i++
+			j++
+		}
+	}
+	return diffs
+}
@@ -0,0 +1,176 @@
+package common
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckSeries(t *testing.T) {
+	candlestick := func(ts int) Candlestick {
+		return Candlestick{Timestamp: ts, OpenPrice: 1, ClosePrice: 1, LowestPrice: 1, HighestPrice: 1}
+	}
+	synthetic := candlestick(120)
+	synthetic.Synthetic = true
+
+	tss := []struct {
+		name               string
+		cs                 []Candlestick
+		interval           time.Duration
+		from               int
+		to                 int
+		expectedGaps       []Gap
+		expectedMisaligned []int
+		expectedErr        error
+	}{
+		{
+			name:               "complete series",
+			cs:                 []Candlestick{candlestick(60), candlestick(120), candlestick(180)},
+			interval:           time.Minute,
+			from:               60,
+			to:                 240,
+			expectedGaps:       []Gap{},
+			expectedMisaligned: []int{},
+		},
+		{
+			name:               "synthetic candlesticks are not gaps",
+			cs:                 []Candlestick{candlestick(60), synthetic, candlestick(180)},
+			interval:           time.Minute,
+			from:               60,
+			to:                 240,
+			expectedGaps:       []Gap{},
+			expectedMisaligned: []int{},
+		},
+		{
+			name:               "gaps at the start, middle and end",
+			cs:                 []Candlestick{candlestick(120), candlestick(300), candlestick(360)},
+			interval:           time.Minute,
+			from:               30,
+			to:                 530,
+			expectedGaps:       []Gap{{From: 60, To: 120}, {From: 180, To: 300}, {From: 420, To: 540}},
+			expectedMisaligned: []int{},
+		},
+		{
+			name:               "empty series is a single gap",
+			cs:                 []Candlestick{},
+			interval:           time.Minute,
+			from:               60,
+			to:                 180,
+			expectedGaps:       []Gap{{From: 60, To: 180}},
+			expectedMisaligned: []int{},
+		},
+		{
+			name:               "misaligned candlesticks are reported and don't fill gaps",
+			cs:                 []Candlestick{candlestick(60), candlestick(150), candlestick(180)},
+			interval:           time.Minute,
+			from:               60,
+			to:                 240,
+			expectedGaps:       []Gap{{From: 120, To: 180}},
+			expectedMisaligned: []int{150},
+		},
+		{
+			name:               "candlesticks outside of the range are ignored",
+			cs:                 []Candlestick{candlestick(0), candlestick(61), candlestick(120), candlestick(180)},
+			interval:           time.Minute,
+			from:               120,
+			to:                 180,
+			expectedGaps:       []Gap{},
+			expectedMisaligned: []int{},
+		},
+		{
+			name:        "unsorted candlesticks",
+			cs:          []Candlestick{candlestick(120), candlestick(60)},
+			interval:    time.Minute,
+			from:        60,
+			to:          180,
+			expectedErr: ErrUnsortedCandlesticks,
+		},
+		{
+			name:        "duplicate timestamps",
+			cs:          []Candlestick{candlestick(60), candlestick(60)},
+			interval:    time.Minute,
+			from:        60,
+			to:          180,
+			expectedErr: ErrUnsortedCandlesticks,
+		},
+		{
+			name:        "invalid interval",
+			cs:          []Candlestick{candlestick(60)},
+			interval:    1500 * time.Millisecond,
+			from:        60,
+			to:          180,
+			expectedErr: ErrUnsupportedCandlestickInterval,
+		},
+	}
+	for _, ts := range tss {
+		t.Run(ts.name, func(t *testing.T) {
+			gaps, misaligned, err := CheckSeries(ts.cs, ts.interval, ts.from, ts.to)
+			require.ErrorIs(t, err, ts.expectedErr)
+			require.Equal(t, ts.expectedGaps, gaps)
+			require.Equal(t, ts.expectedMisaligned, misaligned)
+		})
+	}
+}
+
+func TestCheckInterval(t *testing.T) {
+	hourly := func(tss ...int) []Candlestick {
+		cs := []Candlestick{}
+		for _, ts := range tss {
+			cs = append(cs, Candlestick{Timestamp: ts * 3600})
+		}
+		return cs
+	}
+	daily := []Candlestick{}
+	for i := 0; i < 11; i++ {
+		daily = append(daily, Candlestick{Timestamp: i * 86400})
+	}
+	months := []Candlestick{}
+	for month := time.January; month <= time.December; month++ {
+		months = append(months, Candlestick{Timestamp: int(time.Date(2022, month, 1, 0, 0, 0, 0, time.UTC).Unix())})
+	}
+
+	tss := []struct {
+		name        string
+		cs          []Candlestick
+		interval    time.Duration
+		expectedErr error
+	}{
+		{name: "empty", cs: nil, interval: time.Hour},
+		{name: "single candlestick", cs: hourly(1), interval: time.Minute},
+		{name: "consecutive", cs: hourly(1, 2, 3), interval: time.Hour},
+		{name: "with holes", cs: hourly(1, 2, 5, 9), interval: time.Hour},
+		{name: "few and sparse", cs: hourly(1, 3, 5), interval: time.Hour},
+		{name: "calendar months as 30 days", cs: months, interval: 30 * 24 * time.Hour},
+		{name: "finer than requested", cs: hourly(1, 2, 3), interval: 24 * time.Hour, expectedErr: ErrExchangeReturnedWrongInterval},
+		{name: "coarser than requested", cs: daily, interval: time.Hour, expectedErr: ErrExchangeReturnedWrongInterval},
+		{name: "daily as requested", cs: daily, interval: 24 * time.Hour},
+	}
+	for _, ts := range tss {
+		t.Run(ts.name, func(t *testing.T) {
+			require.ErrorIs(t, CheckInterval(ts.cs, ts.interval), ts.expectedErr)
+		})
+	}
+}
+
+func TestDiffSeries(t *testing.T) {
+	candlestick := func(ts int, price JSONFloat64) Candlestick {
+		return Candlestick{Timestamp: ts, OpenPrice: price, ClosePrice: price, LowestPrice: price, HighestPrice: price}
+	}
+	synthetic := candlestick(180, 1)
+	synthetic.Synthetic = true
+
+	a := []Candlestick{candlestick(60, 1), candlestick(120, 1), candlestick(180, 1), candlestick(240, 1), candlestick(360, 1)}
+	b := []Candlestick{candlestick(0, 1), candlestick(60, 1.005), candlestick(120, 1.5), synthetic, candlestick(300, 1)}
+	expected := []SeriesDiff{
+		{Timestamp: 0, Kind: DiffMissingInA, B: b[0]},
+		{Timestamp: 120, Kind: DiffMismatch, A: a[1], B: b[2]},
+		{Timestamp: 240, Kind: DiffMissingInB, A: a[3]},
+		{Timestamp: 300, Kind: DiffMissingInA, B: b[4]},
+		{Timestamp: 360, Kind: DiffMissingInB, A: a[4]},
+	}
+	require.Equal(t, expected, DiffSeries(a, b, 0.01))
+	require.Equal(t, []SeriesDiff{}, DiffSeries(a, a, 0))
+	require.Equal(t, []SeriesDiff{}, DiffSeries(nil, nil, 0))
+	require.Equal(t, "Mismatch", DiffMismatch.String())
+}
@@ -0,0 +1,64 @@
+package common
+
+import (
+	"sync"
+	"time"
+)
+
+// Stats are cumulative counters of requests to exchanges, e.g. to assert that N candlesticks were fetched in M
+// requests, or to check a cache's effectiveness and a request budget after the fact.
+type Stats struct {
+	// RequestsMade is the number of requests made, including failed ones.
+	RequestsMade int
+
+	// BytesReceived is the total size of the response bodies.
+	BytesReceived int64
+
+	// TotalLatency is the total time spent on requests.
+	TotalLatency time.Duration
+
+	// CandlesticksReceived is the number of candlesticks that successful requests returned.
+	CandlesticksReceived int
+}
+
+// Add returns the sum of both Stats.
+func (s Stats) Add(other Stats) Stats {
+	return Stats{
+		RequestsMade:         s.RequestsMade + other.RequestsMade,
+		BytesReceived:        s.BytesReceived + other.BytesReceived,
+		TotalLatency:         s.TotalLatency + other.TotalLatency,
+		CandlesticksReceived: s.CandlesticksReceived + other.CandlesticksReceived,
+	}
+}
+
+// StatsProvider is optionally implemented by CandlestickProviders that keep Stats of their HTTP requests.
+type StatsProvider interface {
+	// Stats returns the Stats of every HTTP request made so far, including retries and requests to endpoints other
+	// than the candlesticks one (e.g. to list markets).
+	Stats() Stats
+}
+
+// statsCounter accumulates Stats, safely for concurrent use. It's a pointer within Requester, so that copies of a
+// Requester share it.
+type statsCounter struct {
+	lock  sync.Mutex
+	stats Stats
+}
+
+func (c *statsCounter) add(stats Stats) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.stats = c.stats.Add(stats)
+}
+
+func (c *statsCounter) get() Stats {
+	if c == nil {
+		return Stats{}
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.stats
+}
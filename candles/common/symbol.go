@@ -0,0 +1,87 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+)
+
+// knownQuoteAssets are the quote assets that ParseProviderSymbol recognizes at the end of symbols without a separator
+// (e.g. BTCUSDT). Longer assets must come first, so that e.g. BTCUSDT is not parsed as BTCU/SDT or BTCUSD/T.
+var knownQuoteAssets = []string{
+	"FDUSD", "USDT", "USDC", "BUSD", "TUSD", "USDP", "DAI", "USD", "EUR", "GBP", "TRY", "BRL", "AUD", "JPY", "BTC",
+	"ETH", "BNB", "XRP", "TRX",
+}
+
+// SymbolForProvider returns the exact symbol that the given provider uses for the market source's pair, e.g. BTCUSDT
+// for BINANCE, BTC-USDT for KUCOIN, btcusd for BITSTAMP, tBTCUSD for BITFINEX, or BTC_USDT for CRYPTOCOM. The market
+// source's own provider and type are ignored.
+//
+// * Fails with ErrEmptyBaseAsset or ErrEmptyQuoteAsset (both of which are also ErrEmptyAsset) if an asset is empty.
+// * Fails with ErrUnsuportedCandlestickProvider if the provider is not supported.
+func SymbolForProvider(source MarketSource, provider string) (string, error) {
+	base, quote := strings.ToUpper(strings.TrimSpace(source.BaseAsset)), strings.ToUpper(strings.TrimSpace(source.QuoteAsset))
+	if base == "" {
+		return "", ErrEmptyBaseAsset
+	}
+	if quote == "" {
+		return "", ErrEmptyQuoteAsset
+	}
+	switch strings.ToUpper(provider) {
+	case BINANCE, BINANCEUSDMFUTURES:
+		return base + quote, nil
+	case COINBASE, KUCOIN:
+		return base + "-" + quote, nil
+	case BITSTAMP:
+		return strings.ToLower(base + quote), nil
+	case BITFINEX:
+		return "t" + base + quote, nil
+	case CRYPTOCOM:
+		return base + "_" + quote, nil
+	default:
+		return "", fmt.Errorf("%w: %v", ErrUnsuportedCandlestickProvider, provider)
+	}
+}
+
+// ParseProviderSymbol is the inverse of SymbolForProvider: it returns the COIN market source of the given provider
+// for a symbol in that provider's format, e.g. BTC-USDT for KUCOIN. Since some providers don't separate the assets
+// (e.g. BTCUSDT), their symbols are split by the longest known quote asset they end with (e.g. USDT, USD, BTC).
+//
+// * Fails with ErrUnsuportedCandlestickProvider if the provider is not supported.
+// * Fails with ErrInvalidMarketPair if the symbol can't be parsed.
+func ParseProviderSymbol(symbol string, provider string) (MarketSource, error) {
+	var (
+		base, quote string
+		ok          bool
+	)
+	switch provider = strings.ToUpper(provider); provider {
+	case BINANCE, BINANCEUSDMFUTURES, BITSTAMP:
+		base, quote, ok = splitByKnownQuoteAsset(symbol)
+	case COINBASE, KUCOIN:
+		base, quote, ok = strings.Cut(symbol, "-")
+	case BITFINEX:
+		// Bitfinex separates assets with a colon when either one is longer than three characters, e.g. tTESTBTC:TESTUSD.
+		if trimmed := strings.TrimPrefix(symbol, "t"); trimmed != symbol {
+			if base, quote, ok = strings.Cut(trimmed, ":"); !ok {
+				base, quote, ok = splitByKnownQuoteAsset(trimmed)
+			}
+		}
+	case CRYPTOCOM:
+		base, quote, ok = strings.Cut(symbol, "_")
+	default:
+		return MarketSource{}, fmt.Errorf("%w: %v", ErrUnsuportedCandlestickProvider, provider)
+	}
+	if !ok || base == "" || quote == "" {
+		return MarketSource{}, fmt.Errorf("%w: cannot parse symbol %v for %v", ErrInvalidMarketPair, symbol, provider)
+	}
+	return MarketSource{Type: COIN, Provider: provider, BaseAsset: strings.ToUpper(base), QuoteAsset: strings.ToUpper(quote)}, nil
+}
+
+func splitByKnownQuoteAsset(symbol string) (string, string, bool) {
+	upper := strings.ToUpper(symbol)
+	for _, quote := range knownQuoteAssets {
+		if len(upper) > len(quote) && strings.HasSuffix(upper, quote) {
+			return upper[:len(upper)-len(quote)], quote, true
+		}
+	}
+	return "", "", false
+}
@@ -0,0 +1,78 @@
+package common
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSymbolForProvider(t *testing.T) {
+	tss := []struct {
+		provider string
+		expected string
+	}{
+		{provider: BINANCE, expected: "BTCUSDT"},
+		{provider: BINANCEUSDMFUTURES, expected: "BTCUSDT"},
+		{provider: COINBASE, expected: "BTC-USDT"},
+		{provider: KUCOIN, expected: "BTC-USDT"},
+		{provider: BITSTAMP, expected: "btcusdt"},
+		{provider: BITFINEX, expected: "tBTCUSDT"},
+		{provider: CRYPTOCOM, expected: "BTC_USDT"},
+		{provider: "kucoin", expected: "BTC-USDT"},
+	}
+	for _, ts := range tss {
+		t.Run(ts.provider, func(t *testing.T) {
+			actual, err := SymbolForProvider(MarketSource{BaseAsset: "btc", QuoteAsset: "USDT"}, ts.provider)
+			require.Nil(t, err)
+			require.Equal(t, ts.expected, actual)
+
+			marketSource, err := ParseProviderSymbol(actual, ts.provider)
+			require.Nil(t, err)
+			require.Equal(t, MarketSource{Type: COIN, Provider: strings.ToUpper(ts.provider), BaseAsset: "BTC", QuoteAsset: "USDT"}, marketSource)
+		})
+	}
+}
+
+func TestSymbolForProviderErrors(t *testing.T) {
+	_, err := SymbolForProvider(MarketSource{BaseAsset: "BTC", QuoteAsset: "USDT"}, "NOT_AN_EXCHANGE")
+	require.ErrorIs(t, err, ErrUnsuportedCandlestickProvider)
+
+	_, err = SymbolForProvider(MarketSource{BaseAsset: " ", QuoteAsset: "USDT"}, BINANCE)
+	require.ErrorIs(t, err, ErrEmptyAsset)
+
+	_, err = SymbolForProvider(MarketSource{BaseAsset: "BTC"}, BINANCE)
+	require.ErrorIs(t, err, ErrEmptyAsset)
+}
+
+func TestParseProviderSymbol(t *testing.T) {
+	tss := []struct {
+		symbol   string
+		provider string
+		expected MarketSource
+		err      error
+	}{
+		{symbol: "ETHBTC", provider: BINANCE, expected: MarketSource{Type: COIN, Provider: BINANCE, BaseAsset: "ETH", QuoteAsset: "BTC"}},
+		{symbol: "BTCBUSD", provider: BINANCE, expected: MarketSource{Type: COIN, Provider: BINANCE, BaseAsset: "BTC", QuoteAsset: "BUSD"}},
+		{symbol: "btcusd", provider: BITSTAMP, expected: MarketSource{Type: COIN, Provider: BITSTAMP, BaseAsset: "BTC", QuoteAsset: "USD"}},
+		{symbol: "tBTCUSD", provider: BITFINEX, expected: MarketSource{Type: COIN, Provider: BITFINEX, BaseAsset: "BTC", QuoteAsset: "USD"}},
+		{symbol: "tTESTBTC:TESTUSD", provider: BITFINEX, expected: MarketSource{Type: COIN, Provider: BITFINEX, BaseAsset: "TESTBTC", QuoteAsset: "TESTUSD"}},
+		{symbol: "BTCXYZ", provider: BINANCE, err: ErrInvalidMarketPair},
+		{symbol: "USDT", provider: BINANCE, err: ErrInvalidMarketPair},
+		{symbol: "BTCUSD", provider: BITFINEX, err: ErrInvalidMarketPair},
+		{symbol: "BTC-", provider: KUCOIN, err: ErrInvalidMarketPair},
+		{symbol: "BTCUSDT", provider: CRYPTOCOM, err: ErrInvalidMarketPair},
+		{symbol: "BTCUSDT", provider: "NOT_AN_EXCHANGE", err: ErrUnsuportedCandlestickProvider},
+	}
+	for _, ts := range tss {
+		t.Run(ts.symbol, func(t *testing.T) {
+			actual, err := ParseProviderSymbol(ts.symbol, ts.provider)
+			if ts.err != nil {
+				require.ErrorIs(t, err, ts.err)
+				return
+			}
+			require.Nil(t, err)
+			require.Equal(t, ts.expected, actual)
+		})
+	}
+}
@@ -2,9 +2,13 @@
 package common
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math"
+	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -21,6 +25,8 @@ const (
 	BITSTAMP = "BITSTAMP"
 	// BITFINEX is an enumesque string value representing the BITFINEX exchange
 	BITFINEX = "BITFINEX"
+	// CRYPTOCOM is an enumesque string value representing the CRYPTOCOM exchange
+	CRYPTOCOM = "CRYPTOCOM"
 )
 
 var (
@@ -30,6 +36,9 @@ var (
 	// ErrExecutingRequest means: error executing client.Do() http request method
 	ErrExecutingRequest = errors.New("error executing client.Do() http request method")
 
+	// ErrTimeout means: timed out executing client.Do() http request method
+	ErrTimeout = errors.New("timed out executing client.Do() http request method")
+
 	// ErrBrokenBodyResponse means: exchange returned broken body response
 	ErrBrokenBodyResponse = errors.New("exchange returned broken body response")
 
@@ -43,6 +52,36 @@ type Exchange interface {
 	SetDebug(debug bool)
 }
 
+// PatienceConfigurable is optionally implemented by Exchanges whose patience can be overridden, e.g. by the Market's
+// patience options. All the Exchanges shipped with the library implement it.
+type PatienceConfigurable interface {
+	// SetPatience overrides the exchange's patience, for candlestick intervals without a specific patience.
+	SetPatience(patience time.Duration)
+
+	// SetIntervalPatience overrides the exchange's patience for the given candlestick interval.
+	SetIntervalPatience(candlestickInterval time.Duration, patience time.Duration)
+}
+
+// ConfigurableExchange is implemented by the Exchanges shipped with the library, whose requests can be configured
+// beyond debug logging and patience, e.g. to point them to a proxy or a test server.
+type ConfigurableExchange interface {
+	Exchange
+	PatienceConfigurable
+
+	// SetRetryStrategy overrides the exchange's retry strategy for failed requests.
+	SetRetryStrategy(strategy RetryStrategy)
+
+	// SetAPIURL overrides the exchange's API base URL, which must end with a slash.
+	SetAPIURL(apiURL string)
+
+	// SetHTTPClient overrides the HTTP client used to request the exchange.
+	SetHTTPClient(client *http.Client)
+
+	// SetMaxRateLimitWait makes rate limited requests block for the RetryAfter the exchange asked for, up to maxWait.
+	// Zero disables it. See RequesterWithRetry.SetMaxRateLimitWait.
+	SetMaxRateLimitWait(maxWait time.Duration)
+}
+
 // CandlestickProvider wraps a crypto exchanges' API method to retrieve historical candlesticks behind a common
 // interface.
 type CandlestickProvider interface {
@@ -54,7 +93,7 @@ type CandlestickProvider interface {
 	// errors.
 	//
 	// Resulting candlesticks will start from the given startTimeTs rounded to the next minute or day (respectively for
-	// marketPair/asset).
+	// marketPair/asset). Candlesticks older than that are never returned, even if the exchange returns them.
 	//
 	// Some exchanges return results with gaps. In this case, implementations will fill gaps with the next known value.
 	//
@@ -71,16 +110,173 @@ type CandlestickProvider interface {
 	Name() string
 }
 
+// LatestCandlestickProvider is optionally implemented by CandlestickProviders whose exchanges return their most recent
+// candlesticks when no start time is supplied. It's preferred when asking for the latest candlesticks, because asking
+// for a start time close to now may return empty results on some exchanges.
+type LatestCandlestickProvider interface {
+	// RequestLatestCandlesticks requests the most recent candlesticks for a given marketPair/asset, in ascending
+	// order. The last candlestick may not have finished yet.
+	RequestLatestCandlesticks(marketSource MarketSource, candlestickInterval time.Duration) ([]Candlestick, error)
+}
+
+// LimitedLatestCandlestickProvider is optionally implemented by LatestCandlestickProviders whose exchanges accept a
+// limit on the number of candlesticks, so that asking for the latest few doesn't transfer a whole page.
+type LimitedLatestCandlestickProvider interface {
+	// RequestLatestCandlesticksLimit is like RequestLatestCandlesticks, but requests at most "limit" candlesticks.
+	RequestLatestCandlesticksLimit(marketSource MarketSource, candlestickInterval time.Duration, limit int) ([]Candlestick, error)
+}
+
+// EndTimeCandlestickProvider is optionally implemented by CandlestickProviders whose exchanges accept an end time, so
+// that bounded ranges can be requested exactly, rather than a full page starting at the start time.
+type EndTimeCandlestickProvider interface {
+	// RequestCandlesticksUntil is like RequestCandlesticks, but candlesticks starting at or after the end time are not
+	// requested (if the exchange supports it) nor returned. The zero end time means that there's no end time.
+	RequestCandlesticksUntil(marketSource MarketSource, startTime time.Time, endTime time.Time, candlestickInterval time.Duration) ([]Candlestick, error)
+}
+
+// IntervalPatienceProvider is optionally implemented by CandlestickProviders whose patience depends on the candlestick
+// interval. Use PatienceFor rather than calling Patience directly to take it into account.
+type IntervalPatienceProvider interface {
+	// PatienceFor is like Patience, but for the given candlestick interval.
+	PatienceFor(candlestickInterval time.Duration) time.Duration
+}
+
+// MaxCandlesPerRequestProvider is optionally implemented by CandlestickProviders whose exchanges cap the number of
+// candlesticks returned per request. Use MaxCandlesPerRequest rather than calling it directly.
+type MaxCandlesPerRequestProvider interface {
+	// MaxCandlesPerRequest returns the maximum number of candlesticks that the exchange returns per request.
+	MaxCandlesPerRequest() int
+}
+
+// IntervalsProvider is optionally implemented by CandlestickProviders that know upfront which candlestick intervals
+// their exchanges support. Use SupportedIntervalsOf rather than calling it directly.
+type IntervalsProvider interface {
+	// SupportedIntervals lists the candlestick intervals supported by the provider, in ascending order. Nil means that
+	// they are not known upfront. Requests for other intervals fail with ErrUnsupportedCandlestickInterval.
+	SupportedIntervals() []time.Duration
+}
+
+// HistoryDepthProvider is optionally implemented by CandlestickProviders whose exchanges only serve recent
+// candlesticks. Use MaxHistoryDepthOf rather than calling it directly.
+type HistoryDepthProvider interface {
+	// MaxHistoryDepth documents how far back in time (relative to now) the provider serves candlesticks. Zero means
+	// that there's no known limit. Requests older than this fail with ErrDataTooFarBack.
+	MaxHistoryDepth() time.Duration
+}
+
+// MarketLister is optionally implemented by CandlestickProviders whose exchanges have a public endpoint listing their
+// markets.
+type MarketLister interface {
+	// ListMarkets requests the market sources that are currently tradable at the exchange.
+	ListMarkets() ([]MarketSource, error)
+}
+
+// CursorCandlestickProvider is optionally implemented by CandlestickProviders whose exchanges paginate with an opaque
+// cursor (e.g. Kraken's "last") rather than with timestamps. Iterators prefer it over RequestCandlesticks.
+type CursorCandlestickProvider interface {
+	// RequestCandlesticksWithCursor is like RequestCandlesticks, but it also takes the cursor returned by the previous
+	// call, and returns the cursor to request the page that follows the returned candlesticks.
+	//
+	// The cursor is empty on the first call, and whenever the start time doesn't follow the previous page (e.g. after
+	// cache hits). In that case, implementations must paginate by the start time. An empty returned cursor means that
+	// the next page must also be requested by start time.
+	RequestCandlesticksWithCursor(marketSource MarketSource, startTime time.Time, candlestickInterval time.Duration, cursor string) ([]Candlestick, string, error)
+}
+
+// TimestampSemantics says which instant of a candlestick its Timestamp is.
+type TimestampSemantics int
+
+const (
+	// OpenStamped means that the Timestamp is when the candlestick opened. Candlesticks returned by the shipped
+	// providers are always open-stamped, as iterators and the cache expect. This is the default.
+	OpenStamped TimestampSemantics = iota
+	// CloseStamped means that the Timestamp is when the candlestick closed, i.e. when the next one opens.
+	CloseStamped
+)
+
+func (s TimestampSemantics) String() string {
+	switch s {
+	case CloseStamped:
+		return "CloseStamped"
+	default:
+		return "OpenStamped"
+	}
+}
+
+// TimestampSemanticsProvider is optionally implemented by CandlestickProviders whose candlesticks are not
+// open-stamped, e.g. registered providers (see Market.RegisterProvider) that return exchange data as is.
+type TimestampSemanticsProvider interface {
+	// TimestampSemantics says which instant of its candlesticks their Timestamp is.
+	TimestampSemantics() TimestampSemantics
+}
+
+// TimestampSemanticsOf returns the provider's TimestampSemantics, which is OpenStamped unless it implements
+// TimestampSemanticsProvider.
+func TimestampSemanticsOf(provider CandlestickProvider) TimestampSemantics {
+	if semanticsProvider, ok := provider.(TimestampSemanticsProvider); ok {
+		return semanticsProvider.TimestampSemantics()
+	}
+	return OpenStamped
+}
+
 // CandleReqError is an error arising from a call to requestCandlesticks
 type CandleReqError struct {
-	Code           int
+	// Code is the exchange-specific error code, if the exchange provided one. It's not comparable across exchanges.
+	Code int
+	// Kind is the exchange-agnostic category of the error. Prefer switching on it over comparing Err against sentinels.
+	Kind           ErrorKind
 	Err            error
 	IsNotRetryable bool
 	RetryAfter     time.Duration
+	// RawBody is the exchange's (truncated) response body, only present on KindBadData errors. Useful for debugging.
+	RawBody []byte
 }
 
 func (e CandleReqError) Error() string { return e.Err.Error() }
 
+// Unwrap returns the underlying error, so that errors.Is & errors.As work against the existing sentinel errors.
+func (e CandleReqError) Unwrap() error { return e.Err }
+
+// ErrorKind is a stable, exchange-agnostic category for a CandleReqError.
+type ErrorKind int
+
+const (
+	// KindUnknown means the error could not be categorized (e.g. an unexpected exchange error).
+	KindUnknown ErrorKind = iota
+	// KindRateLimited means the exchange asked us to slow down. See RetryAfter.
+	KindRateLimited
+	// KindInvalidPair means the market pair or asset does not exist on the exchange.
+	KindInvalidPair
+	// KindTransient means the request may succeed if retried later (e.g. timeouts, broken responses, 5xx).
+	KindTransient
+	// KindBadData means the exchange responded with data that couldn't be parsed or didn't make sense.
+	KindBadData
+	// KindTooFarBack means the requested time is older than the exchange's MaxHistoryDepth, or than the market pair's
+	// listing (see ErrBeforeListing).
+	KindTooFarBack
+	// KindNotSupported means the request is not supported by the exchange (e.g. an unsupported candlestick interval).
+	KindNotSupported
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case KindRateLimited:
+		return "RateLimited"
+	case KindInvalidPair:
+		return "InvalidPair"
+	case KindTransient:
+		return "Transient"
+	case KindBadData:
+		return "BadData"
+	case KindTooFarBack:
+		return "TooFarBack"
+	case KindNotSupported:
+		return "NotSupported"
+	default:
+		return "Unknown"
+	}
+}
+
 // Candlestick is the generic struct for candlestick data for all supported exchanges.
 type Candlestick struct {
 	// Timestamp is the UNIX timestamp (i.e. seconds since UTC Epoch) at which the candlestick started.
@@ -97,6 +293,210 @@ type Candlestick struct {
 
 	// HighestPrice is the highest price reached during the candlestick duration.
 	HighestPrice JSONFloat64 `json:"h"`
+
+	// Synthetic is true if the exchange didn't return this candlestick, and it was patched in to fill a hole.
+	Synthetic bool `json:"synthetic,omitempty"`
+
+	// CloseTimestamp is the UNIX timestamp at which the candlestick closed, i.e. at which the next one starts (see
+	// Anchor.CloseTimestamp). It's zero unless requested (see WithCloseTimestamps in the candles package), as it's
+	// implied by the interval for all but variable-length candlesticks (e.g. monthly ones).
+	CloseTimestamp int `json:"ct,omitempty"`
+}
+
+// IsValid returns an error wrapping ErrInvalidCandlestick that describes why the candlestick's prices are inconsistent,
+// i.e. if any of them is negative or not a finite number, if the lowest price is above the highest price, or if the
+// open or close prices aren't between them. Zero prices usually mean missing data rather than inconsistent data, so
+// they're left out of the ordering checks; the cache rejects them separately (see ZeroCheck).
+func (c Candlestick) IsValid() error {
+	prices := []struct {
+		name  string
+		price JSONFloat64
+	}{{"open", c.OpenPrice}, {"close", c.ClosePrice}, {"low", c.LowestPrice}, {"high", c.HighestPrice}}
+	for _, p := range prices {
+		if math.IsNaN(float64(p.price)) || math.IsInf(float64(p.price), 0) {
+			return fmt.Errorf("%w: %v price is %v", ErrInvalidCandlestick, p.name, float64(p.price))
+		}
+		if p.price < 0 {
+			return fmt.Errorf("%w: %v price %v is negative", ErrInvalidCandlestick, p.name, p.price)
+		}
+	}
+	if c.LowestPrice == 0 || c.HighestPrice == 0 {
+		return nil
+	}
+	if c.LowestPrice > c.HighestPrice {
+		return fmt.Errorf("%w: low %v is above high %v", ErrInvalidCandlestick, c.LowestPrice, c.HighestPrice)
+	}
+	for _, p := range prices[:2] {
+		if p.price != 0 && (p.price < c.LowestPrice || p.price > c.HighestPrice) {
+			return fmt.Errorf("%w: %v %v is not between low %v & high %v", ErrInvalidCandlestick, p.name, p.price, c.LowestPrice, c.HighestPrice)
+		}
+	}
+	return nil
+}
+
+// ToTicks converts a Candlestick into two Ticks with the same timestamp: the lowest price first, and the highest price
+// second.
+func (c Candlestick) ToTicks() []Tick {
+	return []Tick{
+		{Timestamp: c.Timestamp, Value: c.LowestPrice},
+		{Timestamp: c.Timestamp, Value: c.HighestPrice},
+	}
+}
+
+// TypicalPrice returns the typical price of the candlestick, i.e. (high + low + close) / 3.
+func (c Candlestick) TypicalPrice() JSONFloat64 {
+	return (c.HighestPrice + c.LowestPrice + c.ClosePrice) / 3
+}
+
+// Median returns the median price of the candlestick, i.e. (high + low) / 2.
+func (c Candlestick) Median() JSONFloat64 {
+	return (c.HighestPrice + c.LowestPrice) / 2
+}
+
+// EqualWithin returns true if both candlesticks have the same timestamp, and their open, close, lowest and highest
+// prices differ by at most epsilon. Useful to compare candlesticks from different exchanges, which may have float noise.
+func (c Candlestick) EqualWithin(other Candlestick, epsilon float64) bool {
+	return c.Timestamp == other.Timestamp &&
+		math.Abs(float64(c.OpenPrice-other.OpenPrice)) <= epsilon &&
+		math.Abs(float64(c.ClosePrice-other.ClosePrice)) <= epsilon &&
+		math.Abs(float64(c.LowestPrice-other.LowestPrice)) <= epsilon &&
+		math.Abs(float64(c.HighestPrice-other.HighestPrice)) <= epsilon
+}
+
+// RoundPrices returns the candlestick with its open, close, lowest and highest prices rounded to the supplied number of
+// decimals (see JSONFloat64.Round). Negative decimals leave them as they are.
+func (c Candlestick) RoundPrices(decimals int) Candlestick {
+	c.OpenPrice = c.OpenPrice.Round(decimals)
+	c.ClosePrice = c.ClosePrice.Round(decimals)
+	c.LowestPrice = c.LowestPrice.Round(decimals)
+	c.HighestPrice = c.HighestPrice.Round(decimals)
+	return c
+}
+
+// TimestampFormat controls how FormattedCandlestick serializes its timestamp to JSON.
+type TimestampFormat int
+
+const (
+	// TimestampSeconds serializes timestamps as UNIX seconds, e.g. 1657378800. It's the default.
+	TimestampSeconds TimestampFormat = iota
+	// TimestampMillis serializes timestamps as UNIX milliseconds, e.g. 1657378800000, as Javascript expects.
+	TimestampMillis
+	// TimestampRFC3339 serializes timestamps as RFC3339 UTC strings, e.g. "2022-07-09T15:00:00Z".
+	TimestampRFC3339
+)
+
+func (f TimestampFormat) String() string {
+	switch f {
+	case TimestampMillis:
+		return "millis"
+	case TimestampRFC3339:
+		return "rfc3339"
+	default:
+		return "seconds"
+	}
+}
+
+func (f TimestampFormat) format(timestamp int) interface{} {
+	switch f {
+	case TimestampMillis:
+		return int64(timestamp) * 1000
+	case TimestampRFC3339:
+		return time.Unix(int64(timestamp), 0).UTC().Format(time.RFC3339)
+	default:
+		return timestamp
+	}
+}
+
+// TimestampFormatFromString constructs a TimestampFormat from one of "seconds", "millis" or "rfc3339".
+func TimestampFormatFromString(s string) (TimestampFormat, error) {
+	switch s {
+	case "seconds":
+		return TimestampSeconds, nil
+	case "millis":
+		return TimestampMillis, nil
+	case "rfc3339":
+		return TimestampRFC3339, nil
+	default:
+		return TimestampSeconds, fmt.Errorf("invalid timestamp format '%v': must be one of seconds|millis|rfc3339", s)
+	}
+}
+
+// FieldNames controls the JSON field names that FormattedCandlestick serializes to.
+type FieldNames int
+
+const (
+	// FieldNamesShort serializes to a Candlestick's own field names, i.e. t, o, c, l & h. It's the default.
+	FieldNamesShort FieldNames = iota
+	// FieldNamesCharting serializes to the field names that charting libraries expect (e.g. TradingView's
+	// lightweight-charts), i.e. time, open, high, low & close.
+	FieldNamesCharting
+)
+
+func (n FieldNames) String() string {
+	switch n {
+	case FieldNamesCharting:
+		return "charting"
+	default:
+		return "short"
+	}
+}
+
+// FieldNamesFromString constructs a FieldNames from one of "short" or "charting".
+func FieldNamesFromString(s string) (FieldNames, error) {
+	switch s {
+	case "short":
+		return FieldNamesShort, nil
+	case "charting":
+		return FieldNamesCharting, nil
+	default:
+		return FieldNamesShort, fmt.Errorf("invalid field names '%v': must be one of short|charting", s)
+	}
+}
+
+// FormattedCandlestick wraps a Candlestick so that its JSON serialization uses the given TimestampFormat and
+// FieldNames. Prices are serialized exactly like a Candlestick's.
+type FormattedCandlestick struct {
+	Candlestick
+	Format TimestampFormat
+	Names  FieldNames
+}
+
+// MarshalJSON serializes the candlestick with its timestamps in the configured format, and the configured field names.
+// Like a Candlestick's, the synthetic and close timestamp fields are omitted unless set.
+func (c FormattedCandlestick) MarshalJSON() ([]byte, error) {
+	var closeTimestamp interface{}
+	if c.CloseTimestamp != 0 {
+		closeTimestamp = c.Format.format(c.CloseTimestamp)
+	}
+	if c.Names == FieldNamesCharting {
+		return json.Marshal(struct {
+			Time           interface{} `json:"time"`
+			Open           JSONFloat64 `json:"open"`
+			High           JSONFloat64 `json:"high"`
+			Low            JSONFloat64 `json:"low"`
+			Close          JSONFloat64 `json:"close"`
+			Synthetic      bool        `json:"synthetic,omitempty"`
+			CloseTimestamp interface{} `json:"ct,omitempty"`
+		}{c.Format.format(c.Timestamp), c.OpenPrice, c.HighestPrice, c.LowestPrice, c.ClosePrice, c.Synthetic, closeTimestamp})
+	}
+	return json.Marshal(struct {
+		Timestamp      interface{} `json:"t"`
+		OpenPrice      JSONFloat64 `json:"o"`
+		ClosePrice     JSONFloat64 `json:"c"`
+		LowestPrice    JSONFloat64 `json:"l"`
+		HighestPrice   JSONFloat64 `json:"h"`
+		Synthetic      bool        `json:"synthetic,omitempty"`
+		CloseTimestamp interface{} `json:"ct,omitempty"`
+	}{c.Format.format(c.Timestamp), c.OpenPrice, c.ClosePrice, c.LowestPrice, c.HighestPrice, c.Synthetic, closeTimestamp})
+}
+
+// Tick is a single value at a given time, e.g. the price of BTC/USDT at 2022-01-02T03:04:05Z.
+type Tick struct {
+	// Timestamp is the UNIX timestamp (i.e. seconds since UTC Epoch) of the tick.
+	Timestamp int `json:"t"`
+
+	// Value is the value of the tick (e.g. a price).
+	Value JSONFloat64 `json:"v"`
 }
 
 // JSONFloat64 exists only for the purpose of marshalling floats in a nicer way.
@@ -122,6 +522,20 @@ func (jf JSONFloat64) MarshalJSON() ([]byte, error) {
 	return bs[:i+1], nil
 }
 
+// Round returns the float rounded to the supplied number of decimals (half away from zero), e.g. to drop float artifacts
+// like 96021.20000000001 before displaying it. Negative decimals, or too many to make a difference, leave it as is.
+func (jf JSONFloat64) Round(decimals int) JSONFloat64 {
+	if decimals < 0 || decimals > 15 {
+		return jf
+	}
+	pow := math.Pow10(decimals)
+	rounded := math.Round(float64(jf)*pow) / pow
+	if math.IsInf(rounded, 0) || math.IsNaN(rounded) {
+		return jf
+	}
+	return JSONFloat64(rounded)
+}
+
 // MarketSource uniquely identifies what market an Iterator is built for, e.g. the prices of BTC/USDT in BINANCE
 type MarketSource struct {
 	Type       MarketType
@@ -134,8 +548,62 @@ func (m MarketSource) String() string {
 	return fmt.Sprintf("%v:%v:%v-%v", m.Type.String(), m.Provider, m.BaseAsset, m.QuoteAsset)
 }
 
-// MarketType is the type of market that an Iterator is built for. The only supported MarketType is COIN e.g. BTC/USDT.
-// At the moment it's not a very useful concept, but if MarketCaps are added, then this namespacing will be warranted.
+// ProviderAgnosticString is like String, but without the provider, e.g. "COIN:BTC-USDT". Useful for treating the same
+// market pair on all exchanges as one series.
+func (m MarketSource) ProviderAgnosticString() string {
+	return fmt.Sprintf("%v:%v-%v", m.Type.String(), m.BaseAsset, m.QuoteAsset)
+}
+
+// CacheKey returns a filesystem-safe key for the market source's candlesticks of the given candlestick interval, e.g.
+// "binance_coin_btc_usdt_60", for persisting them (e.g. as file names). Keys only contain lowercase letters, digits,
+// "_" and "-": other characters are escaped as "-" followed by their hex byte (e.g. "-2e" for "."), so that distinct
+// market sources never share a key, except for letter case, which exchanges ignore. The interval is in seconds, or in
+// nanoseconds with an "ns" suffix if it's not a whole number of seconds.
+func (m MarketSource) CacheKey(candlestickInterval time.Duration) string {
+	interval := strconv.Itoa(IntervalToSeconds(candlestickInterval))
+	if IntervalToSeconds(candlestickInterval) == 0 {
+		interval = fmt.Sprintf("%dns", candlestickInterval.Nanoseconds())
+	}
+	return strings.Join([]string{cacheKeyPart(m.Provider), cacheKeyPart(m.Type.String()), cacheKeyPart(m.BaseAsset), cacheKeyPart(m.QuoteAsset), interval}, "_")
+}
+
+// cacheKeyPart lowercases s, and escapes its characters other than lowercase letters and digits (see CacheKey).
+func cacheKeyPart(s string) string {
+	var sb strings.Builder
+	for _, b := range []byte(strings.ToLower(s)) {
+		if (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9') {
+			sb.WriteByte(b)
+			continue
+		}
+		fmt.Fprintf(&sb, "-%02x", b)
+	}
+	return sb.String()
+}
+
+// Validate checks the market source without requesting the exchange. It doesn't check whether the provider is
+// supported, nor whether the market pair exists at the exchange.
+//
+// * Fails with ErrInvalidMarketType if the type is neither COIN nor PERPETUAL.
+// * Fails with ErrEmptyProvider if the provider is empty.
+// * Fails with ErrEmptyBaseAsset or ErrEmptyQuoteAsset (both of which are also ErrEmptyAsset) if an asset is empty.
+func (m MarketSource) Validate() error {
+	if m.Type != COIN && m.Type != PERPETUAL {
+		return fmt.Errorf("%w: %v (only COIN and PERPETUAL are supported)", ErrInvalidMarketType, m.Type.String())
+	}
+	if strings.TrimSpace(m.Provider) == "" {
+		return ErrEmptyProvider
+	}
+	if strings.TrimSpace(m.BaseAsset) == "" {
+		return ErrEmptyBaseAsset
+	}
+	if strings.TrimSpace(m.QuoteAsset) == "" {
+		return ErrEmptyQuoteAsset
+	}
+	return nil
+}
+
+// MarketType is the type of market that an Iterator is built for: COIN for spot market pairs e.g. BTC/USDT, or
+// PERPETUAL for perpetual futures contracts on the same market pairs.
 type MarketType int
 
 const (
@@ -143,12 +611,17 @@ const (
 	UNSUPPORTED MarketType = iota
 	// COIN is the basic market pair MarketType e.g. BTC/USDT
 	COIN
+	// PERPETUAL is the perpetual futures MarketType e.g. the BTC/USDT perpetual contract. The provider is the name of
+	// the exchange (e.g. BINANCE), which is routed to the exchange's futures API.
+	PERPETUAL
 )
 
 func (m MarketType) String() string {
 	switch m {
 	case COIN:
 		return "COIN"
+	case PERPETUAL:
+		return "PERPETUAL"
 	default:
 		return "UNSUPPORTED"
 	}
@@ -156,10 +629,14 @@ func (m MarketType) String() string {
 
 // MarketTypeFromString constructs a MarketType from a string.
 func MarketTypeFromString(s string) MarketType {
-	if s == "COIN" {
+	switch s {
+	case "COIN":
 		return COIN
+	case "PERPETUAL":
+		return PERPETUAL
+	default:
+		return UNSUPPORTED
 	}
-	return UNSUPPORTED
 }
 
 // ISO8601 adds convenience methods for converting ISO8601-formatted date strings.
@@ -195,6 +672,27 @@ var (
 	// ErrUnsuportedCandlestickProvider means: unsupported candlestick provider
 	ErrUnsuportedCandlestickProvider = errors.New("unsupported candlestick provider")
 
+	// ErrUnsupportedProvider is the same error as ErrUnsuportedCandlestickProvider, spelled correctly
+	ErrUnsupportedProvider = ErrUnsuportedCandlestickProvider
+
+	// ErrNotSupported means: the provider doesn't support the requested feature (e.g. listing its markets)
+	ErrNotSupported = errors.New("not supported by the provider")
+
+	// ErrInvalidCandlestick means: the candlestick's prices are inconsistent, e.g. its low is above its high
+	ErrInvalidCandlestick = errors.New("invalid candlestick")
+
+	// ErrEmptyAsset means: empty asset
+	ErrEmptyAsset = errors.New("empty asset")
+
+	// ErrEmptyBaseAsset means: empty base asset. It's also an ErrEmptyAsset.
+	ErrEmptyBaseAsset = fmt.Errorf("%w: base asset", ErrEmptyAsset)
+
+	// ErrEmptyQuoteAsset means: empty quote asset. It's also an ErrEmptyAsset.
+	ErrEmptyQuoteAsset = fmt.Errorf("%w: quote asset", ErrEmptyAsset)
+
+	// ErrEmptyProvider means: empty provider
+	ErrEmptyProvider = errors.New("empty provider")
+
 	// ErrOutOfTicks means: out of ticks
 	ErrOutOfTicks = errors.New("out of ticks")
 
@@ -210,17 +708,48 @@ var (
 	// ErrRateLimit means: exchange asked us to enhance our calm
 	ErrRateLimit = errors.New("exchange asked us to enhance our calm")
 
+	// ErrDataTooFarBack means: requested data is older than the exchange's maximum history depth
+	ErrDataTooFarBack = errors.New("requested data is older than the exchange's maximum history depth")
+
+	// ErrBeforeListing means: requested data is older than the market pair's listing on the exchange
+	ErrBeforeListing = errors.New("requested data is older than the market pair's listing")
+
+	// ErrUnalignedStartTime means: start time is not aligned to the candlestick interval (see WithStrictTimestamps)
+	ErrUnalignedStartTime = errors.New("start time is not aligned to the candlestick interval")
+
+	// ErrTooManyConsecutiveHoles means: more consecutive candlesticks were missing (and patched in as Synthetic) than
+	// allowed (see WithMaxConsecutiveHoles), e.g. during an exchange's maintenance halt
+	ErrTooManyConsecutiveHoles = errors.New("too many consecutive holes")
+
+	// ErrUnsortedCandlesticks means: candlesticks are not in strictly ascending order of timestamp (see CheckSeries)
+	ErrUnsortedCandlesticks = errors.New("candlesticks are not in strictly ascending order")
+
 	// From TickIterator
 
 	// ErrNoNewTicksYet means: no new ticks yet
 	ErrNoNewTicksYet = errors.New("no new ticks yet")
 
+	// ErrIterationComplete means: the iterator reached its end time. It's not a failure, but the normal end of a
+	// historical range, as opposed to ErrOutOfCandlesticks, which means the exchange unexpectedly had no data.
+	ErrIterationComplete = errors.New("iteration complete")
+
+	// ErrMaxCandlesReached means: the iterator already returned the maximum number of candlesticks it was configured
+	// to return, as a safety limit for runaway loops.
+	ErrMaxCandlesReached = errors.New("max candles reached")
+
 	// ErrExchangeReturnedNoTicks means: exchange returned no ticks
 	ErrExchangeReturnedNoTicks = errors.New("exchange returned no ticks")
 
 	// ErrExchangeReturnedOutOfSyncTick means: exchange returned out of sync tick
 	ErrExchangeReturnedOutOfSyncTick = errors.New("exchange returned out of sync tick")
 
+	// ErrExchangeReturnedDuplicateTimestamp means: exchange returned more than one candlestick with the same timestamp
+	ErrExchangeReturnedDuplicateTimestamp = errors.New("exchange returned duplicate timestamp")
+
+	// ErrExchangeReturnedWrongInterval means: exchange returned candlesticks that are not spaced by the requested
+	// candlestick interval, e.g. because it silently replaced an interval it doesn't support (see CheckInterval)
+	ErrExchangeReturnedWrongInterval = errors.New("exchange returned wrong candlestick interval")
+
 	// From PatchTickHoles
 
 	// ErrOutOfSyncTimestampPatchingHoles means: out of sync timestamp found patching holes
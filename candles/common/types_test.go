@@ -1,8 +1,11 @@
 package common
 
 import (
+	"encoding/json"
 	"errors"
+	"math"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -12,6 +15,21 @@ func TestCandleReqError(t *testing.T) {
 	require.Equal(t, "for test", err.Error())
 }
 
+func TestCandleReqErrorUnwrap(t *testing.T) {
+	var err error = CandleReqError{Kind: KindRateLimited, Err: ErrRateLimit}
+	require.ErrorIs(t, err, ErrRateLimit)
+}
+
+func TestErrorKindString(t *testing.T) {
+	require.Equal(t, "Unknown", KindUnknown.String())
+	require.Equal(t, "RateLimited", KindRateLimited.String())
+	require.Equal(t, "InvalidPair", KindInvalidPair.String())
+	require.Equal(t, "Transient", KindTransient.String())
+	require.Equal(t, "BadData", KindBadData.String())
+	require.Equal(t, "TooFarBack", KindTooFarBack.String())
+	require.Equal(t, "NotSupported", KindNotSupported.String())
+}
+
 func TestMarketSourceString(t *testing.T) {
 	ms := MarketSource{
 		Type:       COIN,
@@ -23,12 +41,195 @@ func TestMarketSourceString(t *testing.T) {
 	require.Equal(t, expected, ms.String())
 }
 
+func TestMarketSourceProviderAgnosticString(t *testing.T) {
+	ms := MarketSource{
+		Type:       COIN,
+		Provider:   BINANCE,
+		BaseAsset:  "BTC",
+		QuoteAsset: "USDT",
+	}
+	expected := "COIN:BTC-USDT"
+	require.Equal(t, expected, ms.ProviderAgnosticString())
+}
+
+func TestMarketSourceCacheKey(t *testing.T) {
+	ms := MarketSource{Type: COIN, Provider: BINANCE, BaseAsset: "BTC", QuoteAsset: "USDT"}
+	require.Equal(t, "binance_coin_btc_usdt_60", ms.CacheKey(time.Minute))
+	require.Equal(t, "binance_perpetual_btc_usdt_86400", MarketSource{Type: PERPETUAL, Provider: BINANCE, BaseAsset: "BTC", QuoteAsset: "USDT"}.CacheKey(24*time.Hour))
+	require.Equal(t, "binance_coin_btc_usdt_1500000000ns", ms.CacheKey(1500*time.Millisecond))
+
+	// Characters that are unfriendly to file names are escaped, so that keys don't collide.
+	require.Equal(t, "my-20exchange_coin_a-5fb_c_60", MarketSource{Type: COIN, Provider: "my exchange", BaseAsset: "A_B", QuoteAsset: "C"}.CacheKey(time.Minute))
+	require.Equal(t, "my-20exchange_coin_a_b-5fc_60", MarketSource{Type: COIN, Provider: "my exchange", BaseAsset: "A", QuoteAsset: "B_C"}.CacheKey(time.Minute))
+	require.Equal(t, "kucoin_coin_1000-2e-2fshib_usdt_60", MarketSource{Type: COIN, Provider: KUCOIN, BaseAsset: "1000./SHIB", QuoteAsset: "USDT"}.CacheKey(time.Minute))
+}
+
 func TestMarketTypeFromString(t *testing.T) {
 	require.Equal(t, COIN, MarketTypeFromString("COIN"))
+	require.Equal(t, PERPETUAL, MarketTypeFromString("PERPETUAL"))
 	require.Equal(t, UNSUPPORTED, MarketTypeFromString("ANYTHING ELSE"))
 }
 
 func TestMarketTypeString(t *testing.T) {
 	require.Equal(t, "COIN", COIN.String())
+	require.Equal(t, "PERPETUAL", PERPETUAL.String())
 	require.Equal(t, "UNSUPPORTED", UNSUPPORTED.String())
 }
+
+func TestCandlestickToTicks(t *testing.T) {
+	c := Candlestick{Timestamp: 60, OpenPrice: 2, ClosePrice: 3, LowestPrice: 1, HighestPrice: 4}
+	require.Equal(t, []Tick{{Timestamp: 60, Value: 1}, {Timestamp: 60, Value: 4}}, c.ToTicks())
+}
+
+func TestCandlestickTypicalPriceAndMedian(t *testing.T) {
+	c := Candlestick{Timestamp: 60, OpenPrice: 2, ClosePrice: 3, LowestPrice: 1, HighestPrice: 5}
+	require.Equal(t, JSONFloat64(3), c.TypicalPrice())
+	require.Equal(t, JSONFloat64(3), c.Median())
+
+	c = Candlestick{Timestamp: 60, OpenPrice: 2, ClosePrice: 2, LowestPrice: 1, HighestPrice: 2}
+	require.InDelta(t, 1.66666666, float64(c.TypicalPrice()), 0.0000001)
+	require.Equal(t, JSONFloat64(1.5), c.Median())
+}
+
+func TestFormattedCandlestick(t *testing.T) {
+	c := Candlestick{Timestamp: 1657378800, OpenPrice: 21591.07, ClosePrice: 21535.85, LowestPrice: 21530, HighestPrice: 21643.8}
+
+	tss := []struct {
+		format   TimestampFormat
+		expected string
+	}{
+		{format: TimestampSeconds, expected: `{"t":1657378800,"o":21591.07,"c":21535.85,"l":21530,"h":21643.8}`},
+		{format: TimestampMillis, expected: `{"t":1657378800000,"o":21591.07,"c":21535.85,"l":21530,"h":21643.8}`},
+		{format: TimestampRFC3339, expected: `{"t":"2022-07-09T15:00:00Z","o":21591.07,"c":21535.85,"l":21530,"h":21643.8}`},
+	}
+	for _, ts := range tss {
+		t.Run(ts.format.String(), func(t *testing.T) {
+			bs, err := json.Marshal(FormattedCandlestick{Candlestick: c, Format: ts.format})
+			require.Nil(t, err)
+			require.Equal(t, ts.expected, string(bs))
+		})
+	}
+
+	// Seconds format serializes exactly like a plain Candlestick.
+	plain, _ := json.Marshal(c)
+	formatted, _ := json.Marshal(FormattedCandlestick{Candlestick: c})
+	require.Equal(t, string(plain), string(formatted))
+}
+
+func TestFormattedCandlestickSyntheticAndCloseTimestamp(t *testing.T) {
+	c := Candlestick{Timestamp: 1657378800, OpenPrice: 21591.07, ClosePrice: 21535.85, LowestPrice: 21530, HighestPrice: 21643.8, Synthetic: true, CloseTimestamp: 1657382400}
+
+	bs, err := json.Marshal(FormattedCandlestick{Candlestick: c})
+	require.Nil(t, err)
+	require.Equal(t, `{"t":1657378800,"o":21591.07,"c":21535.85,"l":21530,"h":21643.8,"synthetic":true,"ct":1657382400}`, string(bs))
+
+	// Seconds format still serializes exactly like a plain Candlestick.
+	plain, _ := json.Marshal(c)
+	require.Equal(t, string(plain), string(bs))
+
+	bs, err = json.Marshal(FormattedCandlestick{Candlestick: c, Format: TimestampRFC3339, Names: FieldNamesCharting})
+	require.Nil(t, err)
+	require.Equal(t, `{"time":"2022-07-09T15:00:00Z","open":21591.07,"high":21643.8,"low":21530,"close":21535.85,"synthetic":true,"ct":"2022-07-09T16:00:00Z"}`, string(bs))
+
+	bs, err = json.Marshal(FormattedCandlestick{Candlestick: c, Format: TimestampMillis})
+	require.Nil(t, err)
+	require.Equal(t, `{"t":1657378800000,"o":21591.07,"c":21535.85,"l":21530,"h":21643.8,"synthetic":true,"ct":1657382400000}`, string(bs))
+}
+
+func TestFormattedCandlestickFieldNames(t *testing.T) {
+	c := Candlestick{Timestamp: 1657378800, OpenPrice: 21591.07, ClosePrice: 21535.85, LowestPrice: 21530, HighestPrice: 21643.8}
+
+	bs, err := json.Marshal(FormattedCandlestick{Candlestick: c, Names: FieldNamesCharting})
+	require.Nil(t, err)
+	require.Equal(t, `{"time":1657378800,"open":21591.07,"high":21643.8,"low":21530,"close":21535.85}`, string(bs))
+
+	bs, err = json.Marshal(FormattedCandlestick{Candlestick: c, Format: TimestampRFC3339, Names: FieldNamesCharting})
+	require.Nil(t, err)
+	require.Equal(t, `{"time":"2022-07-09T15:00:00Z","open":21591.07,"high":21643.8,"low":21530,"close":21535.85}`, string(bs))
+
+	for _, n := range []FieldNames{FieldNamesShort, FieldNamesCharting} {
+		actual, err := FieldNamesFromString(n.String())
+		require.Nil(t, err)
+		require.Equal(t, n, actual)
+	}
+	_, err = FieldNamesFromString("long")
+	require.NotNil(t, err)
+}
+
+func TestTimestampFormatFromString(t *testing.T) {
+	for _, f := range []TimestampFormat{TimestampSeconds, TimestampMillis, TimestampRFC3339} {
+		actual, err := TimestampFormatFromString(f.String())
+		require.Nil(t, err)
+		require.Equal(t, f, actual)
+	}
+	_, err := TimestampFormatFromString("nanos")
+	require.NotNil(t, err)
+}
+
+func TestCandlestickEqualWithin(t *testing.T) {
+	c := Candlestick{Timestamp: 60, OpenPrice: 0.1 + 0.2, ClosePrice: 3, LowestPrice: 0.1, HighestPrice: 4}
+	noisy := Candlestick{Timestamp: 60, OpenPrice: 0.3, ClosePrice: 3.0000001, LowestPrice: 0.1, HighestPrice: 4}
+
+	require.NotEqual(t, c, noisy)
+	require.True(t, c.EqualWithin(noisy, 0.000001))
+	require.True(t, noisy.EqualWithin(c, 0.000001))
+	require.False(t, c.EqualWithin(noisy, 0))
+	require.True(t, c.EqualWithin(c, 0))
+
+	noisy.Timestamp = 120
+	require.False(t, c.EqualWithin(noisy, 1))
+
+	noisy = c
+	noisy.HighestPrice += 0.01
+	require.False(t, c.EqualWithin(noisy, 0.001))
+}
+
+func TestCandlestickRoundPrices(t *testing.T) {
+	c := Candlestick{Timestamp: 60, OpenPrice: 96021.20000000001, ClosePrice: 0.1 + 0.2, LowestPrice: 0.125, HighestPrice: 96021.25}
+
+	require.Equal(t, Candlestick{Timestamp: 60, OpenPrice: 96021.2, ClosePrice: 0.3, LowestPrice: 0.13, HighestPrice: 96021.25}, c.RoundPrices(2))
+	require.Equal(t, Candlestick{Timestamp: 60, OpenPrice: 96021, ClosePrice: 0, LowestPrice: 0, HighestPrice: 96021}, c.RoundPrices(0))
+	require.Equal(t, c, c.RoundPrices(-1))
+	require.Equal(t, c, c.RoundPrices(400))
+}
+
+func TestCandlestickIsValid(t *testing.T) {
+	tss := []struct {
+		name        string
+		candlestick Candlestick
+		valid       bool
+	}{
+		{name: "valid", candlestick: Candlestick{OpenPrice: 2, ClosePrice: 3, LowestPrice: 1, HighestPrice: 4}, valid: true},
+		{name: "flat", candlestick: Candlestick{OpenPrice: 1, ClosePrice: 1, LowestPrice: 1, HighestPrice: 1}, valid: true},
+		{name: "zero open is left to the zero check", candlestick: Candlestick{OpenPrice: 0, ClosePrice: 3, LowestPrice: 1, HighestPrice: 4}, valid: true},
+		{name: "all zeros are left to the zero check", candlestick: Candlestick{}, valid: true},
+		{name: "low above high", candlestick: Candlestick{OpenPrice: 2, ClosePrice: 2, LowestPrice: 4, HighestPrice: 1}, valid: false},
+		{name: "open above high", candlestick: Candlestick{OpenPrice: 5, ClosePrice: 3, LowestPrice: 1, HighestPrice: 4}, valid: false},
+		{name: "close below low", candlestick: Candlestick{OpenPrice: 2, ClosePrice: 0.5, LowestPrice: 1, HighestPrice: 4}, valid: false},
+		{name: "negative price", candlestick: Candlestick{OpenPrice: 2, ClosePrice: 3, LowestPrice: -1, HighestPrice: 4}, valid: false},
+		{name: "NaN price", candlestick: Candlestick{OpenPrice: JSONFloat64(math.NaN()), ClosePrice: 3, LowestPrice: 1, HighestPrice: 4}, valid: false},
+		{name: "infinite price", candlestick: Candlestick{OpenPrice: 2, ClosePrice: 3, LowestPrice: 1, HighestPrice: JSONFloat64(math.Inf(1))}, valid: false},
+	}
+	for _, ts := range tss {
+		t.Run(ts.name, func(t *testing.T) {
+			err := ts.candlestick.IsValid()
+			if ts.valid {
+				require.Nil(t, err)
+				return
+			}
+			require.ErrorIs(t, err, ErrInvalidCandlestick)
+		})
+	}
+}
+
+func TestMarketSourceValidate(t *testing.T) {
+	require.Nil(t, MarketSource{Type: COIN, Provider: BINANCE, BaseAsset: "BTC", QuoteAsset: "USDT"}.Validate())
+	require.Nil(t, MarketSource{Type: PERPETUAL, Provider: BINANCE, BaseAsset: "BTC", QuoteAsset: "USDT"}.Validate())
+	require.ErrorIs(t, MarketSource{Type: UNSUPPORTED, Provider: BINANCE, BaseAsset: "BTC", QuoteAsset: "USDT"}.Validate(), ErrInvalidMarketType)
+	require.ErrorIs(t, MarketSource{Type: COIN, Provider: BINANCE, BaseAsset: "", QuoteAsset: "USDT"}.Validate(), ErrEmptyAsset)
+	require.ErrorIs(t, MarketSource{Type: COIN, Provider: BINANCE, BaseAsset: "BTC", QuoteAsset: " "}.Validate(), ErrEmptyAsset)
+	require.ErrorIs(t, MarketSource{Type: COIN, Provider: BINANCE, BaseAsset: "", QuoteAsset: "USDT"}.Validate(), ErrEmptyBaseAsset)
+	require.ErrorIs(t, MarketSource{Type: COIN, Provider: BINANCE, BaseAsset: "BTC", QuoteAsset: " "}.Validate(), ErrEmptyQuoteAsset)
+	require.ErrorIs(t, MarketSource{Type: COIN, Provider: " ", BaseAsset: "BTC", QuoteAsset: "USDT"}.Validate(), ErrEmptyProvider)
+	require.EqualError(t, MarketSource{Type: COIN, Provider: BINANCE, BaseAsset: "", QuoteAsset: "USDT"}.Validate(), "empty asset: base asset")
+}
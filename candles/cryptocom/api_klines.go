@@ -0,0 +1,163 @@
+package cryptocom
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marianogappa/crypto-candles/candles/common"
+)
+
+type responseCandlestick struct {
+	T int64   `json:"t"` // Start time of the candle, in milliseconds
+	O float64 `json:"o"` // Opening price
+	H float64 `json:"h"` // Highest price
+	L float64 `json:"l"` // Lowest price
+	C float64 `json:"c"` // Closing price
+	V float64 `json:"v"` // Volume
+}
+
+type responseResult struct {
+	InstrumentName string                `json:"instrument_name"`
+	Interval       string                `json:"interval"`
+	Data           []responseCandlestick `json:"data"`
+}
+
+type response struct {
+	Code    *int           `json:"code"`
+	Method  string         `json:"method"`
+	Message string         `json:"message"`
+	Result  responseResult `json:"result"`
+}
+
+func (r response) toCandlesticks() ([]common.Candlestick, error) {
+	candlesticks := make([]common.Candlestick, len(r.Result.Data))
+	for i, raw := range r.Result.Data {
+		if raw.L > raw.H {
+			return candlesticks, fmt.Errorf("candlestick %v had low = %v > high %v! Invalid syntax from Crypto.com", i, raw.L, raw.H)
+		}
+		candlesticks[i] = common.Candlestick{
+			Timestamp:    int(time.Unix(0, raw.T*int64(time.Millisecond)).Unix()),
+			OpenPrice:    common.JSONFloat64(raw.O),
+			ClosePrice:   common.JSONFloat64(raw.C),
+			LowestPrice:  common.JSONFloat64(raw.L),
+			HighestPrice: common.JSONFloat64(raw.H),
+		}
+	}
+	return candlesticks, nil
+}
+
+// https://exchange-docs.crypto.com/spot/index.html#response-and-reason-codes
+func (r response) toCandleReqError() common.CandleReqError {
+	err := fmt.Errorf("crypto.com returned error code! Code: %v, Message: %v", *r.Code, r.Message)
+	switch *r.Code {
+	case 10004: // BAD_REQUEST
+		if strings.Contains(strings.ToLower(r.Message), "instrument") {
+			return common.CandleReqError{IsNotRetryable: true, Kind: common.KindInvalidPair, Err: common.ErrInvalidMarketPair, Code: *r.Code}
+		}
+		if strings.Contains(strings.ToLower(r.Message), "timeframe") {
+			return common.CandleReqError{IsNotRetryable: true, Kind: common.KindNotSupported, Err: fmt.Errorf("%w: %v", common.ErrUnsupportedCandlestickInterval, r.Message), Code: *r.Code}
+		}
+		return common.CandleReqError{IsNotRetryable: true, Kind: common.KindUnknown, Err: err, Code: *r.Code}
+	case 10006: // TOO_MANY_REQUESTS
+		return common.CandleReqError{IsNotRetryable: false, Kind: common.KindRateLimited, Err: common.ErrRateLimit, Code: *r.Code}
+	case 30003: // SYMBOL_NOT_FOUND
+		return common.CandleReqError{IsNotRetryable: true, Kind: common.KindInvalidPair, Err: common.ErrInvalidMarketPair, Code: *r.Code}
+	default:
+		return common.CandleReqError{IsNotRetryable: false, Kind: common.KindTransient, Err: err, Code: *r.Code}
+	}
+}
+
+var timeframes = map[time.Duration]string{
+	1 * time.Minute:            "1m",
+	5 * time.Minute:            "5m",
+	15 * time.Minute:           "15m",
+	30 * time.Minute:           "30m",
+	1 * 60 * time.Minute:       "1h",
+	4 * 60 * time.Minute:       "4h",
+	6 * 60 * time.Minute:       "6h",
+	12 * 60 * time.Minute:      "12h",
+	1 * 60 * 24 * time.Minute:  "1D",
+	7 * 60 * 24 * time.Minute:  "7D",
+	14 * 60 * 24 * time.Minute: "14D",
+	30 * 60 * 24 * time.Minute: "1M",
+}
+
+func (e *CryptoCom) requestCandlesticks(baseAsset string, quoteAsset string, startTime time.Time, candlestickInterval time.Duration) ([]common.Candlestick, error) {
+	return e.requestCandlesticksUntil(baseAsset, quoteAsset, startTime, time.Time{}, candlestickInterval)
+}
+
+func (e *CryptoCom) requestCandlesticksUntil(baseAsset string, quoteAsset string, startTime time.Time, endTime time.Time, candlestickInterval time.Duration) ([]common.Candlestick, error) {
+	return e.requestCandlesticksLimit(baseAsset, quoteAsset, startTime, endTime, candlestickInterval, maxLimit)
+}
+
+// maxLimit is the maximum number of candlesticks that the exchange returns per request.
+const maxLimit = 300
+
+// requestCandlesticksLimit is like requestCandlesticksUntil, but requests at most "limit" candlesticks.
+func (e *CryptoCom) requestCandlesticksLimit(baseAsset string, quoteAsset string, startTime time.Time, endTime time.Time, candlestickInterval time.Duration, limit int) ([]common.Candlestick, error) {
+	if limit <= 0 || limit > maxLimit {
+		limit = maxLimit
+	}
+	timeframe, ok := timeframes[candlestickInterval]
+	if !ok {
+		return nil, common.CandleReqError{IsNotRetryable: true, Kind: common.KindNotSupported, Err: common.ErrUnsupportedCandlestickInterval}
+	}
+
+	req, _ := http.NewRequest("GET", fmt.Sprintf("%vpublic/get-candlestick", e.apiURL), nil)
+	instrumentName, err := common.SymbolForProvider(common.MarketSource{BaseAsset: baseAsset, QuoteAsset: quoteAsset}, common.CRYPTOCOM)
+	if err != nil {
+		return nil, common.CandleReqError{IsNotRetryable: true, Kind: common.KindInvalidPair, Err: err}
+	}
+
+	q := req.URL.Query()
+	q.Add("instrument_name", instrumentName)
+	q.Add("timeframe", timeframe)
+
+	// Without start_ts & end_ts, Crypto.com returns the latest candlesticks.
+	if !startTime.IsZero() {
+		// Snap to the future before making the request, to not depend on the exchange doing so.
+		anchor := e.anchor.Get()
+		startTimeSecs := anchor.Normalize(startTime, candlestickInterval, false)
+		q.Add("start_ts", fmt.Sprintf("%v", startTimeSecs*1000))
+		endTimeSecs := anchor.Add(startTimeSecs, candlestickInterval, limit)
+		if !endTime.IsZero() && int(endTime.Unix()) < endTimeSecs {
+			endTimeSecs = int(endTime.Unix())
+		}
+		q.Add("end_ts", fmt.Sprintf("%v", endTimeSecs*1000))
+	}
+	q.Add("count", strconv.Itoa(limit))
+
+	req.URL.RawQuery = q.Encode()
+
+	return e.httpRequester.DoWithInterval(req, candlestickInterval, decodeResponse)
+}
+
+func decodeResponse(statusCode int, byts []byte) ([]common.Candlestick, error) {
+	maybeResponse := response{}
+	if err := json.Unmarshal(byts, &maybeResponse); err != nil {
+		// Non-200 responses may not even be JSON.
+		if statusCode != http.StatusOK {
+			return nil, common.CandleReqError{IsNotRetryable: false, Kind: common.KindTransient, Err: fmt.Errorf("exchange returned status code %v", statusCode)}
+		}
+		return nil, common.CandleReqError{IsNotRetryable: false, Kind: common.KindBadData, Err: common.ErrInvalidJSONResponse}
+	}
+	if maybeResponse.Code == nil {
+		return nil, common.CandleReqError{IsNotRetryable: false, Kind: common.KindBadData, Err: common.ErrInvalidJSONResponse}
+	}
+	if *maybeResponse.Code != 0 {
+		return nil, maybeResponse.toCandleReqError()
+	}
+
+	return maybeResponse.toCandlesticks()
+}
+
+// Crypto.com uses the strategy of having candlesticks on multiples of an hour or a day. To test this, use the
+// following snippet:
+//
+// curl -s "https://api.crypto.com/v2/public/get-candlestick?instrument_name=BTC_USDT&timeframe=1m" | jq '.result.data | .[] | .t | . / 1000 | todate'
+//
+// Timestamps are in milliseconds, and candlesticks are returned in ascending order.
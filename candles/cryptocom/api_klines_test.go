@@ -0,0 +1,350 @@
+package cryptocom
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/marianogappa/crypto-candles/candles/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHappyToCandlesticks(t *testing.T) {
+	testResponse := `
+	{
+		"code": 0,
+		"method": "public/get-candlestick",
+		"result": {
+			"instrument_name": "BTC_USDT",
+			"interval": "1m",
+			"data": [
+				{"t": 1656868680000, "o": 19122.76, "h": 19122.76, "l": 19111.99, "c": 19111.99, "v": 0.02005},
+				{"t": 1656868740000, "o": 19122.79, "h": 19122.79, "l": 19113.03, "c": 19113.03, "v": 0.91282},
+				{"t": 1656868800000, "o": 19122.30, "h": 19122.30, "l": 19120.33, "c": 19121.32, "v": 0.0447}
+			]
+		}
+	}
+	`
+
+	expected := []common.Candlestick{
+		{
+			Timestamp:    1656868680,
+			OpenPrice:    19122.76,
+			ClosePrice:   19111.99,
+			LowestPrice:  19111.99,
+			HighestPrice: 19122.76,
+		},
+		{
+			Timestamp:    1656868740,
+			OpenPrice:    19122.79,
+			ClosePrice:   19113.03,
+			LowestPrice:  19113.03,
+			HighestPrice: 19122.79,
+		},
+		{
+			Timestamp:    1656868800,
+			OpenPrice:    19122.30,
+			ClosePrice:   19121.32,
+			LowestPrice:  19120.33,
+			HighestPrice: 19122.30,
+		},
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/public/get-candlestick", r.URL.Path)
+		require.Equal(t, "BTC_USDT", r.URL.Query().Get("instrument_name"))
+		require.Equal(t, "1m", r.URL.Query().Get("timeframe"))
+		require.Equal(t, "1656868680000", r.URL.Query().Get("start_ts"))
+		w.Write([]byte(testResponse))
+	}))
+	defer ts.Close()
+
+	b := NewCryptoCom()
+	b.SetDebug(true)
+	b.requester.Strategy = common.RetryStrategy{Attempts: 1}
+	b.apiURL = ts.URL + "/"
+
+	actual, err := b.RequestCandlesticks(msBTCUSDT, tp("2022-07-03T17:18:00+00:00"), time.Minute)
+	require.Nil(t, err)
+	require.Len(t, actual, 3)
+	require.Equal(t, expected, actual)
+}
+
+func TestMonthlyCandlesticksFollowCalendarMonths(t *testing.T) {
+	testResponse := `
+	{
+		"code": 0,
+		"method": "public/get-candlestick",
+		"result": {
+			"instrument_name": "BTC_USDT",
+			"interval": "1M",
+			"data": [
+				{"t": 1706745600000, "o": 42580.00, "h": 63900.00, "l": 41820.00, "c": 61130.00, "v": 0.02005},
+				{"t": 1709251200000, "o": 61130.00, "h": 73780.00, "l": 59000.00, "c": 71290.00, "v": 0.91282}
+			]
+		}
+	}
+	`
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "1M", r.URL.Query().Get("timeframe"))
+		// i.e. 2024-02-01, and 300 calendar months later.
+		require.Equal(t, "1706745600000", r.URL.Query().Get("start_ts"))
+		require.Equal(t, "2495750400000", r.URL.Query().Get("end_ts"))
+		w.Write([]byte(testResponse))
+	}))
+	defer ts.Close()
+
+	b := NewCryptoCom()
+	b.requester.Strategy = common.RetryStrategy{Attempts: 1}
+	b.apiURL = ts.URL + "/"
+
+	actual, err := b.RequestCandlesticks(msBTCUSDT, tp("2024-01-15T00:00:00+00:00"), 30*24*time.Hour)
+	require.Nil(t, err)
+	require.Len(t, actual, 2)
+	require.Equal(t, 1709251200, actual[1].Timestamp)
+}
+
+func TestNoCandlesticks(t *testing.T) {
+	testResponse := `{"code": 0, "method": "public/get-candlestick", "result": {"instrument_name": "BTC_USDT", "interval": "1m", "data": []}}`
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testResponse))
+	}))
+	defer ts.Close()
+
+	b := NewCryptoCom()
+	b.SetDebug(true)
+	b.requester.Strategy = common.RetryStrategy{Attempts: 1}
+	b.apiURL = ts.URL + "/"
+
+	_, err := b.RequestCandlesticks(msBTCUSDT, tp("2022-07-03T17:18:00+00:00"), time.Minute)
+	require.ErrorIs(t, err.(common.CandleReqError).Err, common.ErrOutOfCandlesticks)
+}
+
+func TestUnhappyToCandlesticks(t *testing.T) {
+	tests := []string{
+		// Low higher than high
+		`{"code": 0, "result": {"data": [{"t": 1656868680000, "o": 19122.76, "h": 19111.99, "l": 19122.76, "c": 19111.99, "v": 0.02005}]}}`,
+	}
+
+	for i, ts := range tests {
+		t.Run(fmt.Sprintf("Unhappy toCandlesticks %v", i), func(t *testing.T) {
+			r := response{}
+			require.Nil(t, json.Unmarshal([]byte(ts), &r))
+			_, err := r.toCandlesticks()
+			require.NotNil(t, err, "for %v was %v", string(ts), err)
+		})
+	}
+}
+
+func TestUnsupportedInterval(t *testing.T) {
+	b := NewCryptoCom()
+	b.requester.Strategy = common.RetryStrategy{Attempts: 1}
+
+	_, err := b.RequestCandlesticks(msBTCUSDT, tp("2021-07-04T14:14:18+00:00"), 3*time.Minute)
+	require.ErrorIs(t, err.(common.CandleReqError).Err, common.ErrUnsupportedCandlestickInterval)
+	require.Equal(t, common.KindNotSupported, err.(common.CandleReqError).Kind)
+}
+
+func TestKlinesInvalidUrl(t *testing.T) {
+	b := NewCryptoCom()
+	b.requester.Strategy = common.RetryStrategy{Attempts: 1}
+	b.apiURL = "invalid url"
+
+	_, err := b.RequestCandlesticks(msBTCUSDT, tp("2021-07-04T14:14:18+00:00"), time.Minute)
+	if err == nil {
+		t.Fatalf("should have failed due to invalid url")
+	}
+}
+
+func TestKlinesErrReadingResponseBody(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "1")
+	}))
+	defer ts.Close()
+
+	b := NewCryptoCom()
+	b.requester.Strategy = common.RetryStrategy{Attempts: 1}
+	b.apiURL = ts.URL + "/"
+
+	_, err := b.RequestCandlesticks(msBTCUSDT, tp("2021-07-04T14:14:18+00:00"), time.Minute)
+	if err == nil {
+		t.Fatalf("should have failed due to invalid response body")
+	}
+}
+
+func TestKlinesErrorResponses(t *testing.T) {
+	tests := []struct {
+		name              string
+		response          string
+		expectedErr       error
+		expectedKind      common.ErrorKind
+		expectedRetryable bool
+	}{
+		{
+			name:              "Invalid instrument",
+			response:          `{"code": 10004, "method": "public/get-candlestick", "message": "invalid instrument_name"}`,
+			expectedErr:       common.ErrInvalidMarketPair,
+			expectedKind:      common.KindInvalidPair,
+			expectedRetryable: false,
+		},
+		{
+			name:              "Invalid timeframe",
+			response:          `{"code": 10004, "method": "public/get-candlestick", "message": "invalid timeframe"}`,
+			expectedErr:       common.ErrUnsupportedCandlestickInterval,
+			expectedKind:      common.KindNotSupported,
+			expectedRetryable: false,
+		},
+		{
+			name:              "Symbol not found",
+			response:          `{"code": 30003, "method": "public/get-candlestick", "message": "SYMBOL_NOT_FOUND"}`,
+			expectedErr:       common.ErrInvalidMarketPair,
+			expectedKind:      common.KindInvalidPair,
+			expectedRetryable: false,
+		},
+		{
+			name:              "Too many requests",
+			response:          `{"code": 10006, "method": "public/get-candlestick", "message": "TOO_MANY_REQUESTS"}`,
+			expectedErr:       common.ErrRateLimit,
+			expectedKind:      common.KindRateLimited,
+			expectedRetryable: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintln(w, tc.response)
+			}))
+			defer ts.Close()
+
+			b := NewCryptoCom()
+			b.requester.Strategy = common.RetryStrategy{Attempts: 1}
+			b.apiURL = ts.URL + "/"
+
+			_, err := b.RequestCandlesticks(msBTCUSDT, tp("2021-07-04T14:14:18+00:00"), time.Minute)
+			reqErr, ok := err.(common.CandleReqError)
+			require.True(t, ok)
+			require.ErrorIs(t, reqErr.Err, tc.expectedErr)
+			require.Equal(t, tc.expectedKind, reqErr.Kind)
+			require.Equal(t, tc.expectedRetryable, !reqErr.IsNotRetryable)
+		})
+	}
+}
+
+func TestKlinesUnknownErrorCode(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"code": 10001, "method": "public/get-candlestick", "message": "SYS_ERROR"}`)
+	}))
+	defer ts.Close()
+
+	b := NewCryptoCom()
+	b.requester.Strategy = common.RetryStrategy{Attempts: 1}
+	b.apiURL = ts.URL + "/"
+
+	_, err := b.RequestCandlesticks(msBTCUSDT, tp("2021-07-04T14:14:18+00:00"), time.Minute)
+	require.Equal(t, 10001, err.(common.CandleReqError).Code)
+}
+
+func Test429(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(429)
+	}))
+	defer ts.Close()
+
+	b := NewCryptoCom()
+	b.requester.Strategy = common.RetryStrategy{Attempts: 1}
+	b.apiURL = ts.URL + "/"
+
+	_, err := b.RequestCandlesticks(msBTCUSDT, tp("2021-07-04T14:14:18+00:00"), time.Minute)
+	require.ErrorIs(t, err.(common.CandleReqError).Err, common.ErrRateLimit)
+}
+
+func TestKlinesNon200Response(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(500)
+	}))
+	defer ts.Close()
+
+	b := NewCryptoCom()
+	b.requester.Strategy = common.RetryStrategy{Attempts: 1}
+	b.apiURL = ts.URL + "/"
+
+	_, err := b.RequestCandlesticks(msBTCUSDT, tp("2021-07-04T14:14:18+00:00"), time.Minute)
+	if err == nil {
+		t.Fatalf("should have failed due to 500 response")
+	}
+}
+
+func TestKlinesInvalidJSONResponse(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `invalid json`)
+	}))
+	defer ts.Close()
+
+	b := NewCryptoCom()
+	b.SetDebug(true)
+	b.requester.Strategy = common.RetryStrategy{Attempts: 1}
+	b.apiURL = ts.URL + "/"
+
+	_, err := b.RequestCandlesticks(msBTCUSDT, tp("2021-07-04T14:14:18+00:00"), time.Minute)
+	if err == nil {
+		t.Fatalf("should have failed due to invalid json")
+	}
+}
+
+func TestKlinesMissingCodeInJSONResponse(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{}`)
+	}))
+	defer ts.Close()
+
+	b := NewCryptoCom()
+	b.requester.Strategy = common.RetryStrategy{Attempts: 1}
+	b.apiURL = ts.URL + "/"
+
+	_, err := b.RequestCandlesticks(msBTCUSDT, tp("2021-07-04T14:14:18+00:00"), time.Minute)
+	require.ErrorIs(t, err.(common.CandleReqError).Err, common.ErrInvalidJSONResponse)
+}
+
+func TestErrRateLimitRetryAfter(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Retry-After", "7")
+		w.WriteHeader(429)
+	}))
+	defer ts.Close()
+
+	b := NewCryptoCom()
+	b.requester.Strategy = common.RetryStrategy{Attempts: 1}
+	b.apiURL = ts.URL + "/"
+
+	_, err := b.RequestCandlesticks(msBTCUSDT, tp("2021-07-04T14:14:18+00:00"), time.Minute)
+	require.ErrorIs(t, err.(common.CandleReqError).Err, common.ErrRateLimit)
+	require.Equal(t, common.KindRateLimited, err.(common.CandleReqError).Kind)
+	require.Equal(t, 7*time.Second, err.(common.CandleReqError).RetryAfter)
+}
+
+func TestPatience(t *testing.T) {
+	require.Equal(t, 1*time.Minute, NewCryptoCom().Patience())
+}
+
+func TestName(t *testing.T) {
+	require.Equal(t, "CRYPTOCOM", NewCryptoCom().Name())
+}
+
+func tp(s string) time.Time {
+	t, _ := time.Parse(time.RFC3339, s)
+	return t
+}
+
+var (
+	msBTCUSDT = common.MarketSource{
+		Type:       common.COIN,
+		Provider:   "CRYPTOCOM",
+		BaseAsset:  "BTC",
+		QuoteAsset: "USDT",
+	}
+)
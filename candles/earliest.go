@@ -0,0 +1,148 @@
+package candles
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/marianogappa/crypto-candles/candles/common"
+)
+
+// earliestCandleSearchStart is where EarliestCandle starts searching when the provider has no known MaxHistoryDepth:
+// no exchange serves candlesticks older than the Bitcoin genesis block.
+var earliestCandleSearchStart = time.Date(2009, time.January, 3, 0, 0, 0, 0, time.UTC)
+
+// earliestCandleCache holds the candlesticks that EarliestCandle found per market source and candlestick interval.
+// It's a pointer within Market, so that copies of a Market share it.
+type earliestCandleCache struct {
+	lock    sync.Mutex
+	entries map[string]common.Candlestick
+}
+
+func newEarliestCandleCache() *earliestCandleCache {
+	return &earliestCandleCache{entries: map[string]common.Candlestick{}}
+}
+
+// get returns the cached candlestick for the key, if any. A nil cache never has candlesticks.
+func (c *earliestCandleCache) get(key string) (common.Candlestick, bool) {
+	if c == nil {
+		return common.Candlestick{}, false
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	candlestick, ok := c.entries[key]
+	return candlestick, ok
+}
+
+// put caches the candlestick for the key. It's a no-op on a nil cache.
+func (c *earliestCandleCache) put(key string, candlestick common.Candlestick) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.entries[key] = candlestick
+}
+
+// EarliestCandle returns the oldest candlestick the market source's provider serves for the given candlestick
+// interval, e.g. to bound RequestRange to the market pair's real history. Results are cached for the lifetime of the
+// Market, since a market pair's history doesn't grow backwards.
+//
+// Providers that answer a request before the market pair's listing with the first candlesticks after it (e.g.
+// BINANCE) take a single request. Otherwise, it binary-searches the pages between the provider's MaxHistoryDepth (or
+// the Bitcoin genesis block) and now, which takes about log2 of the number of candlesticks in between requests.
+//
+// * Fails like Iterator if the market source is invalid.
+// * Fails with ErrOutOfCandlesticks if the provider has no candlesticks for the market source at all.
+// * Fails with the provider's CandleReqError otherwise, whose Kind classifies the failure.
+func (m Market) EarliestCandle(marketSource common.MarketSource, candlestickInterval time.Duration) (common.Candlestick, error) {
+	marketSource = m.normalize(marketSource)
+	if err := marketSource.Validate(); err != nil {
+		return common.Candlestick{}, err
+	}
+	exchange, err := m.getExchange(marketSource)
+	if err != nil {
+		return common.Candlestick{}, err
+	}
+
+	key := fmt.Sprintf("%v-%v", marketSource.String(), candlestickInterval)
+	if candlestick, ok := m.earliestCandles.get(key); ok {
+		return candlestick, nil
+	}
+
+	// The lock isn't held while searching, so that searches for other market sources aren't blocked on this one.
+	// Concurrent searches for the same key may both run, but they find the same candlestick.
+	candlestick, err := m.searchEarliestCandle(exchange, marketSource, candlestickInterval)
+	if err != nil {
+		return common.Candlestick{}, err
+	}
+	m.earliestCandles.put(key, candlestick)
+	return candlestick, nil
+}
+
+// searchEarliestCandle binary-searches the earliest start time whose page has a non-synthetic candlestick. Pages are
+// empty (or entirely patched) before the listing and have candlesticks after it, so the first non-synthetic
+// candlestick of that page is the earliest one.
+func (m Market) searchEarliestCandle(exchange common.Exchange, marketSource common.MarketSource, candlestickInterval time.Duration) (common.Candlestick, error) {
+	now := m.timeNowFunc()
+	lowTime := earliestCandleSearchStart
+	if maxDepth := common.MaxHistoryDepthOf(exchange); maxDepth > 0 && now.Add(-maxDepth).After(lowTime) {
+		lowTime = now.Add(-maxDepth)
+	}
+	lowTime = common.AnchorOf(exchange).Ceil(lowTime, candlestickInterval)
+	steps := int(now.Sub(lowTime) / candlestickInterval)
+	if steps < 1 {
+		return common.Candlestick{}, common.CandleReqError{IsNotRetryable: true, Kind: common.KindTooFarBack, Err: common.ErrOutOfCandlesticks}
+	}
+
+	// Candlestick at index i of the search starts at lowTime + i * candlestickInterval. The first one is probed first,
+	// which is enough for providers that skip to the listing, and then the last one, so that market sources without
+	// candlesticks fail early.
+	probe := func(i int) (common.Candlestick, bool, error) {
+		startTime := lowTime.Add(time.Duration(i) * candlestickInterval)
+		requestStart := time.Now()
+		candlesticks, err := exchange.RequestCandlesticks(marketSource, startTime, candlestickInterval)
+		m.observer.ObserveRequest(exchange.Name(), candlestickInterval, time.Since(requestStart), err)
+		if err != nil {
+			if errors.Is(err, common.ErrOutOfCandlesticks) || errors.Is(err, common.ErrBeforeListing) || errors.Is(err, common.ErrDataTooFarBack) {
+				return common.Candlestick{}, false, nil
+			}
+			return common.Candlestick{}, false, err
+		}
+		for _, candlestick := range candlesticks {
+			if !candlestick.Synthetic {
+				return candlestick, true, nil
+			}
+		}
+		return common.Candlestick{}, false, nil
+	}
+
+	earliest, ok, err := probe(0)
+	if err != nil || ok {
+		return earliest, err
+	}
+	earliest, ok, err = probe(steps - 1)
+	if err != nil {
+		return common.Candlestick{}, err
+	}
+	if !ok {
+		return common.Candlestick{}, common.CandleReqError{IsNotRetryable: true, Kind: common.KindTransient, Err: fmt.Errorf("%w: no candlesticks for %v", common.ErrOutOfCandlesticks, marketSource.String())}
+	}
+
+	// Invariant: the page at high has a candlestick (i.e. earliest), and no page before low does.
+	low, high := 1, steps-1
+	for low < high {
+		mid := low + (high-low)/2
+		candlestick, ok, err := probe(mid)
+		if err != nil {
+			return common.Candlestick{}, err
+		}
+		if ok {
+			high, earliest = mid, candlestick
+		} else {
+			low = mid + 1
+		}
+	}
+	return earliest, nil
+}
@@ -0,0 +1,145 @@
+package candles
+
+import (
+	"errors"
+	"time"
+
+	"github.com/marianogappa/crypto-candles/candles/common"
+	"github.com/marianogappa/crypto-candles/candles/iterator"
+)
+
+// FollowFrom returns an iterator that catches up on the candlesticks since the start time (like Iterator), and then
+// tails the market: rather than failing with ErrNoNewTicksYet upon reaching the present, its Next (and Scan) sleep
+// until the next candlestick should be final (i.e. after it closes and the provider's patience elapses), and poll the
+// exchange again. Only final candlesticks are returned, as with WithFinalOnly.
+//
+// Transient errors (e.g. ErrExchangeReturnedNoTicks, rate limits or timeouts) don't stop it either: it backs off
+// exponentially (from a second up to five minutes, or longer if the exchange asks for it) and polls again.
+//
+// Next blocks indefinitely while following; use SetEndTime or SetMaxCandles to stop at some point.
+//
+// * Fails for the same reasons as Iterator, except for transient errors.
+func (m Market) FollowFrom(marketSource common.MarketSource, startTime time.Time, candlestickInterval time.Duration) (iterator.Iterator, error) {
+	// The Market is a value, so this only affects this Iterator.
+	m.finalOnly = true
+	marketSource = m.normalize(marketSource)
+	iter, err := m.Iterator(marketSource, startTime, candlestickInterval)
+	if err != nil {
+		return nil, err
+	}
+	exchange, err := m.getExchange(marketSource)
+	if err != nil {
+		return nil, err
+	}
+	anchor := common.AnchorOf(exchange)
+	return &follower{
+		Iterator:            iter,
+		nextTs:              anchor.Normalize(startTime, candlestickInterval, false),
+		anchor:              anchor,
+		candlestickInterval: candlestickInterval,
+		patience:            common.PatienceFor(exchange, candlestickInterval),
+		timeNowFunc:         m.timeNowFunc,
+		sleep:               time.Sleep,
+	}, nil
+}
+
+// follower is the iterator returned by FollowFrom.
+type follower struct {
+	iterator.Iterator
+	nextTs              int
+	anchor              common.Anchor
+	candlestickInterval time.Duration
+	patience            time.Duration
+	timeNowFunc         func() time.Time
+	sleep               func(time.Duration)
+	failures            int
+	err                 error
+}
+
+// followMaxBackoff is the longest the follower waits after consecutive transient errors, unless the exchange asks for
+// longer (see CandleReqError.RetryAfter).
+const followMaxBackoff = 5 * time.Minute
+
+// Next returns the next candlestick, sleeping until it's final if necessary.
+func (f *follower) Next() (common.Candlestick, error) {
+	for {
+		candlestick, err := f.Iterator.Next()
+		if errors.Is(err, common.ErrNoNewTicksYet) {
+			f.sleep(f.untilNextPoll())
+			continue
+		}
+		if isTransient(err) {
+			f.sleep(f.backoff(err))
+			continue
+		}
+		if err != nil {
+			return common.Candlestick{}, err
+		}
+		f.failures = 0
+		f.nextTs = f.anchor.Add(candlestick.Timestamp, f.candlestickInterval, 1)
+		return candlestick, nil
+	}
+}
+
+// Scan is like the Iterator's Scan, but it uses the follower's blocking Next.
+func (f *follower) Scan(candlestick *common.Candlestick) bool {
+	cs, err := f.Next()
+	f.err = err
+	if errors.Is(err, common.ErrIterationComplete) {
+		f.err = nil
+	}
+	*candlestick = cs
+	return err == nil
+}
+
+// Error returns the error that made Scan return false, if any.
+func (f *follower) Error() error {
+	return f.err
+}
+
+// untilNextPoll returns how long to wait until the next candlestick should be final. If it should be final already
+// (e.g. the exchange is running late), it polls again after a fraction of the interval, but not sooner than a second.
+func (f *follower) untilNextPoll() time.Duration {
+	if wait := f.untilFinal(); wait > 0 {
+		return wait
+	}
+	if wait := f.candlestickInterval / 10; wait > time.Second {
+		return wait
+	}
+	return time.Second
+}
+
+// backoff returns how long to wait after a transient error: twice as long as after the previous consecutive one (from
+// a second up to followMaxBackoff), or as long as the exchange asks for, but not before the next candlestick should be
+// final.
+func (f *follower) backoff(err error) time.Duration {
+	wait := followMaxBackoff
+	if f.failures < 16 && time.Second<<f.failures < followMaxBackoff {
+		wait = time.Second << f.failures
+	}
+	f.failures++
+	var candleReqErr common.CandleReqError
+	if errors.As(err, &candleReqErr) && candleReqErr.RetryAfter > wait {
+		wait = candleReqErr.RetryAfter
+	}
+	if untilFinal := f.untilFinal(); untilFinal > wait {
+		wait = untilFinal
+	}
+	return wait
+}
+
+// untilFinal returns how long until the next candlestick should be final, i.e. after it closes and the patience
+// elapses. It's negative if it should be final already.
+func (f *follower) untilFinal() time.Duration {
+	finalAt := time.Unix(int64(f.anchor.Add(f.nextTs, f.candlestickInterval, 1)), 0).Add(f.patience)
+	return finalAt.Sub(f.timeNowFunc())
+}
+
+// isTransient returns true if the error may go away by polling again later.
+func isTransient(err error) bool {
+	if errors.Is(err, common.ErrExchangeReturnedNoTicks) || errors.Is(err, common.ErrRateLimit) || errors.Is(err, common.ErrExecutingRequest) {
+		return true
+	}
+	var candleReqErr common.CandleReqError
+	return errors.As(err, &candleReqErr) && !candleReqErr.IsNotRetryable && (candleReqErr.Kind == common.KindTransient || candleReqErr.Kind == common.KindRateLimited)
+}
@@ -19,9 +19,13 @@
 // if iter.Error != nil {
 //   return err
 // }
+//
+// If an end time is set with SetEndTime, Next fails with ErrIterationComplete upon reaching it, and Scan returns false
+// with a nil Error().
 package iterator
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
@@ -38,7 +42,40 @@ type Iterator interface {
 	Error() error
 
 	SetStartFromNext(bool)
+	SetStartAtOrBefore(bool)
+	SetEndTime(time.Time)
+	SetMaxCandles(int)
 	SetTimeNowFunc(func() time.Time)
+	SetLookahead(int)
+	SetFallbackProviders(...common.CandlestickProvider)
+
+	LastSource() Source
+	LastProvider() string
+	Stats() common.Stats
+}
+
+// Source describes where a candlestick returned by the Iterator came from.
+type Source int
+
+const (
+	// SourceNone means that no candlestick has been returned yet, or that the last call to Next() failed.
+	SourceNone Source = iota
+	// SourceCache means that the candlestick was served by the cache.
+	SourceCache
+	// SourceNetwork means that the candlestick was requested to the exchange.
+	SourceNetwork
+)
+
+// String returns a human-readable name for the Source.
+func (s Source) String() string {
+	switch s {
+	case SourceCache:
+		return "Cache"
+	case SourceNetwork:
+		return "Network"
+	default:
+		return "None"
+	}
 }
 
 // Impl is the struct for the market Iterator.
@@ -46,20 +83,49 @@ type Impl struct {
 	marketSource        common.MarketSource
 	candlestickCache    *cache.MemoryCache
 	candlestickProvider common.CandlestickProvider
+	fallbackProviders   []common.CandlestickProvider
 	candlestickInterval time.Duration
+	resampleInterval    time.Duration
+	pending             []common.Candlestick
 	candlesticks        []common.Candlestick
+	candlesticksSource  Source
+	lastSource          Source
+	candlesticksBy      string
+	lastProvider        string
 	metric              cache.Metric
 	timeNowFunc         func() time.Time
+	lookahead           int
+	cursor              string
+	cursorTs            int
 	startFromNext       bool
+	startAtOrBefore     bool
 	startTime           time.Time
+	endTime             time.Time
 	lastTs              int
 	lastErr             error
+	flatHoles           bool
+	maxConsecutiveHoles int
+	consecutiveHoles    int
+	closeTimestamps     bool
+	priceDecimals       int
+	finalOnly           bool
+	maxCandles          int
+	returnedCandles     int
+	lastClose           common.JSONFloat64
+	hasLastClose        bool
+	observer            common.Observer
+	stats               common.Stats
 
-	hasStarted bool // used to panic if SetStartFromNext() is called after Next() is called.
+	hasStarted bool // used to panic if SetStartFromNext() or SetStartAtOrBefore() is called after Next() is called.
 }
 
 // NewIterator constructs a market Iterator.
+//
+// * Fails with ErrUnsupportedCandlestickInterval if the candlestick interval is not a positive whole number of seconds.
 func NewIterator(marketSource common.MarketSource, startTime time.Time, candlestickInterval time.Duration, candlestickCache *cache.MemoryCache, candlestickProvider common.CandlestickProvider) (*Impl, error) {
+	if common.IntervalToSeconds(candlestickInterval) == 0 {
+		return nil, fmt.Errorf("%w: %v is not a positive whole number of seconds", common.ErrUnsupportedCandlestickInterval, candlestickInterval)
+	}
 	iter := Impl{
 		marketSource:        marketSource,
 		candlestickCache:    candlestickCache,
@@ -69,6 +135,8 @@ func NewIterator(marketSource common.MarketSource, startTime time.Time, candlest
 		metric:              cache.Metric{Name: marketSource.String(), CandlestickInterval: candlestickInterval},
 		startTime:           startTime,
 		timeNowFunc:         time.Now,
+		observer:            common.NoOpObserver{},
+		priceDecimals:       -1,
 	}
 	iter.lastTs = iter.calculateLastTs()
 
@@ -76,8 +144,25 @@ func NewIterator(marketSource common.MarketSource, startTime time.Time, candlest
 }
 
 func (it *Impl) calculateLastTs() int {
-	startTs := common.NormalizeTimestamp(it.startTime, it.candlestickInterval, it.candlestickProvider.Name(), it.startFromNext)
-	return startTs - int(it.candlestickInterval/time.Second)
+	interval := it.candlestickInterval
+	if it.resampleInterval != 0 {
+		interval = it.resampleInterval
+	}
+	startTime := it.startTime
+	if it.startAtOrBefore {
+		startTime = it.anchor().Floor(startTime, interval)
+	}
+	startTs := it.anchor().Normalize(startTime, interval, it.startFromNext)
+	if it.resampleInterval != 0 && common.TimestampSemanticsOf(it.candlestickProvider) == common.CloseStamped {
+		// The first close-stamped candlestick of a group is stamped an interval after the group opens.
+		return startTs
+	}
+	return it.anchor().Add(startTs, it.candlestickInterval, -1)
+}
+
+// anchor returns where the provider's candlestick boundaries are.
+func (it *Impl) anchor() common.Anchor {
+	return common.AnchorOf(it.candlestickProvider)
 }
 
 // SetTimeNowFunc overrides time.Now() for testing purposes. Current time is used to decide if there are no new
@@ -86,6 +171,54 @@ func (it *Impl) SetTimeNowFunc(f func() time.Time) {
 	it.timeNowFunc = f
 }
 
+// SetCacheMetricName overrides the name under which candlesticks are stored in (and retrieved from) the cache. By
+// default, it's the market source's String(), which includes the provider. Must be called before Next().
+func (it *Impl) SetCacheMetricName(name string) {
+	it.metric.Name = name
+}
+
+// SetLookahead makes the iterator keep requesting consecutive pages from the exchange, whenever it has to request
+// candlesticks, until it has buffered at least the supplied number of candlesticks (or it reaches the present). All
+// pages are put in the cache.
+//
+// It trades memory for fewer, better-timed HTTP calls: it's useful for exchanges with small page sizes, and for
+// consumers that read in bursts. The default is zero, i.e. a single page per request.
+func (it *Impl) SetLookahead(candlesticks int) {
+	it.lookahead = candlesticks
+}
+
+// SetFallbackProviders configures providers to request candlesticks to, in order, when the provider fails with a
+// retryable error (e.g. rate limiting, connection errors), after its own retries. Each provider normalizes the start
+// time in its own way. Use LastProvider() to know which provider served each candlestick.
+//
+// Note that candlesticks served by a fallback provider are cached as if they were served by the main provider.
+func (it *Impl) SetFallbackProviders(providers ...common.CandlestickProvider) {
+	it.fallbackProviders = providers
+}
+
+// SetResampleInterval makes the iterator return candlesticks of the supplied resample interval, by resampling the
+// candlesticks of the iterator's candlestick interval on the fly (see common.ResampleCandlesticks). It's useful for
+// candlestick intervals that the provider doesn't support, e.g. 2h candlesticks from 1h ones.
+//
+// The start time is normalized to the resample interval, and startFromNext moves it by one resample interval. Must be
+// called before Next().
+//
+// * Fails with ErrUnsupportedCandlestickInterval if the resample interval is not a multiple of the candlestick interval.
+func (it *Impl) SetResampleInterval(resampleInterval time.Duration) error {
+	if it.hasStarted {
+		panic("SetResampleInterval() cannot be called after Next() is called")
+	}
+	if common.IntervalToSeconds(resampleInterval) == 0 || resampleInterval%it.candlestickInterval != 0 {
+		return fmt.Errorf("%w: %v is not a multiple of %v", common.ErrUnsupportedCandlestickInterval, resampleInterval, it.candlestickInterval)
+	}
+	it.resampleInterval = resampleInterval
+	if resampleInterval == it.candlestickInterval {
+		it.resampleInterval = 0
+	}
+	it.lastTs = it.calculateLastTs()
+	return nil
+}
+
 // SetStartFromNext moves the startTime to one candlestickInterval in the future. This is useful when the caller
 // has already consumed the "startTime" candlestick and has saved this time in their state, so they want to start
 // consuming from the next time.
@@ -97,6 +230,72 @@ func (it *Impl) SetStartFromNext(b bool) {
 	it.lastTs = it.calculateLastTs()
 }
 
+// SetStartAtOrBefore makes the iterator start at the candlestick that contains the startTime, i.e. at the previous
+// candlestick boundary if the startTime is not on one (see common.Anchor.Floor), rather than at the next one (see
+// common.Anchor.Normalize). E.g. for 5m candlesticks, a startTime of 01:42:24 starts at the 01:40 candlestick rather
+// than at the 01:45 one. If startFromNext is also set, the iterator starts at the candlestick after that one.
+func (it *Impl) SetStartAtOrBefore(b bool) {
+	if it.hasStarted {
+		panic("SetStartAtOrBefore() cannot be called after Next() is called")
+	}
+	it.startAtOrBefore = b
+	it.lastTs = it.calculateLastTs()
+}
+
+// SetFlatHoles makes the iterator return candlesticks that were patched in to fill holes (i.e. Synthetic ones) as flat
+// candlesticks at the previous candlestick's close price, rather than as clones of the next candlestick. A leading
+// synthetic candlestick, which has no previous candlestick, is returned as is.
+func (it *Impl) SetFlatHoles(b bool) {
+	it.flatHoles = b
+}
+
+// SetMaxConsecutiveHoles makes Next fail with ErrTooManyConsecutiveHoles instead of returning a run of more than the
+// supplied number of consecutive Synthetic candlesticks (e.g. patched in during an exchange's maintenance halt), so
+// that fabricated data isn't mistaken for real data. The rest of the run is skipped, so the next call to Next resumes
+// with the first real candlestick after it. Zero (default) means that there's no limit.
+func (it *Impl) SetMaxConsecutiveHoles(maxConsecutiveHoles int) {
+	it.maxConsecutiveHoles = maxConsecutiveHoles
+}
+
+// SetCloseTimestamps makes the iterator set the CloseTimestamp of the candlesticks it returns (see
+// common.CloseTimestamp).
+func (it *Impl) SetCloseTimestamps(b bool) {
+	it.closeTimestamps = b
+}
+
+// SetPriceDecimals makes the iterator round the prices of the candlesticks it returns to the supplied number of
+// decimals (see common.Candlestick.RoundPrices), e.g. to the market's price precision. Candlesticks are cached as the
+// exchange returned them. Negative decimals (default) disable rounding.
+func (it *Impl) SetPriceDecimals(decimals int) {
+	it.priceDecimals = decimals
+}
+
+// SetFinalOnly makes the iterator drop candlesticks that may not be final yet, i.e. those that closed less than the
+// provider's patience ago, even if the exchange returned them. They're not put in the cache either. Next fails with
+// ErrNoNewTicksYet instead of returning them.
+func (it *Impl) SetFinalOnly(b bool) {
+	it.finalOnly = b
+}
+
+// SetEndTime makes the iterator stop at the given time (exclusive), i.e. once the next candlestick would start at or
+// after it, Next fails with ErrIterationComplete rather than requesting more candlesticks. The zero time (default)
+// means that there's no end time.
+func (it *Impl) SetEndTime(endTime time.Time) {
+	it.endTime = endTime
+}
+
+// SetObserver makes the iterator notify the supplied observer of its requests to exchanges and of its cache lookups,
+// e.g. to expose them as metrics.
+func (it *Impl) SetObserver(observer common.Observer) {
+	it.observer = observer
+}
+
+// SetMaxCandles makes Next fail with ErrMaxCandlesReached after returning the supplied number of candlesticks, as a
+// safety limit against runaway loops hammering the exchange. Zero (default) means that there's no limit.
+func (it *Impl) SetMaxCandles(maxCandles int) {
+	it.maxCandles = maxCandles
+}
+
 // Next is the "Next" iterator function, providing the next available Candlestick.
 //
 // It can fail for many reasons because it depends on requesting to an exchange, which means it could fail if the
@@ -104,34 +303,158 @@ func (it *Impl) SetStartFromNext(b bool) {
 //
 // Some common failure reasons:
 //
+// - ErrIterationComplete: the end time set with SetEndTime was reached. This is not a failure.
+// - ErrMaxCandlesReached: the limit set with SetMaxCandles was reached.
 // - ErrNoNewTicksYet: timestamp is already in the present.
 // - ErrExchangeReturnedNoTicks: exchange got the request and returned no results.
+// - ErrDataTooFarBack: the requested time is older than the exchange's MaxHistoryDepth.
 func (it *Impl) Next() (common.Candlestick, error) {
+	if it.maxCandles > 0 && it.returnedCandles >= it.maxCandles {
+		return common.Candlestick{}, common.ErrMaxCandlesReached
+	}
+	candlestick, err := it.nextResampled()
+	if err != nil {
+		return candlestick, err
+	}
+	it.returnedCandles++
+	if it.closeTimestamps {
+		interval := it.candlestickInterval
+		if it.resampleInterval != 0 {
+			interval = it.resampleInterval
+		}
+		candlestick.CloseTimestamp = it.anchor().CloseTimestamp(candlestick.Timestamp, interval)
+	}
+	return candlestick.RoundPrices(it.priceDecimals), nil
+}
+
+func (it *Impl) nextResampled() (common.Candlestick, error) {
+	if it.resampleInterval == 0 {
+		return it.next()
+	}
+
+	// Candlesticks of a group are kept if the iterator fails halfway, so that they're not lost when retrying.
+	for len(it.pending) == 0 || len(it.pending) < it.resampleGroupSize(it.pending[0].Timestamp) {
+		candlestick, err := it.next()
+		if err != nil {
+			return common.Candlestick{}, err
+		}
+		it.pending = append(it.pending, candlestick)
+	}
+	resampled := common.ResampleStampedCandlesticks(it.pending, it.candlestickInterval, it.resampleInterval, it.anchor(), common.TimestampSemanticsOf(it.candlestickProvider))
+	it.pending = nil
+	if len(resampled) == 0 {
+		return common.Candlestick{}, fmt.Errorf("%w: could not resample candlesticks to %v", common.ErrExchangeReturnedOutOfSyncTick, it.resampleInterval)
+	}
+	return resampled[0], nil
+}
+
+// resampleGroupSize returns how many candlesticks make up the resampled candlestick that the one at the supplied
+// timestamp belongs to, which may vary, e.g. for calendar months.
+func (it *Impl) resampleGroupSize(timestamp int) int {
+	anchor := it.anchor()
+	if common.TimestampSemanticsOf(it.candlestickProvider) == common.CloseStamped {
+		timestamp = anchor.Add(timestamp, it.candlestickInterval, -1)
+	}
+	groupTs := int(anchor.Floor(time.Unix(int64(timestamp), 0), it.resampleInterval).Unix())
+	return (anchor.CloseTimestamp(groupTs, it.resampleInterval) - groupTs) / common.IntervalToSeconds(it.candlestickInterval)
+}
+
+func (it *Impl) next() (common.Candlestick, error) {
+	candlestick, err := it.nextCandlestick()
+	if err != nil {
+		return candlestick, err
+	}
+	if err := it.checkConsecutiveHoles(candlestick); err != nil {
+		return common.Candlestick{}, err
+	}
+	if !it.flatHoles {
+		return candlestick, nil
+	}
+	if candlestick.Synthetic && it.hasLastClose {
+		candlestick.OpenPrice = it.lastClose
+		candlestick.ClosePrice = it.lastClose
+		candlestick.LowestPrice = it.lastClose
+		candlestick.HighestPrice = it.lastClose
+	}
+	it.lastClose = candlestick.ClosePrice
+	it.hasLastClose = true
+	return candlestick, nil
+}
+
+// checkConsecutiveHoles fails with ErrTooManyConsecutiveHoles if the supplied candlestick is Synthetic, and the run
+// of Synthetic candlesticks it belongs to (as far as it's known, i.e. those returned before it and those buffered
+// after it) is longer than SetMaxConsecutiveHoles allows. The buffered rest of the run is skipped.
+func (it *Impl) checkConsecutiveHoles(candlestick common.Candlestick) error {
+	if !candlestick.Synthetic {
+		it.consecutiveHoles = 0
+		return nil
+	}
+	it.consecutiveHoles++
+	if it.maxConsecutiveHoles <= 0 {
+		return nil
+	}
+	buffered := 0
+	for buffered < len(it.candlesticks) && it.candlesticks[buffered].Synthetic {
+		buffered++
+	}
+	if it.consecutiveHoles+buffered <= it.maxConsecutiveHoles {
+		return nil
+	}
+	first := it.anchor().Add(candlestick.Timestamp, it.candlestickInterval, 1-it.consecutiveHoles)
+	if buffered > 0 {
+		it.lastTs = it.candlesticks[buffered-1].Timestamp
+		it.candlesticks = it.candlesticks[buffered:]
+		it.consecutiveHoles += buffered
+	}
+	return fmt.Errorf("%w: %v consecutive synthetic candlesticks from %v to %v (max %v)", common.ErrTooManyConsecutiveHoles, it.consecutiveHoles, time.Unix(int64(first), 0).UTC().Format(time.RFC3339), time.Unix(int64(it.lastTs), 0).UTC().Format(time.RFC3339), it.maxConsecutiveHoles)
+}
+
+func (it *Impl) nextCandlestick() (common.Candlestick, error) {
 	it.hasStarted = true
+	it.lastSource = SourceNone
+	it.lastProvider = ""
+
+	if !it.endTime.IsZero() && !it.nextTime().Before(it.endTime) {
+		return common.Candlestick{}, common.ErrIterationComplete
+	}
 
 	// If the candlesticks buffer is empty, try to get candlesticks from the cache.
 	if len(it.candlesticks) == 0 && it.candlestickCache != nil {
 		ticks, err := it.candlestickCache.Get(it.metric, it.nextISO8601())
+		it.observer.ObserveCacheLookup(it.candlestickProvider.Name(), it.candlestickInterval, err == nil)
 		if err == nil {
 			it.candlesticks = ticks
+			it.candlesticksSource = SourceCache
+			it.candlesticksBy = ""
 		}
 	}
 
 	// If the ticks buffer isn't empty (cache hit), use it.
 	if len(it.candlesticks) > 0 {
+		if !it.isFinal(it.candlesticks[0]) {
+			it.candlesticks = []common.Candlestick{}
+			return common.Candlestick{}, common.ErrNoNewTicksYet
+		}
 		candlestick := it.candlesticks[0]
 		it.candlesticks = it.candlesticks[1:]
 		it.lastTs = candlestick.Timestamp
+		it.lastSource = it.candlesticksSource
+		it.lastProvider = it.candlesticksBy
 		return candlestick, nil
 	}
 
 	// If we reach here, before asking the exchange, let's see if it's too early to have new values.
-	if it.nextTime().After(it.timeNowFunc().Add(-it.candlestickProvider.Patience() - it.candlestickInterval)) {
+	if it.isTooEarly(it.nextTs()) {
 		return common.Candlestick{}, common.ErrNoNewTicksYet
 	}
 
+	// Don't bother asking the exchange for candlesticks it no longer serves.
+	if err := common.CheckHistoryDepth(it.candlestickProvider, it.nextTime(), it.timeNowFunc()); err != nil {
+		return common.Candlestick{}, err
+	}
+
 	// If we reach here, the buffer was empty and the cache was empty too. Last chance: try the exchange.
-	candlesticks, err := it.candlestickProvider.RequestCandlesticks(it.marketSource, it.nextTime(), it.candlestickInterval)
+	candlesticks, providerName, err := it.requestCandlesticks(it.nextTime())
 	if err != nil {
 		return common.Candlestick{}, err
 	}
@@ -150,27 +473,60 @@ func (it *Impl) Next() (common.Candlestick, error) {
 		return common.Candlestick{}, fmt.Errorf("%w: expected %v but got %v", common.ErrExchangeReturnedOutOfSyncTick, expected, actual)
 	}
 
-	// Put in the cache for future uses.
-	if it.candlestickCache != nil {
-		if err := it.candlestickCache.Put(it.metric, candlesticks); err != nil && err != cache.ErrCacheNotConfiguredForCandlestickInterval {
-			log.Info().Msgf("IteratorImpl.Next: ignoring error putting into cache: %v\n", err)
-		}
+	// If configured, drop the candlesticks that may not be final yet.
+	candlesticks = it.pruneNonFinalCandlesticks(candlesticks)
+	if len(candlesticks) == 0 {
+		return common.Candlestick{}, common.ErrNoNewTicksYet
 	}
 
+	// Put in the cache for future uses.
+	it.putInCache(candlesticks, providerName)
+
+	// If configured, request consecutive pages until the lookahead window is filled.
+	candlesticks = it.fillLookahead(candlesticks, providerName)
+
 	// Also put in the buffer, except for the first candlestick.
 	candlestick := candlesticks[0]
 	it.candlesticks = candlesticks[1:]
+	it.candlesticksSource = SourceNetwork
+	it.candlesticksBy = providerName
 	it.lastTs = candlestick.Timestamp
+	it.lastSource = SourceNetwork
+	it.lastProvider = providerName
 
 	// Return the first candlestick from exchange request.
 	return candlestick, nil
 }
 
+// LastSource returns where the candlestick returned by the last call to Next() (or Scan()) came from. Candlesticks
+// buffered from an exchange request count as SourceNetwork, even if they are returned in later calls.
+func (it *Impl) LastSource() Source {
+	return it.lastSource
+}
+
+// LastProvider returns the name of the provider that served the candlestick returned by the last call to Next() (or
+// Scan()), which may be a fallback provider. It's empty if the candlestick was served by the cache, or if Next() failed.
+func (it *Impl) LastProvider() string {
+	return it.lastProvider
+}
+
+// Stats returns the Stats of the iterator's requests to its provider and fallback providers so far, e.g. to assert
+// that N candlesticks were fetched in M requests. Candlesticks served by the cache don't count. RequestsMade counts
+// calls to the providers, each of which may take several HTTP requests (e.g. retries); BytesReceived is only known for
+// providers that implement common.StatsProvider, and includes other iterators' requests made to the same provider
+// concurrently.
+func (it *Impl) Stats() common.Stats {
+	return it.stats
+}
+
 // Scan is the Scanner interface implementation. Returns true if the scanning happened without errors. If it returns
-// false, the error is available on iter.Error().
+// false, the error is available on iter.Error(), which is nil if the end time set with SetEndTime was reached.
 func (it *Impl) Scan(candlestick *common.Candlestick) bool {
 	cs, err := it.Next()
 	it.lastErr = err
+	if errors.Is(err, common.ErrIterationComplete) {
+		it.lastErr = nil
+	}
 	*candlestick = cs
 	return err == nil
 }
@@ -180,6 +536,152 @@ func (it *Impl) Error() error {
 	return it.lastErr
 }
 
+// requestCandlesticks requests candlesticks to the provider, and to the fallback providers in order if it fails with an
+// error worth falling back on. It returns the name of the provider that served the candlesticks. If all providers
+// fail, the provider's error is returned.
+func (it *Impl) requestCandlesticks(startTime time.Time) ([]common.Candlestick, string, error) {
+	requestStart, bytesBefore := time.Now(), bytesReceived(it.candlestickProvider)
+	candlesticks, err := it.requestProviderCandlesticks(startTime)
+	it.recordRequest(it.candlestickProvider, time.Since(requestStart), bytesReceived(it.candlestickProvider)-bytesBefore, candlesticks, err)
+	if err == nil || !shouldFallback(err) {
+		return candlesticks, it.candlestickProvider.Name(), err
+	}
+	for _, provider := range it.fallbackProviders {
+		marketSource := it.marketSource
+		marketSource.Provider = provider.Name()
+		requestStart, bytesBefore := time.Now(), bytesReceived(provider)
+		fallbackCandlesticks, fallbackErr := provider.RequestCandlesticks(marketSource, startTime, it.candlestickInterval)
+		it.recordRequest(provider, time.Since(requestStart), bytesReceived(provider)-bytesBefore, fallbackCandlesticks, fallbackErr)
+		if fallbackErr == nil {
+			return fallbackCandlesticks, provider.Name(), nil
+		}
+	}
+	return nil, it.candlestickProvider.Name(), err
+}
+
+// recordRequest notifies the observer of a request to the provider, and adds it to the iterator's Stats.
+func (it *Impl) recordRequest(provider common.CandlestickProvider, latency time.Duration, bytes int64, candlesticks []common.Candlestick, err error) {
+	it.observer.ObserveRequest(provider.Name(), it.candlestickInterval, latency, err)
+	stats := common.Stats{RequestsMade: 1, BytesReceived: bytes, TotalLatency: latency}
+	if err == nil {
+		stats.CandlesticksReceived = len(candlesticks)
+	}
+	it.stats = it.stats.Add(stats)
+}
+
+// bytesReceived returns how many bytes the provider received so far, or zero if it doesn't keep Stats.
+func bytesReceived(provider common.CandlestickProvider) int64 {
+	if statsProvider, ok := provider.(common.StatsProvider); ok {
+		return statsProvider.Stats().BytesReceived
+	}
+	return 0
+}
+
+func shouldFallback(err error) bool {
+	if errors.Is(err, common.ErrRateLimit) || errors.Is(err, common.ErrExecutingRequest) {
+		return true
+	}
+	var candleReqErr common.CandleReqError
+	return errors.As(err, &candleReqErr) && !candleReqErr.IsNotRetryable
+}
+
+// requestProviderCandlesticks requests candlesticks to the provider. If the provider paginates by cursor, the cursor
+// returned by the previous request is passed back, as long as the supplied startTime is the one that follows that
+// request.
+func (it *Impl) requestProviderCandlesticks(startTime time.Time) ([]common.Candlestick, error) {
+	if endTimeProvider, ok := it.candlestickProvider.(common.EndTimeCandlestickProvider); ok && !it.endTime.IsZero() {
+		return endTimeProvider.RequestCandlesticksUntil(it.marketSource, startTime, it.pageEndTime(startTime), it.candlestickInterval)
+	}
+
+	cursorProvider, ok := it.candlestickProvider.(common.CursorCandlestickProvider)
+	if !ok {
+		return it.candlestickProvider.RequestCandlesticks(it.marketSource, startTime, it.candlestickInterval)
+	}
+
+	cursor := ""
+	if it.cursor != "" && it.cursorTs == int(startTime.Unix()) {
+		cursor = it.cursor
+	}
+	candlesticks, nextCursor, err := cursorProvider.RequestCandlesticksWithCursor(it.marketSource, startTime, it.candlestickInterval, cursor)
+	it.cursor = ""
+	if err != nil || len(candlesticks) == 0 {
+		return candlesticks, err
+	}
+	it.cursor = nextCursor
+	it.cursorTs = it.anchor().Add(candlesticks[len(candlesticks)-1].Timestamp, it.candlestickInterval, 1)
+	return candlesticks, nil
+}
+
+// pageEndTime returns the end time of the page starting at startTime: the iterator's end time, unless the provider
+// returns fewer candlesticks per request, in which case the page ends after that many candlesticks. It's never before
+// startTime.
+func (it *Impl) pageEndTime(startTime time.Time) time.Time {
+	endTime := it.endTime
+	if maxCandles := common.MaxCandlesPerRequest(it.candlestickProvider); maxCandles > 0 {
+		pageEndTs := it.anchor().Add(int(startTime.Unix()), it.candlestickInterval, maxCandles)
+		if pageEndTime := time.Unix(int64(pageEndTs), 0); pageEndTime.Before(endTime) {
+			endTime = pageEndTime
+		}
+	}
+	if endTime.Before(startTime) {
+		return startTime
+	}
+	return endTime
+}
+
+// putInCache stores the supplied candlesticks in the cache, except for those that may not be final yet (e.g. the
+// current candlestick, which may still change), regardless of SetFinalOnly, so that they're requested again later.
+// Candlesticks served by a fallback provider are not cached, as the cache entry belongs to the iterator's provider.
+func (it *Impl) putInCache(candlesticks []common.Candlestick, providerName string) {
+	if it.candlestickCache == nil || providerName != it.candlestickProvider.Name() {
+		return
+	}
+	candlesticks = common.FinalAnchoredCandlesticks(candlesticks, it.candlestickInterval, common.PatienceFor(it.candlestickProvider, it.candlestickInterval), it.timeNowFunc(), it.anchor())
+	if len(candlesticks) == 0 {
+		return
+	}
+	if err := it.candlestickCache.Put(it.metric, candlesticks); err != nil && err != cache.ErrCacheNotConfiguredForCandlestickInterval {
+		log.Info().Msgf("IteratorImpl.Next: ignoring error putting into cache: %v\n", err)
+	}
+}
+
+// fillLookahead requests pages following the supplied candlesticks until there are at least it.lookahead of them, or
+// until the end time set with SetEndTime.
+// Errors are not returned, because the supplied candlesticks are still valid; they'll surface on a later Next(). It
+// also stops if a page is served by a different provider than the supplied one, as buffered candlesticks share it.
+func (it *Impl) fillLookahead(candlesticks []common.Candlestick, providerName string) []common.Candlestick {
+	for len(candlesticks) < it.lookahead {
+		nextTs := it.anchor().Add(candlesticks[len(candlesticks)-1].Timestamp, it.candlestickInterval, 1)
+		nextTime := time.Unix(int64(nextTs), 0)
+		if !it.endTime.IsZero() && !nextTime.Before(it.endTime) {
+			break
+		}
+		if it.isTooEarly(nextTs) {
+			break
+		}
+		page, pageProviderName, err := it.requestCandlesticks(nextTime)
+		if err != nil || pageProviderName != providerName {
+			break
+		}
+		for len(page) > 0 && page[0].Timestamp < nextTs {
+			page = page[1:]
+		}
+		if page = it.pruneNonFinalCandlesticks(page); len(page) == 0 || page[0].Timestamp != nextTs {
+			break
+		}
+		it.putInCache(page, pageProviderName)
+		candlesticks = append(candlesticks, page...)
+	}
+	return candlesticks
+}
+
+// isTooEarly returns true if the candlestick at the supplied timestamp hasn't closed (at the provider's next boundary,
+// e.g. at the end of a calendar month) at least the provider's patience ago, so it may not be available yet.
+func (it *Impl) isTooEarly(timestamp int) bool {
+	closeTime := time.Unix(int64(it.anchor().Add(timestamp, it.candlestickInterval, 1)), 0)
+	return closeTime.After(it.timeNowFunc().Add(-common.PatienceFor(it.candlestickProvider, it.candlestickInterval)))
+}
+
 func (it *Impl) nextISO8601() common.ISO8601 {
 	return common.ISO8601(it.nextTime().Format(time.RFC3339))
 }
@@ -189,7 +691,7 @@ func (it *Impl) nextTime() time.Time {
 }
 
 func (it *Impl) nextTs() int {
-	return it.lastTs + int(it.candlestickInterval/time.Second)
+	return it.anchor().Add(it.lastTs, it.candlestickInterval, 1)
 }
 
 func (it *Impl) pruneOlderCandlesticks(candlesticks []common.Candlestick) []common.Candlestick {
@@ -201,3 +703,19 @@ func (it *Impl) pruneOlderCandlesticks(candlesticks []common.Candlestick) []comm
 	}
 	return candlesticks
 }
+
+func (it *Impl) isFinal(candlestick common.Candlestick) bool {
+	if !it.finalOnly {
+		return true
+	}
+	return len(common.FinalAnchoredCandlesticks([]common.Candlestick{candlestick}, it.candlestickInterval, common.PatienceFor(it.candlestickProvider, it.candlestickInterval), it.timeNowFunc(), it.anchor())) == 1
+}
+
+func (it *Impl) pruneNonFinalCandlesticks(candlesticks []common.Candlestick) []common.Candlestick {
+	for i, candlestick := range candlesticks {
+		if !it.isFinal(candlestick) {
+			return candlesticks[:i]
+		}
+	}
+	return candlesticks
+}
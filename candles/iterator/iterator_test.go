@@ -288,17 +288,22 @@ func TestTickIteratorUsesCache(t *testing.T) {
 		testCandlestickProvider1,
 	)
 	it1.SetTimeNowFunc(func() time.Time { return tp("2022-01-03 00:00:00") })
+	require.Equal(t, SourceNone, it1.LastSource())
 	cs, err := it1.Next()
 	require.Nil(t, err)
 	require.Equal(t, cstick1, cs)
+	require.Equal(t, SourceNetwork, it1.LastSource())
 	cs, err = it1.Next()
 	require.Nil(t, err)
 	require.Equal(t, cstick2, cs)
+	require.Equal(t, SourceNetwork, it1.LastSource())
 	cs, err = it1.Next()
 	require.Nil(t, err)
 	require.Equal(t, cstick3, cs)
+	require.Equal(t, SourceNetwork, it1.LastSource())
 	_, err = it1.Next()
 	require.Equal(t, common.ErrOutOfCandlesticks, err)
+	require.Equal(t, SourceNone, it1.LastSource())
 
 	require.Len(t, testCandlestickProvider1.calls, 2)
 
@@ -314,12 +319,15 @@ func TestTickIteratorUsesCache(t *testing.T) {
 	cs, err = it2.Next()
 	require.Nil(t, err)
 	require.Equal(t, cstick1, cs)
+	require.Equal(t, SourceCache, it2.LastSource())
 	cs, err = it2.Next()
 	require.Nil(t, err)
 	require.Equal(t, cstick2, cs)
+	require.Equal(t, SourceCache, it2.LastSource())
 	cs, err = it2.Next()
 	require.Nil(t, err)
 	require.Equal(t, cstick3, cs)
+	require.Equal(t, SourceCache, it2.LastSource())
 	_, err = it2.Next()
 	require.Equal(t, common.ErrOutOfCandlesticks, err)
 
@@ -362,6 +370,36 @@ func TestScannerInterface(t *testing.T) {
 	require.ErrorIs(t, it.Error(), common.ErrOutOfCandlesticks)
 }
 
+func TestIteratorEndTime(t *testing.T) {
+	msBTCUSDT := common.MarketSource{
+		Type:       common.COIN,
+		Provider:   "BINANCE",
+		BaseAsset:  "BTC",
+		QuoteAsset: "USDT",
+	}
+	cstick1 := common.Candlestick{Timestamp: tInt("2020-01-02 00:00:00"), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+	cstick2 := common.Candlestick{Timestamp: tInt("2020-01-02 00:01:00"), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+	cstick3 := common.Candlestick{Timestamp: tInt("2020-01-02 00:02:00"), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+
+	testCandlestickProvider := newTestCandlestickProvider([]testCandlestickProviderResponse{
+		{candlesticks: []common.Candlestick{cstick1, cstick2, cstick3}, err: nil},
+	})
+	it, _ := NewIterator(msBTCUSDT, tp("2020-01-02 00:00:00"), time.Minute, nil, testCandlestickProvider)
+	it.SetEndTime(tp("2020-01-02 00:02:00"))
+
+	// The end time is exclusive, so the buffered cstick3 is not returned.
+	var cs common.Candlestick
+	require.True(t, it.Scan(&cs))
+	require.Equal(t, cstick1, cs)
+	require.True(t, it.Scan(&cs))
+	require.Equal(t, cstick2, cs)
+	require.False(t, it.Scan(&cs))
+	require.Nil(t, it.Error())
+
+	_, err := it.Next()
+	require.ErrorIs(t, err, common.ErrIterationComplete)
+}
+
 type response struct {
 	candlestick common.Candlestick
 	err         error
@@ -378,8 +416,9 @@ type call struct {
 }
 
 type testCandlestickProvider struct {
-	calls     []call
-	responses []testCandlestickProviderResponse
+	calls           []call
+	responses       []testCandlestickProviderResponse
+	maxHistoryDepth time.Duration
 }
 
 func newTestCandlestickProvider(responses []testCandlestickProviderResponse) *testCandlestickProvider {
@@ -392,8 +431,10 @@ func (p *testCandlestickProvider) RequestCandlesticks(marketSource common.Market
 	return resp.candlesticks, resp.err
 }
 
-func (p *testCandlestickProvider) Patience() time.Duration { return 0 * time.Second }
-func (p *testCandlestickProvider) Name() string            { return "TEST" }
+func (p *testCandlestickProvider) Patience() time.Duration             { return 0 * time.Second }
+func (p *testCandlestickProvider) MaxHistoryDepth() time.Duration      { return p.maxHistoryDepth }
+func (p *testCandlestickProvider) SupportedIntervals() []time.Duration { return nil }
+func (p *testCandlestickProvider) Name() string                        { return "TEST" }
 
 func tp(s string) time.Time {
 	t, _ := time.Parse("2006-01-02 15:04:05", s)
@@ -403,3 +444,895 @@ func tp(s string) time.Time {
 func tInt(s string) int {
 	return int(tp(s).Unix())
 }
+
+func TestIteratorFailsWhenDataTooFarBack(t *testing.T) {
+	msBTCUSDT := common.MarketSource{
+		Type:       common.COIN,
+		Provider:   "BINANCE",
+		BaseAsset:  "BTC",
+		QuoteAsset: "USDT",
+	}
+	provider := newTestCandlestickProvider(nil)
+	provider.maxHistoryDepth = 24 * time.Hour
+
+	it, _ := NewIterator(msBTCUSDT, tp("2020-01-02 00:00:00"), time.Minute, nil, provider)
+	it.SetTimeNowFunc(func() time.Time { return tp("2020-01-03 00:01:00") })
+
+	_, err := it.Next()
+	require.ErrorIs(t, err, common.ErrDataTooFarBack)
+	require.Len(t, provider.calls, 0)
+}
+
+func TestIteratorLookahead(t *testing.T) {
+	msBTCUSDT := common.MarketSource{
+		Type:       common.COIN,
+		Provider:   "BINANCE",
+		BaseAsset:  "BTC",
+		QuoteAsset: "USDT",
+	}
+	cstick1 := common.Candlestick{Timestamp: tInt("2020-01-02 00:00:00"), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+	cstick2 := common.Candlestick{Timestamp: tInt("2020-01-02 00:01:00"), OpenPrice: 1235, HighestPrice: 1235, LowestPrice: 1235, ClosePrice: 1235}
+	cstick3 := common.Candlestick{Timestamp: tInt("2020-01-02 00:02:00"), OpenPrice: 1236, HighestPrice: 1236, LowestPrice: 1236, ClosePrice: 1236}
+	cstick4 := common.Candlestick{Timestamp: tInt("2020-01-02 00:03:00"), OpenPrice: 1237, HighestPrice: 1237, LowestPrice: 1237, ClosePrice: 1237}
+
+	t.Run("fills the window with consecutive pages", func(t *testing.T) {
+		provider := newTestCandlestickProvider([]testCandlestickProviderResponse{
+			{candlesticks: []common.Candlestick{cstick1, cstick2}},
+			{candlesticks: []common.Candlestick{cstick3, cstick4}},
+		})
+		memoryCache := cache.NewMemoryCache(map[time.Duration]int{time.Minute: 128})
+		it, _ := NewIterator(msBTCUSDT, tp("2020-01-02 00:00:00"), time.Minute, memoryCache, provider)
+		it.SetTimeNowFunc(func() time.Time { return tp("2022-01-03 00:00:00") })
+		it.SetLookahead(3)
+
+		for _, expected := range []common.Candlestick{cstick1, cstick2, cstick3, cstick4} {
+			cs, err := it.Next()
+			require.Nil(t, err)
+			require.Equal(t, expected, cs)
+			require.Equal(t, SourceNetwork, it.LastSource())
+		}
+		require.Len(t, provider.calls, 2)
+		require.Equal(t, tp("2020-01-02 00:02:00"), provider.calls[1].startTime)
+
+		cached, err := memoryCache.Get(cache.Metric{Name: msBTCUSDT.String(), CandlestickInterval: time.Minute}, "2020-01-02T00:02:00Z")
+		require.Nil(t, err)
+		require.Equal(t, []common.Candlestick{cstick3, cstick4}, cached)
+	})
+
+	t.Run("stops at the present", func(t *testing.T) {
+		provider := newTestCandlestickProvider([]testCandlestickProviderResponse{
+			{candlesticks: []common.Candlestick{cstick1, cstick2}},
+		})
+		it, _ := NewIterator(msBTCUSDT, tp("2020-01-02 00:00:00"), time.Minute, nil, provider)
+		it.SetTimeNowFunc(func() time.Time { return tp("2020-01-02 00:02:30") })
+		it.SetLookahead(10)
+
+		cs, err := it.Next()
+		require.Nil(t, err)
+		require.Equal(t, cstick1, cs)
+		require.Len(t, provider.calls, 1)
+	})
+
+	t.Run("stops at the end time", func(t *testing.T) {
+		provider := newTestCandlestickProvider([]testCandlestickProviderResponse{
+			{candlesticks: []common.Candlestick{cstick1, cstick2}},
+			{candlesticks: []common.Candlestick{cstick3, cstick4}},
+		})
+		it, _ := NewIterator(msBTCUSDT, tp("2020-01-02 00:00:00"), time.Minute, nil, provider)
+		it.SetTimeNowFunc(func() time.Time { return tp("2022-01-03 00:00:00") })
+		it.SetEndTime(tp("2020-01-02 00:02:00"))
+		it.SetLookahead(10)
+
+		cs, err := it.Next()
+		require.Nil(t, err)
+		require.Equal(t, cstick1, cs)
+		require.Len(t, provider.calls, 1)
+	})
+
+	t.Run("keeps the first page on lookahead errors", func(t *testing.T) {
+		provider := newTestCandlestickProvider([]testCandlestickProviderResponse{
+			{candlesticks: []common.Candlestick{cstick1, cstick2}},
+			{err: common.ErrRateLimit},
+		})
+		it, _ := NewIterator(msBTCUSDT, tp("2020-01-02 00:00:00"), time.Minute, nil, provider)
+		it.SetTimeNowFunc(func() time.Time { return tp("2022-01-03 00:00:00") })
+		it.SetLookahead(10)
+
+		cs, err := it.Next()
+		require.Nil(t, err)
+		require.Equal(t, cstick1, cs)
+		cs, err = it.Next()
+		require.Nil(t, err)
+		require.Equal(t, cstick2, cs)
+		require.Len(t, provider.calls, 2)
+	})
+}
+
+type cursorCall struct {
+	startTime time.Time
+	cursor    string
+}
+
+type testCursorCandlestickProvider struct {
+	*testCandlestickProvider
+	cursorCalls []cursorCall
+	cursors     []string
+}
+
+func (p *testCursorCandlestickProvider) RequestCandlesticksWithCursor(marketSource common.MarketSource, startTime time.Time, candlestickInterval time.Duration, cursor string) ([]common.Candlestick, string, error) {
+	nextCursor := p.cursors[len(p.cursorCalls)]
+	p.cursorCalls = append(p.cursorCalls, cursorCall{startTime: startTime.UTC(), cursor: cursor})
+	candlesticks, err := p.RequestCandlesticks(marketSource, startTime, candlestickInterval)
+	return candlesticks, nextCursor, err
+}
+
+func TestIteratorPassesBackCursor(t *testing.T) {
+	msBTCUSDT := common.MarketSource{
+		Type:       common.COIN,
+		Provider:   "KRAKEN",
+		BaseAsset:  "BTC",
+		QuoteAsset: "USDT",
+	}
+	cstick1 := common.Candlestick{Timestamp: tInt("2020-01-02 00:00:00"), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+	cstick2 := common.Candlestick{Timestamp: tInt("2020-01-02 00:01:00"), OpenPrice: 1235, HighestPrice: 1235, LowestPrice: 1235, ClosePrice: 1235}
+	cstick3 := common.Candlestick{Timestamp: tInt("2020-01-02 00:02:00"), OpenPrice: 1236, HighestPrice: 1236, LowestPrice: 1236, ClosePrice: 1236}
+
+	provider := &testCursorCandlestickProvider{
+		testCandlestickProvider: newTestCandlestickProvider([]testCandlestickProviderResponse{
+			{candlesticks: []common.Candlestick{cstick1}},
+			{candlesticks: []common.Candlestick{cstick2}},
+			{candlesticks: []common.Candlestick{cstick3}},
+		}),
+		cursors: []string{"cursor1", "", "cursor3"},
+	}
+	it, _ := NewIterator(msBTCUSDT, tp("2020-01-02 00:00:00"), time.Minute, nil, provider)
+	it.SetTimeNowFunc(func() time.Time { return tp("2022-01-03 00:00:00") })
+
+	for _, expected := range []common.Candlestick{cstick1, cstick2, cstick3} {
+		cs, err := it.Next()
+		require.Nil(t, err)
+		require.Equal(t, expected, cs)
+	}
+	require.Equal(t, []cursorCall{
+		{startTime: tp("2020-01-02 00:00:00"), cursor: ""},
+		{startTime: tp("2020-01-02 00:01:00"), cursor: "cursor1"},
+		{startTime: tp("2020-01-02 00:02:00"), cursor: ""},
+	}, provider.cursorCalls)
+}
+
+func TestIteratorIgnoresCursorAfterCacheHit(t *testing.T) {
+	msBTCUSDT := common.MarketSource{
+		Type:       common.COIN,
+		Provider:   "KRAKEN",
+		BaseAsset:  "BTC",
+		QuoteAsset: "USDT",
+	}
+	cstick1 := common.Candlestick{Timestamp: tInt("2020-01-02 00:00:00"), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+	cstick2 := common.Candlestick{Timestamp: tInt("2020-01-02 00:01:00"), OpenPrice: 1235, HighestPrice: 1235, LowestPrice: 1235, ClosePrice: 1235}
+	cstick3 := common.Candlestick{Timestamp: tInt("2020-01-02 00:02:00"), OpenPrice: 1236, HighestPrice: 1236, LowestPrice: 1236, ClosePrice: 1236}
+
+	memoryCache := cache.NewMemoryCache(map[time.Duration]int{time.Minute: 128})
+	require.Nil(t, memoryCache.Put(cache.Metric{Name: msBTCUSDT.String(), CandlestickInterval: time.Minute}, []common.Candlestick{cstick2}))
+
+	provider := &testCursorCandlestickProvider{
+		testCandlestickProvider: newTestCandlestickProvider([]testCandlestickProviderResponse{
+			{candlesticks: []common.Candlestick{cstick1}},
+			{candlesticks: []common.Candlestick{cstick3}},
+		}),
+		cursors: []string{"cursor1", ""},
+	}
+	it, _ := NewIterator(msBTCUSDT, tp("2020-01-02 00:00:00"), time.Minute, memoryCache, provider)
+	it.SetTimeNowFunc(func() time.Time { return tp("2022-01-03 00:00:00") })
+
+	for _, expected := range []common.Candlestick{cstick1, cstick2, cstick3} {
+		cs, err := it.Next()
+		require.Nil(t, err)
+		require.Equal(t, expected, cs)
+	}
+	require.Equal(t, []cursorCall{
+		{startTime: tp("2020-01-02 00:00:00"), cursor: ""},
+		{startTime: tp("2020-01-02 00:02:00"), cursor: ""},
+	}, provider.cursorCalls)
+}
+
+func TestNewIteratorRejectsInvalidInterval(t *testing.T) {
+	msBTCUSDT := common.MarketSource{
+		Type:       common.COIN,
+		Provider:   "BINANCE",
+		BaseAsset:  "BTC",
+		QuoteAsset: "USDT",
+	}
+	for _, interval := range []time.Duration{0, -time.Minute, 1500 * time.Millisecond} {
+		_, err := NewIterator(msBTCUSDT, tp("2020-01-02 00:00:00"), interval, nil, newTestCandlestickProvider(nil))
+		require.ErrorIs(t, err, common.ErrUnsupportedCandlestickInterval)
+	}
+}
+
+type namedTestCandlestickProvider struct {
+	*testCandlestickProvider
+	name string
+}
+
+func (p namedTestCandlestickProvider) Name() string { return p.name }
+
+func TestIteratorFallbackProviders(t *testing.T) {
+	msBTCUSDT := common.MarketSource{
+		Type:       common.COIN,
+		Provider:   "TEST",
+		BaseAsset:  "BTC",
+		QuoteAsset: "USDT",
+	}
+	cstick1 := common.Candlestick{Timestamp: tInt("2020-01-02 00:00:00"), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+	rateLimitErr := common.CandleReqError{Kind: common.KindRateLimited, Err: common.ErrRateLimit}
+	invalidPairErr := common.CandleReqError{IsNotRetryable: true, Kind: common.KindInvalidPair, Err: common.ErrInvalidMarketPair}
+
+	tss := []struct {
+		name              string
+		primary           []testCandlestickProviderResponse
+		fallback1         []testCandlestickProviderResponse
+		fallback2         []testCandlestickProviderResponse
+		expected          common.Candlestick
+		expectedErr       error
+		expectedProvider  string
+		expectedCallCount []int
+	}{
+		{
+			name:              "Primary succeeds",
+			primary:           []testCandlestickProviderResponse{{candlesticks: []common.Candlestick{cstick1}}},
+			expected:          cstick1,
+			expectedProvider:  "TEST",
+			expectedCallCount: []int{1, 0, 0},
+		},
+		{
+			name:              "Falls back on retryable errors",
+			primary:           []testCandlestickProviderResponse{{err: rateLimitErr}},
+			fallback1:         []testCandlestickProviderResponse{{err: rateLimitErr}},
+			fallback2:         []testCandlestickProviderResponse{{candlesticks: []common.Candlestick{cstick1}}},
+			expected:          cstick1,
+			expectedProvider:  "FALLBACK2",
+			expectedCallCount: []int{1, 1, 1},
+		},
+		{
+			name:              "Does not fall back on non-retryable errors",
+			primary:           []testCandlestickProviderResponse{{err: invalidPairErr}},
+			expectedErr:       common.ErrInvalidMarketPair,
+			expectedCallCount: []int{1, 0, 0},
+		},
+		{
+			name:              "Returns the primary's error if all fail",
+			primary:           []testCandlestickProviderResponse{{err: rateLimitErr}},
+			fallback1:         []testCandlestickProviderResponse{{err: invalidPairErr}},
+			fallback2:         []testCandlestickProviderResponse{{err: rateLimitErr}},
+			expectedErr:       common.ErrRateLimit,
+			expectedCallCount: []int{1, 1, 1},
+		},
+	}
+	for _, ts := range tss {
+		t.Run(ts.name, func(t *testing.T) {
+			primary := newTestCandlestickProvider(ts.primary)
+			fallback1 := namedTestCandlestickProvider{newTestCandlestickProvider(ts.fallback1), "FALLBACK1"}
+			fallback2 := namedTestCandlestickProvider{newTestCandlestickProvider(ts.fallback2), "FALLBACK2"}
+
+			it, _ := NewIterator(msBTCUSDT, tp("2020-01-02 00:00:00"), time.Minute, nil, primary)
+			it.SetTimeNowFunc(func() time.Time { return tp("2022-01-03 00:00:00") })
+			it.SetFallbackProviders(fallback1, fallback2)
+
+			cs, err := it.Next()
+			require.ErrorIs(t, err, ts.expectedErr)
+			require.Equal(t, ts.expected, cs)
+			require.Equal(t, ts.expectedProvider, it.LastProvider())
+			require.Equal(t, ts.expectedCallCount, []int{len(primary.calls), len(fallback1.calls), len(fallback2.calls)})
+			if len(fallback1.calls) > 0 {
+				require.Equal(t, "FALLBACK1", fallback1.calls[0].marketSource.Provider)
+			}
+		})
+	}
+}
+
+func TestIteratorDoesNotCacheFallbackCandlesticks(t *testing.T) {
+	msBTCUSDT := common.MarketSource{
+		Type:       common.COIN,
+		Provider:   "TEST",
+		BaseAsset:  "BTC",
+		QuoteAsset: "USDT",
+	}
+	memoryCache := cache.NewMemoryCache(map[time.Duration]int{time.Minute: 128})
+	cstick1 := common.Candlestick{Timestamp: tInt("2020-01-02 00:00:00"), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+	cstick2 := common.Candlestick{Timestamp: tInt("2020-01-02 00:00:00"), OpenPrice: 1235, HighestPrice: 1235, LowestPrice: 1235, ClosePrice: 1235}
+
+	primary := newTestCandlestickProvider([]testCandlestickProviderResponse{{err: common.CandleReqError{Kind: common.KindRateLimited, Err: common.ErrRateLimit}}})
+	fallback := namedTestCandlestickProvider{newTestCandlestickProvider([]testCandlestickProviderResponse{{candlesticks: []common.Candlestick{cstick1}}}), "FALLBACK"}
+	it, _ := NewIterator(msBTCUSDT, tp("2020-01-02 00:00:00"), time.Minute, memoryCache, primary)
+	it.SetTimeNowFunc(func() time.Time { return tp("2022-01-03 00:00:00") })
+	it.SetFallbackProviders(fallback)
+	cs, err := it.Next()
+	require.Nil(t, err)
+	require.Equal(t, cstick1, cs)
+	require.Equal(t, "FALLBACK", it.LastProvider())
+
+	// The fallback's candlestick wasn't cached under the primary's metric, so the primary is requested.
+	primary = newTestCandlestickProvider([]testCandlestickProviderResponse{{candlesticks: []common.Candlestick{cstick2}}})
+	it, _ = NewIterator(msBTCUSDT, tp("2020-01-02 00:00:00"), time.Minute, memoryCache, primary)
+	it.SetTimeNowFunc(func() time.Time { return tp("2022-01-03 00:00:00") })
+	cs, err = it.Next()
+	require.Nil(t, err)
+	require.Equal(t, cstick2, cs)
+	require.Equal(t, SourceNetwork, it.LastSource())
+	require.Len(t, primary.calls, 1)
+}
+
+func TestIteratorResampleKeepsPendingCandlesticksOnFailure(t *testing.T) {
+	msBTCUSDT := common.MarketSource{
+		Type:       common.COIN,
+		Provider:   "BINANCE",
+		BaseAsset:  "BTC",
+		QuoteAsset: "USDT",
+	}
+	cstick1 := common.Candlestick{Timestamp: tInt("2020-01-02 00:00:00"), OpenPrice: 1, HighestPrice: 2, LowestPrice: 1, ClosePrice: 2}
+	cstick2 := common.Candlestick{Timestamp: tInt("2020-01-02 00:01:00"), OpenPrice: 2, HighestPrice: 3, LowestPrice: 0.5, ClosePrice: 3}
+
+	provider := newTestCandlestickProvider([]testCandlestickProviderResponse{
+		{candlesticks: []common.Candlestick{cstick1}, err: nil},
+		{candlesticks: nil, err: common.ErrRateLimit},
+		{candlesticks: []common.Candlestick{cstick2}, err: nil},
+	})
+	it, _ := NewIterator(msBTCUSDT, tp("2020-01-02 00:00:00"), time.Minute, nil, provider)
+	require.ErrorIs(t, it.SetResampleInterval(90*time.Second), common.ErrUnsupportedCandlestickInterval)
+	require.Nil(t, it.SetResampleInterval(2*time.Minute))
+
+	_, err := it.Next()
+	require.ErrorIs(t, err, common.ErrRateLimit)
+
+	actual, err := it.Next()
+	require.Nil(t, err)
+	require.Equal(t, common.Candlestick{Timestamp: tInt("2020-01-02 00:00:00"), OpenPrice: 1, HighestPrice: 3, LowestPrice: 0.5, ClosePrice: 3}, actual)
+	require.Equal(t, []call{
+		{marketSource: msBTCUSDT, startTime: tp("2020-01-02 00:00:00")},
+		{marketSource: msBTCUSDT, startTime: tp("2020-01-02 00:01:00")},
+		{marketSource: msBTCUSDT, startTime: tp("2020-01-02 00:01:00")},
+	}, provider.calls)
+}
+
+type closeStampedTestCandlestickProvider struct {
+	*testCandlestickProvider
+}
+
+func (closeStampedTestCandlestickProvider) TimestampSemantics() common.TimestampSemantics {
+	return common.CloseStamped
+}
+
+func TestIteratorResamplesCloseStampedCandlesticks(t *testing.T) {
+	msBTCUSDT := common.MarketSource{
+		Type:       common.COIN,
+		Provider:   "BINANCE",
+		BaseAsset:  "BTC",
+		QuoteAsset: "USDT",
+	}
+	// Minutely candlesticks stamped at their close, i.e. the first one opened at 00:00.
+	cs := []common.Candlestick{
+		{Timestamp: tInt("2020-01-02 00:01:00"), OpenPrice: 1, HighestPrice: 2, LowestPrice: 1, ClosePrice: 2},
+		{Timestamp: tInt("2020-01-02 00:02:00"), OpenPrice: 2, HighestPrice: 3, LowestPrice: 0.5, ClosePrice: 3},
+		{Timestamp: tInt("2020-01-02 00:03:00"), OpenPrice: 3, HighestPrice: 4, LowestPrice: 3, ClosePrice: 4},
+		{Timestamp: tInt("2020-01-02 00:04:00"), OpenPrice: 4, HighestPrice: 4, LowestPrice: 2, ClosePrice: 2},
+	}
+	provider := closeStampedTestCandlestickProvider{newTestCandlestickProvider([]testCandlestickProviderResponse{{candlesticks: cs, err: nil}})}
+	it, _ := NewIterator(msBTCUSDT, tp("2020-01-02 00:00:00"), time.Minute, nil, provider)
+	require.Nil(t, it.SetResampleInterval(2*time.Minute))
+
+	actual, err := it.Next()
+	require.Nil(t, err)
+	require.Equal(t, common.Candlestick{Timestamp: tInt("2020-01-02 00:02:00"), OpenPrice: 1, HighestPrice: 3, LowestPrice: 0.5, ClosePrice: 3}, actual)
+	actual, err = it.Next()
+	require.Nil(t, err)
+	require.Equal(t, common.Candlestick{Timestamp: tInt("2020-01-02 00:04:00"), OpenPrice: 3, HighestPrice: 4, LowestPrice: 2, ClosePrice: 2}, actual)
+	require.Equal(t, []call{{marketSource: msBTCUSDT, startTime: tp("2020-01-02 00:01:00")}}, provider.calls)
+}
+
+type testEndTimeCandlestickProvider struct {
+	*testCandlestickProvider
+	endTimes []time.Time
+}
+
+func (p *testEndTimeCandlestickProvider) RequestCandlesticksUntil(marketSource common.MarketSource, startTime time.Time, endTime time.Time, candlestickInterval time.Duration) ([]common.Candlestick, error) {
+	p.endTimes = append(p.endTimes, endTime.UTC())
+	return p.RequestCandlesticks(marketSource, startTime, candlestickInterval)
+}
+
+func TestIteratorRequestsUntilEndTime(t *testing.T) {
+	msBTCUSDT := common.MarketSource{
+		Type:       common.COIN,
+		Provider:   "BINANCE",
+		BaseAsset:  "BTC",
+		QuoteAsset: "USDT",
+	}
+	cstick1 := common.Candlestick{Timestamp: tInt("2020-01-02 00:00:00"), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+
+	provider := &testEndTimeCandlestickProvider{testCandlestickProvider: newTestCandlestickProvider([]testCandlestickProviderResponse{
+		{candlesticks: []common.Candlestick{cstick1}, err: nil},
+		{candlesticks: []common.Candlestick{cstick1}, err: nil},
+	})}
+
+	it, _ := NewIterator(msBTCUSDT, tp("2020-01-02 00:00:00"), time.Minute, nil, provider)
+	_, err := it.Next()
+	require.Nil(t, err)
+	require.Len(t, provider.endTimes, 0)
+
+	it, _ = NewIterator(msBTCUSDT, tp("2020-01-02 00:00:00"), time.Minute, nil, provider)
+	it.SetEndTime(tp("2020-01-02 00:01:00"))
+	actual, err := it.Next()
+	require.Nil(t, err)
+	require.Equal(t, cstick1, actual)
+	require.Equal(t, []time.Time{tp("2020-01-02 00:01:00")}, provider.endTimes)
+
+	// Pages never end before they start, even past the iterator's end time.
+	require.Equal(t, tp("2020-01-02 00:05:00"), it.pageEndTime(tp("2020-01-02 00:05:00")))
+}
+
+func (p *testEndTimeCandlestickProvider) MaxCandlesPerRequest() int { return 2 }
+
+func TestIteratorPagesInMaxCandlesPerRequestStride(t *testing.T) {
+	msBTCUSDT := common.MarketSource{
+		Type:       common.COIN,
+		Provider:   "BINANCE",
+		BaseAsset:  "BTC",
+		QuoteAsset: "USDT",
+	}
+	cstick1 := common.Candlestick{Timestamp: tInt("2020-01-02 00:00:00"), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+	cstick2 := common.Candlestick{Timestamp: tInt("2020-01-02 00:01:00"), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+	cstick3 := common.Candlestick{Timestamp: tInt("2020-01-02 00:02:00"), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+
+	provider := &testEndTimeCandlestickProvider{testCandlestickProvider: newTestCandlestickProvider([]testCandlestickProviderResponse{
+		{candlesticks: []common.Candlestick{cstick1, cstick2}, err: nil},
+		{candlesticks: []common.Candlestick{cstick3}, err: nil},
+	})}
+
+	it, _ := NewIterator(msBTCUSDT, tp("2020-01-02 00:00:00"), time.Minute, nil, provider)
+	it.SetEndTime(tp("2020-01-02 00:03:00"))
+	actual := []common.Candlestick{}
+	var candlestick common.Candlestick
+	for it.Scan(&candlestick) {
+		actual = append(actual, candlestick)
+	}
+	require.Nil(t, it.Error())
+	require.Equal(t, []common.Candlestick{cstick1, cstick2, cstick3}, actual)
+	require.Equal(t, []time.Time{tp("2020-01-02 00:02:00"), tp("2020-01-02 00:03:00")}, provider.endTimes)
+}
+
+type anchoredTestCandlestickProvider struct {
+	*testCandlestickProvider
+	anchor common.Anchor
+}
+
+func (p anchoredTestCandlestickProvider) Anchor() common.Anchor { return p.anchor }
+
+func TestIteratorWeeklyCandlesticksFollowProviderWeekStart(t *testing.T) {
+	msBTCUSDT := common.MarketSource{
+		Type:       common.COIN,
+		Provider:   "BINANCE",
+		BaseAsset:  "BTC",
+		QuoteAsset: "USDT",
+	}
+	// 2021-01-02 is a Saturday, so the next Thursday-anchored weekly candlestick starts on 2021-01-07.
+	cstick := common.Candlestick{Timestamp: tInt("2021-01-07 00:00:00"), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+	provider := newTestCandlestickProvider([]testCandlestickProviderResponse{{candlesticks: []common.Candlestick{cstick}, err: nil}})
+	anchored := anchoredTestCandlestickProvider{provider, common.NewAnchor("TEST").WithWeekStart(time.Thursday)}
+
+	it, _ := NewIterator(msBTCUSDT, tp("2021-01-02 01:42:24"), 7*24*time.Hour, nil, anchored)
+	actual, err := it.Next()
+	require.Nil(t, err)
+	require.Equal(t, cstick, actual)
+	require.Equal(t, []call{{marketSource: msBTCUSDT, startTime: tp("2021-01-07 00:00:00")}}, provider.calls)
+}
+
+func TestIteratorMonthlyCandlesticksFollowCalendarMonths(t *testing.T) {
+	msBTCUSDT := common.MarketSource{
+		Type:       common.COIN,
+		Provider:   "BINANCE",
+		BaseAsset:  "BTC",
+		QuoteAsset: "USDT",
+	}
+	cs := []common.Candlestick{
+		{Timestamp: tInt("2021-02-01 00:00:00"), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234},
+		{Timestamp: tInt("2021-03-01 00:00:00"), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234},
+		{Timestamp: tInt("2021-04-01 00:00:00"), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234},
+	}
+	provider := newTestCandlestickProvider([]testCandlestickProviderResponse{{candlesticks: cs, err: nil}})
+	anchored := anchoredTestCandlestickProvider{provider, common.NewAnchor(common.BINANCE)}
+
+	it, _ := NewIterator(msBTCUSDT, tp("2021-01-15 00:00:00"), 30*24*time.Hour, nil, anchored)
+	it.SetCloseTimestamps(true)
+	for i := range cs {
+		actual, err := it.Next()
+		require.Nil(t, err)
+		require.Equal(t, cs[i].Timestamp, actual.Timestamp)
+	}
+	require.Equal(t, []call{{marketSource: msBTCUSDT, startTime: tp("2021-02-01 00:00:00")}}, provider.calls)
+}
+
+func TestIteratorFinalOnlyMonthlyCandlesticksCloseAtTheEndOfTheMonth(t *testing.T) {
+	msBTCUSDT := common.MarketSource{
+		Type:       common.COIN,
+		Provider:   "BINANCE",
+		BaseAsset:  "BTC",
+		QuoteAsset: "USDT",
+	}
+	cstick := common.Candlestick{Timestamp: tInt("2024-01-01 00:00:00"), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+	provider := newTestCandlestickProvider([]testCandlestickProviderResponse{{candlesticks: []common.Candlestick{cstick}, err: nil}})
+	anchored := anchoredTestCandlestickProvider{provider, common.NewAnchor(common.BINANCE)}
+
+	// January has 31 days, so on its 31st day its candlestick is still forming.
+	it, _ := NewIterator(msBTCUSDT, tp("2024-01-01 00:00:00"), 30*24*time.Hour, nil, anchored)
+	it.SetTimeNowFunc(func() time.Time { return tp("2024-01-31 12:00:00") })
+	it.SetFinalOnly(true)
+	_, err := it.Next()
+	require.ErrorIs(t, err, common.ErrNoNewTicksYet)
+}
+
+func TestIteratorRequestsMonthlyCandlesticksOnceTheMonthEnds(t *testing.T) {
+	msBTCUSDT := common.MarketSource{
+		Type:       common.COIN,
+		Provider:   "BINANCE",
+		BaseAsset:  "BTC",
+		QuoteAsset: "USDT",
+	}
+	february := common.Candlestick{Timestamp: tInt("2024-02-01 00:00:00"), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+	march := common.Candlestick{Timestamp: tInt("2024-03-01 00:00:00"), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+
+	// February 2024 has 29 days, so it's available on March 1st rather than 30 days after it started.
+	provider := newTestCandlestickProvider([]testCandlestickProviderResponse{{candlesticks: []common.Candlestick{february}, err: nil}})
+	it, _ := NewIterator(msBTCUSDT, tp("2024-02-01 00:00:00"), 30*24*time.Hour, nil, anchoredTestCandlestickProvider{provider, common.NewAnchor(common.BINANCE)})
+	it.SetTimeNowFunc(func() time.Time { return tp("2024-03-01 00:00:30") })
+	actual, err := it.Next()
+	require.Nil(t, err)
+	require.Equal(t, february, actual)
+
+	// March has 31 days, so it isn't requested on its 31st day.
+	provider = newTestCandlestickProvider([]testCandlestickProviderResponse{{candlesticks: []common.Candlestick{march}, err: nil}})
+	it, _ = NewIterator(msBTCUSDT, tp("2024-03-01 00:00:00"), 30*24*time.Hour, nil, anchoredTestCandlestickProvider{provider, common.NewAnchor(common.BINANCE)})
+	it.SetTimeNowFunc(func() time.Time { return tp("2024-03-31 12:00:00") })
+	_, err = it.Next()
+	require.ErrorIs(t, err, common.ErrNoNewTicksYet)
+	require.Len(t, provider.calls, 0)
+}
+
+func TestIteratorUsesSeededCache(t *testing.T) {
+	msBTCUSDT := common.MarketSource{
+		Type:       common.COIN,
+		Provider:   "BINANCE",
+		BaseAsset:  "BTC",
+		QuoteAsset: "USDT",
+	}
+	cstick1 := common.Candlestick{Timestamp: tInt("2020-01-02 00:00:00"), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+	cstick2 := common.Candlestick{Timestamp: tInt("2020-01-02 00:01:00"), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+
+	memoryCache := cache.NewMemoryCache(map[time.Duration]int{time.Minute: 128})
+	require.Nil(t, memoryCache.Seed(cache.Metric{Name: msBTCUSDT.String(), CandlestickInterval: time.Minute}, []common.Candlestick{cstick1, cstick2}))
+
+	provider := newTestCandlestickProvider(nil)
+	it, _ := NewIterator(msBTCUSDT, tp("2020-01-02 00:00:00"), time.Minute, memoryCache, provider)
+
+	var cs common.Candlestick
+	require.True(t, it.Scan(&cs))
+	require.Equal(t, cstick1, cs)
+	require.True(t, it.Scan(&cs))
+	require.Equal(t, cstick2, cs)
+	require.Equal(t, SourceCache, it.LastSource())
+	require.Len(t, provider.calls, 0)
+}
+
+func TestIteratorFlatHoles(t *testing.T) {
+	msBTCUSDT := common.MarketSource{
+		Type:       common.COIN,
+		Provider:   "BINANCE",
+		BaseAsset:  "BTC",
+		QuoteAsset: "USDT",
+	}
+	cstick1 := common.Candlestick{Timestamp: tInt("2020-01-02 00:00:00"), OpenPrice: 10, HighestPrice: 12, LowestPrice: 9, ClosePrice: 11, Synthetic: true}
+	cstick2 := common.Candlestick{Timestamp: tInt("2020-01-02 00:01:00"), OpenPrice: 10, HighestPrice: 12, LowestPrice: 9, ClosePrice: 11}
+	cstick3 := common.Candlestick{Timestamp: tInt("2020-01-02 00:02:00"), OpenPrice: 20, HighestPrice: 22, LowestPrice: 19, ClosePrice: 21, Synthetic: true}
+	cstick4 := common.Candlestick{Timestamp: tInt("2020-01-02 00:03:00"), OpenPrice: 20, HighestPrice: 22, LowestPrice: 19, ClosePrice: 21}
+	responses := []testCandlestickProviderResponse{
+		{candlesticks: []common.Candlestick{cstick1, cstick2, cstick3, cstick4}, err: nil},
+	}
+
+	it, _ := NewIterator(msBTCUSDT, tp("2020-01-02 00:00:00"), time.Minute, nil, newTestCandlestickProvider(responses))
+	it.SetFlatHoles(true)
+
+	// The leading synthetic candlestick has no previous close, so it's returned as is.
+	expected := []common.Candlestick{
+		cstick1,
+		cstick2,
+		{Timestamp: tInt("2020-01-02 00:02:00"), OpenPrice: 11, HighestPrice: 11, LowestPrice: 11, ClosePrice: 11, Synthetic: true},
+		cstick4,
+	}
+	for _, expectedCandlestick := range expected {
+		actual, err := it.Next()
+		require.Nil(t, err)
+		require.Equal(t, expectedCandlestick, actual)
+	}
+
+	it, _ = NewIterator(msBTCUSDT, tp("2020-01-02 00:00:00"), time.Minute, nil, newTestCandlestickProvider(responses))
+	for _, expectedCandlestick := range []common.Candlestick{cstick1, cstick2, cstick3, cstick4} {
+		actual, err := it.Next()
+		require.Nil(t, err)
+		require.Equal(t, expectedCandlestick, actual)
+	}
+}
+
+func TestIteratorMaxConsecutiveHoles(t *testing.T) {
+	msBTCUSDT := common.MarketSource{
+		Type:       common.COIN,
+		Provider:   "BINANCE",
+		BaseAsset:  "BTC",
+		QuoteAsset: "USDT",
+	}
+	traded := func(ts string) common.Candlestick {
+		return common.Candlestick{Timestamp: tInt(ts), OpenPrice: 10, HighestPrice: 12, LowestPrice: 9, ClosePrice: 11}
+	}
+	synthetic := func(ts string) common.Candlestick {
+		candlestick := traded(ts)
+		candlestick.Synthetic = true
+		return candlestick
+	}
+	responses := []testCandlestickProviderResponse{
+		{candlesticks: []common.Candlestick{
+			traded("2020-01-02 00:00:00"),
+			synthetic("2020-01-02 00:01:00"),
+			traded("2020-01-02 00:02:00"),
+			synthetic("2020-01-02 00:03:00"),
+			synthetic("2020-01-02 00:04:00"),
+			synthetic("2020-01-02 00:05:00"),
+			traded("2020-01-02 00:06:00"),
+		}, err: nil},
+	}
+
+	it, _ := NewIterator(msBTCUSDT, tp("2020-01-02 00:00:00"), time.Minute, nil, newTestCandlestickProvider(responses))
+	it.SetMaxConsecutiveHoles(2)
+
+	// Short runs are returned, but longer ones fail once and are skipped.
+	for _, expected := range []common.Candlestick{traded("2020-01-02 00:00:00"), synthetic("2020-01-02 00:01:00"), traded("2020-01-02 00:02:00")} {
+		actual, err := it.Next()
+		require.Nil(t, err)
+		require.Equal(t, expected, actual)
+	}
+	_, err := it.Next()
+	require.ErrorIs(t, err, common.ErrTooManyConsecutiveHoles)
+	require.Contains(t, err.Error(), "3 consecutive synthetic candlesticks from 2020-01-02T00:03:00Z to 2020-01-02T00:05:00Z")
+	actual, err := it.Next()
+	require.Nil(t, err)
+	require.Equal(t, traded("2020-01-02 00:06:00"), actual)
+
+	// Without a limit, every candlestick is returned.
+	it, _ = NewIterator(msBTCUSDT, tp("2020-01-02 00:00:00"), time.Minute, nil, newTestCandlestickProvider(responses))
+	for _, expected := range responses[0].candlesticks {
+		actual, err := it.Next()
+		require.Nil(t, err)
+		require.Equal(t, expected, actual)
+	}
+}
+
+func TestIteratorFinalOnly(t *testing.T) {
+	msBTCUSDT := common.MarketSource{
+		Type:       common.COIN,
+		Provider:   "BINANCE",
+		BaseAsset:  "BTC",
+		QuoteAsset: "USDT",
+	}
+	cstick1 := common.Candlestick{Timestamp: tInt("2020-01-02 00:00:00"), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+	cstick2 := common.Candlestick{Timestamp: tInt("2020-01-02 00:01:00"), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+	cstick3 := common.Candlestick{Timestamp: tInt("2020-01-02 00:02:00"), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+
+	memoryCache := cache.NewMemoryCache(map[time.Duration]int{time.Minute: 128})
+	provider := newTestCandlestickProvider([]testCandlestickProviderResponse{
+		{candlesticks: []common.Candlestick{cstick1, cstick2, cstick3}, err: nil},
+	})
+	it, _ := NewIterator(msBTCUSDT, tp("2020-01-02 00:00:00"), time.Minute, memoryCache, provider)
+	it.SetFinalOnly(true)
+	// The third candlestick is still open, so it's not final.
+	it.SetTimeNowFunc(func() time.Time { return tp("2020-01-02 00:02:30") })
+
+	actual, err := it.Next()
+	require.Nil(t, err)
+	require.Equal(t, cstick1, actual)
+	actual, err = it.Next()
+	require.Nil(t, err)
+	require.Equal(t, cstick2, actual)
+	_, err = it.Next()
+	require.ErrorIs(t, err, common.ErrNoNewTicksYet)
+
+	_, err = memoryCache.Get(cache.Metric{Name: msBTCUSDT.String(), CandlestickInterval: time.Minute}, common.ISO8601("2020-01-02T00:02:00Z"))
+	require.ErrorIs(t, err, cache.ErrCacheMiss)
+}
+
+func TestIteratorDoesNotCacheFormingCandlestick(t *testing.T) {
+	msBTCUSDT := common.MarketSource{
+		Type:       common.COIN,
+		Provider:   "BINANCE",
+		BaseAsset:  "BTC",
+		QuoteAsset: "USDT",
+	}
+	cstick1 := common.Candlestick{Timestamp: tInt("2020-01-02 00:00:00"), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+	forming := common.Candlestick{Timestamp: tInt("2020-01-02 00:01:00"), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+	formed := common.Candlestick{Timestamp: tInt("2020-01-02 00:01:00"), OpenPrice: 1234, HighestPrice: 1240, LowestPrice: 1230, ClosePrice: 1235}
+
+	memoryCache := cache.NewMemoryCache(map[time.Duration]int{time.Minute: 128})
+	provider := newTestCandlestickProvider([]testCandlestickProviderResponse{
+		{candlesticks: []common.Candlestick{cstick1, forming}, err: nil},
+		{candlesticks: []common.Candlestick{formed}, err: nil},
+	})
+	it, _ := NewIterator(msBTCUSDT, tp("2020-01-02 00:00:00"), time.Minute, memoryCache, provider)
+	// The second candlestick is still open, but without SetFinalOnly the iterator returns it anyway.
+	it.SetTimeNowFunc(func() time.Time { return tp("2020-01-02 00:01:30") })
+
+	actual, err := it.Next()
+	require.Nil(t, err)
+	require.Equal(t, cstick1, actual)
+	actual, err = it.Next()
+	require.Nil(t, err)
+	require.Equal(t, forming, actual)
+
+	// Only the final candlestick was cached, so a later iterator requests the formed one rather than serving the
+	// stale forming one.
+	it, _ = NewIterator(msBTCUSDT, tp("2020-01-02 00:00:00"), time.Minute, memoryCache, provider)
+	it.SetTimeNowFunc(func() time.Time { return tp("2020-01-02 00:03:00") })
+	actual, err = it.Next()
+	require.Nil(t, err)
+	require.Equal(t, cstick1, actual)
+	actual, err = it.Next()
+	require.Nil(t, err)
+	require.Equal(t, formed, actual)
+}
+
+func TestIteratorMaxCandles(t *testing.T) {
+	msBTCUSDT := common.MarketSource{
+		Type:       common.COIN,
+		Provider:   "BINANCE",
+		BaseAsset:  "BTC",
+		QuoteAsset: "USDT",
+	}
+	cstick1 := common.Candlestick{Timestamp: tInt("2020-01-02 00:00:00"), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+	cstick2 := common.Candlestick{Timestamp: tInt("2020-01-02 00:01:00"), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+	cstick3 := common.Candlestick{Timestamp: tInt("2020-01-02 00:02:00"), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+	provider := newTestCandlestickProvider([]testCandlestickProviderResponse{
+		{candlesticks: []common.Candlestick{cstick1, cstick2, cstick3}, err: nil},
+	})
+
+	it, _ := NewIterator(msBTCUSDT, tp("2020-01-02 00:00:00"), time.Minute, nil, provider)
+	it.SetMaxCandles(2)
+	var (
+		cs     common.Candlestick
+		actual []common.Candlestick
+	)
+	for it.Scan(&cs) {
+		actual = append(actual, cs)
+	}
+	require.Equal(t, []common.Candlestick{cstick1, cstick2}, actual)
+	require.ErrorIs(t, it.Error(), common.ErrMaxCandlesReached)
+	_, err := it.Next()
+	require.ErrorIs(t, err, common.ErrMaxCandlesReached)
+}
+
+func TestIteratorStats(t *testing.T) {
+	msBTCUSDT := common.MarketSource{
+		Type:       common.COIN,
+		Provider:   "BINANCE",
+		BaseAsset:  "BTC",
+		QuoteAsset: "USDT",
+	}
+	cstick1 := common.Candlestick{Timestamp: tInt("2020-01-02 00:00:00"), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+	cstick2 := common.Candlestick{Timestamp: tInt("2020-01-02 00:01:00"), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+	provider := newTestCandlestickProvider([]testCandlestickProviderResponse{
+		{candlesticks: []common.Candlestick{cstick1, cstick2}, err: nil},
+		{candlesticks: nil, err: common.ErrOutOfCandlesticks},
+	})
+	memoryCache := cache.NewMemoryCache(map[time.Duration]int{time.Minute: 128})
+
+	it, _ := NewIterator(msBTCUSDT, tp("2020-01-02 00:00:00"), time.Minute, memoryCache, provider)
+	require.Equal(t, common.Stats{}, it.Stats())
+	var cs common.Candlestick
+	for it.Scan(&cs) {
+	}
+	require.ErrorIs(t, it.Error(), common.ErrOutOfCandlesticks)
+	stats := it.Stats()
+	require.Equal(t, len(provider.calls), stats.RequestsMade)
+	require.Equal(t, 2, stats.RequestsMade)
+	require.Equal(t, 2, stats.CandlesticksReceived)
+	require.Equal(t, int64(0), stats.BytesReceived)
+
+	// Candlesticks served by the cache don't count.
+	cachedIt, _ := NewIterator(msBTCUSDT, tp("2020-01-02 00:00:00"), time.Minute, memoryCache, provider)
+	require.True(t, cachedIt.Scan(&cs))
+	require.True(t, cachedIt.Scan(&cs))
+	require.Equal(t, common.Stats{}, cachedIt.Stats())
+}
+
+func TestIteratorCloseTimestamps(t *testing.T) {
+	msBTCUSDT := common.MarketSource{
+		Type:       common.COIN,
+		Provider:   "BINANCE",
+		BaseAsset:  "BTC",
+		QuoteAsset: "USDT",
+	}
+	cstick1 := common.Candlestick{Timestamp: tInt("2020-01-02 00:00:00"), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+	cstick2 := common.Candlestick{Timestamp: tInt("2020-01-02 00:01:00"), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+	responses := []testCandlestickProviderResponse{{candlesticks: []common.Candlestick{cstick1, cstick2}}}
+
+	it, _ := NewIterator(msBTCUSDT, tp("2020-01-02 00:00:00"), time.Minute, nil, newTestCandlestickProvider(responses))
+	it.SetCloseTimestamps(true)
+	for _, expected := range []int{tInt("2020-01-02 00:01:00"), tInt("2020-01-02 00:02:00")} {
+		cs, err := it.Next()
+		require.Nil(t, err)
+		require.Equal(t, expected, cs.CloseTimestamp)
+	}
+
+	it, _ = NewIterator(msBTCUSDT, tp("2020-01-02 00:00:00"), time.Minute, nil, newTestCandlestickProvider(responses))
+	cs, err := it.Next()
+	require.Nil(t, err)
+	require.Equal(t, cstick1, cs)
+}
+
+func TestIteratorPriceDecimals(t *testing.T) {
+	msBTCUSDT := common.MarketSource{
+		Type:       common.COIN,
+		Provider:   "BINANCE",
+		BaseAsset:  "BTC",
+		QuoteAsset: "USDT",
+	}
+	cstick := common.Candlestick{Timestamp: tInt("2020-01-02 00:00:00"), OpenPrice: 96021.20000000001, HighestPrice: 96021.26, LowestPrice: 96021.14, ClosePrice: 96021.2}
+	responses := []testCandlestickProviderResponse{{candlesticks: []common.Candlestick{cstick}}}
+
+	it, _ := NewIterator(msBTCUSDT, tp("2020-01-02 00:00:00"), time.Minute, nil, newTestCandlestickProvider(responses))
+	it.SetPriceDecimals(1)
+	cs, err := it.Next()
+	require.Nil(t, err)
+	require.Equal(t, common.Candlestick{Timestamp: cstick.Timestamp, OpenPrice: 96021.2, HighestPrice: 96021.3, LowestPrice: 96021.1, ClosePrice: 96021.2}, cs)
+
+	it, _ = NewIterator(msBTCUSDT, tp("2020-01-02 00:00:00"), time.Minute, nil, newTestCandlestickProvider(responses))
+	cs, err = it.Next()
+	require.Nil(t, err)
+	require.Equal(t, cstick, cs)
+}
+
+func TestIteratorStartAtOrBefore(t *testing.T) {
+	msBTCUSDT := common.MarketSource{
+		Type:       common.COIN,
+		Provider:   "BINANCE",
+		BaseAsset:  "BTC",
+		QuoteAsset: "USDT",
+	}
+	cstick := func(s string) common.Candlestick {
+		return common.Candlestick{Timestamp: tInt(s), OpenPrice: 1234, HighestPrice: 1234, LowestPrice: 1234, ClosePrice: 1234}
+	}
+	candlesticks := []common.Candlestick{cstick("2021-01-02 01:40:00"), cstick("2021-01-02 01:45:00"), cstick("2021-01-02 01:50:00")}
+
+	tss := []struct {
+		name            string
+		startTime       time.Time
+		startAtOrBefore bool
+		startFromNext   bool
+		expected        time.Time
+	}{
+		{name: "unaligned start rounds up by default", startTime: tp("2021-01-02 01:42:24"), expected: tp("2021-01-02 01:45:00")},
+		{name: "unaligned start rounds down", startTime: tp("2021-01-02 01:42:24"), startAtOrBefore: true, expected: tp("2021-01-02 01:40:00")},
+		{name: "aligned start by default", startTime: tp("2021-01-02 01:40:00"), expected: tp("2021-01-02 01:40:00")},
+		{name: "aligned start is kept", startTime: tp("2021-01-02 01:40:00"), startAtOrBefore: true, expected: tp("2021-01-02 01:40:00")},
+		{name: "unaligned start rounds down, then moves to the next", startTime: tp("2021-01-02 01:42:24"), startAtOrBefore: true, startFromNext: true, expected: tp("2021-01-02 01:45:00")},
+		{name: "aligned start moves to the next", startTime: tp("2021-01-02 01:40:00"), startAtOrBefore: true, startFromNext: true, expected: tp("2021-01-02 01:45:00")},
+	}
+	for _, ts := range tss {
+		t.Run(ts.name, func(t *testing.T) {
+			provider := newTestCandlestickProvider([]testCandlestickProviderResponse{{candlesticks: candlesticks}})
+			it, _ := NewIterator(msBTCUSDT, ts.startTime, 5*time.Minute, nil, provider)
+			it.SetStartFromNext(ts.startFromNext)
+			it.SetStartAtOrBefore(ts.startAtOrBefore)
+
+			if !ts.startAtOrBefore {
+				require.Equal(t, common.NormalizeTimestamp(ts.startTime, 5*time.Minute, provider.Name(), ts.startFromNext), int(ts.expected.Unix()))
+			}
+			cs, err := it.Next()
+			require.Nil(t, err)
+			require.Equal(t, int(ts.expected.Unix()), cs.Timestamp)
+			require.Equal(t, ts.expected, provider.calls[0].startTime)
+		})
+	}
+}
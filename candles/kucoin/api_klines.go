@@ -3,14 +3,11 @@ package kucoin
 import (
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/marianogappa/crypto-candles/candles/common"
-	"github.com/rs/zerolog/log"
 )
 
 type response struct {
@@ -91,95 +88,82 @@ func responseToCandlesticks(data [][]string) ([]common.Candlestick, error) {
 	return candlesticks, nil
 }
 
+var intervals = map[time.Duration]string{
+	1 * time.Minute:           "1min",
+	3 * time.Minute:           "3min",
+	5 * time.Minute:           "5min",
+	15 * time.Minute:          "15min",
+	30 * time.Minute:          "30min",
+	1 * 60 * time.Minute:      "1hour",
+	2 * 60 * time.Minute:      "2hour",
+	4 * 60 * time.Minute:      "4hour",
+	6 * 60 * time.Minute:      "6hour",
+	8 * 60 * time.Minute:      "8hour",
+	12 * 60 * time.Minute:     "12hour",
+	1 * 60 * 24 * time.Minute: "1day",
+	7 * 60 * 24 * time.Minute: "1week",
+	// Like BINANCE's, monthly candlesticks follow calendar months, starting on the first day of each month.
+	30 * 60 * 24 * time.Minute: "1month",
+}
+
 func (e *Kucoin) requestCandlesticks(baseAsset string, quoteAsset string, startTime time.Time, candlestickInterval time.Duration) ([]common.Candlestick, error) {
+	return e.requestCandlesticksUntil(baseAsset, quoteAsset, startTime, time.Time{}, candlestickInterval)
+}
+
+// maxLimit is the maximum number of candlesticks that the exchange returns per request.
+const maxLimit = 1500
+
+func (e *Kucoin) requestCandlesticksUntil(baseAsset string, quoteAsset string, startTime time.Time, endTime time.Time, candlestickInterval time.Duration) ([]common.Candlestick, error) {
 	req, _ := http.NewRequest("GET", fmt.Sprintf("%vmarket/candles", e.apiURL), nil)
-	symbol := fmt.Sprintf("%v-%v", strings.ToUpper(baseAsset), strings.ToUpper(quoteAsset))
+	symbol, err := common.SymbolForProvider(common.MarketSource{BaseAsset: baseAsset, QuoteAsset: quoteAsset}, common.KUCOIN)
+	if err != nil {
+		return nil, common.CandleReqError{IsNotRetryable: true, Kind: common.KindInvalidPair, Err: err}
+	}
 
 	q := req.URL.Query()
 	q.Add("symbol", symbol)
 
-	switch candlestickInterval {
-	case 1 * time.Minute:
-		q.Add("type", "1min")
-	case 3 * time.Minute:
-		q.Add("type", "3min")
-	case 5 * time.Minute:
-		q.Add("type", "5min")
-	case 15 * time.Minute:
-		q.Add("type", "15min")
-	case 30 * time.Minute:
-		q.Add("type", "30min")
-	case 1 * 60 * time.Minute:
-		q.Add("type", "1hour")
-	case 2 * 60 * time.Minute:
-		q.Add("type", "2hour")
-	case 4 * 60 * time.Minute:
-		q.Add("type", "4hour")
-	case 6 * 60 * time.Minute:
-		q.Add("type", "6hour")
-	case 8 * 60 * time.Minute:
-		q.Add("type", "8hour")
-	case 12 * 60 * time.Minute:
-		q.Add("type", "12hour")
-	case 1 * 60 * 24 * time.Minute:
-		q.Add("type", "1day")
-	case 7 * 60 * 24 * time.Minute:
-		q.Add("type", "1week")
-	default:
-		return nil, common.CandleReqError{IsNotRetryable: true, Err: common.ErrUnsupportedCandlestickInterval}
+	interval, ok := intervals[candlestickInterval]
+	if !ok {
+		return nil, common.CandleReqError{IsNotRetryable: true, Kind: common.KindNotSupported, Err: common.ErrUnsupportedCandlestickInterval}
 	}
-
-	q.Add("startAt", fmt.Sprintf("%v", int(startTime.Unix())))
-	q.Add("endAt", fmt.Sprintf("%v", int(startTime.Unix())+1500*int(candlestickInterval/time.Second)))
-
-	req.URL.RawQuery = q.Encode()
-
-	client := &http.Client{Timeout: 10 * time.Second}
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, common.CandleReqError{IsNotRetryable: true, Err: fmt.Errorf("%w: %v", common.ErrExecutingRequest, err)}
+	q.Add("type", interval)
+
+	// Without startAt & endAt, Kucoin returns the latest candlesticks.
+	if !startTime.IsZero() {
+		q.Add("startAt", fmt.Sprintf("%v", int(startTime.Unix())))
+		endAt := int(startTime.Unix()) + maxLimit*common.IntervalToSeconds(candlestickInterval)
+		if !endTime.IsZero() && int(endTime.Unix()) < endAt {
+			endAt = int(endTime.Unix())
+		}
+		q.Add("endAt", fmt.Sprintf("%v", endAt))
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusTooManyRequests {
-		// In this case we should sleep for 11 seconds due to what it says in the docs.
-		// https://github.com/marianogappa/crypto-predictions/issues/37#issuecomment-1167566211
-		return nil, common.CandleReqError{IsNotRetryable: false, Err: common.ErrRateLimit, RetryAfter: 11 * time.Second}
-	}
+	req.URL.RawQuery = q.Encode()
 
-	byts, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, common.CandleReqError{IsNotRetryable: false, Err: common.ErrBrokenBodyResponse}
-	}
+	return e.httpRequester.DoWithInterval(req, candlestickInterval, decodeResponse)
+}
 
+func decodeResponse(statusCode int, byts []byte) ([]common.Candlestick, error) {
 	maybeResponse := response{}
-	err = json.Unmarshal(byts, &maybeResponse)
+	err := json.Unmarshal(byts, &maybeResponse)
 	if err == nil && (maybeResponse.Code != "200000" || maybeResponse.Msg != "") {
 		if maybeResponse.Code == "400100" && maybeResponse.Msg == "This pair is not provided at present." {
-			return nil, common.CandleReqError{IsNotRetryable: true, Err: common.ErrInvalidMarketPair}
+			return nil, common.CandleReqError{IsNotRetryable: true, Kind: common.KindInvalidPair, Err: common.ErrInvalidMarketPair}
 		}
 
 		err := fmt.Errorf("kucoin returned error code! Code: %v, Message: %v", maybeResponse.Code, maybeResponse.Msg)
 		// https://docs.kucoin.com/#request Codes are numeric
 		code, _ := strconv.Atoi(maybeResponse.Code)
-		return nil, common.CandleReqError{IsNotRetryable: false, Err: err, Code: code}
+		return nil, common.CandleReqError{IsNotRetryable: false, Kind: common.KindTransient, Err: err, Code: code}
 	}
 	if err != nil {
-		return nil, common.CandleReqError{IsNotRetryable: false, Err: common.ErrInvalidJSONResponse}
+		return nil, common.CandleReqError{IsNotRetryable: false, Kind: common.KindBadData, Err: common.ErrInvalidJSONResponse}
 	}
 
 	candlesticks, err := responseToCandlesticks(maybeResponse.Data)
 	if err != nil {
-		return nil, common.CandleReqError{IsNotRetryable: false, Err: err}
-	}
-
-	if e.debug {
-		log.Info().Str("exchange", "KuCoin").Str("market", fmt.Sprintf("%v/%v", baseAsset, quoteAsset)).Int("candlestick_count", len(candlesticks)).Msg("Candlestick request successful!")
-	}
-
-	if len(candlesticks) == 0 {
-		return nil, common.CandleReqError{IsNotRetryable: false, Err: common.ErrOutOfCandlesticks}
+		return nil, err
 	}
 
 	// Reverse slice, because Kucoin returns candlesticks in descending order
@@ -142,6 +142,23 @@ func TestErrRateLimit(t *testing.T) {
 
 	_, err := b.RequestCandlesticks(msBTCUSDT, tp("2022-01-17T11:43:00+00:00"), time.Minute)
 	require.Equal(t, err.(common.CandleReqError).Err, common.ErrRateLimit)
+	require.Equal(t, 11*time.Second, err.(common.CandleReqError).RetryAfter)
+}
+
+func TestErrRateLimitRetryAfter(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Retry-After", "3")
+		w.WriteHeader(429)
+	}))
+	defer ts.Close()
+
+	b := NewKucoin()
+	b.requester.Strategy = common.RetryStrategy{Attempts: 1}
+	b.apiURL = ts.URL + "/"
+
+	_, err := b.RequestCandlesticks(msBTCUSDT, tp("2022-01-17T11:43:00+00:00"), time.Minute)
+	require.Equal(t, err.(common.CandleReqError).Err, common.ErrRateLimit)
+	require.Equal(t, 3*time.Second, err.(common.CandleReqError).RetryAfter)
 }
 
 func TestUnhappyToCandlesticks(t *testing.T) {
@@ -336,6 +353,45 @@ func tp(s string) time.Time {
 	return t
 }
 
+func TestTrimsCandlesticksOlderThanStartTime(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"code": "200000", "data": [
+			["1642330740", "1", "1", "1", "1", "1", "1"],
+			["1642330680", "2", "2", "2", "2", "1", "1"]
+		]}`)
+	}))
+	defer ts.Close()
+
+	b := NewKucoin()
+	b.requester.Strategy = common.RetryStrategy{Attempts: 1}
+	b.apiURL = ts.URL + "/"
+
+	// The start time is normalized to the next minute, so the first returned candlestick is older than it.
+	actual, err := b.RequestCandlesticks(msBTCUSDT, tp("2022-01-16T10:58:30+00:00"), time.Minute)
+	require.Nil(t, err)
+	require.Equal(t, []common.Candlestick{{Timestamp: 1642330740, OpenPrice: 1, ClosePrice: 1, LowestPrice: 1, HighestPrice: 1}}, actual)
+}
+
+func TestRequestCandlesticksUntil(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "1642330680", r.URL.Query().Get("startAt"))
+		require.Equal(t, "1642330740", r.URL.Query().Get("endAt"))
+		fmt.Fprintln(w, `{"code": "200000", "data": [
+			["1642330740", "1", "1", "1", "1", "1", "1"],
+			["1642330680", "2", "2", "2", "2", "1", "1"]
+		]}`)
+	}))
+	defer ts.Close()
+
+	b := NewKucoin()
+	b.requester.Strategy = common.RetryStrategy{Attempts: 1}
+	b.apiURL = ts.URL + "/"
+
+	actual, err := b.RequestCandlesticksUntil(msBTCUSDT, tp("2022-01-16T10:58:00+00:00"), tp("2022-01-16T10:59:00+00:00"), time.Minute)
+	require.Nil(t, err)
+	require.Equal(t, []common.Candlestick{{Timestamp: 1642330680, OpenPrice: 2, ClosePrice: 2, LowestPrice: 2, HighestPrice: 2}}, actual)
+}
+
 var (
 	msBTCUSDT = common.MarketSource{
 		Type:       common.COIN,
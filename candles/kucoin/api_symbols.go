@@ -0,0 +1,70 @@
+package kucoin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/marianogappa/crypto-candles/candles/common"
+)
+
+//	{
+//	  "code": "200000",
+//	  "data": [
+//	    {
+//	      "symbol": "BTC-USDT",
+//	      "baseCurrency": "BTC",
+//	      "quoteCurrency": "USDT",
+//	      "enableTrading": true,
+//	      ...
+//	    }
+//	  ]
+//	}
+type symbolsResponse struct {
+	Code string `json:"code"`
+	Msg  string `json:"msg"`
+	Data []struct {
+		Symbol        string `json:"symbol"`
+		BaseCurrency  string `json:"baseCurrency"`
+		QuoteCurrency string `json:"quoteCurrency"`
+		EnableTrading bool   `json:"enableTrading"`
+	} `json:"data"`
+}
+
+func (r symbolsResponse) toMarketSources() []common.MarketSource {
+	marketSources := []common.MarketSource{}
+	for _, symbol := range r.Data {
+		if !symbol.EnableTrading || symbol.BaseCurrency == "" || symbol.QuoteCurrency == "" {
+			continue
+		}
+		marketSources = append(marketSources, common.MarketSource{Type: common.COIN, Provider: common.KUCOIN, BaseAsset: symbol.BaseCurrency, QuoteAsset: symbol.QuoteCurrency})
+	}
+	return marketSources
+}
+
+func (e *Kucoin) requestMarkets() ([]common.MarketSource, error) {
+	req, _ := http.NewRequest("GET", fmt.Sprintf("%vsymbols", e.apiURL), nil)
+
+	_, byts, err := e.httpRequester.DoRaw(req)
+	if err != nil {
+		return nil, err
+	}
+
+	maybeResponse := symbolsResponse{}
+	err = json.Unmarshal(byts, &maybeResponse)
+	if err == nil && (maybeResponse.Code != "200000" || maybeResponse.Msg != "") {
+		err := fmt.Errorf("kucoin returned error code! Code: %v, Message: %v", maybeResponse.Code, maybeResponse.Msg)
+		code, _ := strconv.Atoi(maybeResponse.Code)
+		return nil, common.CandleReqError{IsNotRetryable: false, Kind: common.KindTransient, Err: err, Code: code}
+	}
+	if err != nil {
+		return nil, common.CandleReqError{IsNotRetryable: false, Kind: common.KindBadData, Err: common.ErrInvalidJSONResponse}
+	}
+	return maybeResponse.toMarketSources(), nil
+}
+
+// Example request for symbols on Kucoin:
+// https://api.kucoin.com/api/v1/symbols
+//
+// Only symbols with enableTrading are listed.
@@ -0,0 +1,45 @@
+package kucoin
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/marianogappa/crypto-candles/candles/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListMarkets(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/symbols", r.URL.Path)
+		fmt.Fprintln(w, `{"code":"200000","data":[
+			{"symbol":"BTC-USDT","baseCurrency":"BTC","quoteCurrency":"USDT","enableTrading":true},
+			{"symbol":"OLD-USDT","baseCurrency":"OLD","quoteCurrency":"USDT","enableTrading":false}
+		]}`)
+	}))
+	defer ts.Close()
+
+	e := NewKucoin()
+	e.apiURL = ts.URL + "/"
+
+	actual, err := e.ListMarkets()
+	require.Nil(t, err)
+	require.Equal(t, []common.MarketSource{{Type: common.COIN, Provider: common.KUCOIN, BaseAsset: "BTC", QuoteAsset: "USDT"}}, actual)
+}
+
+func TestListMarketsErrorResponse(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"code":"400100","msg":"Something went wrong"}`)
+	}))
+	defer ts.Close()
+
+	e := NewKucoin()
+	e.apiURL = ts.URL + "/"
+
+	_, err := e.ListMarkets()
+	var reqErr common.CandleReqError
+	require.ErrorAs(t, err, &reqErr)
+	require.Equal(t, 400100, reqErr.Code)
+	require.Equal(t, common.KindTransient, reqErr.Kind)
+}
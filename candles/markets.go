@@ -0,0 +1,72 @@
+package candles
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/marianogappa/crypto-candles/candles/common"
+)
+
+// DefaultMarketListTTL is how long ListMarkets caches each provider's markets, unless WithMarketListTTL says otherwise.
+const DefaultMarketListTTL = time.Hour
+
+// marketListCache holds the markets that ListMarkets requested per provider. It's a pointer within Market, so that
+// copies of a Market share it.
+type marketListCache struct {
+	lock    sync.Mutex
+	entries map[string]marketListEntry
+}
+
+type marketListEntry struct {
+	marketSources []common.MarketSource
+	requestedAt   time.Time
+}
+
+func newMarketListCache() *marketListCache {
+	return &marketListCache{entries: map[string]marketListEntry{}}
+}
+
+// WithMarketListTTL configures how long ListMarkets caches each provider's markets. Zero or less disables caching.
+func WithMarketListTTL(ttl time.Duration) func(*Market) {
+	return func(m *Market) {
+		m.marketListTTL = ttl
+	}
+}
+
+// ListMarkets returns the COIN market sources currently tradable at the given provider (e.g. BINANCE), as listed by
+// the provider's public symbols endpoint. Results are cached per provider for DefaultMarketListTTL (see
+// WithMarketListTTL), so it's cheap to call e.g. to validate user input.
+//
+// * Fails with ErrUnsuportedCandlestickProvider if the provider is not supported.
+// * Fails with ErrNotSupported if the provider doesn't have a symbols endpoint.
+// * Fails with the provider's CandleReqError otherwise, whose Kind classifies the failure.
+func (m Market) ListMarkets(provider string) ([]common.MarketSource, error) {
+	provider = strings.ToUpper(provider)
+	exchange, err := m.getExchange(common.MarketSource{Type: common.COIN, Provider: provider})
+	if err != nil {
+		return nil, err
+	}
+	lister, ok := exchange.(common.MarketLister)
+	if !ok {
+		return nil, fmt.Errorf("%w: the '%v' provider cannot list its markets", common.ErrNotSupported, provider)
+	}
+
+	if m.marketLists == nil || m.marketListTTL <= 0 {
+		return lister.ListMarkets()
+	}
+	m.marketLists.lock.Lock()
+	defer m.marketLists.lock.Unlock()
+
+	now := m.timeNowFunc()
+	if entry, ok := m.marketLists.entries[provider]; ok && now.Sub(entry.requestedAt) < m.marketListTTL {
+		return append([]common.MarketSource{}, entry.marketSources...), nil
+	}
+	marketSources, err := lister.ListMarkets()
+	if err != nil {
+		return nil, err
+	}
+	m.marketLists.entries[provider] = marketListEntry{marketSources: marketSources, requestedAt: now}
+	return append([]common.MarketSource{}, marketSources...), nil
+}
@@ -0,0 +1,53 @@
+package candles
+
+import (
+	"strings"
+
+	"github.com/marianogappa/crypto-candles/candles/common"
+)
+
+// MarketSourceNormalizer rewrites a market source before it's used, e.g. to request USDT markets on providers that
+// don't list USD ones. It must be idempotent, i.e. normalizing a normalized market source must not change it, as
+// nested calls (e.g. Latest building an Iterator) normalize it again.
+type MarketSourceNormalizer func(common.MarketSource) common.MarketSource
+
+// WithMarketSourceNormalizer makes the Market normalize every market source it's asked for with the supplied
+// normalizer before validating it, so that equivalence rules (e.g. see QuoteAssetEquivalences) are defined once
+// rather than at every call site.
+//
+// The normalized market source is the one the provider is requested with, and the one that keys the cache. Fallback
+// providers (see WithProviderFallback) are requested with the normalized market source, only changing its provider.
+func WithMarketSourceNormalizer(normalizer MarketSourceNormalizer) func(*Market) {
+	return func(m *Market) {
+		m.marketSourceNormalizer = normalizer
+	}
+}
+
+// QuoteAssetEquivalences returns a MarketSourceNormalizer that replaces quote assets per provider, e.g.
+// {"BINANCE": {"USD": "USDT"}} requests BTC/USDT from BINANCE when asked for BTC/USD. Providers and assets are
+// case-insensitive.
+func QuoteAssetEquivalences(equivalences map[string]map[string]string) MarketSourceNormalizer {
+	normalized := map[string]map[string]string{}
+	for provider, quoteAssets := range equivalences {
+		provider = strings.ToUpper(provider)
+		if normalized[provider] == nil {
+			normalized[provider] = map[string]string{}
+		}
+		for from, to := range quoteAssets {
+			normalized[provider][strings.ToUpper(from)] = strings.ToUpper(to)
+		}
+	}
+	return func(marketSource common.MarketSource) common.MarketSource {
+		if to, ok := normalized[strings.ToUpper(marketSource.Provider)][strings.ToUpper(marketSource.QuoteAsset)]; ok {
+			marketSource.QuoteAsset = to
+		}
+		return marketSource
+	}
+}
+
+func (m Market) normalize(marketSource common.MarketSource) common.MarketSource {
+	if m.marketSourceNormalizer == nil {
+		return marketSource
+	}
+	return m.marketSourceNormalizer(marketSource)
+}
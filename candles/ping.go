@@ -0,0 +1,41 @@
+package candles
+
+import (
+	"strings"
+	"time"
+
+	"github.com/marianogappa/crypto-candles/candles/common"
+)
+
+// pingQuoteAssets are the quote assets of the canonical BTC market pair that Ping requests, for the providers that
+// don't quote BTC in USDT.
+var pingQuoteAssets = map[string]string{
+	common.COINBASE: "USD",
+	common.BITSTAMP: "USD",
+	common.BITFINEX: "USD",
+}
+
+// Ping checks that the given provider (e.g. BINANCE) is reachable and serving candlesticks, by requesting a few recent
+// minutely candlesticks of a canonical market pair (BTC/USDT, or BTC/USD where USDT isn't quoted). It's cheap, and
+// goes through the provider's mutex, timeout and retry strategy, so it's useful for readiness probes or for choosing
+// among fallback providers. Nothing is cached.
+//
+// * Fails with ErrUnsuportedCandlestickProvider if the provider is not supported.
+// * Fails with the provider's CandleReqError otherwise, whose Kind classifies the failure.
+func (m Market) Ping(provider string) error {
+	provider = strings.ToUpper(provider)
+	quoteAsset, ok := pingQuoteAssets[provider]
+	if !ok {
+		quoteAsset = "USDT"
+	}
+	marketSource := common.MarketSource{Type: common.COIN, Provider: provider, BaseAsset: "BTC", QuoteAsset: quoteAsset}
+	exchange, err := m.getExchange(marketSource)
+	if err != nil {
+		return err
+	}
+	startTime := m.timeNowFunc().Add(-common.PatienceFor(exchange, time.Minute) - 5*time.Minute).Truncate(time.Minute)
+	requestStart := time.Now()
+	_, err = exchange.RequestCandlesticks(marketSource, startTime, time.Minute)
+	m.observer.ObserveRequest(exchange.Name(), time.Minute, time.Since(requestStart), err)
+	return err
+}
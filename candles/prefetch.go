@@ -0,0 +1,156 @@
+package candles
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/marianogappa/crypto-candles/candles/cache"
+	"github.com/marianogappa/crypto-candles/candles/common"
+)
+
+// Prefetch warms up the cache with all candlesticks of the given market source and candlestick interval, from the
+// "from" time (normalized to the next candlestick) up to (but excluding) the "to" time. It's useful e.g. before
+// running a backtest.
+//
+// It's resumable: ranges already in the cache are skipped, so calling Prefetch again after a failure will only
+// request the missing candlesticks. Candlesticks too recent to be available (as defined by the provider's patience)
+// are not requested.
+//
+// Calendar-month candlesticks (e.g. Binance's "1M") are stepped through month by month, but they aren't cached, as
+// the cache only holds evenly spaced candlesticks.
+//
+// Requests go through the same per-exchange mutex and retry strategy as iterators do, so rate limits are respected.
+//
+// If onProgress is not nil, it's called after every step with the number of candlesticks prefetched so far (either
+// found in the cache or requested), and the total number of candlesticks in the range.
+//
+// * Fails with ErrCacheNotConfiguredForCandlestickInterval if the cache is not configured for the interval, or if the
+// market was created WithNoCache.
+// * Fails with ErrDataTooFarBack if "from" is older than the provider's MaxHistoryDepth.
+func (m Market) Prefetch(marketSource common.MarketSource, from, to time.Time, candlestickInterval time.Duration, onProgress func(prefetched, total int)) error {
+	return m.prefetch(context.Background(), marketSource, from, to, candlestickInterval, onProgress)
+}
+
+// PrefetchProgress is the progress of a PrefetchContext call: the number of candlesticks prefetched so far (either
+// found in the cache or requested), and the total number of candlesticks in the range.
+type PrefetchProgress struct {
+	Prefetched int
+	Total      int
+}
+
+// PrefetchContext is like Prefetch, but it can be cancelled via the supplied context, and it reports progress on the
+// supplied channel (if not nil), which is closed when PrefetchContext returns.
+//
+// Sending progress blocks until it's received or the context is done, so the channel should be consumed concurrently.
+//
+// Whatever was already prefetched is kept in the cache, so calling it again after a cancellation resumes from there.
+//
+// * Fails with a non-retryable CandleReqError wrapping ctx.Err() if the context is done before finishing.
+func (m Market) PrefetchContext(ctx context.Context, marketSource common.MarketSource, from, to time.Time, candlestickInterval time.Duration, progress chan<- PrefetchProgress) error {
+	if progress == nil {
+		return m.prefetch(ctx, marketSource, from, to, candlestickInterval, nil)
+	}
+	defer close(progress)
+	return m.prefetch(ctx, marketSource, from, to, candlestickInterval, func(prefetched, total int) {
+		select {
+		case progress <- PrefetchProgress{Prefetched: prefetched, Total: total}:
+		case <-ctx.Done():
+		}
+	})
+}
+
+func (m Market) prefetch(ctx context.Context, marketSource common.MarketSource, from, to time.Time, candlestickInterval time.Duration, onProgress func(prefetched, total int)) error {
+	marketSource = m.normalize(marketSource)
+	if err := marketSource.Validate(); err != nil {
+		return err
+	}
+	exchange, err := m.getExchange(marketSource)
+	if err != nil {
+		return err
+	}
+	var (
+		metric       = m.cacheMetric(marketSource, candlestickInterval)
+		intervalSecs = common.IntervalToSeconds(candlestickInterval)
+		anchor       = common.AnchorOf(exchange)
+		nextTs       = anchor.Normalize(from, candlestickInterval, false)
+		toTs         = int(to.Unix())
+		readyTs      = int(m.timeNowFunc().Add(-common.PatienceFor(exchange, candlestickInterval)).Unix())
+		prefetched   = 0
+		total        = 0
+	)
+	if intervalSecs <= 0 {
+		return common.ErrUnsupportedCandlestickInterval
+	}
+	if m.cache.IsNoOp() {
+		return cache.ErrCacheNotConfiguredForCandlestickInterval
+	}
+	if err := common.CheckHistoryDepth(exchange, time.Unix(int64(nextTs), 0), m.timeNowFunc()); err != nil {
+		return err
+	}
+	switch {
+	case anchor.IsCalendarMonth(candlestickInterval):
+		for ts := nextTs; ts < toTs; ts = anchor.Add(ts, candlestickInterval, 1) {
+			total++
+		}
+	case toTs > nextTs:
+		total = (toTs - nextTs + intervalSecs - 1) / intervalSecs
+	}
+
+	// Only candlesticks that closed (at the provider's next boundary, e.g. at the end of a calendar month) at least the
+	// provider's patience ago are requested.
+	for nextTs < toTs && anchor.Add(nextTs, candlestickInterval, 1) <= readyTs {
+		if err := ctx.Err(); err != nil {
+			return common.CandleReqError{IsNotRetryable: true, Kind: common.KindUnknown, Err: fmt.Errorf("prefetch cancelled: %w", err)}
+		}
+		candlesticks, err := m.cache.Get(metric, common.ISO8601(time.Unix(int64(nextTs), 0).UTC().Format(time.RFC3339)))
+		if err == cache.ErrCacheNotConfiguredForCandlestickInterval {
+			return err
+		}
+		if err != nil {
+			if candlesticks, err = m.requestPrefetchPage(exchange, marketSource, metric, nextTs); err != nil {
+				return err
+			}
+		}
+		for _, candlestick := range candlesticks {
+			if candlestick.Timestamp >= toTs {
+				break
+			}
+			nextTs = anchor.Add(candlestick.Timestamp, candlestickInterval, 1)
+			prefetched++
+		}
+		if onProgress != nil {
+			onProgress(prefetched, total)
+		}
+	}
+	return nil
+}
+
+func (m Market) requestPrefetchPage(exchange common.Exchange, marketSource common.MarketSource, metric cache.Metric, nextTs int) ([]common.Candlestick, error) {
+	candlesticks, err := exchange.RequestCandlesticks(marketSource, time.Unix(int64(nextTs), 0), metric.CandlestickInterval)
+	if err != nil {
+		return nil, err
+	}
+	for len(candlesticks) > 0 && candlesticks[0].Timestamp < nextTs {
+		candlesticks = candlesticks[1:]
+	}
+	if len(candlesticks) == 0 {
+		return nil, common.ErrExchangeReturnedNoTicks
+	}
+	if candlesticks[0].Timestamp != nextTs {
+		expected := time.Unix(int64(nextTs), 0).UTC().Format(time.RFC3339)
+		actual := time.Unix(int64(candlesticks[0].Timestamp), 0).UTC().Format(time.RFC3339)
+		return nil, fmt.Errorf("%w: expected %v but got %v", common.ErrExchangeReturnedOutOfSyncTick, expected, actual)
+	}
+	// Calendar months aren't evenly spaced, so the cache can't hold them.
+	anchor := common.AnchorOf(exchange)
+	if anchor.IsCalendarMonth(metric.CandlestickInterval) {
+		return candlesticks, nil
+	}
+	// The current candlestick may still change, so only final candlesticks are cached.
+	final := common.FinalAnchoredCandlesticks(candlesticks, metric.CandlestickInterval, common.PatienceFor(exchange, metric.CandlestickInterval), m.timeNowFunc(), anchor)
+	if err := m.cache.Put(metric, final); err != nil {
+		return nil, err
+	}
+	return candlesticks, nil
+}
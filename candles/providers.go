@@ -0,0 +1,191 @@
+package candles
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/marianogappa/crypto-candles/candles/common"
+)
+
+// ProviderInfo describes the capabilities of a candlestick provider, e.g. to let users pick an exchange.
+type ProviderInfo struct {
+	// Name is the uppercase name of the provider, to be used as the MarketSource's Provider (e.g. BINANCE).
+	Name string
+
+	// SupportedIntervals lists the supported candlestick intervals, in ascending order. Nil means unknown, e.g. for
+	// registered providers that don't implement common.IntervalsProvider.
+	SupportedIntervals []time.Duration
+
+	// SupportsSeconds is true if any of the supported candlestick intervals is shorter than a minute.
+	SupportsSeconds bool
+
+	// MaxHistoryDepth is how far back in time (relative to now) the provider serves candlesticks. Zero means no known
+	// limit.
+	MaxHistoryDepth time.Duration
+
+	// Patience is the recommended latency to observe for requesting the latest candlesticks.
+	Patience time.Duration
+
+	// MaxCandlesPerRequest is the maximum number of candlesticks the provider returns per request. Zero means not known
+	// upfront.
+	MaxCandlesPerRequest int
+}
+
+// Providers returns the capabilities of all supported candlestick providers, sorted by name.
+func Providers() []ProviderInfo {
+	return providerInfos(buildExchanges())
+}
+
+// Providers returns the capabilities of all candlestick providers of this Market, sorted by name.
+func (m Market) Providers() []ProviderInfo {
+	return providerInfos(m.exchanges)
+}
+
+func providerInfos(exchanges map[string]common.Exchange) []ProviderInfo {
+	infos := make([]ProviderInfo, 0, len(exchanges))
+	for name, exchange := range exchanges {
+		info := ProviderInfo{
+			Name:                 name,
+			SupportedIntervals:   common.SupportedIntervalsOf(exchange),
+			MaxHistoryDepth:      common.MaxHistoryDepthOf(exchange),
+			Patience:             exchange.Patience(),
+			MaxCandlesPerRequest: common.MaxCandlesPerRequest(exchange),
+		}
+		for _, interval := range info.SupportedIntervals {
+			if interval < time.Minute {
+				info.SupportsSeconds = true
+			}
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// Provider returns the candlestick provider registered under the given name (e.g. BINANCE), which may be a provider
+// registered with RegisterProvider.
+//
+// * Fails with ErrUnsupportedProvider (a.k.a. ErrUnsuportedCandlestickProvider) if there's no provider under that name.
+func (m Market) Provider(name string) (common.CandlestickProvider, error) {
+	return m.getExchange(common.MarketSource{Type: common.COIN, Provider: name})
+}
+
+// ProviderStats returns the Stats of every HTTP request this Market made so far to the given provider (e.g. BINANCE),
+// including retries, e.g. to check a cache's effectiveness or a request budget. For stats of a single iterator, see
+// Iterator.Stats.
+//
+// * Fails with ErrUnsupportedProvider (a.k.a. ErrUnsuportedCandlestickProvider) if there's no provider under that name.
+// * Fails with ErrNotSupported if the provider doesn't keep Stats (see common.StatsProvider).
+func (m Market) ProviderStats(name string) (common.Stats, error) {
+	exchange, err := m.getExchange(common.MarketSource{Type: common.COIN, Provider: name})
+	if err != nil {
+		return common.Stats{}, err
+	}
+	statsProvider, ok := exchange.(common.StatsProvider)
+	if !ok {
+		return common.Stats{}, fmt.Errorf("%w: the '%v' provider doesn't keep stats", common.ErrNotSupported, name)
+	}
+	return statsProvider.Stats(), nil
+}
+
+// RateLimitBreakerState returns the state of the given provider's (e.g. BINANCE) rate limit breaker, e.g. to tell
+// whether requests to it are paused, and until when (see WithRateLimitBreaker).
+//
+// * Fails with ErrUnsupportedProvider (a.k.a. ErrUnsuportedCandlestickProvider) if there's no provider under that name.
+// * Fails with ErrNotSupported if the provider doesn't have a breaker (see common.RateLimitBreakerProvider).
+func (m Market) RateLimitBreakerState(name string) (common.BreakerState, error) {
+	exchange, err := m.getExchange(common.MarketSource{Type: common.COIN, Provider: name})
+	if err != nil {
+		return common.BreakerState{}, err
+	}
+	breakerProvider, ok := exchange.(common.RateLimitBreakerProvider)
+	if !ok {
+		return common.BreakerState{}, fmt.Errorf("%w: the '%v' provider doesn't have a rate limit breaker", common.ErrNotSupported, name)
+	}
+	return breakerProvider.RateLimitBreaker().State(), nil
+}
+
+// InFlightRequests returns the number of HTTP requests to the given provider (e.g. BINANCE) currently in flight, e.g.
+// to observe how close it is to its ProviderMaxInFlightRequests.
+//
+// * Fails with ErrUnsupportedProvider (a.k.a. ErrUnsuportedCandlestickProvider) if there's no provider under that name.
+// * Fails with ErrNotSupported if the provider doesn't cap its requests (see common.InFlightLimitedProvider).
+func (m Market) InFlightRequests(name string) (int, error) {
+	exchange, err := m.getExchange(common.MarketSource{Type: common.COIN, Provider: name})
+	if err != nil {
+		return 0, err
+	}
+	limited, ok := exchange.(common.InFlightLimitedProvider)
+	if !ok {
+		return 0, fmt.Errorf("%w: the '%v' provider doesn't cap its requests", common.ErrNotSupported, name)
+	}
+	return limited.InFlightRequests(), nil
+}
+
+// RegisterProvider plugs a candlestick provider that the library doesn't ship (or replaces a shipped one) under the
+// given name, case-insensitively, so that market sources with that provider are served by it.
+//
+// If the provider implements common.Exchange, it's registered as is. Otherwise, it's wrapped, so SetDebug doesn't
+// apply to it. The wrapper forwards the optional interfaces that have a default (e.g. common.HistoryDepthProvider,
+// common.AnchoredProvider, or common.PatienceConfigurable), but not those that add a capability (e.g.
+// common.LatestCandlestickProvider or common.EndTimeCandlestickProvider), which are ignored: implement SetDebug to keep
+// them.
+func (m *Market) RegisterProvider(name string, provider common.CandlestickProvider) {
+	exchange, ok := provider.(common.Exchange)
+	if !ok {
+		exchange = registeredProvider{provider}
+	}
+	m.exchanges[strings.ToUpper(name)] = exchange
+}
+
+// registeredProvider adapts a CandlestickProvider to the Exchange interface, forwarding the optional interfaces that
+// have a default, so that it's indistinguishable from the provider for them.
+type registeredProvider struct {
+	common.CandlestickProvider
+}
+
+func (registeredProvider) SetDebug(bool) {}
+
+func (p registeredProvider) PatienceFor(candlestickInterval time.Duration) time.Duration {
+	return common.PatienceFor(p.CandlestickProvider, candlestickInterval)
+}
+
+func (p registeredProvider) SetPatience(patience time.Duration) {
+	if configurable, ok := p.CandlestickProvider.(common.PatienceConfigurable); ok {
+		configurable.SetPatience(patience)
+	}
+}
+
+func (p registeredProvider) SetIntervalPatience(candlestickInterval time.Duration, patience time.Duration) {
+	if configurable, ok := p.CandlestickProvider.(common.PatienceConfigurable); ok {
+		configurable.SetIntervalPatience(candlestickInterval, patience)
+	}
+}
+
+func (p registeredProvider) MaxCandlesPerRequest() int {
+	return common.MaxCandlesPerRequest(p.CandlestickProvider)
+}
+
+func (p registeredProvider) SupportedIntervals() []time.Duration {
+	return common.SupportedIntervalsOf(p.CandlestickProvider)
+}
+
+func (p registeredProvider) MaxHistoryDepth() time.Duration {
+	return common.MaxHistoryDepthOf(p.CandlestickProvider)
+}
+
+func (p registeredProvider) Anchor() common.Anchor {
+	return common.AnchorOf(p.CandlestickProvider)
+}
+
+func (p registeredProvider) SetAnchor(anchor common.Anchor) {
+	if configurable, ok := p.CandlestickProvider.(common.AnchorConfigurable); ok {
+		configurable.SetAnchor(anchor)
+	}
+}
+
+func (p registeredProvider) TimestampSemantics() common.TimestampSemantics {
+	return common.TimestampSemanticsOf(p.CandlestickProvider)
+}
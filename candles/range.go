@@ -0,0 +1,179 @@
+package candles
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/marianogappa/crypto-candles/candles/common"
+)
+
+// RequestRange returns all candlesticks of the given market source and candlestick interval from the "from" time
+// (normalized to the next candlestick) up to (but excluding) the "to" time, in ascending order (or descending, with
+// WithDescendingOrder). It goes through an Iterator, so the cache is used and populated, and all the Market's options
+// apply.
+//
+// If the range reaches the present, only the final candlesticks available so far are returned, i.e. the current
+// candlestick is excluded even if the exchange returned it (as with WithFinalOnly). Overlapping pages never produce
+// duplicate timestamps, and nothing at or after the "to" time is returned.
+//
+// * Fails for the same reasons as Iterator and its Next method, except with ErrNoNewTicksYet.
+func (m Market) RequestRange(marketSource common.MarketSource, from, to time.Time, candlestickInterval time.Duration) ([]common.Candlestick, error) {
+	candlesticks, err := m.requestRange(marketSource, from, to, candlestickInterval)
+	if err != nil {
+		return nil, err
+	}
+	return m.ordered(candlesticks), nil
+}
+
+// requestRange is RequestRange, but always in ascending order.
+func (m Market) requestRange(marketSource common.MarketSource, from, to time.Time, candlestickInterval time.Duration) ([]common.Candlestick, error) {
+	// The Market is a value, so this only affects this range's Iterator.
+	m.finalOnly = true
+	iter, err := m.Iterator(marketSource, from, candlestickInterval)
+	if err != nil {
+		return nil, err
+	}
+	iter.SetEndTime(to)
+	candlesticks := []common.Candlestick{}
+	for {
+		candlestick, err := iter.Next()
+		if errors.Is(err, common.ErrIterationComplete) || errors.Is(err, common.ErrNoNewTicksYet) {
+			return candlesticks, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if int64(candlestick.Timestamp) >= to.Unix() {
+			return candlesticks, nil
+		}
+		if len(candlesticks) > 0 && candlestick.Timestamp <= candlesticks[len(candlesticks)-1].Timestamp {
+			continue
+		}
+		candlesticks = append(candlesticks, candlestick)
+	}
+}
+
+// RequestRecent returns the most recent "count" final candlesticks of the given market source and candlestick interval,
+// e.g. the last 200 hourly ones, in ascending order (or descending, with WithDescendingOrder). It's RequestRange from
+// "count" candlesticks before the latest final one up to now, so the cache is used and the current candlestick is
+// never returned.
+//
+// Fewer candlesticks are returned if the exchange doesn't have as many (e.g. holes at the start of a pair's history).
+//
+// * Fails for the same reasons as RequestRange.
+func (m Market) RequestRecent(marketSource common.MarketSource, candlestickInterval time.Duration, count int) ([]common.Candlestick, error) {
+	if count <= 0 {
+		return []common.Candlestick{}, nil
+	}
+	exchange, err := m.getExchange(m.normalize(marketSource))
+	if err != nil {
+		return nil, err
+	}
+	now := m.timeNowFunc()
+	// Candlesticks that start before this boundary have closed at least the provider's patience ago, i.e. are final.
+	finalEnd := common.AnchorOf(exchange).Floor(now.Add(-common.PatienceFor(exchange, candlestickInterval)), candlestickInterval)
+	// One more candlestick than needed is requested, in case calendar months make "count" intervals fall short.
+	from := finalEnd.Add(-time.Duration(count+1) * candlestickInterval)
+	candlesticks, err := m.requestRange(marketSource, from, finalEnd, candlestickInterval)
+	if err != nil {
+		return nil, err
+	}
+	if len(candlesticks) > count {
+		candlesticks = candlesticks[len(candlesticks)-count:]
+	}
+	return m.ordered(candlesticks), nil
+}
+
+// RequestRangeColumns is like RequestRange, but it returns the candlesticks as columns (see
+// common.CandlesticksToColumns).
+func (m Market) RequestRangeColumns(marketSource common.MarketSource, from, to time.Time, candlestickInterval time.Duration) (ts []int64, open, high, low, close []float64, err error) {
+	candlesticks, err := m.RequestRange(marketSource, from, to, candlestickInterval)
+	if err != nil {
+		return nil, nil, nil, nil, nil, err
+	}
+	ts, open, high, low, close = common.CandlesticksToColumns(candlesticks)
+	return ts, open, high, low, close, nil
+}
+
+// maxMultiIntervalBaseCandlesticks caps how many candlesticks of the smallest interval RequestMultiInterval requests in
+// order to resample a larger interval, so that e.g. 1m and 1d don't request a thousand days of minutely candlesticks.
+const maxMultiIntervalBaseCandlesticks = 10000
+
+// RequestMultiInterval returns up to "limit" candlesticks for each of the given candlestick intervals of the same market
+// source, starting at the "startTime" (normalized to the next candlestick of each interval), as with RequestRange.
+//
+// The smallest interval is requested once, and the larger intervals that are multiples of it are resampled from it
+// (see common.ResampleStampedCandlesticks) rather than requested. Intervals that aren't multiples of it, or that would need too
+// many candlesticks of it, are requested separately.
+//
+// * Fails for the same reasons as RequestRange.
+func (m Market) RequestMultiInterval(marketSource common.MarketSource, startTime time.Time, candlestickIntervals []time.Duration, limit int) (map[time.Duration][]common.Candlestick, error) {
+	result := map[time.Duration][]common.Candlestick{}
+	if len(candlestickIntervals) == 0 || limit <= 0 {
+		for _, candlestickInterval := range candlestickIntervals {
+			result[candlestickInterval] = []common.Candlestick{}
+		}
+		return result, nil
+	}
+	exchange, err := m.getExchange(m.normalize(marketSource))
+	if err != nil {
+		return nil, err
+	}
+	anchor := common.AnchorOf(exchange)
+	intervals := append([]time.Duration{}, candlestickIntervals...)
+	sort.Slice(intervals, func(i, j int) bool { return intervals[i] < intervals[j] })
+	baseInterval := intervals[0]
+
+	resampled := []time.Duration{}
+	baseEndTime := multiIntervalEndTime(anchor, startTime, baseInterval, limit)
+	for i, candlestickInterval := range intervals[1:] {
+		if candlestickInterval == intervals[i] {
+			continue
+		}
+		if candlestickInterval%baseInterval != 0 || limit*int(candlestickInterval/baseInterval) > maxMultiIntervalBaseCandlesticks {
+			candlesticks, err := m.requestRange(marketSource, startTime, multiIntervalEndTime(anchor, startTime, candlestickInterval, limit), candlestickInterval)
+			if err != nil {
+				return nil, err
+			}
+			result[candlestickInterval] = m.ordered(candlesticks)
+			continue
+		}
+		resampled = append(resampled, candlestickInterval)
+		if endTime := multiIntervalEndTime(anchor, startTime, candlestickInterval, limit); endTime.After(baseEndTime) {
+			baseEndTime = endTime
+		}
+	}
+
+	base, err := m.requestRange(marketSource, startTime, baseEndTime, baseInterval)
+	if err != nil {
+		return nil, err
+	}
+	for _, candlestickInterval := range resampled {
+		result[candlestickInterval] = m.ordered(truncateCandlesticks(common.ResampleStampedCandlesticks(base, baseInterval, candlestickInterval, anchor, common.TimestampSemanticsOf(exchange)), limit))
+	}
+	result[baseInterval] = m.ordered(truncateCandlesticks(base, limit))
+	return result, nil
+}
+
+// multiIntervalEndTime returns the end time (exclusive) of "limit" candlesticks of the given interval from the start
+// time, normalized to the anchor's next candlestick.
+func multiIntervalEndTime(anchor common.Anchor, startTime time.Time, candlestickInterval time.Duration, limit int) time.Time {
+	firstTs := anchor.Normalize(startTime, candlestickInterval, false)
+	return time.Unix(int64(firstTs), 0).Add(time.Duration(limit) * candlestickInterval)
+}
+
+// ordered returns the supplied ascending candlesticks in the order configured with WithDescendingOrder.
+func (m Market) ordered(candlesticks []common.Candlestick) []common.Candlestick {
+	if !m.descending {
+		return candlesticks
+	}
+	return common.ReverseCandlesticks(candlesticks)
+}
+
+func truncateCandlesticks(candlesticks []common.Candlestick, limit int) []common.Candlestick {
+	if len(candlesticks) > limit {
+		return candlesticks[:limit]
+	}
+	return candlesticks
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -14,25 +15,22 @@ import (
 
 func main() {
 	var (
-		flagMarketType          = flag.String("marketType", "COIN", "for now only 'COIN' is supported, representing market pairs e.g. BTC/USDT")
-		flagProvider            = flag.String("provider", "BINANCE", "one of BINANCE|COINBASE|KUCOIN|BINANCEUSDMFUTURES|BITSTAMP|BITFINEX")
+		flagMarketType          = flag.String("marketType", "COIN", "one of COIN|PERPETUAL, representing market pairs e.g. BTC/USDT, or their perpetual futures (e.g. on BINANCE)")
+		flagProvider            = flag.String("provider", "BINANCE", "one of BINANCE|COINBASE|KUCOIN|BINANCEUSDMFUTURES|BITSTAMP|BITFINEX|CRYPTOCOM")
 		flagBaseAsset           = flag.String("baseAsset", "", "e.g. BTC in BTC/USDT")
 		flagQuoteAsset          = flag.String("quoteAsset", "", "e.g. USDT in BTC/USDT")
 		flagStartTime           = flag.String("startTime", "", "ISO8601/RFC3339 date to start retrieving candlesticks e.g. 2022-07-10T14:01:00Z")
 		flagCandlestickInterval = flag.String("candlestickInterval", "", "the candlestick interval in time.ParseDuration format e.g. 1h, 1m, 24h")
 		flagLimit               = flag.Int("limit", 10, "how many candlesticks to return")
+		flagTimeFormat          = flag.String("timeFormat", "seconds", "how to serialize timestamps: one of seconds|millis|rfc3339")
+		flagFieldNames          = flag.String("fieldNames", "short", "how to name JSON fields: one of short (t,o,c,l,h)|charting (time,open,high,low,close)")
 	)
 
 	flag.Parse()
 
-	if *flagProvider == "" {
-		exit("Empty provider.", true)
-	}
-	if *flagBaseAsset == "" {
-		exit("Empty base asset.", true)
-	}
-	if *flagQuoteAsset == "" {
-		exit("Empty quote asset.", true)
+	marketSource := common.MarketSource{Type: common.MarketTypeFromString(*flagMarketType), Provider: *flagProvider, BaseAsset: *flagBaseAsset, QuoteAsset: *flagQuoteAsset}
+	if err := marketSource.Validate(); err != nil {
+		exit(fmt.Sprintf("invalid market source: %v.", err), true)
 	}
 	if *flagStartTime == "" {
 		exit("Empty start time.", true)
@@ -43,9 +41,6 @@ func main() {
 	if *flagLimit <= 0 {
 		exit("Limit is negative or zero.", true)
 	}
-	if *flagMarketType != "COIN" {
-		exit("marketType must be 'COIN'.", true)
-	}
 
 	startTime, err := time.Parse(time.RFC3339, *flagStartTime)
 	if err != nil {
@@ -55,23 +50,31 @@ func main() {
 	if err != nil {
 		exit(fmt.Sprintf("invalid candlestickInterval '%v': %v.", *flagCandlestickInterval, err), true)
 	}
+	timeFormat, err := common.TimestampFormatFromString(*flagTimeFormat)
+	if err != nil {
+		exit(fmt.Sprintf("%v.", err), true)
+	}
+	fieldNames, err := common.FieldNamesFromString(*flagFieldNames)
+	if err != nil {
+		exit(fmt.Sprintf("%v.", err), true)
+	}
 
-	m := candles.NewMarket(candles.WithCacheSizes(map[time.Duration]int{}))
-	iter, err := m.Iterator(
-		common.MarketSource{Type: common.MarketTypeFromString(*flagMarketType), Provider: *flagProvider, BaseAsset: *flagBaseAsset, QuoteAsset: *flagQuoteAsset},
-		startTime,
-		candlestickInterval,
-	)
+	m := candles.NewMarket(candles.WithNoCache())
+	iter, err := m.Iterator(marketSource, startTime, candlestickInterval)
 	if err != nil {
 		exit(fmt.Sprintf("error building iterator: %v", err), true)
 	}
 
-	for i := 0; i < *flagLimit; i++ {
+	iter.SetMaxCandles(*flagLimit)
+	for {
 		candlestick, err := iter.Next()
+		if errors.Is(err, common.ErrMaxCandlesReached) {
+			return
+		}
 		if err != nil {
 			exit(err.Error(), false)
 		}
-		bs, _ := json.Marshal(candlestick)
+		bs, _ := json.Marshal(common.FormattedCandlestick{Candlestick: candlestick, Format: timeFormat, Names: fieldNames})
 		fmt.Println(string(bs))
 	}
 }